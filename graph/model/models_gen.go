@@ -2,6 +2,86 @@
 
 package model
 
+import (
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// Explains if a resource is visible to the user.
+type AccessExplanation struct {
+	Cluster string `json:"cluster"`
+	UID     string `json:"uid"`
+	// True when the resource is in the index and the user is authorized to see it.
+	// Resources the user isn't authorized to see aren't disclosed.
+	Found bool `json:"found"`
+	// True when the resource is included in the search results of the user.
+	Visible bool `json:"visible"`
+	// The rule that grants access, or MISSING when the resource isn't visible.
+	Rule AccessRule `json:"rule"`
+	// Description of the rule that granted access.
+	Reason *string `json:"reason,omitempty"`
+}
+
+// Freshness of the data collected from a managed cluster.
+type ClusterStatus struct {
+	// The name of the managed cluster.
+	Cluster string `json:"cluster"`
+	// Time the data from the cluster was last known to be current, using the RFC3339 format.
+	// While the search collector is reporting, the time its status was last checked. Otherwise, the time it stopped reporting.
+	// Empty when the status of the collector isn't known.
+	LastUpdated *string `json:"lastUpdated,omitempty"`
+	// Number of resources from the cluster in the index.
+	ResourceCount int `json:"resourceCount"`
+	// True when the collector stopped reporting longer ago than the configured threshold.
+	Stale bool `json:"stale"`
+}
+
+// A value for a property and the number of resources with that value.
+// For number and date properties, contains the range of values instead.
+type CompletionValue struct {
+	// The property value. Object properties like label use the format key=value.
+	// Empty for number and date properties.
+	Value *string `json:"value,omitempty"`
+	// Number of resources matching the value or, for number and date properties, the number of resources with the property.
+	Count *int `json:"count,omitempty"`
+	// The property type.
+	// **Values:** string, boolean, number, date, object, array
+	Type *string `json:"type,omitempty"`
+	// The lowest value. Only for number and date properties.
+	Min *string `json:"min,omitempty"`
+	// The highest value. Only for number and date properties.
+	Max *string `json:"max,omitempty"`
+}
+
+// A kind the user is authorized to list.
+type KindAccess struct {
+	// The API group of the kind. Empty for the core group.
+	Apigroup string `json:"apigroup"`
+	Kind     string `json:"kind"`
+	// The names of the resources the user can list, when the access is limited by name.
+	// Empty when the user can list all the resources of the kind.
+	Names []*string `json:"names,omitempty"`
+}
+
+// The properties of a kind.
+type KindSchema struct {
+	// The kind of the resources.
+	Kind string `json:"kind"`
+	// The cluster of the resources. Only set when the schema is requested per cluster.
+	Cluster *string `json:"cluster,omitempty"`
+	// Number of resources of this kind.
+	Count int `json:"count"`
+	// The properties found on resources of this kind, the most common first.
+	Properties []*PropertySchema `json:"properties,omitempty"`
+}
+
+// The namespaces and kinds the user can list on a managed cluster.
+type ManagedClusterAccess struct {
+	Cluster    string             `json:"cluster"`
+	Namespaces []*NamespaceAccess `json:"namespaces,omitempty"`
+}
+
 // A message is used to communicate conditions detected while executing a query on the server.
 type Message struct {
 	// Unique identifier to be used by clients to process the message independently of locale or grammatical changes.
@@ -11,6 +91,30 @@ type Message struct {
 	Kind *string `json:"kind,omitempty"`
 	// Message text.
 	Description *string `json:"description,omitempty"`
+	// The managed clusters affected by the condition. Only includes the clusters the user is authorized to see.
+	AffectedClusters []*string `json:"affectedClusters,omitempty"`
+	// Number of clusters, results or hubs affected by the condition.
+	Count *int `json:"count,omitempty"`
+	// Link to the documentation with more information about the condition.
+	DocLink *string `json:"docLink,omitempty"`
+}
+
+// The kinds the user can list in a namespace.
+type NamespaceAccess struct {
+	Namespace string        `json:"namespace"`
+	Kinds     []*KindAccess `json:"kinds,omitempty"`
+}
+
+// A property of a kind.
+type PropertySchema struct {
+	// The property name.
+	Name string `json:"name"`
+	// The JSON type of the property.
+	// **Values:** string, number, boolean, object, array
+	Type *string `json:"type,omitempty"`
+	// Fraction of the resources of the kind with this property, from 0 to 1.
+	// Estimated from a sample of up to 1000 resources of each kind.
+	Frequency float64 `json:"frequency"`
 }
 
 // Defines a key/value to filter results.
@@ -34,6 +138,18 @@ type SearchInput struct {
 	// When multiple keywords are provided, it is interpreted as an AND operation.
 	// Matches are case insensitive.
 	Keywords []*string `json:"keywords,omitempty"`
+	// Defines how the keywords are matched.
+	// **Default is** SUBSTRING
+	KeywordMode *KeywordMode `json:"keywordMode,omitempty"`
+	// Limits the keywords to match only the listed properties. For example, `["name", "image"]`.
+	// If empty, SUBSTRING matches any text field, FULLTEXT and FUZZY match the properties name, namespace, kind, label and image.
+	KeywordFields []*string `json:"keywordFields,omitempty"`
+	// Excludes resources containing any of these strings in any text field, or in the `keywordFields` when provided.
+	// Matches are case insensitive.
+	ExcludeKeywords []*string `json:"excludeKeywords,omitempty"`
+	// Minimum similarity, from 0 to 1, to match keywords with `keywordMode: FUZZY`.
+	// **Default is** 0.3
+	FuzzyThreshold *float64 `json:"fuzzyThreshold,omitempty"`
 	// List of SearchFilter, which is a key(property) and values.
 	// When multiple filters are provided, results will match all filters (AND operation).
 	Filters []*SearchFilter `json:"filters,omitempty"`
@@ -45,4 +161,138 @@ type SearchInput struct {
 	// If empty, all relationships will be included.
 	// This filter is used with the 'related' field on SearchResult.
 	RelatedKinds []*string `json:"relatedKinds,omitempty"`
+	// Sort the results.
+	// **Values:** relevance. Sorts by the `_score` property, requires `keywordMode: FULLTEXT` or `FUZZY`.
+	// If empty, the order of the results is not guaranteed.
+	OrderBy *string `json:"orderBy,omitempty"`
+}
+
+// The resources a user is authorized to search.
+// The value `*` means all namespaces or all kinds.
+type UserAccess struct {
+	// The name of the user.
+	User string `json:"user"`
+	// True when the user can list all resources on the hub.
+	AllAccess bool `json:"allAccess"`
+	// True when the user can see the resources from all managed clusters.
+	AllManagedClusters bool `json:"allManagedClusters"`
+	// The managed clusters where the user has view access. Empty when `allManagedClusters` is true.
+	ManagedClusters []*string `json:"managedClusters,omitempty"`
+	// The cluster-scoped kinds on the hub the user can list.
+	ClusterScopedKinds []*KindAccess `json:"clusterScopedKinds,omitempty"`
+	// The namespaces on the hub and the kinds the user can list in each namespace.
+	Namespaces []*NamespaceAccess `json:"namespaces,omitempty"`
+	// The managed clusters where the user has fine-grained permissions, and the kinds the user can list in each namespace.
+	// The user can only see these resources on these clusters.
+	ManagedClusterResources []*ManagedClusterAccess `json:"managedClusterResources,omitempty"`
+	// When the access was computed, using the RFC3339 format. The access is cached and refreshed periodically.
+	ComputedAt *string `json:"computedAt,omitempty"`
+}
+
+// The RBAC rule that grants access to a resource.
+type AccessRule string
+
+const (
+	// The user has view access to the managed cluster.
+	AccessRuleManagedCluster AccessRule = "MANAGED_CLUSTER"
+	// The user is authorized to list the kind in the namespace of the managed cluster.
+	AccessRuleManagedClusterResource AccessRule = "MANAGED_CLUSTER_RESOURCE"
+	// The user is authorized to list the cluster-scoped kind on the hub.
+	AccessRuleHubClusterScoped AccessRule = "HUB_CLUSTER_SCOPED"
+	// The user is authorized to list the kind in the namespace on the hub.
+	AccessRuleHubNamespaced AccessRule = "HUB_NAMESPACED"
+	// The resource isn't in the index, or the user isn't authorized to see it.
+	AccessRuleMissing AccessRule = "MISSING"
+)
+
+var AllAccessRule = []AccessRule{
+	AccessRuleManagedCluster,
+	AccessRuleManagedClusterResource,
+	AccessRuleHubClusterScoped,
+	AccessRuleHubNamespaced,
+	AccessRuleMissing,
+}
+
+func (e AccessRule) IsValid() bool {
+	switch e {
+	case AccessRuleManagedCluster, AccessRuleManagedClusterResource, AccessRuleHubClusterScoped, AccessRuleHubNamespaced, AccessRuleMissing:
+		return true
+	}
+	return false
+}
+
+func (e AccessRule) String() string {
+	return string(e)
+}
+
+func (e *AccessRule) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = AccessRule(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid AccessRule", str)
+	}
+	return nil
+}
+
+func (e AccessRule) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+// Defines how keywords are matched to resources.
+type KeywordMode string
+
+const (
+	// Matches resources containing the keyword in any text field using a case-insensitive substring comparison.
+	KeywordModeSubstring KeywordMode = "SUBSTRING"
+	// Full-text search on the properties name, namespace, kind, label and image.
+	// Wrap the keyword with double quotes to match a phrase, for example `"my app"`.
+	// End the keyword with `*` to match a prefix, for example `ngin*`.
+	// Items include the relevance score in the `_score` property.
+	// **NOTE:** The text search document is computed for each resource with a sequential scan of the table, unless the
+	// database has the GIN index `data_fulltext_idx` on the document. Custom `keywordFields` never use the index.
+	KeywordModeFulltext KeywordMode = "FULLTEXT"
+	// Typo-tolerant search using trigram similarity. Matches keywords on the properties name, namespace, kind, label and image.
+	// The values of the `name` filter are also matched by similarity.
+	// Items include the similarity score in the `_score` property.
+	// Falls back to SUBSTRING if the pg_trgm extension isn't installed in the database.
+	KeywordModeFuzzy KeywordMode = "FUZZY"
+)
+
+var AllKeywordMode = []KeywordMode{
+	KeywordModeSubstring,
+	KeywordModeFulltext,
+	KeywordModeFuzzy,
+}
+
+func (e KeywordMode) IsValid() bool {
+	switch e {
+	case KeywordModeSubstring, KeywordModeFulltext, KeywordModeFuzzy:
+		return true
+	}
+	return false
+}
+
+func (e KeywordMode) String() string {
+	return string(e)
+}
+
+func (e *KeywordMode) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = KeywordMode(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid KeywordMode", str)
+	}
+	return nil
+}
+
+func (e KeywordMode) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
 }
@@ -20,13 +20,19 @@ func (r *queryResolver) Search(ctx context.Context, input []*model.SearchInput)
 }
 
 // SearchComplete is the resolver for the searchComplete field.
-func (r *queryResolver) SearchComplete(ctx context.Context, property string, query *model.SearchInput, limit *int) ([]*string, error) {
+func (r *queryResolver) SearchComplete(ctx context.Context, property string, query *model.SearchInput, limit *int, prefix *string, contains *string, offset *int, keysOnly *bool) ([]*string, error) {
 	if limit != nil {
 		klog.V(3).Infof("Received SearchComplete query with input property **%s** and limit %d", property, *limit)
 	} else {
 		klog.V(3).Infof("Received SearchComplete query with input property **%s**", property)
 	}
-	return resolver.SearchComplete(ctx, property, query, limit)
+	return resolver.SearchComplete(ctx, property, query, limit, prefix, contains, offset, keysOnly)
+}
+
+// SearchCompleteValues is the resolver for the searchCompleteValues field.
+func (r *queryResolver) SearchCompleteValues(ctx context.Context, property string, query *model.SearchInput, limit *int) ([]*model.CompletionValue, error) {
+	klog.V(3).Infof("Received SearchCompleteValues query with input property **%s**", property)
+	return resolver.SearchCompleteValues(ctx, property, query, limit)
 }
 
 // SearchSchema is the resolver for the searchSchema field.
@@ -35,10 +41,34 @@ func (r *queryResolver) SearchSchema(ctx context.Context) (map[string]interface{
 	return resolver.SearchSchemaResolver(ctx)
 }
 
+// SearchSchemaByKind is the resolver for the searchSchemaByKind field.
+func (r *queryResolver) SearchSchemaByKind(ctx context.Context, kinds []*string, cluster *string, perCluster *bool) ([]*model.KindSchema, error) {
+	klog.V(3).Infoln("Received SearchSchemaByKind query")
+	return resolver.SearchSchemaByKind(ctx, kinds, cluster, perCluster)
+}
+
+// ClusterStatus is the resolver for the clusterStatus field.
+func (r *queryResolver) ClusterStatus(ctx context.Context, clusters []*string) ([]*model.ClusterStatus, error) {
+	klog.V(3).Infoln("Received ClusterStatus query")
+	return resolver.ClusterStatus(ctx, clusters)
+}
+
 // Messages is the resolver for the messages field.
-func (r *queryResolver) Messages(ctx context.Context) ([]*model.Message, error) {
+func (r *queryResolver) Messages(ctx context.Context, input []*model.SearchInput) ([]*model.Message, error) {
 	klog.V(3).Infoln("Received Messages query")
-	return resolver.Messages(ctx)
+	return resolver.Messages(ctx, input)
+}
+
+// MyAccess is the resolver for the myAccess field.
+func (r *queryResolver) MyAccess(ctx context.Context) (*model.UserAccess, error) {
+	klog.V(3).Infoln("Received MyAccess query")
+	return resolver.MyAccess(ctx)
+}
+
+// ExplainAccess is the resolver for the explainAccess field.
+func (r *queryResolver) ExplainAccess(ctx context.Context, cluster string, uid string) (*model.AccessExplanation, error) {
+	klog.V(3).Infof("Received ExplainAccess query for cluster %s and uid %s", cluster, uid)
+	return resolver.ExplainAccess(ctx, cluster, uid)
 }
 
 // ExperimentalSearch is the resolver for the experimentalSearch field.
@@ -35,5 +35,8 @@ func main() {
 	// Start process to watch the RBAC config andd update the cache.
 	go rbac.GetCache().StartBackgroundValidation(ctx)
 
+	// Start process to evict expired entries from the cache.
+	go rbac.GetCache().StartCacheJanitor(ctx)
+
 	server.StartAndListen()
 }
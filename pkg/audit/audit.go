@@ -0,0 +1,207 @@
+// Copyright Contributors to the Open Cluster Management project
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/stolostron/search-v2-api/pkg/config"
+	"github.com/stolostron/search-v2-api/pkg/rbac"
+	"github.com/vektah/gqlparser/v2/ast"
+	klog "k8s.io/klog/v2"
+)
+
+const (
+	LevelMetadata = "metadata" // User, operation, result counts, duration and outcome.
+	LevelRequest  = "request"  // Metadata, the normalized inputs and the query.
+
+	OutcomeSuccess = "success"
+	OutcomeError   = "error"
+)
+
+// An audit event, written as a JSON line for each GraphQL operation or federated request.
+// The events never include the tokens from the request or the remote services.
+type Event struct {
+	Time          time.Time                         `json:"time"`
+	Path          string                            `json:"path"` // graphql or federated
+	User          string                            `json:"user"`
+	UID           string                            `json:"uid,omitempty"`
+	Groups        []string                          `json:"groups,omitempty"`
+	Impersonator  string                            `json:"impersonator,omitempty"` // User sending the request.
+	OperationName string                            `json:"operationName,omitempty"`
+	OperationType string                            `json:"operationType,omitempty"`
+	Fields        []string                          `json:"fields,omitempty"`       // Top-level fields, like searchResult.
+	Inputs        map[string]map[string]interface{} `json:"inputs,omitempty"`       // Arguments by response key. Request level.
+	Query         string                            `json:"query,omitempty"`        // Query without extra whitespace. Request level.
+	ResultCounts  map[string][]int                  `json:"resultCounts,omitempty"` // Result counts by response key.
+	DurationMs    int64                             `json:"durationMs"`
+	Outcome       string                            `json:"outcome"`
+	Errors        []string                          `json:"errors,omitempty"`
+}
+
+// Writes the audit events to the sink.
+type Logger struct {
+	level string
+	lock  sync.Mutex
+	out   io.Writer
+}
+
+var loggerOnce sync.Once
+var loggerInstance *Logger
+
+// Returns the audit logger, or nil when the audit log is disabled.
+// Tests will replace this function to write the events to a buffer.
+var getLogger = func() *Logger {
+	loggerOnce.Do(func() {
+		cfg := config.Cfg.Audit
+		if cfg.Log == "" {
+			return
+		}
+		var out io.Writer = os.Stdout
+		if cfg.Log != "stdout" {
+			file, err := openRotatingFile(cfg.Log, cfg.MaxSize, cfg.MaxBackups)
+			if err != nil {
+				klog.Errorf("Error opening the audit log. Requests aren't audited. Error: %s", err)
+				return
+			}
+			out = file
+		}
+		klog.Infof("Writing the audit log to %s with level %s.", cfg.Log, cfg.Level)
+		loggerInstance = &Logger{level: cfg.Level, out: out}
+	})
+	return loggerInstance
+}
+
+// Writes the event as a JSON line. Nothing is written when the logger is nil.
+func (l *Logger) Log(event *Event) {
+	if l == nil {
+		return
+	}
+	if l.level != LevelRequest {
+		event.Inputs = nil
+		event.Query = ""
+	}
+	line, err := json.Marshal(event)
+	if err != nil {
+		klog.Errorf("Error encoding the audit event. Error: %s", err)
+		return
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if _, err := l.out.Write(append(line, '\n')); err != nil {
+		klog.Errorf("Error writing the audit event. Error: %s", err)
+	}
+}
+
+// Tests will replace this function to set the user without a TokenReview.
+var setUser = func(ctx context.Context, event *Event) {
+	uid, userInfo := rbac.GetCache().GetUserUID(ctx)
+	event.User = userInfo.Username
+	event.Groups = userInfo.Groups
+	if uid != "noUidFound" {
+		event.UID = uid
+	}
+	if _, ok := rbac.GetImpersonatedUser(ctx); !ok {
+		return
+	}
+	if certUser, ok := rbac.GetCertUser(ctx); ok {
+		event.Impersonator = certUser.Username
+	} else if token, ok := ctx.Value(rbac.ContextAuthTokenKey).(string); ok {
+		if tokenReview, err := rbac.GetCache().GetTokenReview(ctx, token); err == nil {
+			event.Impersonator = tokenReview.Status.User.Username
+		}
+	}
+}
+
+func newEvent(ctx context.Context, path string, start time.Time) *Event {
+	event := &Event{Time: start.UTC(), Path: path, Outcome: OutcomeSuccess}
+	setUser(ctx, event)
+	return event
+}
+
+// Sets the operation, fields and normalized inputs. The inputs use the values of the variables,
+// so the event is the same whether the inputs are sent inline or as variables.
+func (e *Event) setOperation(operation *ast.OperationDefinition, query string, variables map[string]interface{}) {
+	e.Query = strings.Join(strings.Fields(query), " ")
+	if operation == nil {
+		return
+	}
+	e.OperationName = operation.Name
+	e.OperationType = string(operation.Operation)
+	for _, selection := range operation.SelectionSet {
+		field, ok := selection.(*ast.Field)
+		if !ok {
+			continue
+		}
+		name := field.Alias
+		if name == "" {
+			name = field.Name
+		}
+		e.Fields = append(e.Fields, field.Name)
+		if len(field.Arguments) == 0 {
+			continue
+		}
+		inputs := map[string]interface{}{}
+		for _, arg := range field.Arguments {
+			value, err := arg.Value.Value(variables)
+			if err != nil {
+				klog.V(3).Infof("Error reading the argument %s for the audit log. Error: %s", arg.Name, err)
+				continue
+			}
+			inputs[arg.Name] = value
+		}
+		if e.Inputs == nil {
+			e.Inputs = map[string]map[string]interface{}{}
+		}
+		e.Inputs[name] = inputs
+	}
+}
+
+// Sets the count of results of each field from the response data. Lists of search results use the
+// count or the number of items of each result. Other lists use the number of elements.
+func (e *Event) setResultCounts(data json.RawMessage) {
+	fields := map[string]interface{}{}
+	if len(data) == 0 || json.Unmarshal(data, &fields) != nil {
+		return
+	}
+	for name, value := range fields {
+		list, ok := value.([]interface{})
+		if !ok {
+			continue
+		}
+		counts := []int{}
+		for _, element := range list {
+			result, ok := element.(map[string]interface{})
+			if !ok {
+				counts = []int{len(list)}
+				break
+			}
+			if count, ok := result["count"].(float64); ok {
+				counts = append(counts, int(count))
+			} else if items, ok := result["items"].([]interface{}); ok {
+				counts = append(counts, len(items))
+			}
+		}
+		if e.ResultCounts == nil {
+			e.ResultCounts = map[string][]int{}
+		}
+		e.ResultCounts[name] = counts
+	}
+}
+
+func (e *Event) setErrors(errors []string) {
+	if len(errors) == 0 {
+		return
+	}
+	e.Outcome = OutcomeError
+	e.Errors = append(e.Errors, errors...)
+}
+
+func (e *Event) finish(start time.Time) {
+	e.DurationMs = time.Since(start).Milliseconds()
+}
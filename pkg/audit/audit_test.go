@@ -0,0 +1,105 @@
+// Copyright Contributors to the Open Cluster Management project
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/parser"
+)
+
+// Writes the events to a buffer and sets a fixed user.
+func mockLogger(t *testing.T, level string) *bytes.Buffer {
+	buf := &bytes.Buffer{}
+	logger := &Logger{level: level, out: buf}
+	originalLogger, originalSetUser := getLogger, setUser
+	getLogger = func() *Logger { return logger }
+	setUser = func(ctx context.Context, event *Event) {
+		event.User = "alice"
+		event.UID = "alice-uid"
+		event.Groups = []string{"system:authenticated", "auditors"}
+	}
+	t.Cleanup(func() { getLogger, setUser = originalLogger, originalSetUser })
+	return buf
+}
+
+func readEvents(t *testing.T, buf *bytes.Buffer) []map[string]interface{} {
+	events := []map[string]interface{}{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		event := map[string]interface{}{}
+		assert.Nil(t, json.Unmarshal([]byte(line), &event), "Expected a JSON line. Got: %s", line)
+		events = append(events, event)
+	}
+	return events
+}
+
+func parseOperation(t *testing.T, query string) *ast.OperationDefinition {
+	doc, err := parser.ParseQuery(&ast.Source{Input: query})
+	assert.Nil(t, err)
+	return doc.Operations[0]
+}
+
+func Test_Event_setOperation(t *testing.T) {
+	inline := `query mySearch { searchResult(input: [{filters: [{property: "kind", values: ["Secret"]}]}]) { count } }`
+	variables := `query mySearch($input: [SearchInput]) {
+		searchResult(input: $input) { count }
+	}`
+	vars := map[string]interface{}{"input": []interface{}{map[string]interface{}{
+		"filters": []interface{}{map[string]interface{}{"property": "kind", "values": []interface{}{"Secret"}}}}}}
+
+	inlineEvent, varsEvent := &Event{}, &Event{}
+	inlineEvent.setOperation(parseOperation(t, inline), inline, nil)
+	varsEvent.setOperation(parseOperation(t, variables), variables, vars)
+
+	assert.Equal(t, "mySearch", varsEvent.OperationName)
+	assert.Equal(t, "query", varsEvent.OperationType)
+	assert.Equal(t, []string{"searchResult"}, varsEvent.Fields)
+	assert.Equal(t, inlineEvent.Inputs, varsEvent.Inputs, "Expected the same inputs inline and with variables.")
+	assert.Equal(t, map[string]map[string]interface{}{"searchResult": {"input": vars["input"]}}, varsEvent.Inputs)
+	assert.Equal(t, "query mySearch($input: [SearchInput]) { searchResult(input: $input) { count } }", varsEvent.Query)
+}
+
+func Test_Event_setResultCounts(t *testing.T) {
+	event := &Event{}
+
+	event.setResultCounts(json.RawMessage(`{"searchResult": [{"count": 3}, {"items": [{}, {}]}],
+		"searchComplete": ["a", "b"], "searchSchema": {"allProperties": ["kind"]}}`))
+
+	assert.Equal(t, map[string][]int{"searchResult": {3, 2}, "searchComplete": {2}}, event.ResultCounts)
+}
+
+func Test_Logger_Log_metadata(t *testing.T) {
+	buf := &bytes.Buffer{}
+	logger := &Logger{level: LevelMetadata, out: buf}
+	event := &Event{Time: time.Unix(0, 0).UTC(), Path: "graphql", User: "alice", OperationName: "mySearch",
+		Query: "query mySearch { searchResult { count } }", Inputs: map[string]map[string]interface{}{
+			"searchResult": {"input": "secret"}}, Outcome: OutcomeSuccess}
+
+	logger.Log(event)
+
+	assert.Equal(t, `{"time":"1970-01-01T00:00:00Z","path":"graphql","user":"alice","operationName":"mySearch",`+
+		`"durationMs":0,"outcome":"success"}`+"\n", buf.String())
+}
+
+func Test_Logger_Log_request(t *testing.T) {
+	buf := &bytes.Buffer{}
+	logger := &Logger{level: LevelRequest, out: buf}
+
+	logger.Log(&Event{Query: "{ searchSchema }", Inputs: map[string]map[string]interface{}{"searchResult": {}}})
+
+	events := readEvents(t, buf)
+	assert.Equal(t, "{ searchSchema }", events[0]["query"])
+	assert.Contains(t, events[0], "inputs")
+}
+
+func Test_Logger_Log_disabled(t *testing.T) {
+	var logger *Logger
+
+	logger.Log(&Event{}) // Shouldn't panic.
+}
@@ -0,0 +1,108 @@
+// Copyright Contributors to the Open Cluster Management project
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/parser"
+	klog "k8s.io/klog/v2"
+)
+
+// The GraphQL request sent to /federated.
+type federatedRequest struct {
+	OperationName string                 `json:"operationName"`
+	Query         string                 `json:"query"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+// The response from /federated.
+type federatedResponse struct {
+	Data   json.RawMessage `json:"data"`
+	Errors []string        `json:"errors"`
+}
+
+// Larger federated responses are audited without the result counts, so the audit log doesn't keep
+// a copy of each response in memory.
+const maxRecordedResponse = 1 << 20 // 1 MiB
+
+// Keeps a copy of the response to audit the results, up to maxRecordedResponse bytes.
+type responseRecorder struct {
+	http.ResponseWriter
+	status    int
+	body      bytes.Buffer
+	truncated bool // The response was larger than maxRecordedResponse.
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(data []byte) (int, error) {
+	if !r.truncated && r.body.Len()+len(data) > maxRecordedResponse {
+		r.truncated = true
+		r.body = bytes.Buffer{} // Release the copy.
+	}
+	if !r.truncated {
+		r.body.Write(data)
+	}
+	return r.ResponseWriter.Write(data)
+}
+
+// Middleware to audit the federated requests. Only the GraphQL request in the body is audited,
+// the headers with the tokens aren't read.
+func FederatedMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		logger := getLogger()
+		if logger == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		start := time.Now()
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			klog.Errorf("Error reading the federated request for the audit log. Error: %s", err)
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		recorder := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+
+		event := newEvent(r.Context(), "federated", start)
+		request := federatedRequest{}
+		if err := json.Unmarshal(body, &request); err == nil {
+			event.setOperation(federatedOperation(request), request.Query, request.Variables)
+		}
+		response := federatedResponse{}
+		if recorder.truncated {
+			klog.V(3).Info("The federated response is too large to audit the result counts.")
+		} else if err := json.Unmarshal(recorder.body.Bytes(), &response); err == nil {
+			event.setResultCounts(response.Data)
+			event.setErrors(response.Errors)
+		}
+		if recorder.status >= http.StatusBadRequest && event.Outcome != OutcomeError {
+			event.setErrors([]string{fmt.Sprintf("request failed with status %d", recorder.status)})
+		}
+		event.finish(start)
+		logger.Log(event)
+	})
+}
+
+// Returns the operation from the query, selected by name when the query has more than one.
+func federatedOperation(request federatedRequest) *ast.OperationDefinition {
+	doc, err := parser.ParseQuery(&ast.Source{Input: request.Query})
+	if err != nil {
+		klog.V(3).Infof("Error parsing the federated query for the audit log. Error: %s", err)
+		return nil
+	}
+	if request.OperationName == "" && len(doc.Operations) == 1 {
+		return doc.Operations[0]
+	}
+	return doc.Operations.ForName(request.OperationName)
+}
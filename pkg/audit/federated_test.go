@@ -0,0 +1,77 @@
+// Copyright Contributors to the Open Cluster Management project
+package audit
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stolostron/search-v2-api/pkg/rbac"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_FederatedMiddleware(t *testing.T) {
+	buf := mockLogger(t, LevelRequest)
+	body := `{"operationName": "mySearch", "variables": {"input": [{"keywords": ["db"]}]},
+		"query": "query mySearch($input: [SearchInput]) { searchResult(input: $input) { count } }"}`
+	req := httptest.NewRequest(http.MethodPost, "/federated", strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer secret-token-value")
+	req = req.WithContext(context.WithValue(req.Context(), rbac.ContextAuthTokenKey, "secret-token-value"))
+	w := httptest.NewRecorder()
+	var received string
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		received = string(data)
+		_, _ = w.Write([]byte(`{"data": {"searchResult": [{"count": 7}]}, "errors": ["remote hub unavailable"]}`))
+	})
+
+	FederatedMiddleware(next).ServeHTTP(w, req)
+
+	assert.Equal(t, body, received, "Expected the handler to receive the request body.")
+	assert.Contains(t, w.Body.String(), `"count": 7`)
+	assert.NotContains(t, buf.String(), "secret-token-value", "The token must never be logged.")
+	events := readEvents(t, buf)
+	assert.Equal(t, "federated", events[0]["path"])
+	assert.Equal(t, "alice", events[0]["user"])
+	assert.Equal(t, "mySearch", events[0]["operationName"])
+	assert.Equal(t, map[string]interface{}{"searchResult": []interface{}{float64(7)}}, events[0]["resultCounts"])
+	assert.Equal(t, OutcomeError, events[0]["outcome"])
+	assert.Equal(t, []interface{}{"remote hub unavailable"}, events[0]["errors"])
+}
+
+func Test_FederatedMiddleware_status(t *testing.T) {
+	buf := mockLogger(t, LevelMetadata)
+	req := httptest.NewRequest(http.MethodPost, "/federated", strings.NewReader(`not json`))
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	})
+
+	FederatedMiddleware(next).ServeHTTP(httptest.NewRecorder(), req)
+
+	events := readEvents(t, buf)
+	assert.Equal(t, OutcomeError, events[0]["outcome"])
+	assert.Equal(t, []interface{}{"request failed with status 403"}, events[0]["errors"])
+}
+
+func Test_FederatedMiddleware_largeResponse(t *testing.T) {
+	buf := mockLogger(t, LevelMetadata)
+	req := httptest.NewRequest(http.MethodPost, "/federated", strings.NewReader(`{"query": "{ searchResult { count } }"}`))
+	w := httptest.NewRecorder()
+	chunks := []string{`{"data": {"searchResult": [{"items": [`,
+		strings.Repeat(`{"name": "pod"},`, maxRecordedResponse/16), `{"name": "pod"}]}]}}`}
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, chunk := range chunks {
+			_, _ = w.Write([]byte(chunk))
+		}
+	})
+
+	FederatedMiddleware(next).ServeHTTP(w, req)
+
+	assert.Equal(t, strings.Join(chunks, ""), w.Body.String(), "Expected the client to receive the full response.")
+	events := readEvents(t, buf)
+	assert.Equal(t, OutcomeSuccess, events[0]["outcome"])
+	assert.Nil(t, events[0]["resultCounts"], "Expected no result counts for responses larger than the limit.")
+}
@@ -0,0 +1,57 @@
+// Copyright Contributors to the Open Cluster Management project
+package audit
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/99designs/gqlgen/graphql"
+)
+
+// GraphQL server extension to audit each operation.
+type Extension struct{}
+
+var _ interface {
+	graphql.HandlerExtension
+	graphql.OperationInterceptor
+} = Extension{}
+
+func (Extension) ExtensionName() string {
+	return "Audit"
+}
+
+func (Extension) Validate(schema graphql.ExecutableSchema) error {
+	return nil
+}
+
+// Audits the operation when the first response is sent. Subscriptions send a response on each poll,
+// but they are audited once, with the results of the first response.
+func (Extension) InterceptOperation(ctx context.Context, next graphql.OperationHandler) graphql.ResponseHandler {
+	logger := getLogger()
+	if logger == nil {
+		return next(ctx)
+	}
+	start := time.Now()
+	handler := next(ctx)
+	var once sync.Once
+	return func(ctx context.Context) *graphql.Response {
+		response := handler(ctx)
+		once.Do(func() {
+			event := newEvent(ctx, "graphql", start)
+			opCtx := graphql.GetOperationContext(ctx)
+			event.setOperation(opCtx.Operation, opCtx.RawQuery, opCtx.Variables)
+			if response != nil {
+				event.setResultCounts(response.Data)
+				errors := make([]string, 0, len(response.Errors))
+				for _, err := range response.Errors {
+					errors = append(errors, err.Message)
+				}
+				event.setErrors(errors)
+			}
+			event.finish(start)
+			logger.Log(event)
+		})
+		return response
+	}
+}
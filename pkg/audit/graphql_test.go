@@ -0,0 +1,64 @@
+// Copyright Contributors to the Open Cluster Management project
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/stretchr/testify/assert"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+func Test_Extension_InterceptOperation(t *testing.T) {
+	buf := mockLogger(t, LevelRequest)
+	query := `query mySearch($input: [SearchInput]) { searchResult(input: $input) { count } }`
+	ctx := graphql.WithOperationContext(context.Background(), &graphql.OperationContext{
+		RawQuery: query, OperationName: "mySearch", Operation: parseOperation(t, query),
+		Variables: map[string]interface{}{"input": []interface{}{map[string]interface{}{"keywords": []interface{}{"db"}}}},
+	})
+	calls := 0
+	next := func(ctx context.Context) graphql.ResponseHandler {
+		return func(ctx context.Context) *graphql.Response {
+			calls++
+			return &graphql.Response{Data: json.RawMessage(`{"searchResult": [{"count": 4}]}`)}
+		}
+	}
+
+	handler := Extension{}.InterceptOperation(ctx, next)
+	handler(ctx)
+	handler(ctx) // Subscriptions are only audited on the first response.
+
+	events := readEvents(t, buf)
+	assert.Equal(t, 2, calls)
+	assert.Len(t, events, 1)
+	assert.Equal(t, "alice", events[0]["user"])
+	assert.Equal(t, []interface{}{"system:authenticated", "auditors"}, events[0]["groups"])
+	assert.Equal(t, "graphql", events[0]["path"])
+	assert.Equal(t, "mySearch", events[0]["operationName"])
+	assert.Equal(t, map[string]interface{}{"searchResult": []interface{}{float64(4)}}, events[0]["resultCounts"])
+	assert.Equal(t, map[string]interface{}{"searchResult": map[string]interface{}{"input": []interface{}{
+		map[string]interface{}{"keywords": []interface{}{"db"}}}}}, events[0]["inputs"])
+	assert.Equal(t, OutcomeSuccess, events[0]["outcome"])
+}
+
+func Test_Extension_InterceptOperation_error(t *testing.T) {
+	buf := mockLogger(t, LevelMetadata)
+	query := `{ searchComplete(property: "kind") }`
+	ctx := graphql.WithOperationContext(context.Background(), &graphql.OperationContext{
+		RawQuery: query, Operation: parseOperation(t, query)})
+	next := func(ctx context.Context) graphql.ResponseHandler {
+		return func(ctx context.Context) *graphql.Response {
+			return &graphql.Response{Errors: gqlerror.List{{Message: "database is unavailable"}}}
+		}
+	}
+
+	Extension{}.InterceptOperation(ctx, next)(ctx)
+
+	events := readEvents(t, buf)
+	assert.Equal(t, OutcomeError, events[0]["outcome"])
+	assert.Equal(t, []interface{}{"database is unavailable"}, events[0]["errors"])
+	assert.NotContains(t, events[0], "inputs", "Expected no inputs with the metadata level.")
+	assert.NotContains(t, events[0], "query", "Expected no query with the metadata level.")
+}
@@ -0,0 +1,41 @@
+// Copyright Contributors to the Open Cluster Management project
+package audit
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/stolostron/search-v2-api/pkg/rbac"
+)
+
+// Audits the requests rejected by the authentication, impersonation and rate limit checks.
+// These requests don't reach the GraphQL server or the federated handler, so they are reported by
+// the rbac middleware. See rbac.OnRejectedRequest()
+func LogRejectedRequest(ctx context.Context, path string, status int, reason string) {
+	logger := getLogger()
+	if logger == nil {
+		return
+	}
+	start := time.Now()
+	event := &Event{Time: start.UTC(), Path: "graphql", Outcome: OutcomeSuccess}
+	if strings.HasPrefix(path, "/federated") {
+		event.Path = "federated"
+	}
+	// The user isn't known when the request didn't have a valid token or certificate.
+	if isAuthenticated(ctx) {
+		setUser(ctx, event)
+	}
+	event.setErrors([]string{fmt.Sprintf("request rejected with status %d: %s", status, reason)})
+	event.finish(start)
+	logger.Log(event)
+}
+
+func isAuthenticated(ctx context.Context) bool {
+	if _, ok := rbac.GetCertUser(ctx); ok {
+		return true
+	}
+	token, ok := ctx.Value(rbac.ContextAuthTokenKey).(string)
+	return ok && token != ""
+}
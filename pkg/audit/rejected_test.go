@@ -0,0 +1,49 @@
+// Copyright Contributors to the Open Cluster Management project
+package audit
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stolostron/search-v2-api/pkg/rbac"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_LogRejectedRequest(t *testing.T) {
+	buf := mockLogger(t, LevelMetadata)
+	ctx := context.WithValue(context.Background(), rbac.ContextAuthTokenKey, "secret-token-value")
+
+	LogRejectedRequest(ctx, "/federated", 403,
+		"Impersonation not allowed. user alice isn't allowed to impersonate user bob")
+
+	assert.NotContains(t, buf.String(), "secret-token-value", "The token must never be logged.")
+	events := readEvents(t, buf)
+	assert.Equal(t, "federated", events[0]["path"])
+	assert.Equal(t, "alice", events[0]["user"])
+	assert.Equal(t, OutcomeError, events[0]["outcome"])
+	assert.Equal(t, []interface{}{"request rejected with status 403: Impersonation not allowed. " +
+		"user alice isn't allowed to impersonate user bob"}, events[0]["errors"])
+}
+
+func Test_LogRejectedRequest_unauthenticated(t *testing.T) {
+	buf := mockLogger(t, LevelMetadata)
+
+	LogRejectedRequest(context.Background(), "/searchapi/graphql", 401,
+		"Request didn't have a valid authentication token.")
+
+	events := readEvents(t, buf)
+	assert.Equal(t, "graphql", events[0]["path"])
+	assert.Equal(t, "", events[0]["user"], "Expected no user when the request isn't authenticated.")
+	assert.Equal(t, []interface{}{
+		"request rejected with status 401: Request didn't have a valid authentication token."}, events[0]["errors"])
+}
+
+func Test_LogRejectedRequest_disabled(t *testing.T) {
+	originalLogger := getLogger
+	getLogger = func() *Logger { return nil }
+	defer func() { getLogger = originalLogger }()
+
+	assert.NotPanics(t, func() {
+		LogRejectedRequest(context.Background(), "/searchapi/graphql", 429, "Rate limit exceeded.")
+	})
+}
@@ -0,0 +1,40 @@
+// Copyright Contributors to the Open Cluster Management project
+package audit
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_rotatingFile_Write(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	f, err := openRotatingFile(path, 1, 2)
+	assert.Nil(t, err)
+	f.maxSize = 10 // Rotate after 10 bytes.
+
+	for _, line := range []string{"line-1\n", "line-2\n", "line-3\n", "line-4\n"} {
+		_, err := f.Write([]byte(line))
+		assert.Nil(t, err)
+	}
+
+	for file, expected := range map[string]string{path: "line-4\n", path + ".1": "line-3\n", path + ".2": "line-2\n"} {
+		data, err := os.ReadFile(file) // #nosec G304 - Test file.
+		assert.Nil(t, err)
+		assert.Equal(t, expected, string(data))
+	}
+	_, err = os.Stat(path + ".3")
+	assert.True(t, os.IsNotExist(err), "Expected only 2 backups.")
+}
+
+func Test_rotatingFile_append(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	assert.Nil(t, os.WriteFile(path, []byte("existing\n"), 0600))
+
+	f, err := openRotatingFile(path, 1, 1)
+
+	assert.Nil(t, err)
+	assert.Equal(t, int64(9), f.size, "Expected the size of the existing file.")
+}
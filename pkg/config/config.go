@@ -5,6 +5,7 @@ package config
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/url"
 	"os"
 	"strconv"
@@ -19,9 +20,14 @@ var Cfg = new()
 type Config struct {
 	HubName                  string //Display Name of the cluster where ACM is deployed
 	API_SERVER_URL           string // address for Kubernetes API Server
+	Audit                    auditConfig // Audit log of the search requests.
 	AuthCacheTTL             int    // Time-to-live (milliseconds) of Authentication (TokenReview) cache.
+	AuthCacheMaxSize         int    // Max number of tokens in the Authentication (TokenReview) cache.
+	CacheJanitorInterval     int    // Time (milliseconds) between runs of the process that evicts expired cache entries.
 	SharedCacheTTL           int    // Time-to-live (milliseconds) of common resources (shared across users) cache.
 	UserCacheTTL             int    // Time-to-live (milliseconds) of namespaced resources (specifc to users) cache.
+	UserCacheMaxSize         int    // Max number of users in the user data cache.
+	ClientCAFile             string // Path to the CA bundle to verify client certificates. Enables mTLS authentication.
 	ContextPath              string
 	DBHost                   string
 	DBMinConns               int32 // Overrides pgxpool.Config{ MinConns } Default: 0
@@ -36,11 +42,22 @@ type Config struct {
 	DevelopmentMode          bool             // Indicates if running in local development mode.
 	Features                 featureFlags     // Enable or disable features.
 	Federation               federationConfig // Federated search configuration.
+	FuzzySearchThreshold     float64          // Minimum trigram similarity (0 to 1) to match keywords in FUZZY mode. Default 0.3
 	HttpPort                 int
+	ManagedClusterPermissionProvider  string // Source of fine-grained permissions on managed clusters: configmap or clusterpermission.
+	ManagedClusterPermissionConfigMap string // Name of the ConfigMap with the policy for the configmap provider.
+	MessagesDocURL           string // Documentation URL used to build the docLink of messages. The message ID is the anchor.
+	OIDCIssuersConfig        string // Path to a JSON file with the OIDC issuers to validate JWT tokens locally.
 	PlaygroundMode           bool   // Enable the GraphQL Playground client.
 	PodNamespace             string // Kubernetes namespace where the pod is running.
 	QueryLimit               uint   // The default LIMIT to use on queries. Client can override.
+	RateLimit                rateLimitConfig // Limits the requests of each user and the requests to the database.
+	RbacAccessTableThreshold int    // Users with access to more namespaces use the RBAC access table in the database. 0 disables it.
+	RedactionPolicyConfig    string // Path to a JSON file with the policy to redact sensitive properties from the results.
 	RelationLevel            int    // The number of levels/hops for finding relationships for a particular resource
+	SchemaCacheTTL           int    // Time-to-live (milliseconds) of the schema by kind cache (specific to users).
+	ShareUserDataByGroups    bool   // Users without direct RoleBindings or ClusterRoleBindings share the user data with users in the same groups.
+	StaleClusterThreshold    int    // Time (milliseconds) after which the data from a managed cluster is reported as stale.
 	SlowLog                  int    // Logs when queries are slower than the specified time duration in ms. Default 300ms
 	SubscriptionRefreshInterval int    // Number of seconds between subscription polls
 	SubscriptionRefreshTimeout  int    // Minutes a subscription will stay open before timeout
@@ -62,6 +79,23 @@ type httpClientPool struct {
 	RequestTimeout        int // Timeout for outbound federated requests.
 }
 
+// Audit log configuration options.
+type auditConfig struct {
+	Log        string // Destination of the audit log: stdout or the path of a file. Disabled when empty.
+	Level      string // metadata: user, operation, result counts, duration and outcome. request: adds the inputs.
+	MaxSize    int    // Size (MB) of the audit log file before it's rotated.
+	MaxBackups int    // Number of rotated audit log files to keep.
+}
+
+// Rate limit configuration options.
+type rateLimitConfig struct {
+	UserRate      float64 // Requests per second allowed for each user. Disabled when 0.
+	UserBurst     int     // Requests allowed in a burst for each user.
+	MaxConcurrent int     // Max number of database operations in flight across all users. Default: DBMaxConns. Disabled when 0.
+	MaxWait       int     // Time (milliseconds) a database operation waits for one of the MaxConcurrent slots before it's rejected.
+	ExemptUsers   string  // Comma-separated usernames exempt from the limits. Use * as wildcard, like system:serviceaccount:ns:*
+}
+
 // Federated search configuration options.
 type federationConfig struct {
 	GlobalHubName  string         // Identifies the global hub cluster, similar to local-cluster
@@ -75,9 +109,19 @@ func new() *Config {
 	conf := &Config{
 		HubName:             getEnv("HUB_NAME", ""),
 		API_SERVER_URL:      getEnv("API_SERVER_URL", "https://kubernetes.default.svc"),
+		Audit: auditConfig{
+			Log:        getEnv("AUDIT_LOG", ""), // Disabled by default.
+			Level:      getEnv("AUDIT_LEVEL", "metadata"),
+			MaxSize:    getEnvAsInt("AUDIT_LOG_MAX_SIZE", 100), // 100 MB
+			MaxBackups: getEnvAsInt("AUDIT_LOG_MAX_BACKUPS", 5),
+		},
 		AuthCacheTTL:        getEnvAsInt("AUTH_CACHE_TTL", 60000),    // 1 minute
+		AuthCacheMaxSize:    getEnvAsInt("AUTH_CACHE_MAX_SIZE", 10000),
+		CacheJanitorInterval: getEnvAsInt("CACHE_JANITOR_INTERVAL", 60000), // 1 minute
 		SharedCacheTTL:      getEnvAsInt("SHARED_CACHE_TTL", 300000), // 5 minutes
 		UserCacheTTL:        getEnvAsInt("USER_CACHE_TTL", 300000),   // 5 minutes
+		UserCacheMaxSize:    getEnvAsInt("USER_CACHE_MAX_SIZE", 5000),
+		ClientCAFile:        getEnv("CLIENT_CA_FILE", ""), // Disabled by default.
 		ContextPath:         getEnv("CONTEXT_PATH", "/searchapi"),
 		DBHost:              getEnv("DB_HOST", "localhost"),
 		DBMaxConns:          getEnvAsInt32("DB_MAX_CONNS", int32(10)),         // Overrides pgxpool default (4)
@@ -106,17 +150,35 @@ func new() *Config {
 				RequestTimeout:        getEnvAsInt("FEDERATED_REQUEST_TIMEOUT", 60*1000), // 60 seconds.
 			},
 		},
+		FuzzySearchThreshold: getEnvAsFloat("FUZZY_SEARCH_THRESHOLD", 0.3), // Same as the pg_trgm default.
 		HttpPort:       getEnvAsInt("HTTP_PORT", 4010),
+		ManagedClusterPermissionProvider:  getEnv("MANAGED_CLUSTER_PERMISSION_PROVIDER", ""), // Disabled by default.
+		ManagedClusterPermissionConfigMap: getEnv("MANAGED_CLUSTER_PERMISSION_CONFIGMAP", "search-managed-cluster-permissions"),
+		MessagesDocURL: getEnv("MESSAGES_DOC_URL", ""),
+		OIDCIssuersConfig: getEnv("OIDC_ISSUERS_CONFIG", ""), // Disabled by default, all tokens use TokenReview.
 		PlaygroundMode: getEnvAsBool("PLAYGROUND_MODE", false),
 		PodNamespace:   getEnv("POD_NAMESPACE", "open-cluster-management"),
 		QueryLimit:     getEnvAsUint("QUERY_LIMIT", uint(1000)),
+		RateLimit: rateLimitConfig{
+			UserRate:      getEnvAsFloat("RATE_LIMIT_USER_RATE", 10),
+			UserBurst:     getEnvAsInt("RATE_LIMIT_USER_BURST", 50),
+			MaxWait:       getEnvAsInt("RATE_LIMIT_MAX_WAIT", 1000), // 1 second
+			ExemptUsers:   getEnv("RATE_LIMIT_EXEMPT_USERS", ""),
+		},
+		RbacAccessTableThreshold: getEnvAsInt("RBAC_ACCESS_TABLE_THRESHOLD", 0), // Disabled by default.
+		RedactionPolicyConfig: getEnv("REDACTION_POLICY_CONFIG", ""), // Disabled by default.
 		SlowLog:        getEnvAsInt("SLOW_LOG", 300),
+		StaleClusterThreshold: getEnvAsInt("STALE_CLUSTER_THRESHOLD", 30*60*1000), // 30 minutes
 		// Setting default level to 0 to check if user has explicitly set this variable
 		// This will be updated to 1 for default searches and 3 for applications - unless set by the user
 		RelationLevel: getEnvAsInt("RELATION_LEVEL", 0),
+		SchemaCacheTTL: getEnvAsInt("SCHEMA_CACHE_TTL", 300000), // 5 minutes
+		ShareUserDataByGroups: getEnvAsBool("SHARE_USER_DATA_BY_GROUPS", false),
 		SubscriptionRefreshInterval:   getEnvAsInt("SUBSCRIPTION_REFRESH_INTERVAL", 10*1000),  // 10 seconds - default subscription poll interval
 		SubscriptionRefreshTimeout:    getEnvAsInt("SUBSCRIPTION_REFRESH_TIMEOUT", 5*60*1000),  // 5 minutes - default subscription poll timeout
 	}
+	// The default depends on DB_MAX_CONNS, so the limit doesn't allow more operations than connections.
+	conf.RateLimit.MaxConcurrent = getEnvAsInt("RATE_LIMIT_MAX_CONCURRENT", int(conf.DBMaxConns))
 	conf.DBPass = url.QueryEscape(conf.DBPass)
 	return conf
 }
@@ -147,6 +209,13 @@ func (cfg *Config) Validate() error {
 	if cfg.DBPass == "" {
 		return errors.New("required environment DB_PASS is not set")
 	}
+	if cfg.RateLimit.MaxConcurrent > int(cfg.DBMaxConns) {
+		return fmt.Errorf("environment RATE_LIMIT_MAX_CONCURRENT (%d) must not be higher than DB_MAX_CONNS (%d)",
+			cfg.RateLimit.MaxConcurrent, cfg.DBMaxConns)
+	}
+	if cfg.Audit.Level != "metadata" && cfg.Audit.Level != "request" {
+		return fmt.Errorf("environment AUDIT_LEVEL must be metadata or request, found: %s", cfg.Audit.Level)
+	}
 	return nil
 }
 
@@ -185,6 +254,15 @@ func getEnvAsUint(name string, defaultVal uint) uint {
 	return defaultVal
 }
 
+// Helper function to read an environment variable into a float64 or return a default value
+func getEnvAsFloat(name string, defaultVal float64) float64 {
+	valueStr := getEnv(name, "")
+	if value, err := strconv.ParseFloat(valueStr, 64); err == nil {
+		return value
+	}
+	return defaultVal
+}
+
 // Helper to read an environment variable into a bool or return default value
 func getEnvAsBool(name string, defaultVal bool) bool {
 	valStr := getEnv(name, "")
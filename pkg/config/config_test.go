@@ -49,6 +49,16 @@ func Test_getEnvAsInt(t *testing.T) {
 	}
 }
 
+// Should load float value from environment.
+func Test_getEnvAsFloat(t *testing.T) {
+	os.Setenv("TEST_VARIABLE", "0.5")
+	res := getEnvAsFloat("TEST_VARIABLE", 0.3)
+
+	if res != 0.5 {
+		t.Errorf("Failed testing getEnvAsFloat() Expected: %f  Got: %f", 0.5, res)
+	}
+}
+
 // Should use default boolean value when environment variable does not exist.
 func Test_getEnvAsBool_default(t *testing.T) {
 	res := getEnvAsBool("ENV_VARIABLE_NOT_DEFINED", false)
@@ -127,3 +137,25 @@ func Test_Validate(t *testing.T) {
 		t.Errorf("Expected %s Got: %s", "required environment DB_NAME is not set", result)
 	}
 }
+
+// Should validate the audit level.
+func Test_Validate_AuditLevel(t *testing.T) {
+	conf := &Config{DBName: "test", DBUser: "test", DBPass: "test", Audit: auditConfig{Level: "all"}}
+
+	result := conf.Validate()
+	if result == nil || result.Error() != "environment AUDIT_LEVEL must be metadata or request, found: all" {
+		t.Errorf("Expected an error for the audit level. Got: %v", result)
+	}
+}
+
+// Should not allow more database operations in flight than connections in the pool.
+func Test_Validate_RateLimitMaxConcurrent(t *testing.T) {
+	conf := &Config{DBName: "test", DBUser: "test", DBPass: "test", DBMaxConns: 10,
+		Audit: auditConfig{Level: "metadata"}, RateLimit: rateLimitConfig{MaxConcurrent: 20}}
+
+	result := conf.Validate()
+	if result == nil ||
+		result.Error() != "environment RATE_LIMIT_MAX_CONCURRENT (20) must not be higher than DB_MAX_CONNS (10)" {
+		t.Errorf("Expected an error for the max concurrent operations. Got: %v", result)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/driftprogramming/pgxpoolmock"
 	"github.com/jackc/pgx/v4"
 	pgxpool "github.com/jackc/pgx/v4/pgxpool"
 	"github.com/stolostron/search-v2-api/pkg/config"
@@ -15,6 +16,7 @@ import (
 )
 
 var pool *pgxpool.Pool
+var limitedConnPool pgxpoolmock.PgxPool // The pool with the limit of database operations in flight.
 var timeLastPing time.Time
 
 // Checks new connection is healthy before using it.
@@ -75,9 +77,15 @@ func initializePool(ctx context.Context) {
 		klog.Info("Successfully connected to database!")
 	}
 	pool = conn
+	if pool != nil {
+		limitedConnPool = newLimitedPool(pool, cfg.RateLimit.MaxConcurrent,
+			time.Duration(cfg.RateLimit.MaxWait)*time.Millisecond)
+	}
 }
 
-func GetConnPool(ctx context.Context) *pgxpool.Pool {
+// Returns the pool, or nil when the database isn't healthy. The database operations in flight are limited
+// to RATE_LIMIT_MAX_CONCURRENT, so a single client can't use all the connections of the pool.
+func GetConnPool(ctx context.Context) pgxpoolmock.PgxPool {
 	if pool == nil {
 		initializePool(ctx)
 	}
@@ -85,7 +93,7 @@ func GetConnPool(ctx context.Context) *pgxpool.Pool {
 	if pool != nil {
 		// Skip database ping if checked less than 1 second ago.
 		if time.Since(timeLastPing) < time.Second {
-			return pool
+			return limitedConnPool
 		}
 		err := pool.Ping(ctx)
 		if err != nil {
@@ -95,6 +103,16 @@ func GetConnPool(ctx context.Context) *pgxpool.Pool {
 		}
 		timeLastPing = time.Now()
 		klog.V(5).Info("Database pool connection is healthy.")
+		return limitedConnPool
+	}
+	return nil
+}
+
+// Returns true when all the connections in the pool are in use, so new queries have to wait for a connection.
+func IsPoolSaturated() bool {
+	if pool == nil {
+		return false
 	}
-	return pool
+	stat := pool.Stat()
+	return stat.MaxConns() > 0 && stat.AcquiredConns() >= stat.MaxConns()
 }
@@ -0,0 +1,216 @@
+// Copyright Contributors to the Open Cluster Management project
+package database
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/driftprogramming/pgxpoolmock"
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+	"github.com/stolostron/search-v2-api/pkg/metrics"
+	"k8s.io/klog/v2"
+)
+
+// Returned when a database operation can't get one of the RATE_LIMIT_MAX_CONCURRENT slots within
+// RATE_LIMIT_MAX_WAIT, so the requests from all users don't queue up for the connections of the pool.
+var ErrTooManyQueries = errors.New("too many database queries in flight, retry later")
+
+// Pool that limits the database operations in flight. A slot is held until the rows are closed,
+// the row is scanned, the batch is closed, or the transaction ends.
+type limitedPool struct {
+	pgxpoolmock.PgxPool
+	slots   chan struct{}
+	maxWait time.Duration
+}
+
+// Returns the pool with the concurrency limit. The pool isn't wrapped when the limit is disabled.
+func newLimitedPool(pool pgxpoolmock.PgxPool, maxConcurrent int, maxWait time.Duration) pgxpoolmock.PgxPool {
+	if maxConcurrent <= 0 {
+		return pool
+	}
+	return &limitedPool{PgxPool: pool, slots: make(chan struct{}, maxConcurrent), maxWait: maxWait}
+}
+
+// Waits up to maxWait for a slot. Returns the function to release the slot, which is safe to call more than once.
+func (p *limitedPool) acquire(ctx context.Context) (func(), error) {
+	var once sync.Once
+	release := func() {
+		once.Do(func() {
+			<-p.slots
+			metrics.DBQueriesInFlight.Dec()
+		})
+	}
+	select {
+	case p.slots <- struct{}{}:
+		metrics.DBQueriesInFlight.Inc()
+		return release, nil
+	default:
+	}
+	timer := time.NewTimer(p.maxWait)
+	defer timer.Stop()
+	select {
+	case p.slots <- struct{}{}:
+		metrics.DBQueriesInFlight.Inc()
+		return release, nil
+	case <-timer.C:
+		klog.V(3).Info("Rejecting database query: too many queries in flight.")
+		metrics.RequestsThrottled.WithLabelValues("database").Inc()
+		return nil, ErrTooManyQueries
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (p *limitedPool) Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error) {
+	release, err := p.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	return p.PgxPool.Exec(ctx, sql, args...)
+}
+
+func (p *limitedPool) Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error) {
+	release, err := p.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := p.PgxPool.Query(ctx, sql, args...)
+	if err != nil {
+		release()
+		return rows, err
+	}
+	return &limitedRows{Rows: rows, release: release}, nil
+}
+
+func (p *limitedPool) QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row {
+	release, err := p.acquire(ctx)
+	if err != nil {
+		return errRow{err: err}
+	}
+	return &limitedRow{Row: p.PgxPool.QueryRow(ctx, sql, args...), release: release}
+}
+
+func (p *limitedPool) QueryFunc(ctx context.Context, sql string, args []interface{}, scans []interface{},
+	f func(pgx.QueryFuncRow) error) (pgconn.CommandTag, error) {
+	release, err := p.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	return p.PgxPool.QueryFunc(ctx, sql, args, scans, f)
+}
+
+func (p *limitedPool) SendBatch(ctx context.Context, b *pgx.Batch) pgx.BatchResults {
+	release, err := p.acquire(ctx)
+	if err != nil {
+		return errBatchResults{err: err}
+	}
+	return &limitedBatchResults{BatchResults: p.PgxPool.SendBatch(ctx, b), release: release}
+}
+
+func (p *limitedPool) Begin(ctx context.Context) (pgx.Tx, error) {
+	return p.BeginTx(ctx, pgx.TxOptions{})
+}
+
+func (p *limitedPool) BeginTx(ctx context.Context, txOptions pgx.TxOptions) (pgx.Tx, error) {
+	release, err := p.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	tx, err := p.PgxPool.BeginTx(ctx, txOptions)
+	if err != nil {
+		release()
+		return tx, err
+	}
+	return &limitedTx{Tx: tx, release: release}, nil
+}
+
+func (p *limitedPool) BeginFunc(ctx context.Context, f func(pgx.Tx) error) error {
+	return p.BeginTxFunc(ctx, pgx.TxOptions{}, f)
+}
+
+func (p *limitedPool) BeginTxFunc(ctx context.Context, txOptions pgx.TxOptions, f func(pgx.Tx) error) error {
+	release, err := p.acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+	return p.PgxPool.BeginTxFunc(ctx, txOptions, f)
+}
+
+type limitedRows struct {
+	pgx.Rows
+	release func()
+}
+
+func (r *limitedRows) Next() bool {
+	next := r.Rows.Next()
+	if !next {
+		r.release() // The rows are closed after the last row.
+	}
+	return next
+}
+
+func (r *limitedRows) Close() {
+	r.Rows.Close()
+	r.release()
+}
+
+type limitedRow struct {
+	pgx.Row
+	release func()
+}
+
+func (r *limitedRow) Scan(dest ...interface{}) error {
+	defer r.release()
+	return r.Row.Scan(dest...)
+}
+
+type errRow struct {
+	err error
+}
+
+func (r errRow) Scan(dest ...interface{}) error {
+	return r.err
+}
+
+type limitedBatchResults struct {
+	pgx.BatchResults
+	release func()
+}
+
+func (b *limitedBatchResults) Close() error {
+	defer b.release()
+	return b.BatchResults.Close()
+}
+
+type errBatchResults struct {
+	err error
+}
+
+func (b errBatchResults) Exec() (pgconn.CommandTag, error) { return nil, b.err }
+func (b errBatchResults) Query() (pgx.Rows, error)         { return nil, b.err }
+func (b errBatchResults) QueryRow() pgx.Row                { return errRow{err: b.err} }
+func (b errBatchResults) QueryFunc(scans []interface{}, f func(pgx.QueryFuncRow) error) (pgconn.CommandTag, error) {
+	return nil, b.err
+}
+func (b errBatchResults) Close() error { return b.err }
+
+type limitedTx struct {
+	pgx.Tx
+	release func()
+}
+
+func (t *limitedTx) Commit(ctx context.Context) error {
+	defer t.release()
+	return t.Tx.Commit(ctx)
+}
+
+func (t *limitedTx) Rollback(ctx context.Context) error {
+	defer t.release()
+	return t.Tx.Rollback(ctx)
+}
@@ -0,0 +1,98 @@
+// Copyright Contributors to the Open Cluster Management project
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/driftprogramming/pgxpoolmock"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_newLimitedPool_disabled(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockPool := pgxpoolmock.NewMockPgxPool(ctrl)
+
+	assert.Equal(t, mockPool, newLimitedPool(mockPool, 0, time.Second), "Expected the pool without the limit.")
+}
+
+func Test_limitedPool_Query_releaseOnNext(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockPool := pgxpoolmock.NewMockPgxPool(ctrl)
+	rows := pgxpoolmock.NewRows([]string{"uid"}).AddRow("uid-1").ToPgxRows()
+	mockPool.EXPECT().Query(gomock.Any(), "SELECT uid").Return(rows, nil)
+	pool := newLimitedPool(mockPool, 1, time.Millisecond).(*limitedPool)
+
+	result, err := pool.Query(context.Background(), "SELECT uid")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(pool.slots), "Expected the slot to be held while reading the rows.")
+
+	for result.Next() {
+	}
+	assert.Equal(t, 0, len(pool.slots), "Expected the slot to be released after the last row.")
+	result.Close() // Releasing again doesn't free another slot.
+	assert.Equal(t, 0, len(pool.slots))
+}
+
+func Test_limitedPool_Query_releaseOnClose(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockPool := pgxpoolmock.NewMockPgxPool(ctrl)
+	rows := pgxpoolmock.NewRows([]string{"uid"}).AddRow("uid-1").AddRow("uid-2").ToPgxRows()
+	mockPool.EXPECT().Query(gomock.Any(), "SELECT uid").Return(rows, nil)
+	pool := newLimitedPool(mockPool, 1, time.Millisecond).(*limitedPool)
+
+	result, err := pool.Query(context.Background(), "SELECT uid")
+	assert.Nil(t, err)
+	result.Next()
+	result.Close()
+
+	assert.Equal(t, 0, len(pool.slots), "Expected the slot to be released when the rows are closed.")
+}
+
+func Test_limitedPool_tooManyQueries(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockPool := pgxpoolmock.NewMockPgxPool(ctrl)
+	rows := pgxpoolmock.NewRows([]string{"uid"}).AddRow("uid-1").ToPgxRows()
+	mockPool.EXPECT().Query(gomock.Any(), "SELECT uid").Return(rows, nil)
+	pool := newLimitedPool(mockPool, 1, 10*time.Millisecond)
+
+	held, err := pool.Query(context.Background(), "SELECT uid")
+	assert.Nil(t, err)
+
+	_, err = pool.Query(context.Background(), "SELECT uid")
+	assert.Equal(t, ErrTooManyQueries, err)
+	var count int
+	err = pool.QueryRow(context.Background(), "SELECT count(*)").Scan(&count)
+	assert.Equal(t, ErrTooManyQueries, err)
+
+	held.Close()
+	mockPool.EXPECT().Exec(gomock.Any(), "DELETE").Return(nil, nil)
+	_, err = pool.Exec(context.Background(), "DELETE")
+	assert.Nil(t, err, "Expected a slot to be available after the rows are closed.")
+}
+
+func Test_limitedPool_waitsForSlot(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockPool := pgxpoolmock.NewMockPgxPool(ctrl)
+	rows := pgxpoolmock.NewRows([]string{"uid"}).AddRow("uid-1").ToPgxRows()
+	mockPool.EXPECT().Query(gomock.Any(), "SELECT uid").Return(rows, nil)
+	mockPool.EXPECT().Exec(gomock.Any(), "DELETE").Return(nil, nil)
+	pool := newLimitedPool(mockPool, 1, time.Second)
+
+	held, err := pool.Query(context.Background(), "SELECT uid")
+	assert.Nil(t, err)
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		held.Close()
+	}()
+
+	_, err = pool.Exec(context.Background(), "DELETE")
+	assert.Nil(t, err, "Expected the query to wait for the slot to be released.")
+}
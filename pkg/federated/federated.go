@@ -9,6 +9,7 @@ import (
 	"net/http"
 	"sync"
 
+	"github.com/stolostron/search-v2-api/pkg/federated/hubstatus"
 	"k8s.io/klog/v2"
 )
 
@@ -89,11 +90,13 @@ func (fedRequest *FederatedRequest) getFederatedResponse(remoteService RemoteSea
 	resp, err := client.Do(req)
 	if err != nil {
 		klog.Errorf("Error sending federated request: %s", err)
+		hubstatus.SetReachable(remoteService.Name, false)
 		fedRequest.Response.Errors = append(fedRequest.Response.Errors, fmt.Errorf("error sending federated request: %s", err).Error())
 		return
 	}
 
 	// Read and process the response.
+	hubstatus.SetReachable(remoteService.Name, true)
 	defer resp.Body.Close()
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
@@ -0,0 +1,38 @@
+// Copyright Contributors to the Open Cluster Management project
+
+// Package hubstatus keeps the managed hubs that couldn't be reached on the last federated request.
+// It's a separate package, so the resolver can report unreachable hubs without importing the federated package.
+package hubstatus
+
+import (
+	"sort"
+	"sync"
+)
+
+var hubStatus = struct {
+	unreachable map[string]struct{}
+	lock        sync.RWMutex
+}{unreachable: map[string]struct{}{}}
+
+// Records the result of the last federated request sent to the hub.
+func SetReachable(hubName string, reachable bool) {
+	hubStatus.lock.Lock()
+	defer hubStatus.lock.Unlock()
+	if reachable {
+		delete(hubStatus.unreachable, hubName)
+	} else {
+		hubStatus.unreachable[hubName] = struct{}{}
+	}
+}
+
+// Returns the managed hubs that couldn't be reached on the last federated request.
+func Unreachable() []string {
+	hubStatus.lock.RLock()
+	defer hubStatus.lock.RUnlock()
+	hubs := make([]string, 0, len(hubStatus.unreachable))
+	for hub := range hubStatus.unreachable {
+		hubs = append(hubs, hub)
+	}
+	sort.Strings(hubs)
+	return hubs
+}
@@ -0,0 +1,20 @@
+// Copyright Contributors to the Open Cluster Management project
+package hubstatus
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnreachable(t *testing.T) {
+	SetReachable("managed-hub-b", false)
+	SetReachable("managed-hub-a", false)
+
+	assert.Equal(t, []string{"managed-hub-a", "managed-hub-b"}, Unreachable())
+
+	SetReachable("managed-hub-a", true)
+	SetReachable("managed-hub-b", true)
+
+	assert.Equal(t, []string{}, Unreachable())
+}
@@ -19,6 +19,41 @@ var (
 		Help: "The number of failed database connection attempts.",
 	})
 
+	CacheInvalidations = promauto.With(PromRegistry).NewCounterVec(prometheus.CounterOpts{
+		Name: "search_api_cache_invalidations",
+		Help: "The number of cache invalidations triggered by changes to the watched resources.",
+	}, []string{"source"})
+
+	CacheSize = promauto.With(PromRegistry).NewGaugeVec(prometheus.GaugeOpts{
+		Name: "search_api_cache_size",
+		Help: "The number of entries in the cache.",
+	}, []string{"cache"})
+
+	CacheHits = promauto.With(PromRegistry).NewCounterVec(prometheus.CounterOpts{
+		Name: "search_api_cache_hits",
+		Help: "The number of requests resolved with valid cached data.",
+	}, []string{"cache"})
+
+	CacheMisses = promauto.With(PromRegistry).NewCounterVec(prometheus.CounterOpts{
+		Name: "search_api_cache_misses",
+		Help: "The number of requests without valid cached data.",
+	}, []string{"cache"})
+
+	CacheEvictions = promauto.With(PromRegistry).NewCounterVec(prometheus.CounterOpts{
+		Name: "search_api_cache_evictions",
+		Help: "The number of entries removed from the cache because they expired or the cache was full.",
+	}, []string{"cache", "reason"})
+
+	RequestsThrottled = promauto.With(PromRegistry).NewCounterVec(prometheus.CounterOpts{
+		Name: "search_api_requests_throttled",
+		Help: "The number of requests, websocket connections, subscription polls and database queries rejected by the rate limits.",
+	}, []string{"source"})
+
+	DBQueriesInFlight = promauto.With(PromRegistry).NewGauge(prometheus.GaugeOpts{
+		Name: "search_api_db_queries_in_flight",
+		Help: "The number of database operations holding one of the slots of the concurrency limit.",
+	})
+
 	DBQueryDuration = promauto.With(PromRegistry).NewHistogramVec(prometheus.HistogramOpts{
 		Name: "search_api_db_query_duration",
 		Help: "Latency (seconds) for database queries.",
@@ -0,0 +1,56 @@
+// Copyright Contributors to the Open Cluster Management project
+package rbac
+
+import (
+	"context"
+
+	"github.com/stolostron/search-v2-api/pkg/config"
+	authv1 "k8s.io/api/authentication/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	v1 "k8s.io/client-go/kubernetes/typed/authentication/v1"
+	"k8s.io/klog/v2"
+)
+
+// Validates a token and returns the user information in a TokenReview.
+// The user information is used to impersonate the user when resolving the RBAC.
+// An invalid token returns a TokenReview with Status.Authenticated=false and a nil error,
+// the error is reserved for failures to validate the token.
+type Authenticator interface {
+	Authenticate(ctx context.Context, token string) (*authv1.TokenReview, error)
+}
+
+// Returns the authenticator for the configuration. When OIDC issuers are configured, JWT tokens from
+// those issuers are validated locally. Other tokens are validated with a TokenReview.
+func newAuthenticator(authClient v1.AuthenticationV1Interface) Authenticator {
+	tokenReview := &tokenReviewAuthenticator{authClient: authClient}
+	if config.Cfg.OIDCIssuersConfig == "" {
+		return tokenReview
+	}
+	issuers, err := loadJWTIssuers(config.Cfg.OIDCIssuersConfig)
+	if err != nil {
+		klog.Errorf("Error loading the OIDC issuers config. Using TokenReview to validate all tokens. Error: %s", err)
+		return tokenReview
+	}
+	klog.Infof("Validating JWT tokens locally for %d OIDC issuers.", len(issuers))
+	return &jwtAuthenticator{issuers: issuers, fallback: tokenReview}
+}
+
+// Validates the token with a TokenReview request to the Kube API.
+type tokenReviewAuthenticator struct {
+	authClient v1.AuthenticationV1Interface // This allows tests to replace with mock client.
+}
+
+func (a *tokenReviewAuthenticator) Authenticate(ctx context.Context, token string) (*authv1.TokenReview, error) {
+	tr := authv1.TokenReview{
+		Spec: authv1.TokenReviewSpec{
+			Token: token,
+		},
+	}
+
+	result, err := a.authClient.TokenReviews().Create(ctx, &tr, metav1.CreateOptions{})
+	if err != nil {
+		klog.Warning("Error resolving TokenReview from Kube API.", err.Error())
+	}
+	klog.V(9).Infof("TokenReview Kube API result: %v\n", prettyPrint(result.Status))
+	return result, err
+}
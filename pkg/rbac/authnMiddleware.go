@@ -3,9 +3,13 @@ package rbac
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"net/http"
 	"strings"
 
+	"github.com/99designs/gqlgen/graphql/handler/transport"
+	"github.com/stolostron/search-v2-api/pkg/config"
 	"k8s.io/klog/v2"
 )
 
@@ -30,31 +34,129 @@ func AuthenticateUser(next http.Handler) http.Handler {
 		}
 		// Retrieving and verifying the token
 		if clientToken == "" {
+			// Clients with a verified certificate don't need a token.
+			if userInfo, ok := certificateUser(r); ok {
+				klog.V(6).Infof("User %s authenticated with client certificate.", userInfo.Username)
+				ctx := context.WithValue(r.Context(), ContextCertUserKey, userInfo)
+				if ctx, ok = withImpersonation(w, r, ctx); ok {
+					next.ServeHTTP(w, r.WithContext(ctx))
+				}
+				return
+			}
+			// Browsers can't set headers on websocket requests. The token will be validated
+			// when the client sends the connection_init message. See AuthenticateWebsocketInit()
+			if isWebsocketUpgrade(r) {
+				klog.V(6).Info("Websocket request without token. Authentication deferred to connection_init.")
+				next.ServeHTTP(w, r)
+				return
+			}
 			klog.V(4).Info("Request didn't have a valid authentication token.")
-			http.Error(w, "{\"message\":\"Request didn't have a valid authentication token.\"}",
-				http.StatusUnauthorized)
+			rejectRequest(r.Context(), w, r, http.StatusUnauthorized, "Request didn't have a valid authentication token.")
 			return
 		}
 
 		authenticated, err := GetCache().IsValidToken(r.Context(), clientToken)
 		if err != nil {
 			klog.Warning("Unexpected error while authenticating the request token.", err)
-			http.Error(w, "{\"message\":\"Unexpected error while authenticating the request token.\"}",
-				http.StatusInternalServerError)
+			writeErrorResponse(w, http.StatusInternalServerError,
+				"Unexpected error while authenticating the request token.")
 			return
 
 		}
 		if !authenticated {
 			klog.V(4).Info("Rejecting request: Invalid token.")
-			http.Error(w, "{\"message\":\"Invalid token\"}", http.StatusForbidden)
+			rejectRequest(r.Context(), w, r, http.StatusForbidden, "Invalid token")
 			return
 		}
 
 		klog.V(6).Info("User authentication successful!")
 
 		ctx := context.WithValue(r.Context(), ContextAuthTokenKey, clientToken)
+		ctx, ok := withImpersonation(w, r, ctx)
+		if !ok {
+			return
+		}
 
 		next.ServeHTTP(w, r.WithContext(ctx))
 
 	})
 }
+
+// Authenticates the websocket connection using the token from the graphql-ws connection_init payload.
+// If the payload doesn't include a token, uses the token from the cookie or header of the upgrade request.
+func AuthenticateWebsocketInit(ctx context.Context, initPayload transport.InitPayload) (context.Context, error) {
+	clientToken, _ := ctx.Value(ContextAuthTokenKey).(string)
+	if payloadToken := initPayload.Authorization(); payloadToken != "" {
+		klog.V(6).Info("Got user token from websocket connection_init payload.")
+		// Remove the keyword "Bearer " if it exists in the payload.
+		payloadToken = strings.Replace(payloadToken, "Bearer ", "", 1)
+		// Impersonation was allowed for the user of the upgrade request.
+		if _, impersonated := GetImpersonatedUser(ctx); impersonated && payloadToken != clientToken {
+			klog.V(4).Info("Rejecting websocket connection: Token doesn't match the impersonating user.")
+			return ctx, rejectWebsocket(ctx, http.StatusForbidden,
+				errors.New("impersonation requires the same token used for the upgrade request"))
+		}
+		clientToken = payloadToken
+	}
+	if _, ok := GetCertUser(ctx); ok && clientToken == "" {
+		klog.V(6).Info("Websocket connection authenticated with client certificate.")
+		return ctx, checkWebsocketRateLimit(ctx)
+	}
+	if clientToken == "" {
+		klog.V(4).Info("Websocket connection didn't have a valid authentication token.")
+		return ctx, rejectWebsocket(ctx, http.StatusUnauthorized,
+			errors.New("websocket connection didn't have a valid authentication token"))
+	}
+
+	authenticated, err := GetCache().IsValidToken(ctx, clientToken)
+	if err != nil {
+		klog.Warning("Unexpected error while authenticating the websocket token.", err)
+		return ctx, errors.New("unexpected error while authenticating the websocket token")
+	}
+	if !authenticated {
+		klog.V(4).Info("Rejecting websocket connection: Invalid token.")
+		return ctx, rejectWebsocket(ctx, http.StatusForbidden, errors.New("invalid token"))
+	}
+
+	klog.V(6).Info("Websocket authentication successful!")
+	ctx = context.WithValue(ctx, ContextAuthTokenKey, clientToken)
+	return ctx, checkWebsocketRateLimit(ctx)
+}
+
+// The upgrade request isn't limited, because it may not have a token. Each connection counts as a request.
+func checkWebsocketRateLimit(ctx context.Context) error {
+	if delay, allowed := CheckRateLimit(ctx, "websocket"); !allowed {
+		return rejectWebsocket(ctx, http.StatusTooManyRequests, errors.New(rateLimitMessage(delay)))
+	}
+	return nil
+}
+
+// Reports the rejected websocket connection. Returns the error to close the connection.
+func rejectWebsocket(ctx context.Context, status int, err error) error {
+	reportRejectedRequest(ctx, config.Cfg.ContextPath+"/graphql", status, err.Error())
+	return err
+}
+
+// Adds the impersonated user to the context. Writes the error response if the impersonation isn't allowed.
+func withImpersonation(w http.ResponseWriter, r *http.Request, ctx context.Context) (context.Context, bool) {
+	userInfo, status, err := GetCache().impersonatedUser(ctx, r)
+	if err != nil {
+		klog.V(4).Info("Rejecting request: Impersonation not allowed. ", err)
+		if status == http.StatusInternalServerError {
+			writeErrorResponse(w, status, fmt.Sprintf("Impersonation not allowed. %s", err))
+		} else {
+			rejectRequest(ctx, w, r, status, fmt.Sprintf("Impersonation not allowed. %s", err))
+		}
+		return ctx, false
+	}
+	if userInfo != nil {
+		ctx = context.WithValue(ctx, ContextImpersonatedUserKey, *userInfo)
+	}
+	return ctx, true
+}
+
+// Check if the request is a websocket upgrade request.
+func isWebsocketUpgrade(r *http.Request) bool {
+	return strings.EqualFold(r.Header.Get("Upgrade"), "websocket") &&
+		strings.Contains(strings.ToLower(r.Header.Get("Connection")), "upgrade")
+}
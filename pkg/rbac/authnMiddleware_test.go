@@ -2,13 +2,17 @@
 package rbac
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"testing"
+	"time"
 
+	"github.com/99designs/gqlgen/graphql/handler/transport"
 	"github.com/stretchr/testify/assert"
+	authv1 "k8s.io/api/authentication/v1"
 )
 
 // Runs before the tests
@@ -147,3 +151,60 @@ func TestAuthenticateEmptyTokenUser(t *testing.T) {
 	assert.Equal(t, "{\"message\":\"Request didn't have a valid authentication token.\"}\n", response.Body.String())
 
 }
+
+// test websocket upgrade request without token is deferred to connection_init
+func TestAuthenticateWebsocketUpgradeNoToken(t *testing.T) {
+	nextCalled := false
+	authenticateHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { nextCalled = true })
+
+	r := httptest.NewRequest("GET", "https://localhost:4010/searchapi/graphql", nil)
+	r.Header.Add("Connection", "Upgrade")
+	r.Header.Add("Upgrade", "websocket")
+	response := httptest.NewRecorder()
+
+	authen := AuthenticateUser(authenticateHandler)
+	authen.ServeHTTP(response, r)
+
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.True(t, nextCalled, "Expected websocket upgrade request to reach the next handler.")
+}
+
+// test token from websocket connection_init payload
+func TestAuthenticateWebsocketInitPayloadToken(t *testing.T) {
+	cacheInst.tokenReviews.add(tokenHash("ws-valid-token"), &tokenReviewCache{
+		meta: cacheMetadata{updatedAt: time.Now()},
+		tokenReview: &authv1.TokenReview{
+			Status: authv1.TokenReviewStatus{Authenticated: true},
+		},
+	})
+	defer cacheInst.tokenReviews.remove(tokenHash("ws-valid-token"))
+
+	ctx, err := AuthenticateWebsocketInit(context.Background(),
+		transport.InitPayload{"Authorization": "Bearer ws-valid-token"})
+
+	assert.Nil(t, err)
+	assert.Equal(t, "ws-valid-token", ctx.Value(ContextAuthTokenKey))
+}
+
+// test invalid token from websocket connection_init payload
+func TestAuthenticateWebsocketInitInvalidToken(t *testing.T) {
+	cacheInst.tokenReviews.add(tokenHash("ws-invalid-token"), &tokenReviewCache{
+		meta: cacheMetadata{updatedAt: time.Now()},
+		tokenReview: &authv1.TokenReview{
+			Status: authv1.TokenReviewStatus{Authenticated: false},
+		},
+	})
+	defer cacheInst.tokenReviews.remove(tokenHash("ws-invalid-token"))
+
+	_, err := AuthenticateWebsocketInit(context.Background(),
+		transport.InitPayload{"authorization": "ws-invalid-token"})
+
+	assert.EqualError(t, err, "invalid token")
+}
+
+// test websocket connection_init without token
+func TestAuthenticateWebsocketInitNoToken(t *testing.T) {
+	_, err := AuthenticateWebsocketInit(context.Background(), transport.InitPayload{})
+
+	assert.EqualError(t, err, "websocket connection didn't have a valid authentication token")
+}
@@ -13,6 +13,14 @@ func AuthorizeUser(next http.Handler) http.Handler {
 		// different place where it's independent of the request.
 		GetCache().shared.PopulateSharedCache(r.Context())
 
+		// Websocket requests may not have a token until the connection_init message is received.
+		_, isCertUser := GetCertUser(r.Context())
+		if r.Context().Value(ContextAuthTokenKey) == nil && !isCertUser {
+			klog.V(6).Info("Token not found in request context. Skipping user authorization.")
+			next.ServeHTTP(w, r)
+			return
+		}
+
 		_, userErr := GetCache().GetUserDataCache(r.Context(), nil)
 		if userErr != nil {
 			klog.Warning("Unexpected error while obtaining user data.", userErr)
@@ -9,6 +9,7 @@ import (
 	"github.com/stolostron/search-v2-api/pkg/config"
 	db "github.com/stolostron/search-v2-api/pkg/database"
 	authnv1 "k8s.io/client-go/kubernetes/typed/authentication/v1"
+	authzv1 "k8s.io/client-go/kubernetes/typed/authorization/v1"
 	"k8s.io/client-go/rest"
 	"k8s.io/klog/v2"
 )
@@ -16,17 +17,23 @@ import (
 // Cache helps optimize requests to external APIs (Kubernetes and Database)
 type Cache struct {
 	shared           SharedData
-	tokenReviews     map[string]*tokenReviewCache //Key:ClientToken
+	tokenReviews     *lruCache[*tokenReviewCache] // Key: hash of the ClientToken
 	tokenReviewsLock sync.Mutex
-	users            map[string]*UserDataCache // UID:{userdata} UID comes from tokenreview
+	users            *lruCache[*UserDataCache] // UID:{userdata} UID comes from tokenreview
 	usersLock        sync.Mutex
+	rbacIndex        rbacIndex // Last seen state of the RBAC resources, used to find the users affected by a change.
 
 	// Clients to external APIs.
 	// Defining these here allow the tests to replace with a mock client.
 	authnClient       authnv1.AuthenticationV1Interface
+	authenticator     Authenticator // Validates the tokens. Defaults to TokenReview.
+	authzClient       authzv1.AuthorizationV1Interface
 	pool              pgxpoolmock.PgxPool // Database client
 	restConfig        *rest.Config
 	dbConnInitialized bool
+
+	// Provides fine-grained permissions on managed clusters. Nil when not enabled.
+	permissionProvider ManagedClusterPermissionProvider
 }
 
 func (c *Cache) GetDbConnInitialized() bool {
@@ -39,7 +46,7 @@ func (c *Cache) setDbConnInitialized(initialized bool) {
 
 // Initialize the cache as a singleton instance.
 var cacheInst = Cache{
-	tokenReviews:     map[string]*tokenReviewCache{},
+	tokenReviews:     newTokenReviewsCache(),
 	tokenReviewsLock: sync.Mutex{},
 	usersLock:        sync.Mutex{},
 	shared: SharedData{
@@ -49,9 +56,10 @@ var cacheInst = Cache{
 		pool:             db.GetConnPool(context.TODO()),
 		dynamicClient:    config.GetDynamicClient(),
 	},
-	users:      map[string]*UserDataCache{},
-	restConfig: config.GetClientConfig(),
-	pool:       db.GetConnPool(context.TODO()),
+	users:              newUsersCache(),
+	restConfig:         config.GetClientConfig(),
+	pool:               db.GetConnPool(context.TODO()),
+	permissionProvider: newManagedClusterPermissionProvider(config.GetDynamicClient()),
 }
 
 // Get a reference to the cache instance.
@@ -32,3 +32,10 @@ func (cacheMeta *cacheMetadata) isValid() bool {
 	}
 	return time.Now().Before(cacheMeta.updatedAt.Add(cacheTTL))
 }
+
+// Returns the time when the data field was last updated.
+func (cacheMeta *cacheMetadata) getUpdatedAt() time.Time {
+	cacheMeta.lock.Lock()
+	defer cacheMeta.lock.Unlock()
+	return cacheMeta.updatedAt
+}
@@ -6,10 +6,14 @@ import (
 	"sync"
 	"time"
 
+	"github.com/stolostron/search-v2-api/pkg/config"
+	"github.com/stolostron/search-v2-api/pkg/metrics"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
 	"k8s.io/client-go/dynamic"
 	"k8s.io/klog/v2"
 )
@@ -51,21 +55,72 @@ func (c *Cache) StartBackgroundValidation(ctx context.Context) {
 	go watchManagedClusters.start(ctx)
 
 	// Watch ManagedClusterAddon
+	// Updates the clusters with the search add-on disabled.
+	watchAddons := watchResource{
+		dynamicClient: c.shared.dynamicClient,
+		gvr:           managedClusterAddonGvr,
+		onAdd:         c.addonAdded,
+		onModify:      nil, // Ignoring MODIFY because it doesn't affect the cached data.
+		onDelete:      c.addonDeleted,
+	}
+	go watchAddons.start(ctx)
 
-	// Watch ROLES
-
-	// Watch CLUSTERROLES
-
-	// Watch ROLEBINDINGS
+	// Watch ROLES and CLUSTERROLES
+	// Invalidates the users bound to the role.
+	for _, gvr := range []schema.GroupVersionResource{rolesGvr, clusterRolesGvr} {
+		watchRoles := watchResource{
+			dynamicClient: c.shared.dynamicClient,
+			gvr:           gvr,
+			onAdd:         c.roleChanged,
+			onModify:      c.roleChanged,
+			onDelete:      c.roleDeleted,
+		}
+		go watchRoles.start(ctx)
+	}
 
-	// Watch CLUSTERRROLEBINDINGS
+	// Watch ROLEBINDINGS and CLUSTERRROLEBINDINGS
+	// Invalidates the users that are subjects of the binding.
+	for _, gvr := range []schema.GroupVersionResource{roleBindingsGvr, clusterRoleBindingsGvr} {
+		watchBindings := watchResource{
+			dynamicClient: c.shared.dynamicClient,
+			gvr:           gvr,
+			onAdd:         c.bindingChanged,
+			onModify:      c.bindingChanged,
+			onDelete:      c.bindingDeleted,
+		}
+		go watchBindings.start(ctx)
+	}
 
 	// Watch GROUPS
+	// Invalidates the users added or removed from the group.
+	watchGroups := watchResource{
+		dynamicClient: c.shared.dynamicClient,
+		gvr:           groupsGvr,
+		onAdd:         c.groupChanged,
+		onModify:      c.groupChanged,
+		onDelete:      c.groupDeleted,
+	}
+	// Groups are only available on OpenShift.
+	if served, err := isGroupVersionServed(groupsGvr.GroupVersion()); err == nil && !served {
+		klog.Infof("Not watching %s because the API isn't available.", groupsGvr.String())
+	} else {
+		go watchGroups.start(ctx)
+	}
 
 	// Watch CRDS
+	// Updates the cluster-scoped resources and the property types.
+	watchCrds := watchResource{
+		dynamicClient: c.shared.dynamicClient,
+		gvr:           crdGvr,
+		onAdd:         c.crdAdded,
+		onModify:      c.crdChanged,
+		onDelete:      c.crdDeleted,
+	}
+	go watchCrds.start(ctx)
 }
 
 // Start watching for changes to a resource and trigger the action to update the cache.
+// Watches again when the server closes the watch.
 func (w watchResource) start(ctx context.Context) {
 	for {
 		watch, watchError := w.dynamicClient.Resource(w.gvr).Watch(ctx, metav1.ListOptions{})
@@ -75,9 +130,9 @@ func (w watchResource) start(ctx context.Context) {
 			continue
 		}
 
-		defer watch.Stop()
 		klog.V(2).Infof("Watching resource: %s", w.gvr.String())
 
+	events:
 		for {
 			select {
 			case <-ctx.Done():
@@ -85,7 +140,11 @@ func (w watchResource) start(ctx context.Context) {
 				watch.Stop()
 				return
 
-			case event := <-watch.ResultChan(): // Read events from the watch channel.
+			case event, ok := <-watch.ResultChan(): // Read events from the watch channel.
+				if !ok {
+					klog.V(2).Infof("Watch closed by the server, restarting watch for %s", w.gvr.String())
+					break events
+				}
 				klog.V(6).Infof("Event: %s \tResource: %s  ", event.Type, w.gvr.String())
 				o, err := runtime.UnstructuredConverter.ToUnstructured(runtime.DefaultUnstructuredConverter, &event.Object)
 				if err != nil {
@@ -112,12 +171,26 @@ func (w watchResource) start(ctx context.Context) {
 					klog.V(2).Infof("Unexpected event, waiting 5 seconds and restarting watch for %s", w.gvr.String())
 					watch.Stop()
 					time.Sleep(5 * time.Second)
+					break events
 				}
 			}
 		}
 	}
 }
 
+// Tests will replace this function to avoid using the discovery client.
+var isGroupVersionServed = func(gv schema.GroupVersion) (bool, error) {
+	client, err := discovery.NewDiscoveryClientForConfig(config.GetClientConfig())
+	if err != nil {
+		return false, err
+	}
+	_, err = client.ServerResourcesForGroupVersion(gv.String())
+	if apierrors.IsNotFound(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
 // Update the cache when a namespace is ADDED.
 func (c *Cache) namespaceAdded(obj *unstructured.Unstructured) {
 	// Add namespace to shared cache.
@@ -125,19 +198,20 @@ func (c *Cache) namespaceAdded(obj *unstructured.Unstructured) {
 	c.shared.namespaces = append(c.shared.namespaces, obj.GetName())
 	c.shared.nsCache.updatedAt = time.Now()
 	c.shared.nsCache.lock.Unlock()
+	metrics.CacheInvalidations.WithLabelValues("Namespace").Inc()
 
 	// Add the namespace to each user in UserData cache.
 	c.usersLock.Lock()
 	defer c.usersLock.Unlock()
 	wg := sync.WaitGroup{}
 	lock := sync.Mutex{}
-	for _, userCache := range c.users {
+	c.users.each(func(_ string, userCache *UserDataCache) {
 		wg.Add(1)
 		go func(userCache *UserDataCache) { // All users updated asynchronously
 			defer wg.Done()
 			userCache.getSSRRforNamespace(context.TODO(), c, obj.GetName(), &lock)
 		}(userCache)
-	}
+	})
 	wg.Wait() // Wait until all users have been updated.
 
 	// Note: The ManagedCluster and DisabledClusters cache will get updated
@@ -158,14 +232,15 @@ func (c *Cache) namespaceDeleted(obj *unstructured.Unstructured) {
 	}
 	c.shared.namespaces = newNamespaces
 	c.shared.nsCache.updatedAt = time.Now()
+	metrics.CacheInvalidations.WithLabelValues("Namespace").Inc()
 
 	// Delete from UserData cache
 	c.usersLock.Lock()
 	defer c.usersLock.Unlock()
-	for _, userCache := range c.users {
+	c.users.each(func(_ string, userCache *UserDataCache) {
 		delete(userCache.UserData.NsResources, ns)
 		delete(userCache.UserData.ManagedClusters, ns)
-	}
+	})
 }
 
 func (c *Cache) managedClusterAdded(obj *unstructured.Unstructured) {
@@ -174,20 +249,21 @@ func (c *Cache) managedClusterAdded(obj *unstructured.Unstructured) {
 	c.shared.managedClusters[obj.GetName()] = struct{}{}
 	c.shared.mcCache.updatedAt = time.Now()
 	c.shared.mcCache.lock.Unlock()
+	metrics.CacheInvalidations.WithLabelValues("ManagedCluster").Inc()
 
 	// Update UserData cache for users with access to the managed cluster.
 	c.usersLock.Lock()
 	defer c.usersLock.Unlock()
 	wg := sync.WaitGroup{}
 	lock := sync.Mutex{}
-	for _, userCache := range c.users {
+	c.users.each(func(_ string, userCache *UserDataCache) {
 		wg.Add(1)
 		go func(userCache *UserDataCache) { // All users updated asynchronously
 			defer wg.Done()
 			// Refresh the SSRR, this will add the Managed cluster if user has access.
 			userCache.getSSRRforNamespace(context.TODO(), c, obj.GetName(), &lock)
 		}(userCache)
-	}
+	})
 	wg.Wait() // Wait until all users have been updated.
 }
 
@@ -197,13 +273,14 @@ func (c *Cache) managedClusterDeleted(obj *unstructured.Unstructured) {
 	delete(c.shared.managedClusters, obj.GetName())
 	c.shared.mcCache.updatedAt = time.Now()
 	c.shared.mcCache.lock.Unlock()
+	metrics.CacheInvalidations.WithLabelValues("ManagedCluster").Inc()
 
 	// Delete ManagedCluster from UserData cache
 	c.usersLock.Lock()
 	defer c.usersLock.Unlock()
-	for _, userCache := range c.users {
+	c.users.each(func(_ string, userCache *UserDataCache) {
 		delete(userCache.UserData.ManagedClusters, obj.GetName())
-	}
+	})
 
 	// Delete from DisabledClusters shared cache
 	c.shared.dcCache.lock.Lock()
@@ -211,3 +288,110 @@ func (c *Cache) managedClusterDeleted(obj *unstructured.Unstructured) {
 	delete(c.shared.disabledClusters, obj.GetName())
 	c.shared.dcCache.updatedAt = time.Now()
 }
+
+// Update the disabled clusters when the search add-on is ADDED to a managed cluster.
+func (c *Cache) addonAdded(obj *unstructured.Unstructured) {
+	if obj.GetName() != searchAddonName {
+		return
+	}
+	c.shared.dcCache.lock.Lock()
+	defer c.shared.dcCache.lock.Unlock()
+	if _, disabled := c.shared.disabledClusters[obj.GetNamespace()]; disabled {
+		delete(c.shared.disabledClusters, obj.GetNamespace())
+		metrics.CacheInvalidations.WithLabelValues("ManagedClusterAddOn").Inc()
+	}
+}
+
+// Update the disabled clusters when the search add-on is DELETED from a managed cluster.
+// The add-on is created in the namespace of the managed cluster.
+func (c *Cache) addonDeleted(obj *unstructured.Unstructured) {
+	if obj.GetName() != searchAddonName {
+		return
+	}
+	c.shared.mcCache.lock.Lock()
+	_, isManagedCluster := c.shared.managedClusters[obj.GetNamespace()]
+	c.shared.mcCache.lock.Unlock()
+
+	c.shared.dcCache.lock.Lock()
+	defer c.shared.dcCache.lock.Unlock()
+	// A nil map means the disabled clusters haven't been loaded yet, they are queried on the next request.
+	if !isManagedCluster || c.shared.disabledClusters == nil {
+		return
+	}
+	c.shared.disabledClusters[obj.GetNamespace()] = struct{}{}
+	metrics.CacheInvalidations.WithLabelValues("ManagedClusterAddOn").Inc()
+}
+
+// Update the cluster-scoped resources when a CRD is ADDED. The index doesn't have resources of a new CRD,
+// so the property types don't change. The watch also sends ADDED for each existing CRD when it starts.
+func (c *Cache) crdAdded(obj *unstructured.Unstructured) {
+	if c.crdSeen(obj) {
+		return
+	}
+	scope, _, _ := unstructured.NestedString(obj.Object, "spec", "scope")
+	c.updateCrd(obj, scope == "Cluster")
+}
+
+// Update the cluster-scoped resources and property types when a CRD is MODIFIED.
+func (c *Cache) crdChanged(obj *unstructured.Unstructured) {
+	if c.crdSeen(obj) {
+		return
+	}
+	scope, _, _ := unstructured.NestedString(obj.Object, "spec", "scope")
+	c.markPropTypesStale()
+	c.updateCrd(obj, scope == "Cluster")
+}
+
+func (c *Cache) crdSeen(obj *unstructured.Unstructured) bool {
+	c.rbacIndex.lock.Lock()
+	defer c.rbacIndex.lock.Unlock()
+	return c.rbacIndex.seen(rbacObjectKey(obj), obj.GetResourceVersion())
+}
+
+// Update the cluster-scoped resources and property types when a CRD is DELETED.
+func (c *Cache) crdDeleted(obj *unstructured.Unstructured) {
+	c.rbacIndex.lock.Lock()
+	delete(c.rbacIndex.resourceVersions, rbacObjectKey(obj))
+	c.rbacIndex.lock.Unlock()
+	c.markPropTypesStale()
+	c.updateCrd(obj, false)
+}
+
+// Properties of the custom resource are added or removed, so the property types are queried again
+// on the next request.
+func (c *Cache) markPropTypesStale() {
+	c.shared.ptLock.Lock()
+	c.shared.propTypesStale = true
+	c.shared.ptLock.Unlock()
+	metrics.CacheInvalidations.WithLabelValues("CustomResourceDefinition").Inc()
+}
+
+func (c *Cache) updateCrd(obj *unstructured.Unstructured, clusterScoped bool) {
+	group, _, _ := unstructured.NestedString(obj.Object, "spec", "group")
+	plural, _, _ := unstructured.NestedString(obj.Object, "spec", "names", "plural")
+	resource := Resource{Apigroup: group, Kind: plural}
+
+	c.shared.csrCache.lock.Lock()
+	_, wasClusterScoped := c.shared.csResourcesMap[resource]
+	if clusterScoped == wasClusterScoped {
+		c.shared.csrCache.lock.Unlock()
+		return
+	}
+	if clusterScoped {
+		if c.shared.csResourcesMap == nil {
+			c.shared.csResourcesMap = map[Resource]struct{}{}
+		}
+		c.shared.csResourcesMap[resource] = struct{}{}
+	} else {
+		delete(c.shared.csResourcesMap, resource)
+	}
+	c.shared.csrCache.lock.Unlock()
+
+	// The cluster-scoped resources of each user must be checked again.
+	c.usersLock.Lock()
+	defer c.usersLock.Unlock()
+	klog.V(3).Infof("Invalidated cached data for %d users after change to CustomResourceDefinition %s.",
+		c.users.len(), obj.GetName())
+	c.users.purge()
+	metrics.CacheInvalidations.WithLabelValues("crd").Inc()
+}
@@ -3,14 +3,21 @@ package rbac
 
 import (
 	"context"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stolostron/search-v2-api/pkg/metrics"
 	"github.com/stretchr/testify/assert"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
 	fakedynclient "k8s.io/client-go/dynamic/fake"
 	"k8s.io/client-go/kubernetes/scheme"
+	testingk8s "k8s.io/client-go/testing"
 )
 
 func initMockCache() Cache {
@@ -26,17 +33,88 @@ func initMockCache() Cache {
 			disabledClusters: map[string]struct{}{"a": {}, "b": {}},
 			dynamicClient:    fakedynclient.NewSimpleDynamicClient(testScheme, mockns),
 		},
-		users: map[string]*UserDataCache{
+		users: newMockUsersCache(map[string]*UserDataCache{
 			"usr1": {UserData: UserData{NsResources: map[string][]Resource{}}},
-		},
+		}),
 	}
 }
 
+func mockGroupVersionServed(t *testing.T, served bool) {
+	original := isGroupVersionServed
+	isGroupVersionServed = func(gv schema.GroupVersion) (bool, error) { return served, nil }
+	t.Cleanup(func() { isGroupVersionServed = original })
+}
+
+// Counts the watches of each resource. Each watch returns a new fake watcher.
+func mockWatches(client *fakedynclient.FakeDynamicClient) (func(resource string) int, chan *watch.FakeWatcher) {
+	lock := sync.Mutex{}
+	counts := map[string]int{}
+	watchers := make(chan *watch.FakeWatcher, 10)
+	client.PrependWatchReactor("*", func(action testingk8s.Action) (bool, watch.Interface, error) {
+		lock.Lock()
+		defer lock.Unlock()
+		counts[action.GetResource().Resource]++
+		watcher := watch.NewFakeWithChanSize(1, false)
+		if action.GetResource().Resource == "namespaces" {
+			watchers <- watcher
+		}
+		return true, watcher, nil
+	})
+	return func(resource string) int {
+		lock.Lock()
+		defer lock.Unlock()
+		return counts[resource]
+	}, watchers
+}
+
 func Test_cacheValidation_StartBackgroundValidation(t *testing.T) {
+	mockGroupVersionServed(t, true)
+	mock_cache := initMockCache()
+	watchCount, _ := mockWatches(mock_cache.shared.dynamicClient.(*fakedynclient.FakeDynamicClient))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mock_cache.StartBackgroundValidation(ctx)
+
+	assert.Eventually(t, func() bool { return watchCount("groups") == 1 }, time.Second, 10*time.Millisecond)
+}
+
+func Test_cacheValidation_groupsNotServed(t *testing.T) {
+	mockGroupVersionServed(t, false)
 	mock_cache := initMockCache()
+	watchCount, _ := mockWatches(mock_cache.shared.dynamicClient.(*fakedynclient.FakeDynamicClient))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 
-	ctx := context.Background()
 	mock_cache.StartBackgroundValidation(ctx)
+
+	assert.Eventually(t, func() bool { return watchCount("namespaces") == 1 }, time.Second, 10*time.Millisecond)
+	assert.Never(t, func() bool { return watchCount("groups") > 0 }, 100*time.Millisecond, 10*time.Millisecond,
+		"Expected no watch for groups when the API isn't available.")
+}
+
+func Test_watchResource_restartWhenClosed(t *testing.T) {
+	client := fakedynclient.NewSimpleDynamicClient(scheme.Scheme)
+	watchCount, watchers := mockWatches(client)
+	added := make(chan string, 2)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	w := watchResource{
+		dynamicClient: client,
+		gvr:           schema.GroupVersionResource{Resource: "namespaces", Version: "v1"},
+		onAdd:         func(obj *unstructured.Unstructured) { added <- obj.GetName() },
+	}
+	go w.start(ctx)
+
+	first := <-watchers
+	first.Add(&unstructured.Unstructured{Object: map[string]interface{}{"metadata": map[string]interface{}{"name": "a"}}})
+	assert.Equal(t, "a", <-added)
+	first.Stop() // The server closes the watch.
+
+	second := <-watchers
+	second.Add(&unstructured.Unstructured{Object: map[string]interface{}{"metadata": map[string]interface{}{"name": "b"}}})
+	assert.Equal(t, "b", <-added, "Expected the events from the new watch.")
+	assert.Equal(t, 2, watchCount("namespaces"))
 }
 
 func Test_cacheValidation_namespaceAdded(t *testing.T) {
@@ -103,3 +181,115 @@ func Test_cacheValidation_managedClusterDeleted(t *testing.T) {
 	mock_cache.managedClusterDeleted(mock_managedCluster)
 	assert.Equal(t, map[string]struct{}{"b": {}}, mock_cache.shared.managedClusters)
 }
+
+func newMockAddon(cluster, name string) *unstructured.Unstructured {
+	return &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"apiVersion": "addon.open-cluster-management.io/v1alpha1",
+			"kind":       "ManagedClusterAddOn",
+			"metadata": map[string]interface{}{
+				"name":      name,
+				"namespace": cluster,
+			},
+		},
+	}
+}
+
+func Test_cacheValidation_addonAdded(t *testing.T) {
+	mock_cache := initMockCache()
+
+	mock_cache.addonAdded(newMockAddon("a", "search-collector"))
+	mock_cache.addonAdded(newMockAddon("b", "other-addon"))
+
+	assert.Equal(t, map[string]struct{}{"b": {}}, mock_cache.shared.disabledClusters)
+}
+
+func Test_cacheValidation_addonDeleted(t *testing.T) {
+	mock_cache := initMockCache()
+	mock_cache.shared.managedClusters["c"] = struct{}{}
+
+	mock_cache.addonDeleted(newMockAddon("c", "search-collector"))
+	mock_cache.addonDeleted(newMockAddon("not-a-cluster", "search-collector"))
+
+	assert.Equal(t, map[string]struct{}{"a": {}, "b": {}, "c": {}}, mock_cache.shared.disabledClusters)
+}
+
+func newMockCrd(plural, scope, resourceVersion string) *unstructured.Unstructured {
+	return &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"apiVersion": "apiextensions.k8s.io/v1",
+			"kind":       "CustomResourceDefinition",
+			"metadata": map[string]interface{}{
+				"name":            plural + ".example.com",
+				"resourceVersion": resourceVersion,
+			},
+			"spec": map[string]interface{}{
+				"group": "example.com",
+				"names": map[string]interface{}{"plural": plural},
+				"scope": scope,
+			},
+		},
+	}
+}
+
+func Test_cacheValidation_crdChanged(t *testing.T) {
+	mock_cache := initMockCache()
+	mock_cache.shared.propTypes = map[string]string{"kind": "string"}
+
+	invalidations := testutil.ToFloat64(metrics.CacheInvalidations.WithLabelValues("crd"))
+
+	mock_cache.crdChanged(newMockCrd("widgets", "Cluster", "1"))
+
+	assert.Equal(t, map[Resource]struct{}{{Apigroup: "example.com", Kind: "widgets"}: {}},
+		mock_cache.shared.csResourcesMap)
+	assert.True(t, mock_cache.shared.propTypesStale, "Property types are queried again.")
+	assert.Equal(t, 0, mock_cache.users.len(), "Users are checked again for the new cluster-scoped resource.")
+	assert.Equal(t, invalidations+1, testutil.ToFloat64(metrics.CacheInvalidations.WithLabelValues("crd")),
+		"Expected the invalidation of the users to be counted.")
+}
+
+func Test_cacheValidation_crdAdded(t *testing.T) {
+	mock_cache := initMockCache()
+	mock_cache.shared.propTypes = map[string]string{"kind": "string"}
+
+	mock_cache.crdAdded(newMockCrd("widgets", "Cluster", "1"))
+
+	assert.Equal(t, map[Resource]struct{}{{Apigroup: "example.com", Kind: "widgets"}: {}},
+		mock_cache.shared.csResourcesMap)
+	assert.False(t, mock_cache.shared.propTypesStale, "Property types don't change for a new CRD.")
+	assert.Equal(t, 0, mock_cache.users.len(), "Users are checked again for the new cluster-scoped resource.")
+}
+
+func Test_cacheValidation_crdChangedNamespaced(t *testing.T) {
+	mock_cache := initMockCache()
+
+	invalidations := testutil.ToFloat64(metrics.CacheInvalidations.WithLabelValues("crd"))
+
+	mock_cache.crdChanged(newMockCrd("gadgets", "Namespaced", "1"))
+
+	assert.Equal(t, invalidations, testutil.ToFloat64(metrics.CacheInvalidations.WithLabelValues("crd")))
+	assert.Equal(t, 0, len(mock_cache.shared.csResourcesMap))
+	assert.Equal(t, 1, mock_cache.users.len(), "Users aren't invalidated because cluster-scoped resources didn't change.")
+}
+
+func Test_cacheValidation_crdAddedAgain(t *testing.T) {
+	mock_cache := initMockCache()
+	mock_cache.crdChanged(newMockCrd("widgets", "Cluster", "1"))
+	mock_cache.shared.propTypesStale = false
+
+	// The same event is received again when the watch is restarted.
+	mock_cache.crdChanged(newMockCrd("widgets", "Cluster", "1"))
+
+	assert.False(t, mock_cache.shared.propTypesStale, "Property types aren't queried again for the same CRD.")
+}
+
+func Test_cacheValidation_crdDeleted(t *testing.T) {
+	mock_cache := initMockCache()
+	mock_cache.shared.csResourcesMap = map[Resource]struct{}{{Apigroup: "example.com", Kind: "widgets"}: {}}
+
+	mock_cache.crdDeleted(newMockCrd("widgets", "Cluster", "2"))
+
+	assert.Equal(t, map[Resource]struct{}{}, mock_cache.shared.csResourcesMap)
+	assert.True(t, mock_cache.shared.propTypesStale)
+	assert.Equal(t, 0, mock_cache.users.len())
+}
@@ -0,0 +1,65 @@
+// Copyright Contributors to the Open Cluster Management project
+package rbac
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/stolostron/search-v2-api/pkg/config"
+	authv1 "k8s.io/api/authentication/v1"
+	"k8s.io/klog/v2"
+)
+
+// The user from a verified client certificate. Set instead of ContextAuthTokenKey.
+const ContextCertUserKey ContextKey = "certUser"
+
+// Enables authentication with client certificates signed by the configured CA bundle.
+// Clients without a certificate continue to authenticate with a token.
+func ConfigureClientCertAuth(tlsConfig *tls.Config) error {
+	if config.Cfg.ClientCAFile == "" {
+		return nil
+	}
+	caBundle, err := os.ReadFile(config.Cfg.ClientCAFile)
+	if err != nil {
+		return fmt.Errorf("error reading the client CA bundle: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caBundle) {
+		return errors.New("the client CA bundle doesn't have any valid certificates")
+	}
+	tlsConfig.ClientCAs = pool
+	tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	klog.Infof("Client certificate authentication is enabled with CA bundle %s.", config.Cfg.ClientCAFile)
+	return nil
+}
+
+// Returns the user from the verified client certificate of the request. Maps the certificate the same
+// way as the Kube API, the common name is the username and the organizations are the groups.
+func certificateUser(r *http.Request) (authv1.UserInfo, bool) {
+	// The chains are only set when the certificate was verified with the client CA bundle.
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return authv1.UserInfo{}, false
+	}
+	subject := r.TLS.VerifiedChains[0][0].Subject
+	if subject.CommonName == "" {
+		return authv1.UserInfo{}, false
+	}
+	return authv1.UserInfo{Username: subject.CommonName, Groups: append([]string{}, subject.Organization...)}, true
+}
+
+// Returns the user set by AuthenticateUser for a request with a client certificate.
+func GetCertUser(ctx context.Context) (authv1.UserInfo, bool) {
+	userInfo, ok := ctx.Value(ContextCertUserKey).(authv1.UserInfo)
+	return userInfo, ok
+}
+
+// Certificates don't have a UID. The username and groups identify the user in the cache.
+func certUserUID(userInfo authv1.UserInfo) string {
+	return fmt.Sprintf("x509:%s/%s", userInfo.Username, strings.Join(userInfo.Groups, ","))
+}
@@ -0,0 +1,135 @@
+// Copyright Contributors to the Open Cluster Management project
+package rbac
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/99designs/gqlgen/graphql/handler/transport"
+	"github.com/stolostron/search-v2-api/pkg/config"
+	"github.com/stretchr/testify/assert"
+	authv1 "k8s.io/api/authentication/v1"
+)
+
+func newTestCertificate(t *testing.T, subject pkix.Name) *x509.Certificate {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               subject,
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal("Error creating the test certificate.", err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return cert
+}
+
+// Request with a client certificate verified by the TLS handshake.
+func newCertRequest(cert *x509.Certificate) *http.Request {
+	r := httptest.NewRequest("POST", "https://localhost:4010/searchapi/graphql", nil)
+	r.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+	return r
+}
+
+func Test_ConfigureClientCertAuth(t *testing.T) {
+	cert := newTestCertificate(t, pkix.Name{CommonName: "test-ca"})
+	caFile := filepath.Join(t.TempDir(), "ca.crt")
+	_ = os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}), 0600)
+	config.Cfg.ClientCAFile = caFile
+	defer func() { config.Cfg.ClientCAFile = "" }()
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	err := ConfigureClientCertAuth(tlsConfig)
+
+	assert.Nil(t, err)
+	assert.Equal(t, tls.VerifyClientCertIfGiven, tlsConfig.ClientAuth)
+	assert.NotNil(t, tlsConfig.ClientCAs)
+}
+
+func Test_ConfigureClientCertAuth_invalidBundle(t *testing.T) {
+	caFile := filepath.Join(t.TempDir(), "ca.crt")
+	_ = os.WriteFile(caFile, []byte("not a certificate"), 0600)
+	config.Cfg.ClientCAFile = caFile
+	defer func() { config.Cfg.ClientCAFile = "" }()
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	err := ConfigureClientCertAuth(tlsConfig)
+
+	assert.NotNil(t, err)
+	assert.Equal(t, tls.NoClientCert, tlsConfig.ClientAuth)
+}
+
+func Test_ConfigureClientCertAuth_disabled(t *testing.T) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	err := ConfigureClientCertAuth(tlsConfig)
+
+	assert.Nil(t, err)
+	assert.Nil(t, tlsConfig.ClientCAs)
+}
+
+func Test_AuthenticateUser_clientCertificate(t *testing.T) {
+	cert := newTestCertificate(t, pkix.Name{CommonName: "automation", Organization: []string{"team-a", "team-b"}})
+	var userInfo authv1.UserInfo
+	var isCertUser bool
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userInfo, isCertUser = GetCertUser(r.Context())
+	})
+	response := httptest.NewRecorder()
+
+	AuthenticateUser(next).ServeHTTP(response, newCertRequest(cert))
+
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.True(t, isCertUser)
+	assert.Equal(t, authv1.UserInfo{Username: "automation", Groups: []string{"team-a", "team-b"}}, userInfo)
+}
+
+func Test_AuthenticateUser_clientCertificateWithoutCommonName(t *testing.T) {
+	cert := newTestCertificate(t, pkix.Name{Organization: []string{"team-a"}})
+	nextCalled := false
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { nextCalled = true })
+	response := httptest.NewRecorder()
+
+	AuthenticateUser(next).ServeHTTP(response, newCertRequest(cert))
+
+	assert.Equal(t, http.StatusUnauthorized, response.Code)
+	assert.False(t, nextCalled)
+}
+
+func Test_GetUserUID_clientCertificate(t *testing.T) {
+	mock_cache := newMockCache()
+	ctx := context.WithValue(context.Background(), ContextCertUserKey,
+		authv1.UserInfo{Username: "automation", Groups: []string{"team-a"}})
+
+	uid, userInfo := mock_cache.GetUserUID(ctx)
+
+	assert.Equal(t, "x509:automation/team-a", uid)
+	assert.Equal(t, "automation", userInfo.Username)
+	assert.Equal(t, "", userInfo.UID, "The UID isn't set, so it isn't used to impersonate the user.")
+}
+
+func Test_AuthenticateWebsocketInit_clientCertificate(t *testing.T) {
+	ctx := context.WithValue(context.Background(), ContextCertUserKey, authv1.UserInfo{Username: "automation"})
+
+	_, err := AuthenticateWebsocketInit(ctx, transport.InitPayload{})
+
+	assert.Nil(t, err)
+}
@@ -0,0 +1,107 @@
+// Copyright Contributors to the Open Cluster Management project
+package rbac
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/stolostron/search-v2-api/pkg/config"
+	authv1 "k8s.io/api/authentication/v1"
+	authz "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	v1 "k8s.io/client-go/kubernetes/typed/authorization/v1"
+	"k8s.io/klog/v2"
+)
+
+// The user impersonated with the Impersonate-User and Impersonate-Group headers.
+// When set, the request uses the UserData of the impersonated user.
+const ContextImpersonatedUserKey ContextKey = "impersonatedUser"
+
+const (
+	impersonateUserHeader  = "Impersonate-User"
+	impersonateGroupHeader = "Impersonate-Group"
+)
+
+// Returns the impersonated user from the request headers. The caller must be allowed to impersonate
+// the user and each group, the same as impersonating with the Kube API.
+// Returns a nil user if the request doesn't use impersonation.
+func (c *Cache) impersonatedUser(ctx context.Context, r *http.Request) (*authv1.UserInfo, int, error) {
+	username := r.Header.Get(impersonateUserHeader)
+	groups := r.Header.Values(impersonateGroupHeader)
+	if username == "" && len(groups) == 0 {
+		return nil, http.StatusOK, nil
+	}
+	if username == "" {
+		return nil, http.StatusBadRequest, fmt.Errorf("the %s header requires the %s header",
+			impersonateGroupHeader, impersonateUserHeader)
+	}
+
+	_, caller := c.GetUserUID(ctx)
+	if caller.Username == "" {
+		return nil, http.StatusForbidden, fmt.Errorf("unable to find the user requesting impersonation")
+	}
+	checks := []authz.ResourceAttributes{{Verb: "impersonate", Resource: "users", Name: username}}
+	for _, group := range groups {
+		checks = append(checks, authz.ResourceAttributes{Verb: "impersonate", Resource: "groups", Name: group})
+	}
+	for _, check := range checks {
+		allowed, err := c.canImpersonate(ctx, caller, check)
+		if err != nil {
+			return nil, http.StatusInternalServerError, err
+		}
+		if !allowed {
+			return nil, http.StatusForbidden, fmt.Errorf("user %s isn't allowed to impersonate %s %s",
+				caller.Username, strings.TrimSuffix(check.Resource, "s"), check.Name)
+		}
+	}
+
+	// Logged at the default verbosity because the audit log is disabled by default.
+	klog.Infof("AUDIT: User [%s] with groups %v is impersonating user [%s] with groups %v. Request: %s %s",
+		caller.Username, caller.Groups, username, groups, r.Method, r.URL.Path)
+	return &authv1.UserInfo{Username: username, Groups: groups}, http.StatusOK, nil
+}
+
+// Checks if the caller can impersonate with a SubjectAccessReview.
+func (c *Cache) canImpersonate(ctx context.Context, caller authv1.UserInfo,
+	check authz.ResourceAttributes) (bool, error) {
+	extra := map[string]authz.ExtraValue{}
+	for key, value := range caller.Extra {
+		extra[key] = authz.ExtraValue(value)
+	}
+	sar := &authz.SubjectAccessReview{
+		Spec: authz.SubjectAccessReviewSpec{
+			User:               caller.Username,
+			UID:                caller.UID,
+			Groups:             caller.Groups,
+			Extra:              extra,
+			ResourceAttributes: &check,
+		},
+	}
+	result, err := c.getAuthzClient().SubjectAccessReviews().Create(ctx, sar, metav1.CreateOptions{})
+	if err != nil {
+		klog.Error("Error creating SubjectAccessReview to check impersonation. ", err)
+		return false, err
+	}
+	return result.Status.Allowed, nil
+}
+
+// Returns the user impersonated by the request.
+func GetImpersonatedUser(ctx context.Context) (authv1.UserInfo, bool) {
+	userInfo, ok := ctx.Value(ContextImpersonatedUserKey).(authv1.UserInfo)
+	return userInfo, ok
+}
+
+// The impersonated user may not have a UID. The username and groups identify the user in the cache.
+func impersonatedUserUID(userInfo authv1.UserInfo) string {
+	return fmt.Sprintf("impersonated:%s/%s", userInfo.Username, strings.Join(userInfo.Groups, ","))
+}
+
+// Utility to allow tests to inject a fake client to mock the k8s api call.
+func (c *Cache) getAuthzClient() v1.AuthorizationV1Interface {
+	if c.authzClient == nil {
+		c.authzClient = config.KubeClient().AuthorizationV1()
+	}
+	return c.authzClient
+}
@@ -0,0 +1,152 @@
+// Copyright Contributors to the Open Cluster Management project
+package rbac
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/99designs/gqlgen/graphql/handler/transport"
+	"github.com/stretchr/testify/assert"
+	authv1 "k8s.io/api/authentication/v1"
+	authz "k8s.io/api/authorization/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	fake "k8s.io/client-go/kubernetes/fake"
+	testingk8s "k8s.io/client-go/testing"
+	"k8s.io/klog/v2"
+)
+
+// Fake client that allows the admin user to impersonate any user, and the groups in allowedGroups.
+func newMockImpersonationClient(allowedGroups ...string) *fake.Clientset {
+	client := fake.NewSimpleClientset()
+	client.PrependReactor("create", "subjectaccessreviews",
+		func(action testingk8s.Action) (bool, runtime.Object, error) {
+			sar := action.(testingk8s.CreateAction).GetObject().(*authz.SubjectAccessReview)
+			allowed := sar.Spec.User == "admin" && sar.Spec.ResourceAttributes.Verb == "impersonate"
+			if sar.Spec.ResourceAttributes.Resource == "groups" {
+				allowed = false
+				for _, group := range allowedGroups {
+					allowed = allowed || group == sar.Spec.ResourceAttributes.Name
+				}
+			}
+			sar.Status.Allowed = allowed
+			return true, sar, nil
+		})
+	return client
+}
+
+// Sets up the token cache with the admin and developer users and the fake authorization client.
+func setupImpersonationCache(allowedGroups ...string) {
+	cacheInst = newMockCache()
+	cacheInst.authzClient = newMockImpersonationClient(allowedGroups...).AuthorizationV1()
+	for token, username := range map[string]string{"admin-token": "admin", "developer-token": "developer"} {
+		cacheInst.tokenReviews.add(tokenHash(token), &tokenReviewCache{
+			meta: cacheMetadata{updatedAt: time.Now()},
+			tokenReview: &authv1.TokenReview{Status: authv1.TokenReviewStatus{
+				Authenticated: true, User: authv1.UserInfo{Username: username, UID: username + "-uid"}}},
+		})
+	}
+}
+
+func newImpersonationRequest(token, user string, groups ...string) *http.Request {
+	r := httptest.NewRequest("POST", "https://localhost:4010/searchapi/graphql", nil)
+	r.Header.Set("Authorization", "Bearer "+token)
+	if user != "" {
+		r.Header.Set("Impersonate-User", user)
+	}
+	for _, group := range groups {
+		r.Header.Add("Impersonate-Group", group)
+	}
+	return r
+}
+
+func Test_AuthenticateUser_impersonation(t *testing.T) {
+	setupImpersonationCache("team-a")
+	var uid string
+	var userInfo authv1.UserInfo
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		uid, userInfo = GetCache().GetUserUID(r.Context())
+	})
+	response := httptest.NewRecorder()
+
+	AuthenticateUser(next).ServeHTTP(response, newImpersonationRequest("admin-token", "alice", "team-a"))
+
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Equal(t, "impersonated:alice/team-a", uid)
+	assert.Equal(t, authv1.UserInfo{Username: "alice", Groups: []string{"team-a"}}, userInfo,
+		"Expected the request to use the impersonated user.")
+}
+
+func Test_AuthenticateUser_impersonationLogged(t *testing.T) {
+	setupImpersonationCache("team-a")
+	var buf bytes.Buffer
+	klog.LogToStderr(false)
+	klog.SetOutput(&buf)
+	defer func() {
+		klog.SetOutput(os.Stderr)
+		klog.LogToStderr(true)
+	}()
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	AuthenticateUser(next).ServeHTTP(httptest.NewRecorder(), newImpersonationRequest("admin-token", "alice", "team-a"))
+	klog.Flush()
+
+	assert.Contains(t, buf.String(), "AUDIT: User [admin] with groups [] is impersonating user [alice] with groups "+
+		"[team-a]. Request: POST /searchapi/graphql", "Expected both users to be logged without the audit log.")
+}
+
+func Test_AuthenticateUser_impersonationDenied(t *testing.T) {
+	setupImpersonationCache("team-a")
+	requests := map[string]*http.Request{
+		"user without permission":  newImpersonationRequest("developer-token", "alice"),
+		"group without permission": newImpersonationRequest("admin-token", "alice", "team-a", "cluster-admins"),
+	}
+	for name, r := range requests {
+		nextCalled := false
+		next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { nextCalled = true })
+		response := httptest.NewRecorder()
+
+		AuthenticateUser(next).ServeHTTP(response, r)
+
+		assert.Equal(t, http.StatusForbidden, response.Code, name)
+		assert.False(t, nextCalled, name)
+	}
+}
+
+func Test_AuthenticateUser_impersonateGroupWithoutUser(t *testing.T) {
+	setupImpersonationCache("team-a")
+	response := httptest.NewRecorder()
+
+	AuthenticateUser(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).
+		ServeHTTP(response, newImpersonationRequest("admin-token", "", "team-a"))
+
+	assert.Equal(t, http.StatusBadRequest, response.Code)
+}
+
+func Test_AuthenticateUser_withoutImpersonation(t *testing.T) {
+	setupImpersonationCache()
+	var impersonated bool
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, impersonated = GetImpersonatedUser(r.Context())
+	})
+	response := httptest.NewRecorder()
+
+	AuthenticateUser(next).ServeHTTP(response, newImpersonationRequest("developer-token", ""))
+
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.False(t, impersonated)
+}
+
+func Test_AuthenticateWebsocketInit_impersonationWithOtherToken(t *testing.T) {
+	setupImpersonationCache()
+	ctx := context.WithValue(context.Background(), ContextAuthTokenKey, "admin-token")
+	ctx = context.WithValue(ctx, ContextImpersonatedUserKey, authv1.UserInfo{Username: "alice"})
+
+	_, err := AuthenticateWebsocketInit(ctx, transport.InitPayload{"authorization": "developer-token"})
+
+	assert.NotNil(t, err, "Expected the impersonation to be rejected with a different token.")
+}
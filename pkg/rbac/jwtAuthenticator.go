@@ -0,0 +1,378 @@
+// Copyright Contributors to the Open Cluster Management project
+package rbac
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	jose "github.com/go-jose/go-jose/v3"
+	"github.com/go-jose/go-jose/v3/jwt"
+	"golang.org/x/sync/singleflight"
+	authv1 "k8s.io/api/authentication/v1"
+	"k8s.io/klog/v2"
+)
+
+// Tolerance for the clock difference with the issuer when validating the exp and nbf claims.
+const jwtClockSkew = 1 * time.Minute
+
+// Min time between requests to reload the JWKS when a token is signed with an unknown key.
+const jwksReloadInterval = 1 * time.Minute
+
+// Configuration of an OIDC issuer. The keys are loaded from one of jwks (static key set), jwksFile or jwksURL.
+// Sample config:
+//
+//	[{"issuer": "https://sso.example.com", "audiences": ["search"], "jwksURL": "https://sso.example.com/certs",
+//	  "usernameClaim": "email", "usernamePrefix": "oidc:", "groupsClaim": "groups", "groupsPrefix": "oidc:"}]
+//
+// The prefixes default to the same as the Kube API: usernames from claims other than email are prefixed
+// with the issuer URL and "#", and groups aren't prefixed. Use "-" as the usernamePrefix to disable it.
+type jwtIssuerConfig struct {
+	Issuer         string          `json:"issuer"`
+	Audiences      []string        `json:"audiences"` // The token must have one of these audiences. Optional.
+	JWKS           json.RawMessage `json:"jwks"`
+	JWKSFile       string          `json:"jwksFile"`
+	JWKSURL        string          `json:"jwksURL"`
+	UsernameClaim  string          `json:"usernameClaim"` // Default: sub
+	UsernamePrefix string          `json:"usernamePrefix"`
+	GroupsClaim    string          `json:"groupsClaim"` // Default: groups
+	GroupsPrefix   string          `json:"groupsPrefix"`
+	UIDClaim       string          `json:"uidClaim"` // Default: sub. Required, the UID identifies the user in the cache.
+}
+
+// An OIDC issuer and its signing keys.
+type jwtIssuer struct {
+	config     jwtIssuerConfig
+	httpClient *http.Client
+
+	keys         *jose.JSONWebKeySet
+	keysErr      error // Error from the last attempt to load the keys.
+	keysLoadedAt time.Time
+	keysLock     sync.Mutex         // Guards the keys. Isn't held while loading the keys.
+	keysGroup    singleflight.Group // Loads the keys once for concurrent requests.
+}
+
+// Validates JWT tokens from the configured issuers locally. Other tokens use the fallback authenticator.
+type jwtAuthenticator struct {
+	issuers  map[string]*jwtIssuer // Key: issuer URL
+	fallback Authenticator
+}
+
+// Load the issuers from a JSON file.
+func loadJWTIssuers(path string) (map[string]*jwtIssuer, error) {
+	data, err := os.ReadFile(path) // #nosec G304 - The path is set by the administrator.
+	if err != nil {
+		return nil, err
+	}
+	configs := []jwtIssuerConfig{}
+	if err := json.Unmarshal(data, &configs); err != nil {
+		return nil, fmt.Errorf("error parsing %s: %w", path, err)
+	}
+	issuers := map[string]*jwtIssuer{}
+	for _, cfg := range configs {
+		issuer, err := newJWTIssuer(cfg)
+		if err != nil {
+			return nil, err
+		}
+		issuers[cfg.Issuer] = issuer
+	}
+	return issuers, nil
+}
+
+func newJWTIssuer(cfg jwtIssuerConfig) (*jwtIssuer, error) {
+	if cfg.Issuer == "" {
+		return nil, errors.New("the OIDC issuer config is missing the issuer")
+	}
+	if len(cfg.JWKS) == 0 && cfg.JWKSFile == "" && cfg.JWKSURL == "" {
+		return nil, fmt.Errorf("the OIDC issuer %s is missing the jwks, jwksFile or jwksURL", cfg.Issuer)
+	}
+	if cfg.UsernameClaim == "" {
+		cfg.UsernameClaim = "sub"
+	}
+	if cfg.GroupsClaim == "" {
+		cfg.GroupsClaim = "groups"
+	}
+	if cfg.UIDClaim == "" {
+		cfg.UIDClaim = "sub"
+	}
+	if cfg.UsernamePrefix == "-" {
+		cfg.UsernamePrefix = ""
+	} else if cfg.UsernamePrefix == "" && cfg.UsernameClaim != "email" {
+		cfg.UsernamePrefix = cfg.Issuer + "#"
+	}
+	issuer := &jwtIssuer{config: cfg, httpClient: &http.Client{Timeout: 10 * time.Second}}
+	// A static key set is loaded once, so configuration errors are found at startup.
+	if len(cfg.JWKS) > 0 {
+		keys, err := parseJWKS(cfg.JWKS)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing the jwks of OIDC issuer %s: %w", cfg.Issuer, err)
+		}
+		issuer.keys = keys
+	}
+	return issuer, nil
+}
+
+func (a *jwtAuthenticator) Authenticate(ctx context.Context, token string) (*authv1.TokenReview, error) {
+	issuerURL, isJWT := jwtIssuerURL(token)
+	issuer, configured := a.issuers[issuerURL]
+	if !isJWT || !configured {
+		// Opaque tokens and tokens from other issuers, like service account tokens.
+		return a.fallback.Authenticate(ctx, token)
+	}
+
+	result := &authv1.TokenReview{}
+	userInfo, err := issuer.validate(token)
+	var keysErr *jwksError
+	if errors.As(err, &keysErr) {
+		return result, err
+	}
+	if err != nil {
+		klog.V(4).Infof("Invalid JWT token from issuer %s. %s", issuerURL, err)
+		result.Status.Error = err.Error()
+		return result, nil
+	}
+	result.Status.Authenticated = true
+	result.Status.User = userInfo
+	result.Status.Audiences = issuer.config.Audiences
+	return result, nil
+}
+
+// Returns the issuer of a JWT token, without validating the token.
+func jwtIssuerURL(token string) (string, bool) {
+	parsed, err := jwt.ParseSigned(token)
+	if err != nil {
+		return "", false
+	}
+	claims := jwt.Claims{}
+	if err := parsed.UnsafeClaimsWithoutVerification(&claims); err != nil {
+		return "", false
+	}
+	return claims.Issuer, true
+}
+
+// An error loading the keys of the issuer. This isn't a problem with the token.
+type jwksError struct {
+	err error
+}
+
+func (e *jwksError) Error() string {
+	return "error loading the JWKS: " + e.err.Error()
+}
+
+// Signing algorithms accepted for the tokens. Symmetric algorithms and none aren't accepted.
+var jwtSigningAlgorithms = map[string]bool{
+	string(jose.RS256): true, string(jose.RS384): true, string(jose.RS512): true,
+	string(jose.PS256): true, string(jose.PS384): true, string(jose.PS512): true,
+	string(jose.ES256): true, string(jose.ES384): true, string(jose.ES512): true,
+}
+
+// Verifies the signature and claims of the token and maps the claims to the user information.
+func (issuer *jwtIssuer) validate(token string) (authv1.UserInfo, error) {
+	parsed, err := jwt.ParseSigned(token)
+	if err != nil {
+		return authv1.UserInfo{}, fmt.Errorf("error parsing the token: %w", err)
+	}
+	if len(parsed.Headers) != 1 {
+		return authv1.UserInfo{}, errors.New("the token must have one signature")
+	}
+	header := parsed.Headers[0]
+	if !jwtSigningAlgorithms[header.Algorithm] {
+		return authv1.UserInfo{}, fmt.Errorf("unsupported algorithm %s", header.Algorithm)
+	}
+	keys, err := issuer.getKeys(header.KeyID)
+	if err != nil {
+		return authv1.UserInfo{}, &jwksError{err: err}
+	}
+
+	claims := jwt.Claims{}
+	extraClaims := map[string]interface{}{}
+	verified := false
+	for _, key := range keys.Keys {
+		if header.KeyID != "" && key.KeyID != header.KeyID {
+			continue
+		}
+		if parsed.Claims(key.Key, &claims, &extraClaims) == nil {
+			verified = true
+			break
+		}
+	}
+	if !verified {
+		return authv1.UserInfo{}, errors.New("the token signature can't be verified with the keys of the issuer")
+	}
+	if err := issuer.validateClaims(claims); err != nil {
+		return authv1.UserInfo{}, err
+	}
+	return issuer.userInfo(extraClaims)
+}
+
+func (issuer *jwtIssuer) validateClaims(claims jwt.Claims) error {
+	if claims.Expiry == nil {
+		return errors.New("the token doesn't have the exp claim")
+	}
+	err := claims.ValidateWithLeeway(jwt.Expected{Issuer: issuer.config.Issuer, Time: time.Now()}, jwtClockSkew)
+	if err != nil {
+		return err
+	}
+	if len(issuer.config.Audiences) == 0 {
+		return nil
+	}
+	for _, audience := range issuer.config.Audiences {
+		if claims.Audience.Contains(audience) {
+			return nil
+		}
+	}
+	return errors.New("the token audience doesn't match the configured audiences")
+}
+
+// Maps the claims to the user information with the configured prefixes. The API impersonates the user to
+// check access, so usernames and groups with the system: prefix are rejected. The UID is prefixed with
+// the issuer, so users from different issuers with the same subject don't share the cached user data.
+func (issuer *jwtIssuer) userInfo(claims map[string]interface{}) (authv1.UserInfo, error) {
+	cfg := issuer.config
+	username, ok := claims[cfg.UsernameClaim].(string)
+	if !ok || username == "" {
+		return authv1.UserInfo{}, fmt.Errorf("the token doesn't have the %s claim", cfg.UsernameClaim)
+	}
+	if cfg.UsernameClaim == "email" {
+		if verified, exists := claims["email_verified"].(bool); exists && !verified {
+			return authv1.UserInfo{}, errors.New("the token email isn't verified")
+		}
+	}
+	uid, ok := claims[cfg.UIDClaim].(string)
+	if !ok || uid == "" {
+		return authv1.UserInfo{}, fmt.Errorf("the token doesn't have the %s claim", cfg.UIDClaim)
+	}
+	userInfo := authv1.UserInfo{Username: cfg.UsernamePrefix + username, UID: fmt.Sprintf("oidc:%s#%s", cfg.Issuer, uid)}
+	if strings.HasPrefix(userInfo.Username, "system:") {
+		return authv1.UserInfo{}, fmt.Errorf("the username %s is reserved", userInfo.Username)
+	}
+	for _, group := range claimStrings(claims[cfg.GroupsClaim]) {
+		group = cfg.GroupsPrefix + group
+		if strings.HasPrefix(group, "system:") {
+			return authv1.UserInfo{}, fmt.Errorf("the group %s is reserved", group)
+		}
+		userInfo.Groups = append(userInfo.Groups, group)
+	}
+	return userInfo, nil
+}
+
+// Claims like groups can be a string or a list of strings.
+func claimStrings(claim interface{}) []string {
+	switch value := claim.(type) {
+	case string:
+		return []string{value}
+	case []interface{}:
+		values := []string{}
+		for _, v := range value {
+			if s, ok := v.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+// Returns the keys of the issuer. The keys from a file or URL are reloaded if the kid isn't found,
+// so keys rotated by the issuer are picked up. Reloads at most once per jwksReloadInterval, so tokens
+// with unknown keys don't send a request to the issuer each time.
+func (issuer *jwtIssuer) getKeys(kid string) (*jose.JSONWebKeySet, error) {
+	issuer.keysLock.Lock()
+	keys, keysErr, keysLoadedAt := issuer.keys, issuer.keysErr, issuer.keysLoadedAt
+	issuer.keysLock.Unlock()
+
+	static := len(issuer.config.JWKS) > 0
+	if static || (keys != nil && (kid == "" || len(keys.Key(kid)) > 0)) {
+		return keys, nil
+	}
+	if time.Since(keysLoadedAt) < jwksReloadInterval {
+		if keys == nil {
+			return nil, keysErr
+		}
+		return keys, nil
+	}
+	result, err, _ := issuer.keysGroup.Do("keys", func() (interface{}, error) {
+		return issuer.loadKeys()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result.(*jose.JSONWebKeySet), nil
+}
+
+// Loads the keys from the file or URL without holding the lock, then replaces the keys.
+func (issuer *jwtIssuer) loadKeys() (*jose.JSONWebKeySet, error) {
+	var data []byte
+	var err error
+	if issuer.config.JWKSFile != "" {
+		data, err = os.ReadFile(issuer.config.JWKSFile)
+	} else {
+		// The keys are shared by the requests waiting for them, so the request isn't canceled with one of them.
+		data, err = issuer.fetchJWKS(context.Background())
+	}
+	var keys *jose.JSONWebKeySet
+	if err == nil {
+		keys, err = parseJWKS(data)
+	}
+
+	issuer.keysLock.Lock()
+	defer issuer.keysLock.Unlock()
+	issuer.keysLoadedAt = time.Now()
+	if err != nil {
+		issuer.keysErr = err
+		return nil, err
+	}
+	klog.V(3).Infof("Loaded %d keys for OIDC issuer %s.", len(keys.Keys), issuer.config.Issuer)
+	issuer.keys, issuer.keysErr = keys, nil
+	return keys, nil
+}
+
+func (issuer *jwtIssuer) fetchJWKS(ctx context.Context) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, issuer.config.JWKSURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := issuer.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d from %s", resp.StatusCode, issuer.config.JWKSURL)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// Parses the public signing keys of the JWKS. Keys that can't be parsed are ignored,
+// so a key with an unsupported type doesn't break the other keys.
+func parseJWKS(data []byte) (*jose.JSONWebKeySet, error) {
+	jwks := struct {
+		Keys []json.RawMessage `json:"keys"`
+	}{}
+	if err := json.Unmarshal(data, &jwks); err != nil {
+		return nil, err
+	}
+	keys := &jose.JSONWebKeySet{}
+	for _, raw := range jwks.Keys {
+		key := jose.JSONWebKey{}
+		if err := key.UnmarshalJSON(raw); err != nil {
+			klog.Warningf("Ignoring a key from the JWKS. %s", err)
+			continue
+		}
+		if (key.Use != "" && key.Use != "sig") || !key.Valid() || !key.IsPublic() {
+			continue
+		}
+		keys.Keys = append(keys.Keys, key)
+	}
+	if len(keys.Keys) == 0 {
+		return nil, errors.New("the JWKS doesn't have any signing keys")
+	}
+	return keys, nil
+}
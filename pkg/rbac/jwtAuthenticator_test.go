@@ -0,0 +1,352 @@
+// Copyright Contributors to the Open Cluster Management project
+package rbac
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stolostron/search-v2-api/pkg/config"
+	"github.com/stretchr/testify/assert"
+	authv1 "k8s.io/api/authentication/v1"
+)
+
+const testIssuer = "https://sso.example.com"
+
+var testRSAKey, _ = rsa.GenerateKey(rand.Reader, 2048)
+var testECKey, _ = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+func b64(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// Static JWKS with the test keys.
+func testJWKS() json.RawMessage {
+	jwks := fmt.Sprintf(`{"keys": [
+		{"kty": "RSA", "kid": "rsa-key", "use": "sig", "n": "%s", "e": "%s"},
+		{"kty": "EC", "kid": "ec-key", "crv": "P-256", "x": "%s", "y": "%s"}]}`,
+		b64(testRSAKey.N.Bytes()), b64(big.NewInt(int64(testRSAKey.E)).Bytes()),
+		b64(testECKey.X.FillBytes(make([]byte, 32))), b64(testECKey.Y.FillBytes(make([]byte, 32))))
+	return json.RawMessage(jwks)
+}
+
+// Builds a token signed with the test keys.
+func newTestJWT(t *testing.T, alg, kid string, claims map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := b64(header) + "." + b64(payload)
+	digest := sha256.Sum256([]byte(signed))
+
+	var signature []byte
+	var err error
+	switch alg {
+	case "RS256":
+		signature, err = rsa.SignPKCS1v15(rand.Reader, testRSAKey, crypto.SHA256, digest[:])
+	case "ES256":
+		r, s, signErr := ecdsa.Sign(rand.Reader, testECKey, digest[:])
+		signature, err = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...), signErr
+	}
+	if err != nil {
+		t.Fatal("Error signing the test token.", err)
+	}
+	return signed + "." + b64(signature)
+}
+
+func validClaims() map[string]interface{} {
+	return map[string]interface{}{
+		"iss":    testIssuer,
+		"sub":    "user-id-1",
+		"aud":    "search",
+		"email":  "alice@example.com",
+		"groups": []string{"team-a", "team-b"},
+		"exp":    time.Now().Add(time.Hour).Unix(),
+	}
+}
+
+// Authenticator that records the tokens sent to the TokenReview.
+type mockFallbackAuthenticator struct {
+	tokens []string
+}
+
+func (m *mockFallbackAuthenticator) Authenticate(ctx context.Context, token string) (*authv1.TokenReview, error) {
+	m.tokens = append(m.tokens, token)
+	return &authv1.TokenReview{Status: authv1.TokenReviewStatus{Authenticated: true}}, nil
+}
+
+func newMockJWTAuthenticator(t *testing.T, cfg jwtIssuerConfig) (*jwtAuthenticator, *mockFallbackAuthenticator) {
+	issuer, err := newJWTIssuer(cfg)
+	if err != nil {
+		t.Fatal("Error creating the test issuer.", err)
+	}
+	fallback := &mockFallbackAuthenticator{}
+	return &jwtAuthenticator{issuers: map[string]*jwtIssuer{cfg.Issuer: issuer}, fallback: fallback}, fallback
+}
+
+func Test_jwtAuthenticator_validToken(t *testing.T) {
+	authenticator, fallback := newMockJWTAuthenticator(t, jwtIssuerConfig{
+		Issuer: testIssuer, Audiences: []string{"search"}, JWKS: testJWKS(),
+		UsernameClaim: "email", UsernamePrefix: "oidc:", GroupsPrefix: "oidc:",
+	})
+
+	for _, alg := range []string{"RS256", "ES256"} {
+		kid := map[string]string{"RS256": "rsa-key", "ES256": "ec-key"}[alg]
+		result, err := authenticator.Authenticate(context.TODO(), newTestJWT(t, alg, kid, validClaims()))
+
+		assert.Nil(t, err)
+		assert.True(t, result.Status.Authenticated, "Expected %s token to be valid.", alg)
+		assert.Equal(t, authv1.UserInfo{Username: "oidc:alice@example.com", UID: "oidc:https://sso.example.com#user-id-1",
+			Groups: []string{"oidc:team-a", "oidc:team-b"}}, result.Status.User)
+	}
+	assert.Empty(t, fallback.tokens, "Expected the tokens to be validated locally.")
+}
+
+func Test_jwtAuthenticator_invalidTokens(t *testing.T) {
+	authenticator, _ := newMockJWTAuthenticator(t, jwtIssuerConfig{
+		Issuer: testIssuer, Audiences: []string{"search"}, JWKS: testJWKS(),
+	})
+	expired := validClaims()
+	expired["exp"] = time.Now().Add(-time.Hour).Unix()
+	otherAudience := validClaims()
+	otherAudience["aud"] = []string{"console"}
+	noExp := validClaims()
+	delete(noExp, "exp")
+	noSub := validClaims()
+	delete(noSub, "sub")
+	// Replace the claims of a valid token.
+	validToken := strings.Split(newTestJWT(t, "RS256", "rsa-key", validClaims()), ".")
+	otherClaims, _ := json.Marshal(otherAudience)
+	modified := validToken[0] + "." + b64(otherClaims) + "." + validToken[2]
+
+	tokens := map[string]string{
+		"expired":         newTestJWT(t, "RS256", "rsa-key", expired),
+		"other audience":  newTestJWT(t, "RS256", "rsa-key", otherAudience),
+		"no exp":          newTestJWT(t, "RS256", "rsa-key", noExp),
+		"no uid":          newTestJWT(t, "RS256", "rsa-key", noSub),
+		"modified claims": modified,
+		"unknown kid":     newTestJWT(t, "RS256", "other-key", validClaims()),
+		"wrong algorithm": newTestJWT(t, "ES256", "rsa-key", validClaims()),
+		"alg none":        b64([]byte(`{"alg":"none"}`)) + "." + validToken[1] + ".",
+	}
+	for name, token := range tokens {
+		result, err := authenticator.Authenticate(context.TODO(), token)
+
+		assert.Nil(t, err, name)
+		assert.False(t, result.Status.Authenticated, "Expected token with %s to be invalid.", name)
+		assert.NotEmpty(t, result.Status.Error, name)
+	}
+}
+
+func Test_jwtAuthenticator_fallback(t *testing.T) {
+	authenticator, fallback := newMockJWTAuthenticator(t, jwtIssuerConfig{Issuer: testIssuer, JWKS: testJWKS()})
+	otherIssuer := validClaims()
+	otherIssuer["iss"] = "kubernetes/serviceaccount"
+	serviceAccountToken := newTestJWT(t, "RS256", "rsa-key", otherIssuer)
+
+	for _, token := range []string{"sha256~opaque-token", serviceAccountToken} {
+		result, err := authenticator.Authenticate(context.TODO(), token)
+
+		assert.Nil(t, err)
+		assert.True(t, result.Status.Authenticated)
+	}
+	assert.Equal(t, []string{"sha256~opaque-token", serviceAccountToken}, fallback.tokens,
+		"Expected the tokens from other issuers to use the TokenReview.")
+}
+
+func Test_jwtAuthenticator_jwksURL(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		_, _ = w.Write(testJWKS())
+	}))
+	defer server.Close()
+	authenticator, _ := newMockJWTAuthenticator(t, jwtIssuerConfig{Issuer: testIssuer, JWKSURL: server.URL})
+
+	for i := 0; i < 2; i++ {
+		result, err := authenticator.Authenticate(context.TODO(), newTestJWT(t, "RS256", "rsa-key", validClaims()))
+		assert.Nil(t, err)
+		assert.True(t, result.Status.Authenticated)
+	}
+	// Unknown keys don't reload the JWKS more than once per interval.
+	_, _ = authenticator.Authenticate(context.TODO(), newTestJWT(t, "RS256", "other-key", validClaims()))
+
+	assert.Equal(t, 1, requests, "Expected the JWKS to be loaded once.")
+}
+
+func Test_jwtAuthenticator_jwksUnavailable(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+	authenticator, _ := newMockJWTAuthenticator(t, jwtIssuerConfig{Issuer: testIssuer, JWKSURL: server.URL})
+
+	_, err := authenticator.Authenticate(context.TODO(), newTestJWT(t, "RS256", "rsa-key", validClaims()))
+
+	assert.NotNil(t, err, "Expected an error when the keys can't be loaded.")
+}
+
+func Test_newAuthenticator_oidcConfig(t *testing.T) {
+	dir := t.TempDir()
+	jwksFile := filepath.Join(dir, "jwks.json")
+	configFile := filepath.Join(dir, "issuers.json")
+	_ = os.WriteFile(jwksFile, testJWKS(), 0600)
+	_ = os.WriteFile(configFile, []byte(fmt.Sprintf(`[{"issuer": "%s", "jwksFile": "%s"}]`, testIssuer, jwksFile)), 0600)
+	config.Cfg.OIDCIssuersConfig = configFile
+	defer func() { config.Cfg.OIDCIssuersConfig = "" }()
+
+	authenticator := newAuthenticator(nil)
+
+	jwtAuth, ok := authenticator.(*jwtAuthenticator)
+	assert.True(t, ok, "Expected the JWT authenticator.")
+	result, err := jwtAuth.Authenticate(context.TODO(), newTestJWT(t, "RS256", "rsa-key", validClaims()))
+	assert.Nil(t, err)
+	assert.True(t, result.Status.Authenticated)
+	assert.Equal(t, "https://sso.example.com#user-id-1", result.Status.User.Username)
+}
+
+func Test_newAuthenticator_default(t *testing.T) {
+	authenticator := newAuthenticator(nil)
+
+	_, ok := authenticator.(*tokenReviewAuthenticator)
+	assert.True(t, ok, "Expected the TokenReview authenticator.")
+}
+
+// The UserInfo from a JWT token is used to get the user data, like the UserInfo from a TokenReview.
+func Test_GetTokenReview_jwtAuthenticator(t *testing.T) {
+	authenticator, _ := newMockJWTAuthenticator(t, jwtIssuerConfig{Issuer: testIssuer, JWKS: testJWKS()})
+	mock_cache := Cache{tokenReviews: newTokenReviewsCache(), authenticator: authenticator}
+	token := newTestJWT(t, "ES256", "ec-key", validClaims())
+
+	uid, userInfo := mock_cache.GetUserUID(context.WithValue(context.Background(), ContextAuthTokenKey, token))
+
+	assert.Equal(t, "oidc:https://sso.example.com#user-id-1", uid)
+	assert.Equal(t, []string{"team-a", "team-b"}, userInfo.Groups)
+}
+
+// Users from different issuers with the same subject must not share the cached user data.
+func Test_jwtAuthenticator_sameSubjectOtherIssuer(t *testing.T) {
+	const otherIssuer = "https://other-sso.example.com"
+	authenticator, _ := newMockJWTAuthenticator(t, jwtIssuerConfig{Issuer: testIssuer, JWKS: testJWKS()})
+	other, err := newJWTIssuer(jwtIssuerConfig{Issuer: otherIssuer, JWKS: testJWKS()})
+	assert.Nil(t, err)
+	authenticator.issuers[otherIssuer] = other
+	otherClaims := validClaims()
+	otherClaims["iss"] = otherIssuer
+
+	result, err := authenticator.Authenticate(context.TODO(), newTestJWT(t, "RS256", "rsa-key", validClaims()))
+	assert.Nil(t, err)
+	otherResult, err := authenticator.Authenticate(context.TODO(), newTestJWT(t, "RS256", "rsa-key", otherClaims))
+	assert.Nil(t, err)
+
+	assert.True(t, result.Status.Authenticated)
+	assert.True(t, otherResult.Status.Authenticated)
+	assert.Equal(t, "https://sso.example.com#user-id-1", result.Status.User.Username)
+	assert.Equal(t, "https://other-sso.example.com#user-id-1", otherResult.Status.User.Username)
+	assert.NotEqual(t, result.Status.User.UID, otherResult.Status.User.UID)
+	assert.Equal(t, "oidc:https://other-sso.example.com#user-id-1", otherResult.Status.User.UID)
+}
+
+// The username prefix defaults to the issuer, except for the email claim, like the Kube API.
+func Test_jwtAuthenticator_usernamePrefix(t *testing.T) {
+	prefixes := map[string]jwtIssuerConfig{
+		"alice@example.com": {Issuer: testIssuer, JWKS: testJWKS(), UsernameClaim: "email"},
+		"user-id-1":         {Issuer: testIssuer, JWKS: testJWKS(), UsernamePrefix: "-"},
+		"oidc:user-id-1":    {Issuer: testIssuer, JWKS: testJWKS(), UsernamePrefix: "oidc:"},
+	}
+	for expected, cfg := range prefixes {
+		authenticator, _ := newMockJWTAuthenticator(t, cfg)
+
+		result, err := authenticator.Authenticate(context.TODO(), newTestJWT(t, "RS256", "rsa-key", validClaims()))
+
+		assert.Nil(t, err)
+		assert.Equal(t, expected, result.Status.User.Username)
+	}
+}
+
+// The API impersonates the user, so a token must not be able to claim a system user or group.
+func Test_jwtAuthenticator_reservedNames(t *testing.T) {
+	authenticator, _ := newMockJWTAuthenticator(t, jwtIssuerConfig{Issuer: testIssuer, JWKS: testJWKS(),
+		UsernamePrefix: "-"})
+	systemUser := validClaims()
+	systemUser["sub"] = "system:serviceaccount:kube-system:admin"
+	systemGroup := validClaims()
+	systemGroup["groups"] = []string{"team-a", "system:masters"}
+
+	for name, claims := range map[string]map[string]interface{}{"user": systemUser, "group": systemGroup} {
+		result, err := authenticator.Authenticate(context.TODO(), newTestJWT(t, "RS256", "rsa-key", claims))
+
+		assert.Nil(t, err, name)
+		assert.False(t, result.Status.Authenticated, "Expected the token with a system %s to be invalid.", name)
+	}
+
+	prefixed, _ := newMockJWTAuthenticator(t, jwtIssuerConfig{Issuer: testIssuer, JWKS: testJWKS(), GroupsPrefix: "oidc:"})
+	result, err := prefixed.Authenticate(context.TODO(), newTestJWT(t, "RS256", "rsa-key", systemGroup))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"oidc:team-a", "oidc:system:masters"}, result.Status.User.Groups)
+}
+
+// Loading the keys of an issuer doesn't block the authentication of other tokens, and concurrent
+// requests load the keys once.
+func Test_GetTokenReview_jwksLoadNotBlocking(t *testing.T) {
+	const urlIssuer = "https://slow-sso.example.com"
+	requests := int32(0)
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		<-release
+		_, _ = w.Write(testJWKS())
+	}))
+	defer server.Close()
+	authenticator, _ := newMockJWTAuthenticator(t, jwtIssuerConfig{Issuer: testIssuer, JWKS: testJWKS()})
+	slow, err := newJWTIssuer(jwtIssuerConfig{Issuer: urlIssuer, JWKSURL: server.URL})
+	assert.Nil(t, err)
+	authenticator.issuers[urlIssuer] = slow
+	mock_cache := Cache{tokenReviews: newTokenReviewsCache(), authenticator: authenticator}
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			slowClaims := validClaims()
+			slowClaims["iss"], slowClaims["sub"] = urlIssuer, fmt.Sprintf("user-%d", i)
+			result, err := mock_cache.GetTokenReview(context.TODO(), newTestJWT(t, "RS256", "rsa-key", slowClaims))
+			assert.Nil(t, err)
+			assert.True(t, result.Status.Authenticated)
+		}(i)
+	}
+	assert.Eventually(t, func() bool { return atomic.LoadInt32(&requests) == 1 }, time.Second, 10*time.Millisecond)
+
+	done := make(chan struct{})
+	go func() {
+		result, err := mock_cache.GetTokenReview(context.TODO(), newTestJWT(t, "RS256", "rsa-key", validClaims()))
+		assert.Nil(t, err)
+		assert.True(t, result.Status.Authenticated)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Error("Expected the token from another issuer to be authenticated while the keys are loading.")
+	}
+	close(release)
+	wg.Wait()
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&requests), "Expected the keys to be loaded once.")
+}
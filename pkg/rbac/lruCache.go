@@ -0,0 +1,189 @@
+// Copyright Contributors to the Open Cluster Management project
+package rbac
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	"github.com/stolostron/search-v2-api/pkg/config"
+	"github.com/stolostron/search-v2-api/pkg/metrics"
+	"k8s.io/klog/v2"
+)
+
+// A cache with a max number of entries. When full, the least recently used entry is evicted.
+// Entries not used within the TTL are evicted by the janitor.
+// The cache isn't safe for concurrent use, the caller must hold the lock that protects it.
+type lruCache[V any] struct {
+	name    string // Used to label the metrics.
+	maxSize int
+	ttl     time.Duration
+	entries map[string]*list.Element
+	order   *list.List // Front is the most recently used.
+}
+
+type lruEntry[V any] struct {
+	key    string
+	value  V
+	usedAt time.Time
+}
+
+func newLRUCache[V any](name string, maxSize int, ttl time.Duration) *lruCache[V] {
+	return &lruCache[V]{
+		name:    name,
+		maxSize: maxSize,
+		ttl:     ttl,
+		entries: map[string]*list.Element{},
+		order:   list.New(),
+	}
+}
+
+// Cache of TokenReviews. Key: hash of the token.
+func newTokenReviewsCache() *lruCache[*tokenReviewCache] {
+	return newLRUCache[*tokenReviewCache]("tokenReviews", config.Cfg.AuthCacheMaxSize,
+		time.Duration(config.Cfg.AuthCacheTTL)*time.Millisecond)
+}
+
+// Cache of user data. Key: UID of the user.
+func newUsersCache() *lruCache[*UserDataCache] {
+	return newLRUCache[*UserDataCache]("users", config.Cfg.UserCacheMaxSize,
+		time.Duration(config.Cfg.UserCacheTTL)*time.Millisecond)
+}
+
+// The token cache is keyed by a hash, so the tokens aren't kept in memory.
+func tokenHash(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
+
+// Returns the value and marks it as recently used.
+func (l *lruCache[V]) get(key string) (V, bool) {
+	var value V
+	if l == nil {
+		return value, false
+	}
+	element, exists := l.entries[key]
+	if !exists {
+		return value, false
+	}
+	entry := element.Value.(*lruEntry[V])
+	entry.usedAt = time.Now()
+	l.order.MoveToFront(element)
+	return entry.value, true
+}
+
+// Adds or replaces the value. Evicts the least recently used entry if the cache is full.
+func (l *lruCache[V]) add(key string, value V) {
+	if element, exists := l.entries[key]; exists {
+		entry := element.Value.(*lruEntry[V])
+		entry.value, entry.usedAt = value, time.Now()
+		l.order.MoveToFront(element)
+		return
+	}
+	l.entries[key] = l.order.PushFront(&lruEntry[V]{key: key, value: value, usedAt: time.Now()})
+	for l.maxSize > 0 && l.order.Len() > l.maxSize {
+		l.removeElement(l.order.Back())
+		metrics.CacheEvictions.WithLabelValues(l.name, "capacity").Inc()
+	}
+	metrics.CacheSize.WithLabelValues(l.name).Set(float64(l.order.Len()))
+}
+
+func (l *lruCache[V]) remove(key string) {
+	if l == nil {
+		return
+	}
+	if element, exists := l.entries[key]; exists {
+		l.removeElement(element)
+		metrics.CacheSize.WithLabelValues(l.name).Set(float64(l.order.Len()))
+	}
+}
+
+func (l *lruCache[V]) removeElement(element *list.Element) {
+	l.order.Remove(element)
+	delete(l.entries, element.Value.(*lruEntry[V]).key)
+}
+
+// Removes all the entries.
+func (l *lruCache[V]) purge() {
+	if l == nil {
+		return
+	}
+	l.entries = map[string]*list.Element{}
+	l.order.Init()
+	metrics.CacheSize.WithLabelValues(l.name).Set(0)
+}
+
+// Removes the entries not used within the TTL. Returns the number of entries removed.
+func (l *lruCache[V]) removeExpired() int {
+	if l == nil || l.ttl <= 0 {
+		return 0
+	}
+	removed := 0
+	// Entries are ordered by use, so stop at the first entry that hasn't expired.
+	for element := l.order.Back(); element != nil; element = l.order.Back() {
+		if time.Since(element.Value.(*lruEntry[V]).usedAt) <= l.ttl {
+			break
+		}
+		l.removeElement(element)
+		removed++
+	}
+	if removed > 0 {
+		metrics.CacheEvictions.WithLabelValues(l.name, "expired").Add(float64(removed))
+		metrics.CacheSize.WithLabelValues(l.name).Set(float64(l.order.Len()))
+	}
+	return removed
+}
+
+func (l *lruCache[V]) len() int {
+	if l == nil {
+		return 0
+	}
+	return l.order.Len()
+}
+
+// Calls the function for each entry, without changing the order of use.
+// The function must not add or remove entries.
+func (l *lruCache[V]) each(f func(key string, value V)) {
+	if l == nil {
+		return
+	}
+	for element := l.order.Front(); element != nil; element = element.Next() {
+		entry := element.Value.(*lruEntry[V])
+		f(entry.key, entry.value)
+	}
+}
+
+// Periodically evicts the expired TokenReviews and user data.
+func (c *Cache) StartCacheJanitor(ctx context.Context) {
+	interval := time.Duration(config.Cfg.CacheJanitorInterval) * time.Millisecond
+	if interval <= 0 {
+		klog.Warning("The cache janitor is disabled. Expired entries are only evicted when the cache is full.")
+		return
+	}
+	klog.Info("Starting cache janitor.")
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			klog.V(2).Info("Stopped cache janitor.")
+			return
+		case <-ticker.C:
+			c.evictExpired()
+		}
+	}
+}
+
+func (c *Cache) evictExpired() {
+	c.tokenReviewsLock.Lock()
+	tokens := c.tokenReviews.removeExpired()
+	c.tokenReviewsLock.Unlock()
+
+	c.usersLock.Lock()
+	users := c.users.removeExpired()
+	c.usersLock.Unlock()
+
+	klog.V(5).Infof("Cache janitor evicted %d TokenReviews and %d users.", tokens, users)
+}
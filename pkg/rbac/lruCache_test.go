@@ -0,0 +1,109 @@
+// Copyright Contributors to the Open Cluster Management project
+package rbac
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Initialize the users cache with the given entries.
+func newMockUsersCache(users map[string]*UserDataCache) *lruCache[*UserDataCache] {
+	cache := newUsersCache()
+	for uid, user := range users {
+		cache.add(uid, user)
+	}
+	return cache
+}
+
+// Initialize the TokenReviews cache with the given entries. Key: token
+func newMockTokenReviewsCache(tokenReviews map[string]*tokenReviewCache) *lruCache[*tokenReviewCache] {
+	cache := newTokenReviewsCache()
+	for token, tokenReview := range tokenReviews {
+		cache.add(tokenHash(token), tokenReview)
+	}
+	return cache
+}
+
+// Returns the cached value, or the zero value if it isn't cached.
+func (l *lruCache[V]) value(key string) V {
+	value, _ := l.get(key)
+	return value
+}
+
+func Test_lruCache_evictsLeastRecentlyUsed(t *testing.T) {
+	cache := newLRUCache[string]("test", 2, time.Minute)
+	cache.add("a", "1")
+	cache.add("b", "2")
+	cache.get("a") // Now b is the least recently used.
+
+	cache.add("c", "3")
+
+	_, aExists := cache.get("a")
+	_, bExists := cache.get("b")
+	_, cExists := cache.get("c")
+	assert.True(t, aExists)
+	assert.False(t, bExists, "Expected the least recently used entry to be evicted.")
+	assert.True(t, cExists)
+	assert.Equal(t, 2, cache.len())
+}
+
+func Test_lruCache_replace(t *testing.T) {
+	cache := newLRUCache[string]("test", 2, time.Minute)
+	cache.add("a", "1")
+	cache.add("a", "2")
+
+	value, _ := cache.get("a")
+	assert.Equal(t, "2", value)
+	assert.Equal(t, 1, cache.len())
+}
+
+func Test_lruCache_removeExpired(t *testing.T) {
+	cache := newLRUCache[string]("test", 10, time.Minute)
+	cache.add("expired", "1")
+	cache.add("active", "2")
+	cache.entries["expired"].Value.(*lruEntry[string]).usedAt = time.Now().Add(-2 * time.Minute)
+
+	removed := cache.removeExpired()
+
+	assert.Equal(t, 1, removed)
+	_, exists := cache.get("expired")
+	assert.False(t, exists)
+	_, exists = cache.get("active")
+	assert.True(t, exists)
+}
+
+func Test_lruCache_nilCache(t *testing.T) {
+	var cache *lruCache[string]
+
+	_, exists := cache.get("a")
+	cache.remove("a")
+	cache.each(func(string, string) { t.Error("Expected no entries.") })
+
+	assert.False(t, exists)
+	assert.Equal(t, 0, cache.len())
+	assert.Equal(t, 0, cache.removeExpired())
+}
+
+func Test_tokenHash(t *testing.T) {
+	hash := tokenHash("1234567890")
+
+	assert.NotContains(t, hash, "1234567890")
+	assert.Equal(t, 64, len(hash))
+	assert.Equal(t, hash, tokenHash("1234567890"))
+}
+
+func Test_evictExpired(t *testing.T) {
+	mock_cache := Cache{
+		tokenReviews: newMockTokenReviewsCache(map[string]*tokenReviewCache{"token": {}}),
+		users:        newMockUsersCache(map[string]*UserDataCache{"uid": {}}),
+	}
+	mock_cache.tokenReviews.entries[tokenHash("token")].Value.(*lruEntry[*tokenReviewCache]).usedAt = time.Time{}
+	mock_cache.users.entries["uid"].Value.(*lruEntry[*UserDataCache]).usedAt = time.Time{}
+
+	mock_cache.evictExpired()
+
+	assert.Equal(t, 0, mock_cache.tokenReviews.len())
+	assert.Equal(t, 0, mock_cache.users.len())
+}
@@ -0,0 +1,415 @@
+// Copyright Contributors to the Open Cluster Management project
+package rbac
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/stolostron/search-v2-api/pkg/config"
+	authv1 "k8s.io/api/authentication/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/klog/v2"
+)
+
+// Namespaced resources the user is authorized to list on each managed cluster.
+// Key: cluster name, then namespace. The namespace * matches all namespaces of the cluster.
+type ManagedClusterResources map[string]map[string][]Resource
+
+// Provides fine-grained permissions for resources on managed clusters. Returns the permissions of the user
+// and the managed clusters covered by the provider, which are the clusters in any of its rules. On the covered
+// clusters, the user only has the permissions from the provider, so these clusters are removed from the
+// managed clusters where the user has view access (UserData.ManagedClusters).
+type ManagedClusterPermissionProvider interface {
+	GetPermissions(ctx context.Context, userInfo authv1.UserInfo) (ManagedClusterResources, map[string]struct{}, error)
+}
+
+var configMapGvr = schema.GroupVersionResource{
+	Group:    "",
+	Version:  "v1",
+	Resource: "configmaps",
+}
+var clusterPermissionGvr = schema.GroupVersionResource{
+	Group:    "rbac.open-cluster-management.io",
+	Version:  "v1alpha1",
+	Resource: "clusterpermissions",
+}
+
+// Returns the provider selected with the MANAGED_CLUSTER_PERMISSION_PROVIDER env. Returns nil when
+// fine-grained permissions aren't enabled.
+func newManagedClusterPermissionProvider(dynamicClient dynamic.Interface) ManagedClusterPermissionProvider {
+	switch config.Cfg.ManagedClusterPermissionProvider {
+	case "":
+		return nil
+	case "configmap":
+		return &configMapPermissionProvider{
+			dynamicClient: dynamicClient,
+			namespace:     config.Cfg.PodNamespace,
+			name:          config.Cfg.ManagedClusterPermissionConfigMap,
+		}
+	case "clusterpermission":
+		return &clusterPermissionProvider{dynamicClient: dynamicClient}
+	default:
+		klog.Warningf("Unknown managed cluster permission provider [%s]. Fine-grained permissions are disabled.",
+			config.Cfg.ManagedClusterPermissionProvider)
+		return nil
+	}
+}
+
+// A rule in the policy ConfigMap. Grants the users and groups access to list the resources
+// in the namespaces of the clusters.
+type permissionPolicyRule struct {
+	Users      []string   `json:"users"`
+	Groups     []string   `json:"groups"`
+	Clusters   []string   `json:"clusters"`
+	Namespaces []string   `json:"namespaces"`
+	Resources  []Resource `json:"resources"`
+}
+
+// Reads the permissions from the policy key of a ConfigMap. Sample policy:
+//
+//	[{"groups": ["team-a"], "clusters": ["managed1"], "namespaces": ["app-a"],
+//	  "resources": [{"Apigroup": "apps", "Kind": "deployments"}]}]
+//
+// The policy is cached for all users using the shared cache TTL.
+type configMapPermissionProvider struct {
+	dynamicClient dynamic.Interface
+	namespace     string
+	name          string
+	rules         []permissionPolicyRule
+	cache         cacheMetadata
+}
+
+func (p *configMapPermissionProvider) GetPermissions(ctx context.Context,
+	userInfo authv1.UserInfo) (ManagedClusterResources, map[string]struct{}, error) {
+	rules, err := p.getRules(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	permissions := ManagedClusterResources{}
+	clusters := map[string]struct{}{}
+	for _, rule := range rules {
+		for _, cluster := range rule.Clusters {
+			clusters[cluster] = struct{}{}
+		}
+		if !matchesSubject(userInfo, rule.Users, rule.Groups) {
+			continue
+		}
+		for _, cluster := range rule.Clusters {
+			for _, namespace := range rule.Namespaces {
+				permissions.add(cluster, namespace, rule.Resources...)
+			}
+		}
+	}
+	return permissions.sorted(), clusters, nil
+}
+
+// Returns the rules of the policy. Uses the cached rules if valid.
+func (p *configMapPermissionProvider) getRules(ctx context.Context) ([]permissionPolicyRule, error) {
+	p.cache.lock.Lock()
+	defer p.cache.lock.Unlock()
+	if p.cache.isValid() {
+		return p.rules, p.cache.err
+	}
+	p.rules, p.cache.err = p.loadRules(ctx)
+	p.cache.updatedAt = time.Now()
+	return p.rules, p.cache.err
+}
+
+func (p *configMapPermissionProvider) loadRules(ctx context.Context) ([]permissionPolicyRule, error) {
+	configMap, err := p.dynamicClient.Resource(configMapGvr).Namespace(p.namespace).Get(ctx, p.name, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("error getting the managed cluster permissions ConfigMap %s/%s: %w", p.namespace, p.name, err)
+	}
+	policy, _, err := unstructured.NestedString(configMap.Object, "data", "policy")
+	if err != nil || policy == "" {
+		return nil, fmt.Errorf("the managed cluster permissions ConfigMap %s/%s doesn't have a policy", p.namespace, p.name)
+	}
+	rules := []permissionPolicyRule{}
+	if err = json.Unmarshal([]byte(policy), &rules); err != nil {
+		return nil, fmt.Errorf("error parsing the managed cluster permissions policy: %w", err)
+	}
+	return rules, nil
+}
+
+// The fields of the ClusterPermission spec used to find the permissions.
+type clusterPermissionSpec struct {
+	ClusterRole *struct {
+		Rules []rbacv1.PolicyRule `json:"rules"`
+	} `json:"clusterRole"`
+	ClusterRoleBinding *struct {
+		RoleRef *clusterPermissionRoleRef `json:"roleRef"` // Optional. Default: the ClusterRole.
+		Subject rbacv1.Subject            `json:"subject"`
+	} `json:"clusterRoleBinding"`
+	Roles []struct {
+		Namespace string              `json:"namespace"`
+		Rules     []rbacv1.PolicyRule `json:"rules"`
+	} `json:"roles"`
+	RoleBindings []struct {
+		Namespace string                   `json:"namespace"`
+		RoleRef   clusterPermissionRoleRef `json:"roleRef"`
+		Subject   rbacv1.Subject           `json:"subject"`
+	} `json:"roleBindings"`
+}
+
+// The role of a binding, a Role or ClusterRole. The ClusterPermission creates its roles on the managed cluster
+// with the name of the ClusterPermission, so the name is empty or the name of the ClusterPermission. Other names
+// are roles that already exist on the managed cluster, and their rules aren't known on the hub.
+type clusterPermissionRoleRef struct {
+	Kind string `json:"kind"`
+	Name string `json:"name"`
+}
+
+// A ClusterPermission and the managed cluster where it applies.
+type clusterPermission struct {
+	cluster string
+	name    string
+	spec    clusterPermissionSpec
+}
+
+// Reads the permissions from the ClusterPermission resources on the hub. A ClusterPermission
+// is created in the namespace of the managed cluster, so the namespace is the cluster name.
+// The list is cached for all users using the shared cache TTL.
+type clusterPermissionProvider struct {
+	dynamicClient      dynamic.Interface
+	clusterPermissions []clusterPermission
+	cache              cacheMetadata
+}
+
+func (p *clusterPermissionProvider) GetPermissions(ctx context.Context,
+	userInfo authv1.UserInfo) (ManagedClusterResources, map[string]struct{}, error) {
+	clusterPermissions, err := p.getClusterPermissions(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	permissions := ManagedClusterResources{}
+	clusters := map[string]struct{}{}
+	for _, item := range clusterPermissions {
+		cluster, spec := item.cluster, item.spec
+		clusters[cluster] = struct{}{}
+		if spec.ClusterRoleBinding != nil && matchesRbacSubject(userInfo, spec.ClusterRoleBinding.Subject) {
+			roleRef := clusterPermissionRoleRef{Kind: "ClusterRole"}
+			if spec.ClusterRoleBinding.RoleRef != nil {
+				roleRef = *spec.ClusterRoleBinding.RoleRef
+			}
+			if roleRef.Kind == "ClusterRole" {
+				permissions.add(cluster, "*", listResources(item.boundRules(roleRef, ""))...)
+			}
+		}
+		for _, binding := range spec.RoleBindings {
+			if !matchesRbacSubject(userInfo, binding.Subject) {
+				continue
+			}
+			// A RoleBinding to the ClusterRole grants the rules only in the namespace of the binding.
+			permissions.add(cluster, binding.Namespace, listResources(item.boundRules(binding.RoleRef, binding.Namespace))...)
+		}
+	}
+	return permissions.sorted(), clusters, nil
+}
+
+// Returns the rules of the role referenced by a binding. The rules of a Role are the rules for the namespace.
+// Returns no rules when the role wasn't created by the ClusterPermission.
+func (p clusterPermission) boundRules(roleRef clusterPermissionRoleRef, namespace string) []rbacv1.PolicyRule {
+	if roleRef.Name != "" && roleRef.Name != p.name {
+		klog.V(3).Infof("Ignoring the binding to %s %s in ClusterPermission %s/%s. The rules of the role aren't known.",
+			roleRef.Kind, roleRef.Name, p.cluster, p.name)
+		return nil
+	}
+	rules := []rbacv1.PolicyRule{}
+	switch roleRef.Kind {
+	case "ClusterRole":
+		if p.spec.ClusterRole != nil {
+			rules = append(rules, p.spec.ClusterRole.Rules...)
+		}
+	case "Role":
+		for _, role := range p.spec.Roles {
+			if role.Namespace == namespace {
+				rules = append(rules, role.Rules...)
+			}
+		}
+	}
+	return rules
+}
+
+// Returns the ClusterPermissions. Uses the cached list if valid.
+func (p *clusterPermissionProvider) getClusterPermissions(ctx context.Context) ([]clusterPermission, error) {
+	p.cache.lock.Lock()
+	defer p.cache.lock.Unlock()
+	if p.cache.isValid() {
+		return p.clusterPermissions, p.cache.err
+	}
+	p.clusterPermissions, p.cache.err = p.listClusterPermissions(ctx)
+	p.cache.updatedAt = time.Now()
+	return p.clusterPermissions, p.cache.err
+}
+
+func (p *clusterPermissionProvider) listClusterPermissions(ctx context.Context) ([]clusterPermission, error) {
+	list, err := p.dynamicClient.Resource(clusterPermissionGvr).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("error listing ClusterPermissions: %w", err)
+	}
+	clusterPermissions := []clusterPermission{}
+	for _, item := range list.Items {
+		spec := clusterPermissionSpec{}
+		specObj, ok := item.Object["spec"].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(specObj, &spec); err != nil {
+			klog.Warningf("Error parsing ClusterPermission %s/%s: %s", item.GetNamespace(), item.GetName(), err)
+			continue
+		}
+		clusterPermissions = append(clusterPermissions,
+			clusterPermission{cluster: item.GetNamespace(), name: item.GetName(), spec: spec})
+	}
+	return clusterPermissions, nil
+}
+
+// Returns the resources that the rules allow to list.
+func listResources(rules []rbacv1.PolicyRule) []Resource {
+	resources := []Resource{}
+	for _, rule := range rules {
+		canList := false
+		for _, verb := range rule.Verbs {
+			if verb == "list" || verb == "*" {
+				canList = true
+			}
+		}
+		// Rules limited to some resource names aren't supported.
+		if !canList || (len(rule.ResourceNames) > 0 && rule.ResourceNames[0] != "*") {
+			continue
+		}
+		for _, apigroup := range rule.APIGroups {
+			for _, kind := range rule.Resources {
+				resources = append(resources, Resource{Apigroup: apigroup, Kind: kind})
+			}
+		}
+	}
+	return resources
+}
+
+func matchesRbacSubject(userInfo authv1.UserInfo, subject rbacv1.Subject) bool {
+	switch subject.Kind {
+	case rbacv1.UserKind:
+		return matchesSubject(userInfo, []string{subject.Name}, nil)
+	case rbacv1.GroupKind:
+		return matchesSubject(userInfo, nil, []string{subject.Name})
+	case rbacv1.ServiceAccountKind:
+		return matchesSubject(userInfo, []string{"system:serviceaccount:" + subject.Namespace + ":" + subject.Name}, nil)
+	}
+	return false
+}
+
+func matchesSubject(userInfo authv1.UserInfo, users []string, groups []string) bool {
+	for _, user := range users {
+		if user == userInfo.Username {
+			return true
+		}
+	}
+	for _, group := range groups {
+		for _, userGroup := range userInfo.Groups {
+			if group == userGroup {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Adds the resources, skipping duplicates. When all resources are allowed, keeps only the wildcard.
+func (p ManagedClusterResources) add(cluster, namespace string, resources ...Resource) {
+	if len(resources) == 0 {
+		return
+	}
+	if p[cluster] == nil {
+		p[cluster] = map[string][]Resource{}
+	}
+	for _, res := range resources {
+		existing := p[cluster][namespace]
+		if len(existing) == 1 && existing[0].Apigroup == "*" && existing[0].Kind == "*" {
+			return
+		}
+		if res.Apigroup == "*" && res.Kind == "*" {
+			p[cluster][namespace] = []Resource{res}
+			return
+		}
+		found := false
+		for _, e := range existing {
+			if e == res {
+				found = true
+			}
+		}
+		if !found {
+			p[cluster][namespace] = append(existing, res)
+		}
+	}
+}
+
+// Sorts the resources so the RBAC clause is stable and easier to consolidate.
+func (p ManagedClusterResources) sorted() ManagedClusterResources {
+	for _, namespaces := range p {
+		for _, resources := range namespaces {
+			sort.Slice(resources, func(i, j int) bool {
+				if resources[i].Kind != resources[j].Kind {
+					return resources[i].Kind < resources[j].Kind
+				}
+				return resources[i].Apigroup < resources[j].Apigroup
+			})
+		}
+	}
+	return p
+}
+
+// Returns a copy, so the cached permissions can't be modified.
+func (p ManagedClusterResources) copy() ManagedClusterResources {
+	permissionsCopy := ManagedClusterResources{}
+	for cluster, namespaces := range p {
+		permissionsCopy[cluster] = map[string][]Resource{}
+		for namespace, resources := range namespaces {
+			permissionsCopy[cluster][namespace] = append([]Resource{}, resources...)
+		}
+	}
+	return permissionsCopy
+}
+
+// Get the fine-grained permissions for the user from the managed cluster permission provider. The clusters
+// covered by the provider are removed from the managed clusters where the user has view access, so these
+// clusters are only matched by the fine-grained permissions.
+func (user *UserDataCache) getManagedClusterResources(ctx context.Context, cache *Cache) {
+	if cache.permissionProvider == nil {
+		return
+	}
+	permissions, coveredClusters, err := cache.permissionProvider.GetPermissions(ctx, user.userInfo)
+	user.clustersCache.lock.Lock()
+	defer user.clustersCache.lock.Unlock()
+	if err != nil {
+		// The covered clusters aren't known, so the user doesn't keep the view access to any managed cluster.
+		klog.Warningf("Error getting managed cluster permissions for user %s with uid %s. %s",
+			user.userInfo.Username, user.userInfo.UID, err)
+		user.ManagedClusters = map[string]struct{}{}
+		user.ManagedClusterResources = nil
+		user.clustersCache.err = err
+		return
+	}
+	for cluster := range coveredClusters {
+		delete(user.ManagedClusters, cluster)
+	}
+	user.ManagedClusterResources = permissions
+	klog.V(5).Infof("User %s with uid %s has fine-grained access to resources on %d managed clusters.",
+		user.userInfo.Username, user.userInfo.UID, len(permissions))
+}
+
+func (user *UserDataCache) GetManagedClusterResourcesCopy() ManagedClusterResources {
+	user.clustersCache.lock.Lock()
+	defer user.clustersCache.lock.Unlock()
+	return user.ManagedClusterResources.copy()
+}
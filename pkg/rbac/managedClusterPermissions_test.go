@@ -0,0 +1,276 @@
+// Copyright Contributors to the Open Cluster Management project
+package rbac
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	authv1 "k8s.io/api/authentication/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	fakedynclient "k8s.io/client-go/dynamic/fake"
+)
+
+func newFakePermissionsClient(objects ...runtime.Object) *fakedynclient.FakeDynamicClient {
+	return fakedynclient.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{
+			clusterPermissionGvr: "ClusterPermissionList",
+			configMapGvr:         "ConfigMapList",
+		}, objects...)
+}
+
+func Test_configMapPermissionProvider(t *testing.T) {
+	configMap := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata":   map[string]interface{}{"name": "search-managed-cluster-permissions", "namespace": "ocm"},
+		"data": map[string]interface{}{"policy": `[
+			{"groups": ["team-a"], "clusters": ["managed1", "managed2"], "namespaces": ["app-a"],
+			 "resources": [{"Apigroup": "apps", "Kind": "deployments"}, {"Apigroup": "", "Kind": "pods"}]},
+			{"users": ["bob"], "clusters": ["managed1"], "namespaces": ["app-b"],
+			 "resources": [{"Apigroup": "*", "Kind": "*"}]}]`},
+	}}
+	provider := &configMapPermissionProvider{
+		dynamicClient: newFakePermissionsClient(configMap),
+		namespace:     "ocm",
+		name:          "search-managed-cluster-permissions",
+	}
+
+	permissions, clusters, err := provider.GetPermissions(context.TODO(),
+		authv1.UserInfo{Username: "alice", Groups: []string{"team-a"}})
+
+	assert.Nil(t, err)
+	assert.Equal(t, ManagedClusterResources{
+		"managed1": {"app-a": {{Apigroup: "apps", Kind: "deployments"}, {Apigroup: "", Kind: "pods"}}},
+		"managed2": {"app-a": {{Apigroup: "apps", Kind: "deployments"}, {Apigroup: "", Kind: "pods"}}},
+	}, permissions)
+	assert.Equal(t, map[string]struct{}{"managed1": {}, "managed2": {}}, clusters)
+}
+
+func Test_configMapPermissionProvider_NotFound(t *testing.T) {
+	provider := &configMapPermissionProvider{dynamicClient: newFakePermissionsClient(), namespace: "ocm", name: "missing"}
+
+	permissions, clusters, err := provider.GetPermissions(context.TODO(), authv1.UserInfo{Username: "alice"})
+
+	assert.NotNil(t, err)
+	assert.Nil(t, permissions)
+	assert.Nil(t, clusters)
+}
+
+func Test_clusterPermissionProvider(t *testing.T) {
+	clusterPermission := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "rbac.open-cluster-management.io/v1alpha1",
+		"kind":       "ClusterPermission",
+		"metadata":   map[string]interface{}{"name": "team-a", "namespace": "managed1"},
+		"spec": map[string]interface{}{
+			"clusterRole": map[string]interface{}{
+				"rules": []interface{}{map[string]interface{}{
+					"apiGroups": []interface{}{""}, "resources": []interface{}{"nodes"},
+					"verbs": []interface{}{"get", "list"}}},
+			},
+			"clusterRoleBinding": map[string]interface{}{
+				"subject": map[string]interface{}{"kind": "Group", "name": "team-a"},
+			},
+			"roles": []interface{}{
+				map[string]interface{}{"namespace": "app-a", "rules": []interface{}{
+					map[string]interface{}{"apiGroups": []interface{}{"apps"}, "resources": []interface{}{"deployments"},
+						"verbs": []interface{}{"*"}},
+					map[string]interface{}{"apiGroups": []interface{}{""}, "resources": []interface{}{"secrets"},
+						"verbs": []interface{}{"get"}},
+				}},
+				map[string]interface{}{"namespace": "app-b", "rules": []interface{}{
+					map[string]interface{}{"apiGroups": []interface{}{""}, "resources": []interface{}{"pods"},
+						"verbs": []interface{}{"list"}},
+				}},
+			},
+			"roleBindings": []interface{}{
+				map[string]interface{}{"namespace": "app-a",
+					"roleRef": map[string]interface{}{"kind": "Role"},
+					"subject": map[string]interface{}{"kind": "User", "name": "alice"}},
+				map[string]interface{}{"namespace": "app-b",
+					"roleRef": map[string]interface{}{"kind": "Role"},
+					"subject": map[string]interface{}{"kind": "User", "name": "bob"}},
+			},
+		},
+	}}
+	otherCluster := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "rbac.open-cluster-management.io/v1alpha1",
+		"kind":       "ClusterPermission",
+		"metadata":   map[string]interface{}{"name": "team-b", "namespace": "managed2"},
+		"spec":       map[string]interface{}{},
+	}}
+	client := newFakePermissionsClient(clusterPermission, otherCluster)
+	provider := &clusterPermissionProvider{dynamicClient: client}
+
+	permissions, clusters, err := provider.GetPermissions(context.TODO(),
+		authv1.UserInfo{Username: "alice", Groups: []string{"team-a"}})
+
+	assert.Nil(t, err)
+	assert.Equal(t, ManagedClusterResources{
+		"managed1": {
+			"*":     {{Apigroup: "", Kind: "nodes"}},
+			"app-a": {{Apigroup: "apps", Kind: "deployments"}},
+		},
+	}, permissions)
+	assert.Equal(t, map[string]struct{}{"managed1": {}, "managed2": {}}, clusters,
+		"Expected the clusters with a ClusterPermission for any user.")
+
+	// The list is cached for the next users.
+	_, _, err = provider.GetPermissions(context.TODO(), authv1.UserInfo{Username: "bob"})
+	assert.Nil(t, err)
+	lists := 0
+	for _, action := range client.Actions() {
+		if action.GetVerb() == "list" {
+			lists++
+		}
+	}
+	assert.Equal(t, 1, lists, "Expected the ClusterPermissions to be listed once.")
+}
+
+// Returns a ClusterPermission in managed1 with a ClusterRole for nodes, a Role for pods in app-a and the bindings.
+func newClusterPermission(clusterRoleBinding map[string]interface{}, roleBindings ...interface{}) runtime.Object {
+	spec := map[string]interface{}{
+		"clusterRole": map[string]interface{}{
+			"rules": []interface{}{map[string]interface{}{
+				"apiGroups": []interface{}{""}, "resources": []interface{}{"nodes"}, "verbs": []interface{}{"list"}}},
+		},
+		"roles": []interface{}{
+			map[string]interface{}{"namespace": "app-a", "rules": []interface{}{
+				map[string]interface{}{"apiGroups": []interface{}{""}, "resources": []interface{}{"pods"},
+					"verbs": []interface{}{"list"}},
+			}},
+		},
+		"roleBindings": roleBindings,
+	}
+	if clusterRoleBinding != nil {
+		spec["clusterRoleBinding"] = clusterRoleBinding
+	}
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "rbac.open-cluster-management.io/v1alpha1",
+		"kind":       "ClusterPermission",
+		"metadata":   map[string]interface{}{"name": "team-a", "namespace": "managed1"},
+		"spec":       spec,
+	}}
+}
+
+func Test_clusterPermissionProvider_roleRef(t *testing.T) {
+	alice := map[string]interface{}{"kind": "User", "name": "alice"}
+	tests := []struct {
+		name     string
+		object   runtime.Object
+		expected ManagedClusterResources
+	}{
+		{"Role of the ClusterPermission",
+			newClusterPermission(nil, map[string]interface{}{"namespace": "app-a", "subject": alice,
+				"roleRef": map[string]interface{}{"kind": "Role", "name": "team-a"}}),
+			ManagedClusterResources{"managed1": {"app-a": {{Apigroup: "", Kind: "pods"}}}}},
+		{"Role not created by the ClusterPermission",
+			newClusterPermission(nil, map[string]interface{}{"namespace": "app-a", "subject": alice,
+				"roleRef": map[string]interface{}{"kind": "Role", "name": "admin"}}),
+			ManagedClusterResources{}},
+		{"RoleBinding to the ClusterRole",
+			newClusterPermission(nil, map[string]interface{}{"namespace": "app-b", "subject": alice,
+				"roleRef": map[string]interface{}{"kind": "ClusterRole", "name": "team-a"}}),
+			ManagedClusterResources{"managed1": {"app-b": {{Apigroup: "", Kind: "nodes"}}}}},
+		{"RoleBinding to a ClusterRole not created by the ClusterPermission",
+			newClusterPermission(nil, map[string]interface{}{"namespace": "app-b", "subject": alice,
+				"roleRef": map[string]interface{}{"kind": "ClusterRole", "name": "cluster-admin"}}),
+			ManagedClusterResources{}},
+		{"ClusterRoleBinding to a ClusterRole not created by the ClusterPermission",
+			newClusterPermission(map[string]interface{}{"subject": alice,
+				"roleRef": map[string]interface{}{"kind": "ClusterRole", "name": "cluster-admin"}}),
+			ManagedClusterResources{}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			provider := &clusterPermissionProvider{dynamicClient: newFakePermissionsClient(test.object)}
+
+			permissions, _, err := provider.GetPermissions(context.TODO(), authv1.UserInfo{Username: "alice"})
+
+			assert.Nil(t, err)
+			assert.Equal(t, test.expected, permissions)
+		})
+	}
+}
+
+func Test_clusterPermissionProvider_serviceAccount(t *testing.T) {
+	serviceAccount := map[string]interface{}{"kind": "ServiceAccount", "name": "collector", "namespace": "app-a"}
+	provider := &clusterPermissionProvider{dynamicClient: newFakePermissionsClient(newClusterPermission(
+		map[string]interface{}{"subject": serviceAccount},
+		map[string]interface{}{"namespace": "app-a", "subject": serviceAccount,
+			"roleRef": map[string]interface{}{"kind": "Role"}}))}
+
+	permissions, _, err := provider.GetPermissions(context.TODO(),
+		authv1.UserInfo{Username: "system:serviceaccount:app-a:collector"})
+
+	assert.Nil(t, err)
+	assert.Equal(t, ManagedClusterResources{"managed1": {
+		"*":     {{Apigroup: "", Kind: "nodes"}},
+		"app-a": {{Apigroup: "", Kind: "pods"}},
+	}}, permissions)
+
+	// A service account with the same name in another namespace isn't the subject.
+	permissions, _, err = provider.GetPermissions(context.TODO(),
+		authv1.UserInfo{Username: "system:serviceaccount:app-b:collector"})
+
+	assert.Nil(t, err)
+	assert.Equal(t, ManagedClusterResources{}, permissions)
+}
+
+func Test_ManagedClusterResources_add(t *testing.T) {
+	permissions := ManagedClusterResources{}
+
+	permissions.add("managed1", "app-a", Resource{Apigroup: "", Kind: "pods"}, Resource{Apigroup: "", Kind: "pods"})
+	permissions.add("managed1", "app-b", Resource{Apigroup: "", Kind: "pods"}, Resource{Apigroup: "*", Kind: "*"},
+		Resource{Apigroup: "apps", Kind: "deployments"})
+	permissions.add("managed2", "app-a")
+
+	assert.Equal(t, ManagedClusterResources{"managed1": {
+		"app-a": {{Apigroup: "", Kind: "pods"}},
+		"app-b": {{Apigroup: "*", Kind: "*"}},
+	}}, permissions)
+}
+
+func Test_getManagedClusterResources_coveredClusters(t *testing.T) {
+	configMap := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata":   map[string]interface{}{"name": "search-managed-cluster-permissions", "namespace": "ocm"},
+		"data": map[string]interface{}{"policy": `[
+			{"groups": ["team-a"], "clusters": ["managed1"], "namespaces": ["app-a"],
+			 "resources": [{"Apigroup": "", "Kind": "pods"}]},
+			{"users": ["bob"], "clusters": ["managed2"], "namespaces": ["app-b"],
+			 "resources": [{"Apigroup": "*", "Kind": "*"}]}]`},
+	}}
+	cache := &Cache{permissionProvider: &configMapPermissionProvider{
+		dynamicClient: newFakePermissionsClient(configMap), namespace: "ocm",
+		name: "search-managed-cluster-permissions"}}
+	user := &UserDataCache{userInfo: authv1.UserInfo{Username: "alice", Groups: []string{"team-a"}}}
+	user.ManagedClusters = map[string]struct{}{"managed1": {}, "managed2": {}, "managed3": {}}
+
+	user.getManagedClusterResources(context.TODO(), cache)
+
+	assert.Equal(t, map[string]struct{}{"managed3": {}}, user.GetManagedClustersCopy(),
+		"Expected the clusters covered by the provider to be removed from the view access.")
+	assert.Equal(t, ManagedClusterResources{"managed1": {"app-a": {{Apigroup: "", Kind: "pods"}}}},
+		user.GetManagedClusterResourcesCopy())
+}
+
+func Test_getManagedClusterResources(t *testing.T) {
+	user := &UserDataCache{userInfo: authv1.UserInfo{Username: "alice"}}
+	user.ManagedClusters = map[string]struct{}{"managed1": {}}
+	cache := &Cache{permissionProvider: &configMapPermissionProvider{
+		dynamicClient: newFakePermissionsClient(), namespace: "ocm", name: "missing"}}
+
+	// An error from the provider removes the access to the managed clusters, because the covered clusters aren't known.
+	user.getManagedClusterResources(context.TODO(), cache)
+	assert.Nil(t, user.ManagedClusterResources)
+	assert.Equal(t, map[string]struct{}{}, user.GetManagedClustersCopy())
+	assert.NotNil(t, user.clustersCache.err)
+
+	// Without a provider, fine-grained permissions aren't used.
+	user.getManagedClusterResources(context.TODO(), &Cache{})
+	assert.Equal(t, ManagedClusterResources{}, user.GetManagedClusterResourcesCopy())
+}
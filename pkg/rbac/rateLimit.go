@@ -0,0 +1,181 @@
+// Copyright Contributors to the Open Cluster Management project
+package rbac
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/stolostron/search-v2-api/pkg/config"
+	"github.com/stolostron/search-v2-api/pkg/metrics"
+	"golang.org/x/time/rate"
+	"k8s.io/klog/v2"
+)
+
+// Limits the requests of each user with a token bucket. The database operations in flight across all users
+// are limited by the database pool.
+type rateLimiter struct {
+	userRate     rate.Limit
+	userBurst    int
+	limiters     *lruCache[*rate.Limiter] // Key: username
+	limitersLock sync.Mutex
+	exemptUsers  []string
+}
+
+func newRateLimiter(cfg config.Config) *rateLimiter {
+	limiter := &rateLimiter{
+		userRate:  rate.Limit(cfg.RateLimit.UserRate),
+		userBurst: cfg.RateLimit.UserBurst,
+	}
+	if cfg.RateLimit.UserRate > 0 {
+		// An idle limiter is the same as a new one after the bucket is refilled, so it can be evicted.
+		refill := time.Duration(float64(cfg.RateLimit.UserBurst) / cfg.RateLimit.UserRate * float64(time.Second))
+		limiter.limiters = newLRUCache[*rate.Limiter]("rateLimiters", cfg.AuthCacheMaxSize, refill+time.Minute)
+	}
+	for _, user := range strings.Split(cfg.RateLimit.ExemptUsers, ",") {
+		if user = strings.TrimSpace(user); user != "" {
+			limiter.exemptUsers = append(limiter.exemptUsers, user)
+		}
+	}
+	return limiter
+}
+
+var rateLimiterInst = newRateLimiter(*config.Cfg)
+
+// Set on websocket upgrade requests, so the operations received over the connection are rate limited.
+const contextWebsocketKey ContextKey = "websocket"
+
+// Middleware to apply the rate limit of the user. Must be added after AuthenticateUser.
+// Rejected requests get a 429 response with the Retry-After header.
+func RateLimitUser(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Websocket requests may not have a token until the connection_init message is received,
+		// so the limit is applied by AuthenticateWebsocketInit, on each operation received over the
+		// connection by WebsocketRateLimit, and on each subscription poll.
+		if isWebsocketUpgrade(r) {
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), contextWebsocketKey, true)))
+			return
+		}
+		if delay, allowed := CheckRateLimit(r.Context(), "graphql"); !allowed {
+			tooManyRequests(w, r, delay, "Rate limit exceeded.")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// GraphQL server extension to apply the rate limit of the user to each operation received over a websocket.
+// A client sends any number of operations over a single connection, so limiting the upgrade request isn't enough.
+// Must be added to the server handled by RateLimitUser.
+type WebsocketRateLimit struct{}
+
+var _ interface {
+	graphql.HandlerExtension
+	graphql.OperationInterceptor
+} = WebsocketRateLimit{}
+
+func (WebsocketRateLimit) ExtensionName() string {
+	return "WebsocketRateLimit"
+}
+
+func (WebsocketRateLimit) Validate(schema graphql.ExecutableSchema) error {
+	return nil
+}
+
+func (WebsocketRateLimit) InterceptOperation(ctx context.Context, next graphql.OperationHandler) graphql.ResponseHandler {
+	if websocket, _ := ctx.Value(contextWebsocketKey).(bool); !websocket {
+		return next(ctx)
+	}
+	if delay, allowed := CheckRateLimit(ctx, "websocket"); !allowed {
+		message := rateLimitMessage(delay)
+		reportRejectedRequest(ctx, config.Cfg.ContextPath+"/graphql", http.StatusTooManyRequests, message)
+		return graphql.OneShot(graphql.ErrorResponse(ctx, "%s", message))
+	}
+	return next(ctx)
+}
+
+func rateLimitMessage(retryAfter time.Duration) string {
+	return fmt.Sprintf("rate limit exceeded, retry after %d seconds", int(math.Ceil(retryAfter.Seconds())))
+}
+
+// Takes a token from the bucket of the user sending the request. Returns false and the time to wait
+// when the user exceeded the rate limit. The source labels the metric of throttled requests.
+// Exempt users and requests without an authenticated user aren't limited.
+func CheckRateLimit(ctx context.Context, source string) (time.Duration, bool) {
+	limiter := rateLimiterInst
+	username, authenticated := GetCache().requestingUser(ctx)
+	if !authenticated {
+		return 0, true
+	}
+	if limiter.isExempt(username) {
+		klog.V(6).Infof("User %s is exempt from the rate limits.", username)
+		return 0, true
+	}
+	if delay := limiter.reserve(username); delay > 0 {
+		klog.V(3).Infof("Rejecting %s request from user %s: rate limit exceeded.", source, username)
+		metrics.RequestsThrottled.WithLabelValues(source).Inc()
+		return delay, false
+	}
+	return 0, true
+}
+
+func tooManyRequests(w http.ResponseWriter, r *http.Request, retryAfter time.Duration, message string) {
+	w.Header().Set("Retry-After", fmt.Sprintf("%d", int(math.Ceil(retryAfter.Seconds()))))
+	rejectRequest(r.Context(), w, r, http.StatusTooManyRequests, message)
+}
+
+// Returns the user who sent the request. The limits apply to the user impersonating, not the impersonated user.
+func (c *Cache) requestingUser(ctx context.Context) (string, bool) {
+	if certUser, ok := GetCertUser(ctx); ok {
+		return certUser.Username, true
+	}
+	token, _ := ctx.Value(ContextAuthTokenKey).(string)
+	if token == "" {
+		return "", false
+	}
+	tokenReview, err := c.GetTokenReview(ctx, token)
+	if err != nil || tokenReview == nil {
+		return "", false
+	}
+	return tokenReview.Status.User.Username, true
+}
+
+func (l *rateLimiter) isExempt(username string) bool {
+	for _, exempt := range l.exemptUsers {
+		if matched, _ := path.Match(exempt, username); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// Takes a token from the user's bucket. Returns the time to wait when the bucket is empty.
+func (l *rateLimiter) reserve(username string) time.Duration {
+	if l.limiters == nil {
+		return 0
+	}
+	l.limitersLock.Lock()
+	l.limiters.removeExpired()
+	limiter, ok := l.limiters.get(username)
+	if !ok {
+		limiter = rate.NewLimiter(l.userRate, l.userBurst)
+		l.limiters.add(username, limiter)
+	}
+	l.limitersLock.Unlock()
+
+	reservation := limiter.Reserve()
+	if !reservation.OK() { // The burst is 0, so no requests are allowed.
+		return time.Second
+	}
+	delay := reservation.Delay()
+	if delay > 0 {
+		reservation.Cancel()
+	}
+	return delay
+}
@@ -0,0 +1,190 @@
+// Copyright Contributors to the Open Cluster Management project
+package rbac
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/99designs/gqlgen/graphql/handler/testserver"
+	"github.com/99designs/gqlgen/graphql/handler/transport"
+	"github.com/gorilla/websocket"
+	"github.com/stolostron/search-v2-api/pkg/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func mockRateLimiter(t *testing.T, cfg config.Config) *rateLimiter {
+	original := rateLimiterInst
+	rateLimiterInst = newRateLimiter(cfg)
+	t.Cleanup(func() { rateLimiterInst = original })
+	return rateLimiterInst
+}
+
+// Sends the request through the authentication and rate limit middleware.
+func rateLimitRequest(r *http.Request) *httptest.ResponseRecorder {
+	response := httptest.NewRecorder()
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	AuthenticateUser(RateLimitUser(next)).ServeHTTP(response, r)
+	return response
+}
+
+func Test_RateLimitUser_userRate(t *testing.T) {
+	setupImpersonationCache()
+	cfg := *config.Cfg
+	cfg.RateLimit.UserRate, cfg.RateLimit.UserBurst = 0.5, 2
+	mockRateLimiter(t, cfg)
+
+	first := rateLimitRequest(newImpersonationRequest("developer-token", ""))
+	second := rateLimitRequest(newImpersonationRequest("developer-token", ""))
+	throttled := rateLimitRequest(newImpersonationRequest("developer-token", ""))
+	otherUser := rateLimitRequest(newImpersonationRequest("admin-token", ""))
+
+	assert.Equal(t, http.StatusOK, first.Code)
+	assert.Equal(t, http.StatusOK, second.Code)
+	assert.Equal(t, http.StatusTooManyRequests, throttled.Code)
+	assert.Equal(t, "2", throttled.Header().Get("Retry-After"))
+	assert.Equal(t, http.StatusOK, otherUser.Code, "Expected a separate limit for each user.")
+}
+
+func Test_RateLimitUser_impersonation(t *testing.T) {
+	setupImpersonationCache()
+	cfg := *config.Cfg
+	cfg.RateLimit.UserRate, cfg.RateLimit.UserBurst = 0.5, 1
+	mockRateLimiter(t, cfg)
+
+	first := rateLimitRequest(newImpersonationRequest("admin-token", "alice"))
+	throttled := rateLimitRequest(newImpersonationRequest("admin-token", "bob"))
+
+	assert.Equal(t, http.StatusOK, first.Code)
+	assert.Equal(t, http.StatusTooManyRequests, throttled.Code,
+		"Expected the limit of the impersonating user.")
+}
+
+func Test_RateLimitUser_exempt(t *testing.T) {
+	setupImpersonationCache()
+	cfg := *config.Cfg
+	cfg.RateLimit.UserRate, cfg.RateLimit.UserBurst = 0.5, 1
+	cfg.RateLimit.ExemptUsers = "system:serviceaccount:open-cluster-management:*, admin"
+	limiter := mockRateLimiter(t, cfg)
+
+	for i := 0; i < 3; i++ {
+		response := rateLimitRequest(newImpersonationRequest("admin-token", ""))
+		assert.Equal(t, http.StatusOK, response.Code)
+	}
+	assert.True(t, limiter.isExempt("system:serviceaccount:open-cluster-management:console"))
+	assert.False(t, limiter.isExempt("system:serviceaccount:default:console"))
+}
+
+func Test_RateLimitUser_websocketUpgrade(t *testing.T) {
+	setupImpersonationCache()
+	cfg := *config.Cfg
+	cfg.RateLimit.UserRate, cfg.RateLimit.UserBurst = 0.5, 1
+	mockRateLimiter(t, cfg)
+	r := newImpersonationRequest("developer-token", "")
+	r.Header.Set("Upgrade", "websocket")
+	r.Header.Set("Connection", "Upgrade")
+
+	first := rateLimitRequest(r)
+	second := rateLimitRequest(r)
+
+	assert.Equal(t, http.StatusOK, first.Code)
+	assert.Equal(t, http.StatusOK, second.Code, "Expected the limit to be applied on connection_init.")
+}
+
+func Test_AuthenticateWebsocketInit_rateLimit(t *testing.T) {
+	setupImpersonationCache()
+	cfg := *config.Cfg
+	cfg.RateLimit.UserRate, cfg.RateLimit.UserBurst = 0.5, 1
+	mockRateLimiter(t, cfg)
+	payload := transport.InitPayload{"Authorization": "Bearer developer-token"}
+
+	_, err := AuthenticateWebsocketInit(context.Background(), payload)
+	assert.Nil(t, err)
+	_, err = AuthenticateWebsocketInit(context.Background(), payload)
+
+	assert.EqualError(t, err, "rate limit exceeded, retry after 2 seconds")
+}
+
+// Sends the query over the websocket connection. Returns the errors of the response.
+func websocketQuery(t *testing.T, conn *websocket.Conn, id string) []string {
+	err := conn.WriteJSON(map[string]interface{}{"type": "start", "id": id,
+		"payload": map[string]interface{}{"query": "{ name }"}})
+	assert.Nil(t, err)
+	errors := []string{}
+	for {
+		var msg struct {
+			Type    string `json:"type"`
+			Payload struct {
+				Errors []struct {
+					Message string `json:"message"`
+				} `json:"errors"`
+			} `json:"payload"`
+		}
+		if err := conn.ReadJSON(&msg); err != nil {
+			t.Fatalf("Error reading the websocket response: %s", err)
+		}
+		for _, e := range msg.Payload.Errors {
+			errors = append(errors, e.Message)
+		}
+		if msg.Type == "complete" || msg.Type == "error" {
+			return errors
+		}
+	}
+}
+
+func Test_WebsocketRateLimit_operations(t *testing.T) {
+	setupImpersonationCache()
+	cfg := *config.Cfg
+	cfg.RateLimit.UserRate, cfg.RateLimit.UserBurst = 0.5, 3
+	mockRateLimiter(t, cfg)
+	srv := testserver.New()
+	srv.AddTransport(transport.Websocket{InitFunc: AuthenticateWebsocketInit})
+	srv.Use(WebsocketRateLimit{})
+	server := httptest.NewServer(AuthenticateUser(RateLimitUser(srv)))
+	defer server.Close()
+
+	dialer := websocket.Dialer{Subprotocols: []string{"graphql-ws"}}
+	conn, _, err := dialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	assert.Nil(t, err)
+	defer conn.Close()
+	assert.Nil(t, conn.WriteJSON(map[string]interface{}{"type": "connection_init",
+		"payload": map[string]interface{}{"Authorization": "Bearer developer-token"}}))
+	var ack map[string]json.RawMessage
+	assert.Nil(t, conn.ReadJSON(&ack))
+	assert.Equal(t, `"connection_ack"`, string(ack["type"]))
+
+	// The connection_init used the first token of the bucket.
+	assert.Empty(t, websocketQuery(t, conn, "1"))
+	assert.Empty(t, websocketQuery(t, conn, "2"))
+	assert.Equal(t, []string{"rate limit exceeded, retry after 2 seconds"}, websocketQuery(t, conn, "3"),
+		"Expected the operations over the same connection to be limited.")
+}
+
+func Test_WebsocketRateLimit_http(t *testing.T) {
+	cfg := *config.Cfg
+	cfg.RateLimit.UserRate, cfg.RateLimit.UserBurst = 0.5, 0
+	mockRateLimiter(t, cfg)
+	called := false
+
+	WebsocketRateLimit{}.InterceptOperation(context.WithValue(context.Background(), ContextAuthTokenKey, "x"),
+		func(ctx context.Context) graphql.ResponseHandler {
+			called = true
+			return nil
+		})
+
+	assert.True(t, called, "Expected HTTP requests to be limited only by RateLimitUser.")
+}
+
+func Test_CheckRateLimit_noUser(t *testing.T) {
+	cfg := *config.Cfg
+	cfg.RateLimit.UserRate, cfg.RateLimit.UserBurst = 0.5, 0
+	mockRateLimiter(t, cfg)
+
+	_, allowed := CheckRateLimit(context.Background(), "graphql")
+
+	assert.True(t, allowed, "Expected requests without an authenticated user to skip the limit.")
+}
@@ -0,0 +1,261 @@
+// Copyright Contributors to the Open Cluster Management project
+package rbac
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/stolostron/search-v2-api/pkg/metrics"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/klog/v2"
+)
+
+var rolesGvr = schema.GroupVersionResource{Group: "rbac.authorization.k8s.io", Version: "v1", Resource: "roles"}
+var clusterRolesGvr = schema.GroupVersionResource{
+	Group:    "rbac.authorization.k8s.io",
+	Version:  "v1",
+	Resource: "clusterroles",
+}
+var roleBindingsGvr = schema.GroupVersionResource{
+	Group:    "rbac.authorization.k8s.io",
+	Version:  "v1",
+	Resource: "rolebindings",
+}
+var clusterRoleBindingsGvr = schema.GroupVersionResource{
+	Group:    "rbac.authorization.k8s.io",
+	Version:  "v1",
+	Resource: "clusterrolebindings",
+}
+var groupsGvr = schema.GroupVersionResource{Group: "user.openshift.io", Version: "v1", Resource: "groups"}
+
+// Last seen state of a RoleBinding or ClusterRoleBinding.
+type bindingState struct {
+	resourceVersion string
+	namespace       string // Empty for ClusterRoleBindings.
+	roleRef         rbacv1.RoleRef
+	subjects        []rbacv1.Subject
+}
+
+// Keeps the last seen state of the RBAC resources. A MODIFIED or DELETED event only has the new state,
+// so the previous state is needed to find the users that lost access.
+type rbacIndex struct {
+	bindings         map[string]bindingState // Key: kind/namespace/name
+	groupUsers       map[string][]string     // Users in each group. Key: group name
+	resourceVersions map[string]string       // Last seen resourceVersion of roles and groups. Key: kind/namespace/name
+	lock             sync.Mutex
+}
+
+// Returns true if the object was already processed. The watch sends an ADDED event for existing
+// objects each time it's restarted, those events don't need to invalidate the cache.
+func (idx *rbacIndex) seen(key, resourceVersion string) bool {
+	if idx.resourceVersions == nil {
+		idx.resourceVersions = map[string]string{}
+	}
+	if resourceVersion != "" && idx.resourceVersions[key] == resourceVersion {
+		return true
+	}
+	idx.resourceVersions[key] = resourceVersion
+	return false
+}
+
+func rbacObjectKey(obj *unstructured.Unstructured) string {
+	return fmt.Sprintf("%s/%s/%s", obj.GetKind(), obj.GetNamespace(), obj.GetName())
+}
+
+// Update the cache when a RoleBinding or ClusterRoleBinding is ADDED or MODIFIED.
+func (c *Cache) bindingChanged(obj *unstructured.Unstructured) {
+	binding := rbacv1.RoleBinding{} // A ClusterRoleBinding has the same fields.
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, &binding); err != nil {
+		klog.Warningf("Error parsing %s %s. Error: %s", obj.GetKind(), obj.GetName(), err)
+		return
+	}
+	key := rbacObjectKey(obj)
+
+	c.rbacIndex.lock.Lock()
+	if c.rbacIndex.bindings == nil {
+		c.rbacIndex.bindings = map[string]bindingState{}
+	}
+	previous, exists := c.rbacIndex.bindings[key]
+	if exists && previous.resourceVersion != "" && previous.resourceVersion == obj.GetResourceVersion() {
+		c.rbacIndex.lock.Unlock()
+		return
+	}
+	c.rbacIndex.bindings[key] = bindingState{
+		resourceVersion: obj.GetResourceVersion(),
+		namespace:       obj.GetNamespace(),
+		roleRef:         binding.RoleRef,
+		subjects:        binding.Subjects,
+	}
+	c.rbacIndex.lock.Unlock()
+	c.shared.addDirectUsers(binding.Subjects)
+
+	// Users removed from the binding lose access, users added gain access.
+	c.invalidateSubjects(key, append(previous.subjects, binding.Subjects...))
+}
+
+// Update the cache when a RoleBinding or ClusterRoleBinding is DELETED.
+func (c *Cache) bindingDeleted(obj *unstructured.Unstructured) {
+	key := rbacObjectKey(obj)
+	c.rbacIndex.lock.Lock()
+	previous := c.rbacIndex.bindings[key]
+	delete(c.rbacIndex.bindings, key)
+	c.rbacIndex.lock.Unlock()
+
+	binding := rbacv1.RoleBinding{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, &binding); err != nil {
+		klog.Warningf("Error parsing %s %s. Error: %s", obj.GetKind(), obj.GetName(), err)
+	}
+	c.invalidateSubjects(key, append(previous.subjects, binding.Subjects...))
+}
+
+// Update the cache when a Role or ClusterRole is ADDED or MODIFIED.
+func (c *Cache) roleChanged(obj *unstructured.Unstructured) {
+	c.rbacIndex.lock.Lock()
+	seen := c.rbacIndex.seen(rbacObjectKey(obj), obj.GetResourceVersion())
+	c.rbacIndex.lock.Unlock()
+	if !seen {
+		c.invalidateRoleSubjects(obj)
+	}
+}
+
+// Update the cache when a Role or ClusterRole is DELETED.
+func (c *Cache) roleDeleted(obj *unstructured.Unstructured) {
+	c.rbacIndex.lock.Lock()
+	delete(c.rbacIndex.resourceVersions, rbacObjectKey(obj))
+	c.rbacIndex.lock.Unlock()
+	c.invalidateRoleSubjects(obj)
+}
+
+// Invalidate the users bound to the role. A Role is used by RoleBindings in the same namespace.
+// A ClusterRole is used by ClusterRoleBindings and by RoleBindings in any namespace.
+func (c *Cache) invalidateRoleSubjects(obj *unstructured.Unstructured) {
+	subjects := []rbacv1.Subject{}
+	c.rbacIndex.lock.Lock()
+	for _, binding := range c.rbacIndex.bindings {
+		if binding.roleRef.Kind != obj.GetKind() || binding.roleRef.Name != obj.GetName() {
+			continue
+		}
+		if obj.GetKind() == "Role" && binding.namespace != obj.GetNamespace() {
+			continue
+		}
+		subjects = append(subjects, binding.subjects...)
+	}
+	c.rbacIndex.lock.Unlock()
+	c.invalidateSubjects(rbacObjectKey(obj), subjects)
+}
+
+// Update the cache when a Group is ADDED or MODIFIED.
+func (c *Cache) groupChanged(obj *unstructured.Unstructured) {
+	users, _, _ := unstructured.NestedStringSlice(obj.Object, "users")
+	c.rbacIndex.lock.Lock()
+	if c.rbacIndex.seen(rbacObjectKey(obj), obj.GetResourceVersion()) {
+		c.rbacIndex.lock.Unlock()
+		return
+	}
+	if c.rbacIndex.groupUsers == nil {
+		c.rbacIndex.groupUsers = map[string][]string{}
+	}
+	previous := c.rbacIndex.groupUsers[obj.GetName()]
+	c.rbacIndex.groupUsers[obj.GetName()] = users
+	c.rbacIndex.lock.Unlock()
+
+	c.invalidateGroupMembers(obj.GetName(), append(previous, users...))
+}
+
+// Update the cache when a Group is DELETED.
+func (c *Cache) groupDeleted(obj *unstructured.Unstructured) {
+	users, _, _ := unstructured.NestedStringSlice(obj.Object, "users")
+	c.rbacIndex.lock.Lock()
+	previous := c.rbacIndex.groupUsers[obj.GetName()]
+	delete(c.rbacIndex.groupUsers, obj.GetName())
+	delete(c.rbacIndex.resourceVersions, rbacObjectKey(obj))
+	c.rbacIndex.lock.Unlock()
+
+	c.invalidateGroupMembers(obj.GetName(), append(previous, users...))
+}
+
+// Invalidate the users added or removed from the group, and the users that have the group.
+// The groups of a user come from the TokenReview, so the cached TokenReview is invalidated too.
+func (c *Cache) invalidateGroupMembers(group string, users []string) {
+	members := map[string]struct{}{}
+	for _, user := range users {
+		members[user] = struct{}{}
+	}
+	c.tokenReviewsLock.Lock()
+	tokens := []string{}
+	c.tokenReviews.each(func(token string, trc *tokenReviewCache) {
+		if trc.tokenReview == nil {
+			return
+		}
+		if _, isMember := members[trc.tokenReview.Status.User.Username]; isMember {
+			tokens = append(tokens, token)
+		}
+	})
+	for _, token := range tokens {
+		c.tokenReviews.remove(token)
+	}
+	c.tokenReviewsLock.Unlock()
+
+	c.invalidateUsers("Group/"+group, func(user *UserDataCache) bool {
+		_, isMember := members[user.userInfo.Username]
+		return isMember || hasGroup(user, group)
+	})
+}
+
+// Invalidate the users matching any of the subjects.
+func (c *Cache) invalidateSubjects(source string, subjects []rbacv1.Subject) {
+	if len(subjects) == 0 {
+		return
+	}
+	c.invalidateUsers(source, func(user *UserDataCache) bool {
+		for _, subject := range subjects {
+			switch subject.Kind {
+			case rbacv1.UserKind:
+				if subject.Name == user.userInfo.Username {
+					return true
+				}
+			case rbacv1.GroupKind:
+				if hasGroup(user, subject.Name) {
+					return true
+				}
+			case rbacv1.ServiceAccountKind:
+				if fmt.Sprintf("system:serviceaccount:%s:%s", subject.Namespace, subject.Name) == user.userInfo.Username {
+					return true
+				}
+			}
+		}
+		return false
+	})
+}
+
+func hasGroup(user *UserDataCache, group string) bool {
+	for _, userGroup := range user.userInfo.Groups {
+		if userGroup == group {
+			return true
+		}
+	}
+	return false
+}
+
+// Remove the matching users from the UserData cache. Their data is requested again on the next request.
+func (c *Cache) invalidateUsers(source string, match func(*UserDataCache) bool) {
+	c.usersLock.Lock()
+	defer c.usersLock.Unlock()
+	invalidated := []string{}
+	c.users.each(func(uid string, userCache *UserDataCache) {
+		if match(userCache) {
+			invalidated = append(invalidated, uid)
+		}
+	})
+	for _, uid := range invalidated {
+		c.users.remove(uid)
+	}
+	if len(invalidated) > 0 {
+		metrics.CacheInvalidations.WithLabelValues(strings.SplitN(source, "/", 2)[0]).Inc()
+		klog.V(3).Infof("Invalidated cached data for %d users after change to %s.", len(invalidated), source)
+	}
+}
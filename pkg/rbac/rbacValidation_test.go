@@ -0,0 +1,180 @@
+// Copyright Contributors to the Open Cluster Management project
+package rbac
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	authv1 "k8s.io/api/authentication/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func initMockRbacCache() *Cache {
+	return &Cache{
+		users: newMockUsersCache(map[string]*UserDataCache{
+			"uid-alice": {userInfo: authv1.UserInfo{Username: "alice", Groups: []string{"team-a"}}},
+			"uid-bob":   {userInfo: authv1.UserInfo{Username: "bob", Groups: []string{"team-b"}}},
+			"uid-sa":    {userInfo: authv1.UserInfo{Username: "system:serviceaccount:ocm:search"}},
+		}),
+		tokenReviews: newMockTokenReviewsCache(map[string]*tokenReviewCache{
+			"token-alice": {tokenReview: &authv1.TokenReview{Status: authv1.TokenReviewStatus{
+				User: authv1.UserInfo{Username: "alice"}}}},
+			"token-bob": {tokenReview: &authv1.TokenReview{Status: authv1.TokenReviewStatus{
+				User: authv1.UserInfo{Username: "bob"}}}},
+		}),
+	}
+}
+
+func newMockBinding(kind, namespace, resourceVersion, roleKind, roleName string,
+	subjects ...map[string]interface{}) *unstructured.Unstructured {
+	subjectList := []interface{}{}
+	for _, subject := range subjects {
+		subjectList = append(subjectList, subject)
+	}
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "rbac.authorization.k8s.io/v1",
+		"kind":       kind,
+		"metadata": map[string]interface{}{
+			"name": "binding", "namespace": namespace, "resourceVersion": resourceVersion},
+		"roleRef":  map[string]interface{}{"apiGroup": "rbac.authorization.k8s.io", "kind": roleKind, "name": roleName},
+		"subjects": subjectList,
+	}}
+}
+
+func newMockRole(kind, namespace, name, resourceVersion string) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "rbac.authorization.k8s.io/v1",
+		"kind":       kind,
+		"metadata":   map[string]interface{}{"name": name, "namespace": namespace, "resourceVersion": resourceVersion},
+	}}
+}
+
+func cachedUsers(c *Cache) []string {
+	users := []string{}
+	c.users.each(func(uid string, _ *UserDataCache) {
+		users = append(users, uid)
+	})
+	sort.Strings(users)
+	return users
+}
+
+func newSubjects(kind, name string) []rbacv1.Subject {
+	return []rbacv1.Subject{{Kind: kind, Name: name}}
+}
+
+func newRoleRef(kind, name string) rbacv1.RoleRef {
+	return rbacv1.RoleRef{APIGroup: "rbac.authorization.k8s.io", Kind: kind, Name: name}
+}
+
+func Test_rbacValidation_bindingChanged(t *testing.T) {
+	mock_cache := initMockRbacCache()
+	binding := newMockBinding("RoleBinding", "app-a", "1", "Role", "viewer",
+		map[string]interface{}{"kind": "User", "name": "alice"})
+
+	mock_cache.bindingChanged(binding)
+
+	assert.Equal(t, []string{"uid-bob", "uid-sa"}, cachedUsers(mock_cache))
+}
+
+func Test_rbacValidation_bindingModifiedRemovesSubject(t *testing.T) {
+	mock_cache := initMockRbacCache()
+	mock_cache.rbacIndex.bindings = map[string]bindingState{
+		"ClusterRoleBinding//binding": {resourceVersion: "1", subjects: newSubjects("Group", "team-b")},
+	}
+	// The subject changed from group team-b to the service account.
+	binding := newMockBinding("ClusterRoleBinding", "", "2", "ClusterRole", "view",
+		map[string]interface{}{"kind": "ServiceAccount", "name": "search", "namespace": "ocm"})
+
+	mock_cache.bindingChanged(binding)
+
+	assert.Equal(t, []string{"uid-alice"}, cachedUsers(mock_cache))
+}
+
+func Test_rbacValidation_bindingAddedAgain(t *testing.T) {
+	mock_cache := initMockRbacCache()
+	binding := newMockBinding("RoleBinding", "app-a", "1", "Role", "viewer",
+		map[string]interface{}{"kind": "Group", "name": "team-a"})
+	mock_cache.bindingChanged(binding)
+	mock_cache.users.add("uid-alice",
+		&UserDataCache{userInfo: authv1.UserInfo{Username: "alice", Groups: []string{"team-a"}}})
+
+	// The watch sends ADDED again when restarted, the user isn't invalidated because the binding didn't change.
+	mock_cache.bindingChanged(binding)
+
+	assert.Equal(t, []string{"uid-alice", "uid-bob", "uid-sa"}, cachedUsers(mock_cache))
+}
+
+func Test_rbacValidation_bindingDeleted(t *testing.T) {
+	mock_cache := initMockRbacCache()
+	binding := newMockBinding("RoleBinding", "app-a", "1", "Role", "viewer",
+		map[string]interface{}{"kind": "User", "name": "bob"})
+
+	mock_cache.bindingDeleted(binding)
+
+	assert.Equal(t, []string{"uid-alice", "uid-sa"}, cachedUsers(mock_cache))
+}
+
+func Test_rbacValidation_roleChanged(t *testing.T) {
+	mock_cache := initMockRbacCache()
+	mock_cache.rbacIndex.bindings = map[string]bindingState{
+		"RoleBinding/app-a/binding": {namespace: "app-a", roleRef: newRoleRef("Role", "viewer"),
+			subjects: newSubjects("User", "alice")},
+		"RoleBinding/app-b/binding": {namespace: "app-b", roleRef: newRoleRef("Role", "viewer"),
+			subjects: newSubjects("User", "bob")},
+	}
+
+	mock_cache.roleChanged(newMockRole("Role", "app-a", "viewer", "1"))
+
+	assert.Equal(t, []string{"uid-bob", "uid-sa"}, cachedUsers(mock_cache),
+		"Only the users bound to the Role in the same namespace are invalidated.")
+}
+
+func Test_rbacValidation_clusterRoleDeleted(t *testing.T) {
+	mock_cache := initMockRbacCache()
+	mock_cache.rbacIndex.bindings = map[string]bindingState{
+		"RoleBinding/app-a/binding": {namespace: "app-a", roleRef: newRoleRef("ClusterRole", "view"),
+			subjects: newSubjects("User", "alice")},
+		"ClusterRoleBinding//binding": {roleRef: newRoleRef("ClusterRole", "view"),
+			subjects: newSubjects("Group", "team-b")},
+		"ClusterRoleBinding//other": {roleRef: newRoleRef("ClusterRole", "admin"),
+			subjects: newSubjects("User", "system:serviceaccount:ocm:search")},
+	}
+
+	mock_cache.roleDeleted(newMockRole("ClusterRole", "", "view", "1"))
+
+	assert.Equal(t, []string{"uid-sa"}, cachedUsers(mock_cache))
+}
+
+func Test_rbacValidation_groupChanged(t *testing.T) {
+	mock_cache := initMockRbacCache()
+	mock_cache.rbacIndex.groupUsers = map[string][]string{"team-c": {"bob"}}
+	group := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "user.openshift.io/v1",
+		"kind":       "Group",
+		"metadata":   map[string]interface{}{"name": "team-c", "resourceVersion": "2"},
+		"users":      []interface{}{"carol"},
+	}}
+
+	// bob was removed from the group.
+	mock_cache.groupChanged(group)
+
+	assert.Equal(t, []string{"uid-alice", "uid-sa"}, cachedUsers(mock_cache))
+	_, tokenReviewCached := mock_cache.tokenReviews.get(tokenHash("token-bob"))
+	assert.False(t, tokenReviewCached, "The TokenReview with the user groups is invalidated.")
+	assert.Equal(t, []string{"carol"}, mock_cache.rbacIndex.groupUsers["team-c"])
+}
+
+func Test_rbacValidation_groupDeleted(t *testing.T) {
+	mock_cache := initMockRbacCache()
+	group := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "user.openshift.io/v1",
+		"kind":       "Group",
+		"metadata":   map[string]interface{}{"name": "team-a"},
+	}}
+
+	mock_cache.groupDeleted(group)
+
+	assert.Equal(t, []string{"uid-bob", "uid-sa"}, cachedUsers(mock_cache), "Users with the group are invalidated.")
+}
@@ -0,0 +1,44 @@
+// Copyright Contributors to the Open Cluster Management project
+package rbac
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"k8s.io/klog/v2"
+)
+
+// Receives the requests rejected by the authentication, impersonation and rate limit checks, which don't
+// reach the GraphQL server or the federated handler. The context has the authenticated user when it's known.
+type RejectedRequestHandler func(ctx context.Context, path string, status int, reason string)
+
+var rejectedRequestHandler RejectedRequestHandler
+
+// Sets the handler of the rejected requests. Must be called before the server starts.
+func OnRejectedRequest(handler RejectedRequestHandler) {
+	rejectedRequestHandler = handler
+}
+
+func reportRejectedRequest(ctx context.Context, path string, status int, reason string) {
+	if rejectedRequestHandler != nil {
+		rejectedRequestHandler(ctx, path, status, reason)
+	}
+}
+
+// Reports the rejected request and writes the error response.
+func rejectRequest(ctx context.Context, w http.ResponseWriter, r *http.Request, status int, message string) {
+	reportRejectedRequest(ctx, r.URL.Path, status, message)
+	writeErrorResponse(w, status, message)
+}
+
+// Writes the error response with the message in a JSON body. The message may include user and group
+// names from the request headers, so it must be encoded.
+func writeErrorResponse(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(map[string]string{"message": message}); err != nil {
+		klog.Warning("Error writing the error response. ", err)
+	}
+}
@@ -0,0 +1,96 @@
+// Copyright Contributors to the Open Cluster Management project
+package rbac
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/99designs/gqlgen/graphql/handler/transport"
+	"github.com/stolostron/search-v2-api/pkg/config"
+	"github.com/stretchr/testify/assert"
+)
+
+type rejectedRequest struct {
+	path   string
+	status int
+	reason string
+	user   string
+}
+
+// Records the rejected requests with the user from the context.
+func mockRejectedRequestHandler(t *testing.T) *[]rejectedRequest {
+	rejected := &[]rejectedRequest{}
+	original := rejectedRequestHandler
+	OnRejectedRequest(func(ctx context.Context, path string, status int, reason string) {
+		user, _ := GetCache().requestingUser(ctx)
+		*rejected = append(*rejected, rejectedRequest{path: path, status: status, reason: reason, user: user})
+	})
+	t.Cleanup(func() { rejectedRequestHandler = original })
+	return rejected
+}
+
+func Test_rejectRequest_authentication(t *testing.T) {
+	setupImpersonationCache()
+	rejected := mockRejectedRequestHandler(t)
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	AuthenticateUser(next).ServeHTTP(httptest.NewRecorder(),
+		httptest.NewRequest("POST", "https://localhost:4010/searchapi/graphql", nil))
+	AuthenticateUser(next).ServeHTTP(httptest.NewRecorder(), newImpersonationRequest("invalid-token", ""))
+
+	assert.Equal(t, []rejectedRequest{
+		{path: "/searchapi/graphql", status: http.StatusUnauthorized,
+			reason: "Request didn't have a valid authentication token."},
+		{path: "/searchapi/graphql", status: http.StatusForbidden, reason: "Invalid token"},
+	}, *rejected)
+}
+
+func Test_rejectRequest_impersonationDenied(t *testing.T) {
+	setupImpersonationCache()
+	rejected := mockRejectedRequestHandler(t)
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	AuthenticateUser(next).ServeHTTP(httptest.NewRecorder(), newImpersonationRequest("developer-token", "alice"))
+
+	assert.Equal(t, []rejectedRequest{{path: "/searchapi/graphql", status: http.StatusForbidden,
+		reason: "Impersonation not allowed. user developer isn't allowed to impersonate user alice",
+		user:   "developer"}}, *rejected)
+}
+
+// The message includes the user from the request headers, so the body must be encoded.
+func Test_rejectRequest_jsonBody(t *testing.T) {
+	setupImpersonationCache()
+	response := httptest.NewRecorder()
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	AuthenticateUser(next).ServeHTTP(response, newImpersonationRequest("developer-token", `al"ice\`))
+
+	body := map[string]string{}
+	assert.Nil(t, json.Unmarshal(response.Body.Bytes(), &body), "Expected a valid JSON body.")
+	assert.Equal(t, `Impersonation not allowed. user developer isn't allowed to impersonate user al"ice\`, body["message"])
+	assert.Equal(t, "application/json", response.Header().Get("Content-Type"))
+}
+
+func Test_rejectRequest_rateLimit(t *testing.T) {
+	setupImpersonationCache()
+	cfg := *config.Cfg
+	cfg.RateLimit.UserRate, cfg.RateLimit.UserBurst = 0.5, 1
+	mockRateLimiter(t, cfg)
+	rejected := mockRejectedRequestHandler(t)
+
+	rateLimitRequest(newImpersonationRequest("developer-token", ""))
+	rateLimitRequest(newImpersonationRequest("developer-token", ""))
+	_, err := AuthenticateWebsocketInit(context.Background(),
+		transport.InitPayload{"Authorization": "Bearer developer-token"})
+
+	assert.NotNil(t, err)
+	assert.Equal(t, []rejectedRequest{
+		{path: "/searchapi/graphql", status: http.StatusTooManyRequests, reason: "Rate limit exceeded.",
+			user: "developer"},
+		{path: config.Cfg.ContextPath + "/graphql", status: http.StatusTooManyRequests,
+			reason: "rate limit exceeded, retry after 2 seconds", user: "developer"},
+	}, *rejected)
+}
@@ -3,6 +3,7 @@ package rbac
 
 import (
 	"context"
+	"fmt"
 	"sync"
 	"time"
 
@@ -10,6 +11,7 @@ import (
 	"github.com/doug-martin/goqu/v9/exp"
 	"github.com/driftprogramming/pgxpoolmock"
 	"github.com/stolostron/search-v2-api/pkg/metrics"
+	rbacv1 "k8s.io/api/rbac/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
@@ -21,17 +23,21 @@ import (
 type SharedData struct {
 	// These are the data fields.
 	csResourcesMap   map[Resource]struct{}
+	directUsers      map[string]struct{} // Users and service accounts that are subjects of a binding.
 	disabledClusters map[string]struct{}
 	managedClusters  map[string]struct{}
 	namespaces       []string
 	propTypes        map[string]string
+	propTypesStale   bool // A CRD was modified or deleted, so the property types are queried again.
 
 	// Metadata to manage the state of the cached data.
 	csrCache    cacheMetadata
+	duCache     cacheMetadata
 	dcCache     cacheMetadata
 	mcCache     cacheMetadata
 	nsCache     cacheMetadata
-	propTypeErr error // Capture errors retrieving property types
+	propTypeErr error      // Capture errors retrieving property types
+	ptLock      sync.Mutex // Locks the property types, which are marked stale by the CRD watch.
 
 	// Clients to external APIs to be replaced with a mock by unit tests.
 	dynamicClient dynamic.Interface
@@ -48,12 +54,25 @@ var managedClusterResourceGvr = schema.GroupVersionResource{
 	Version:  "v1",
 	Resource: "managedclusters",
 }
+var managedClusterAddonGvr = schema.GroupVersionResource{
+	Group:    "addon.open-cluster-management.io",
+	Version:  "v1alpha1",
+	Resource: "managedclusteraddons",
+}
+var crdGvr = schema.GroupVersionResource{
+	Group:    "apiextensions.k8s.io",
+	Version:  "v1",
+	Resource: "customresourcedefinitions",
+}
 var namespacesGvr = schema.GroupVersionResource{
 	Group:    "",
 	Version:  "v1",
 	Resource: "namespaces",
 }
 
+// Name of the ManagedClusterAddOn that enables search on a managed cluster.
+const searchAddonName = "search-collector"
+
 // Query the database to get all properties and their types.
 // Sample query:
 //
@@ -104,8 +123,10 @@ func (shared *SharedData) getPropertyTypes(ctx context.Context) (map[string]stri
 
 	klog.Info("Successfully fetched property types from the database.")
 	//cache results:
+	shared.ptLock.Lock()
 	shared.propTypes = propTypeMap
 	shared.propTypeErr = err
+	shared.ptLock.Unlock()
 
 	return propTypeMap, err
 }
@@ -115,11 +136,16 @@ func (shared *SharedData) getPropertyTypes(ctx context.Context) (map[string]stri
 //	refresh - forces cached data to refresh from database.
 func (cache *Cache) GetPropertyTypes(ctx context.Context, refresh bool) (map[string]string, error) {
 	// check if propTypes data in cache and not nil and return
-	if len(cache.shared.propTypes) > 0 && cache.shared.propTypeErr == nil && !refresh {
-		propTypesMap := cache.shared.propTypes
+	cache.shared.ptLock.Lock()
+	propTypesMap, propTypeErr, stale := cache.shared.propTypes, cache.shared.propTypeErr, cache.shared.propTypesStale
+	if len(propTypesMap) > 0 && propTypeErr == nil && !stale && !refresh {
+		cache.shared.ptLock.Unlock()
 		return propTypesMap, nil
 
 	} else {
+		// A CRD modified while the query runs marks the property types stale again.
+		cache.shared.propTypesStale = false
+		cache.shared.ptLock.Unlock()
 		klog.V(6).Info("Getting property types from database.")
 		// run query to refresh data
 		propTypes, err := cache.shared.getPropertyTypes(ctx)
@@ -319,6 +345,66 @@ func (shared *SharedData) getManagedClusters(ctx context.Context) error {
 
 }
 
+// Returns true if the user is a subject of a RoleBinding or ClusterRoleBinding, so the user can have
+// access that isn't granted to the groups.
+// Equivalent to `oc get rolebindings,clusterrolebindings -A` and checking the subjects.
+func (shared *SharedData) hasDirectBindings(ctx context.Context, username string) (bool, error) {
+	defer metrics.SlowLog("hasDirectBindings", 100*time.Millisecond)()
+	shared.duCache.lock.Lock()
+	defer shared.duCache.lock.Unlock()
+
+	if !shared.duCache.isValid() {
+		shared.directUsers = nil
+		shared.duCache.err = nil
+		directUsers := map[string]struct{}{}
+		for _, gvr := range []schema.GroupVersionResource{roleBindingsGvr, clusterRoleBindingsGvr} {
+			bindings, err := shared.dynamicClient.Resource(gvr).List(ctx, metav1.ListOptions{})
+			if err != nil {
+				klog.Warning("Error resolving the subjects of the bindings with dynamic client. ", err.Error())
+				shared.duCache.err = err
+				shared.duCache.updatedAt = time.Now()
+				return true, err
+			}
+			for _, item := range bindings.Items {
+				binding := rbacv1.RoleBinding{}
+				if err := runtime.DefaultUnstructuredConverter.FromUnstructured(item.Object, &binding); err != nil {
+					klog.Warningf("Error parsing %s %s. Error: %s", item.GetKind(), item.GetName(), err)
+					continue
+				}
+				addDirectUsers(directUsers, binding.Subjects)
+			}
+		}
+		klog.V(3).Infof("Found %d users and service accounts with direct bindings.", len(directUsers))
+		shared.directUsers = directUsers
+		shared.duCache.updatedAt = time.Now()
+	}
+	if shared.duCache.err != nil {
+		return true, shared.duCache.err
+	}
+	_, direct := shared.directUsers[username]
+	return direct, nil
+}
+
+// Adds the users of a new or modified binding, so they stop sharing the user data before the cache expires.
+func (shared *SharedData) addDirectUsers(subjects []rbacv1.Subject) {
+	shared.duCache.lock.Lock()
+	defer shared.duCache.lock.Unlock()
+	if shared.directUsers != nil {
+		addDirectUsers(shared.directUsers, subjects)
+	}
+}
+
+func addDirectUsers(directUsers map[string]struct{}, subjects []rbacv1.Subject) {
+	for _, subject := range subjects {
+		switch subject.Kind {
+		case rbacv1.UserKind:
+			directUsers[subject.Name] = struct{}{}
+		case rbacv1.ServiceAccountKind:
+			directUsers[fmt.Sprintf("system:serviceaccount:%s:%s", subject.Namespace, subject.Name)] = struct{}{}
+		}
+	}
+}
+
 // Returns a map of managed clusters for which the search add-on has been disabled.
 func (cache *Cache) GetDisabledClusters(ctx context.Context) (*map[string]struct{}, error) {
 	uid, _ := cache.GetUserUID(ctx)
@@ -398,7 +484,7 @@ func buildSearchAddonDisabledQuery(ctx context.Context) (string, error) {
 		LeftOuterJoin(schemaTable2,
 			goqu.On(goqu.L(`"mcInfo".data->>?`, "name").Eq(goqu.L(`"srchAddon".data->>?`, "namespace")),
 				goqu.L(`"srchAddon".data->>?`, "kind").Eq("ManagedClusterAddOn"),
-				goqu.L(`"srchAddon".data->>?`, "name").Eq("search-collector")))
+				goqu.L(`"srchAddon".data->>?`, "name").Eq(searchAddonName)))
 
 	//SELECT CLAUSE
 	selectDs = ds.SelectDistinct(goqu.L(`"mcInfo".data->>?`, "name").As("srchAddonDisabledCluster"))
@@ -41,7 +41,7 @@ func mockResourcesListCache(t *testing.T) (*pgxpoolmock.MockPgxPool, Cache) {
 	}
 
 	return mockPool, Cache{
-		users: map[string]*UserDataCache{},
+		users: newUsersCache(),
 		shared: SharedData{
 			pool:          mockPool,
 			dynamicClient: fakedynclient.NewSimpleDynamicClient(testScheme, mockmc, mockns),
@@ -255,7 +255,7 @@ func Test_getDisabledClusters_UserNotFound(t *testing.T) {
 	disabledClusters := map[string]struct{}{}
 	disabledClusters["disabled1"] = struct{}{}
 	_, mock_cache := mockResourcesListCache(t)
-	mock_cache.tokenReviews = map[string]*tokenReviewCache{}
+	mock_cache.tokenReviews = newTokenReviewsCache()
 	//user's managedclusters
 	manClusters := map[string]struct{}{}
 	manClusters["disabled1"] = struct{}{}
@@ -429,3 +429,25 @@ func Test_Messages_Query(t *testing.T) {
 		t.Errorf("Expected error to be nil, but got : %s", err)
 	}
 }
+
+func Test_GetPropertyTypes_stale(t *testing.T) {
+	mockpool, mock_cache := mockResourcesListCache(t)
+	mock_cache.shared.propTypes = map[string]string{"kind": "string"}
+	mock_cache.shared.propTypesStale = true
+	mockpool.EXPECT().Query(gomock.Any(),
+		gomock.Eq(`SELECT DISTINCT key, jsonb_typeof("value") AS "datatype" FROM "search"."resources", jsonb_each("data")`),
+		gomock.Eq([]interface{}{}),
+	).Return(pgxpoolmock.NewRows([]string{"key", "datatype"}).AddRow("kind", "string").
+		AddRow("size", "number").ToPgxRows(), nil)
+
+	propTypes, err := mock_cache.GetPropertyTypes(context.TODO(), false)
+
+	assert.Nil(t, err)
+	assert.Equal(t, "number", propTypes["size"], "Expected the stale property types to be queried again.")
+	assert.False(t, mock_cache.shared.propTypesStale)
+
+	// The mock pool fails the test if the property types are queried again.
+	propTypes, err = mock_cache.GetPropertyTypes(context.TODO(), false)
+	assert.Nil(t, err)
+	assert.Equal(t, "number", propTypes["size"])
+}
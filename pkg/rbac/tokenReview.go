@@ -7,8 +7,8 @@ import (
 	"time"
 
 	"github.com/stolostron/search-v2-api/pkg/config"
+	"github.com/stolostron/search-v2-api/pkg/metrics"
 	authv1 "k8s.io/api/authentication/v1"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	v1 "k8s.io/client-go/kubernetes/typed/authentication/v1"
 	"k8s.io/klog/v2"
 )
@@ -17,9 +17,8 @@ import (
 type tokenReviewCache struct {
 	meta cacheMetadata
 
-	authClient  v1.AuthenticationV1Interface // This allows tests to replace with mock client.
-	token       string
-	tokenReview *authv1.TokenReview
+	authenticator Authenticator // This allows tests to replace with mock authenticator.
+	tokenReview   *authv1.TokenReview
 }
 
 // Verify that the token is valid using a TokenReview.
@@ -32,26 +31,27 @@ func (c *Cache) IsValidToken(ctx context.Context, token string) (bool, error) {
 // Get the TokenReview response for a given token.
 // Will use cached data if available and valid, otherwise starts a new request.
 func (c *Cache) GetTokenReview(ctx context.Context, token string) (*authv1.TokenReview, error) {
-	c.tokenReviewsLock.Lock()
-	defer c.tokenReviewsLock.Unlock()
-
 	// Check if a TokenReviewCacheRequest exists in the cache or create a new one.
-	cachedTR, tokenExists := c.tokenReviews[token]
+	// The lock isn't held while authenticating, so a slow authentication doesn't block other users.
+	c.tokenReviewsLock.Lock()
+	key := tokenHash(token)
+	cachedTR, tokenExists := c.tokenReviews.get(key)
 	if !tokenExists {
 		cachedTR = &tokenReviewCache{
-			authClient: c.getAuthClient(),
-			token:      token,
+			authenticator: c.getAuthenticator(),
 		}
 		if c.tokenReviews == nil {
-			c.tokenReviews = map[string]*tokenReviewCache{}
+			c.tokenReviews = newTokenReviewsCache()
 		}
-		c.tokenReviews[token] = cachedTR
+		c.tokenReviews.add(key, cachedTR)
 	}
-	return cachedTR.getTokenReview()
+	c.tokenReviewsLock.Unlock()
+	return cachedTR.getTokenReview(token)
 }
 
 // Get the resolved TokenReview from the cached tokenReviewCachedRequest object.
-func (trc *tokenReviewCache) getTokenReview() (*authv1.TokenReview, error) {
+// The token isn't stored in the cache, it's passed by the caller.
+func (trc *tokenReviewCache) getTokenReview(token string) (*authv1.TokenReview, error) {
 	// This ensures that only 1 process is updating the TokenReview data from API request.
 	trc.meta.lock.Lock()
 	defer trc.meta.lock.Unlock()
@@ -59,24 +59,19 @@ func (trc *tokenReviewCache) getTokenReview() (*authv1.TokenReview, error) {
 	// Check if cached TokenReview data is valid. Update if needed.
 	if time.Now().After(trc.meta.updatedAt.Add(time.Duration(config.Cfg.AuthCacheTTL) * time.Millisecond)) {
 		klog.V(6).Infof("Starting TokenReview. tokenReviewCache expired or never updated. UpdatedAt %s", trc.meta.updatedAt)
+		metrics.CacheMisses.WithLabelValues("tokenReviews").Inc()
 
-		tr := authv1.TokenReview{
-			Spec: authv1.TokenReviewSpec{
-				Token: trc.token,
-			},
-		}
-
-		result, err := trc.authClient.TokenReviews().Create(context.TODO(), &tr, metav1.CreateOptions{})
+		result, err := trc.authenticator.Authenticate(context.TODO(), token)
 		if err != nil {
-			klog.Warning("Error resolving TokenReview from Kube API.", err.Error())
+			klog.Warning("Error authenticating the token.", err.Error())
 		}
-		klog.V(9).Infof("TokenReview Kube API result: %v\n", prettyPrint(result.Status))
 
 		trc.meta.updatedAt = time.Now()
 		trc.meta.err = err
 		trc.tokenReview = result
 	} else {
 		klog.V(6).Info("Using cached TokenReview.")
+		metrics.CacheHits.WithLabelValues("tokenReviews").Inc()
 	}
 
 	return trc.tokenReview, trc.meta.err
@@ -88,6 +83,15 @@ func prettyPrint(i interface{}) string {
 	return string(s)
 }
 
+// Returns the authenticator selected by the configuration. Tokens that can't be validated
+// locally are validated with a TokenReview.
+func (c *Cache) getAuthenticator() Authenticator {
+	if c.authenticator == nil {
+		c.authenticator = newAuthenticator(c.getAuthClient())
+	}
+	return c.authenticator
+}
+
 // Utility to allow tests to inject a fake client to mock the k8s api call.
 func (c *Cache) getAuthClient() v1.AuthenticationV1Interface {
 	if c.authnClient == nil {
@@ -16,7 +16,7 @@ func newMockCache() Cache {
 	return Cache{
 		// Use a fake Kubernetes authentication client.
 		authnClient:      fake.NewSimpleClientset().AuthenticationV1(),
-		tokenReviews:     map[string]*tokenReviewCache{},
+		tokenReviews:     newTokenReviewsCache(),
 		tokenReviewsLock: sync.Mutex{},
 	}
 }
@@ -42,14 +42,14 @@ func Test_IsValidToken_emptyCache(t *testing.T) {
 func Test_IsValidToken_usingCache(t *testing.T) {
 	// Initialize cache and set state.
 	mock_cache := newMockCache()
-	mock_cache.tokenReviews["1234567890"] = &tokenReviewCache{
+	mock_cache.tokenReviews.add(tokenHash("1234567890"), &tokenReviewCache{
 		meta: cacheMetadata{updatedAt: time.Now()},
 		tokenReview: &authv1.TokenReview{
 			Status: authv1.TokenReviewStatus{
 				Authenticated: true,
 			},
 		},
-	}
+	})
 
 	// Execute function
 	result, err := mock_cache.IsValidToken(context.TODO(), "1234567890")
@@ -67,16 +67,15 @@ func Test_IsValidToken_usingCache(t *testing.T) {
 func Test_IsValidToken_expiredCache(t *testing.T) {
 	// Initialize cache and set state to TokenReview updated 5 minutes ago.
 	mock_cache := newMockCache()
-	mock_cache.tokenReviews["1234567890-expired"] = &tokenReviewCache{
-		authClient: fake.NewSimpleClientset().AuthenticationV1(),
-		meta:       cacheMetadata{updatedAt: time.Now().Add(time.Duration(-5) * time.Minute)},
-		token:      "1234567890-expired",
+	mock_cache.tokenReviews.add(tokenHash("1234567890-expired"), &tokenReviewCache{
+		authenticator: &tokenReviewAuthenticator{authClient: fake.NewSimpleClientset().AuthenticationV1()},
+		meta:          cacheMetadata{updatedAt: time.Now().Add(time.Duration(-5) * time.Minute)},
 		tokenReview: &authv1.TokenReview{
 			Status: authv1.TokenReviewStatus{
 				Authenticated: true,
 			},
 		},
-	}
+	})
 
 	// Execute function
 	result, err := mock_cache.IsValidToken(context.TODO(), "1234567890-expired")
@@ -89,7 +88,7 @@ func Test_IsValidToken_expiredCache(t *testing.T) {
 		t.Error("Received unexpected error from IsValidToken()", err)
 	}
 	// Verify that cache was updated within the last 1 millisecond.
-	if mock_cache.tokenReviews["1234567890-expired"].meta.updatedAt.Before(time.Now().Add(time.Duration(-1) * time.Millisecond)) {
+	if mock_cache.tokenReviews.value(tokenHash("1234567890-expired")).meta.updatedAt.Before(time.Now().Add(time.Duration(-1) * time.Millisecond)) {
 		t.Error("Expected the cached TokenReview to be updated within the last millisecond.")
 	}
 
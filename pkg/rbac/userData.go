@@ -3,6 +3,9 @@ package rbac
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"sort"
@@ -22,11 +25,19 @@ import (
 
 const impersonationConfigCreationerror = "error creating clientset with impersonation config"
 
+// Error returned when the user's access can't be resolved.
+var ErrUserAccess = errors.New("unable to resolve query because of error while resolving user's access")
+
 // Contains data about the resources the user is allowed to access.
 type UserData struct {
 	CsResources     []Resource            // Cluster-scoped resources on hub the user has list access.
 	NsResources     map[string][]Resource // Namespaced resources on hub the user has list access.
 	ManagedClusters map[string]struct{}   // Managed clusters where the user has view access.
+	// Resources on hub the user can list only by name, from rules with resourceNames.
+	CsResourceNames map[Resource][]string            // Cluster-scoped resources and the names.
+	NsResourceNames map[string]map[Resource][]string // Namespaced resources and the names. Key: namespace.
+	// Namespaced resources on managed clusters the user has list access, from the permission provider.
+	ManagedClusterResources ManagedClusterResources
 }
 
 // Extend UserData with caching information.
@@ -39,6 +50,10 @@ type UserDataCache struct {
 	csrCache      cacheMetadata
 	nsrCache      cacheMetadata
 
+	// Cluster-scoped resources with resourceNames from the SelfSubjectRulesReviews. These are verified
+	// with a SelfSubjectAccessReview, because a RoleBinding doesn't grant access to cluster-scoped resources.
+	csNameCandidates map[Resource][]string
+
 	// Client to external API to be replaced with a mock by unit tests.
 	authzClient v1.AuthorizationV1Interface
 }
@@ -46,6 +61,12 @@ type UserDataCache struct {
 // Get user's UID
 // Note: kubeadmin gets an empty string for uid
 func (cache *Cache) GetUserUID(ctx context.Context) (string, authv1.UserInfo) {
+	if userInfo, ok := GetImpersonatedUser(ctx); ok {
+		return impersonatedUserUID(userInfo), userInfo
+	}
+	if userInfo, ok := GetCertUser(ctx); ok {
+		return certUserUID(userInfo), userInfo
+	}
 	authKey := ctx.Value(ContextAuthTokenKey)
 	if authKey != nil {
 		clientToken := authKey.(string)
@@ -65,6 +86,31 @@ func (cache *Cache) GetUserUID(ctx context.Context) (string, authv1.UserInfo) {
 	}
 }
 
+// Returns the key to cache the user data. When ShareUserDataByGroups is enabled, users without direct
+// bindings have the same access as the other users in the same groups, so they share the user data.
+// Users with direct bindings, or when the bindings can't be checked, use their own user data.
+func (cache *Cache) userDataKey(ctx context.Context, uid string, userInfo authv1.UserInfo) string {
+	// The managed cluster permission providers can grant access to a user, which isn't in the bindings.
+	if !config.Cfg.ShareUserDataByGroups || cache.permissionProvider != nil || userInfo.Username == "" {
+		return uid
+	}
+	if direct, err := cache.shared.hasDirectBindings(ctx, userInfo.Username); err != nil || direct {
+		return uid
+	}
+	// The extra fields are included because they can restrict the access, like the scopes of OpenShift tokens.
+	groups := append([]string{}, userInfo.Groups...)
+	sort.Strings(groups)
+	equivalence, err := json.Marshal(struct {
+		Groups []string
+		Extra  map[string]authv1.ExtraValue
+	}{groups, userInfo.Extra})
+	if err != nil {
+		return uid
+	}
+	sum := sha256.Sum256(equivalence)
+	return "groups:" + hex.EncodeToString(sum[:16])
+}
+
 func (cache *Cache) GetUserDataCache(ctx context.Context,
 	authzClient v1.AuthorizationV1Interface) (*UserDataCache, error) {
 
@@ -76,21 +122,21 @@ func (cache *Cache) GetUserDataCache(ctx context.Context,
 	if uid, userInfo = cache.GetUserUID(ctx); uid == "noUidFound" {
 		return user, fmt.Errorf("cannot find user with uid: %s", uid)
 	}
-	clientToken := ctx.Value(ContextAuthTokenKey).(string)
+	clientToken, _ := ctx.Value(ContextAuthTokenKey).(string) // Not set for users with a client certificate.
+	key := cache.userDataKey(ctx, uid, userInfo)
 
 	cache.usersLock.Lock()
 	defer cache.usersLock.Unlock()
-	cachedUserData, userDataExists := cache.users[uid] //check if userData cache for user already exists
+	cachedUserData, userDataExists := cache.users.get(key) //check if userData cache for user already exists
 
 	// UserDataExists and its valid
 	if userDataExists && cachedUserData.isValid() {
 		klog.V(5).Info("Using user data from cache.")
+		metrics.CacheHits.WithLabelValues("users").Inc()
 
 		return cachedUserData, nil
 	} else {
-		if cache.users == nil {
-			cache.users = map[string]*UserDataCache{}
-		}
+		metrics.CacheMisses.WithLabelValues("users").Inc()
 		// User not in cache , Initialize and assign to the UID
 		user = &UserDataCache{
 			userInfo:      userInfo,
@@ -99,9 +145,9 @@ func (cache *Cache) GetUserDataCache(ctx context.Context,
 			nsrCache:      cacheMetadata{ttl: time.Duration(config.Cfg.UserCacheTTL) * time.Millisecond},
 		}
 		if cache.users == nil {
-			cache.users = map[string]*UserDataCache{}
+			cache.users = newUsersCache()
 		}
-		cache.users[uid] = user
+		cache.users.add(key, user)
 
 		// We want to setup the client if passed, this is only for unit tests
 		if authzClient != nil {
@@ -126,10 +172,12 @@ func (cache *Cache) GetUserDataCache(ctx context.Context,
 
 	// Get cluster scoped resource access for the user.
 	if err == nil {
-		klog.V(5).Info("No errors on namespacedresources present for: ",
-			cache.tokenReviews[clientToken].tokenReview.Status.User.Username)
+		klog.V(5).Info("No errors on namespacedresources present for: ", userInfo.Username)
 		userDataCache, err = user.getClusterScopedResources(ctx, cache)
 	}
+	if err == nil {
+		user.getManagedClusterResources(ctx, cache)
+	}
 	return userDataCache, err
 }
 
@@ -145,11 +193,13 @@ func (user *UserDataCache) userHasAllAccess(ctx context.Context, cache *Cache) (
 		user.csrCache.lock.Lock()
 		defer user.csrCache.lock.Unlock()
 		user.CsResources = []Resource{{Apigroup: "*", Kind: "*"}}
+		user.CsResourceNames = nil
 		user.csrCache.updatedAt = time.Now()
 
 		user.nsrCache.lock.Lock()
 		defer user.nsrCache.lock.Unlock()
 		user.NsResources = map[string][]Resource{"*": {{Apigroup: "*", Kind: "*"}}}
+		user.NsResourceNames = nil
 		user.nsrCache.updatedAt = time.Now()
 
 		cache.shared.mcCache.lock.Lock()
@@ -168,11 +218,13 @@ func (user *UserDataCache) userHasAllAccess(ctx context.Context, cache *Cache) (
 		user.csrCache.lock.Lock()
 		defer user.csrCache.lock.Unlock()
 		user.CsResources = []Resource{}
+		user.CsResourceNames = nil
 		user.csrCache.updatedAt = time.Now()
 
 		user.nsrCache.lock.Lock()
 		defer user.nsrCache.lock.Unlock()
 		user.NsResources = map[string][]Resource{}
+		user.NsResourceNames = nil
 		user.nsrCache.updatedAt = time.Now()
 
 		cache.shared.mcCache.lock.Lock()
@@ -194,14 +246,17 @@ func (cache *Cache) GetUserData(ctx context.Context) (UserData, error) {
 
 	if userDataErr != nil {
 		klog.Error("Error fetching UserAccessData: ", userDataErr)
-		return UserData{}, errors.New("unable to resolve query because of error while resolving user's access")
+		return UserData{}, ErrUserAccess
 	}
 	// Proceed if user's rbac data exists
 	// Get a copy of the current user access if user data exists
 	userAccess := UserData{
-		CsResources:     userDataCache.GetCsResourcesCopy(),
-		NsResources:     userDataCache.GetNsResourcesCopy(),
-		ManagedClusters: userDataCache.GetManagedClustersCopy(),
+		CsResources:             userDataCache.GetCsResourcesCopy(),
+		NsResources:             userDataCache.GetNsResourcesCopy(),
+		ManagedClusters:         userDataCache.GetManagedClustersCopy(),
+		CsResourceNames:         userDataCache.GetCsResourceNamesCopy(),
+		NsResourceNames:         userDataCache.GetNsResourceNamesCopy(),
+		ManagedClusterResources: userDataCache.GetManagedClusterResourcesCopy(),
 	}
 	return userAccess, nil
 }
@@ -252,22 +307,55 @@ func (user *UserDataCache) getClusterScopedResources(ctx context.Context, cache
 		}(res.Apigroup, res.Kind)
 	}
 	wg.Wait() // Wait for all requests to complete.
+	user.CsResourceNames = user.getClusterScopedResourceNames(ctx, impersClientSet)
 
 	uid, userInfo := cache.GetUserUID(ctx)
 	klog.V(7).Infof("User %s with uid: %s has access to these cluster scoped res: %+v \n", userInfo.Username, uid,
 		user.CsResources)
+	klog.V(7).Infof("User %s with uid: %s has access to these cluster scoped res by name: %+v \n",
+		userInfo.Username, uid, user.CsResourceNames)
 	user.csrCache.updatedAt = time.Now()
 	return user, user.csrCache.err
 }
 
+// Get the cluster-scoped resources the user is authorized to list only by name. Checks each name from the
+// resourceNames rules, unless the user is authorized to list all resources of the kind.
+// Equivalent to: oc auth can-i list <resource>/<name> --as=<user>
+func (user *UserDataCache) getClusterScopedResourceNames(ctx context.Context,
+	authzClient v1.AuthorizationV1Interface) map[Resource][]string {
+	authorized := map[Resource]struct{}{}
+	for _, res := range user.CsResources {
+		authorized[res] = struct{}{}
+	}
+	resourceNames := map[Resource][]string{}
+	for res, names := range user.csNameCandidates {
+		if _, found := authorized[res]; found {
+			continue
+		}
+		for _, name := range names {
+			if user.userAuthorizedNameSSAR(ctx, authzClient, "list", res.Apigroup, res.Kind, name) {
+				resourceNames[res] = append(resourceNames[res], name)
+			}
+		}
+	}
+	return resourceNames
+}
+
 func (user *UserDataCache) userAuthorizedListSSAR(ctx context.Context, authzClient v1.AuthorizationV1Interface,
 	verb string, apigroup string, kindPlural string) bool {
+	return user.userAuthorizedNameSSAR(ctx, authzClient, verb, apigroup, kindPlural, "")
+}
+
+// Same as userAuthorizedListSSAR, for a resource with the given name.
+func (user *UserDataCache) userAuthorizedNameSSAR(ctx context.Context, authzClient v1.AuthorizationV1Interface,
+	verb string, apigroup string, kindPlural string, name string) bool {
 	accessCheck := &authz.SelfSubjectAccessReview{
 		Spec: authz.SelfSubjectAccessReviewSpec{
 			ResourceAttributes: &authz.ResourceAttributes{
 				Verb:     verb,
 				Group:    apigroup,
 				Resource: kindPlural,
+				Name:     name,
 			},
 		},
 	}
@@ -327,7 +415,7 @@ func (user *UserDataCache) getSSRRforNamespace(ctx context.Context, cache *Cache
 				for _, res := range rule.Resources {
 					for _, api := range rule.APIGroups {
 						// Add the resource if it is not cluster scoped
-						// fail-safe mechanism to avoid whitelist - TODO: incorporate whitelist
+						// Resources restricted with resourceNames are added to NsResourceNames.
 						if !cache.shared.isClusterScoped(res, api) && (len(rule.ResourceNames) == 0 ||
 							(len(rule.ResourceNames) > 0 && rule.ResourceNames[0] == "*")) {
 							// if the user has access to all resources, reset userData.NsResources for the namespace
@@ -335,6 +423,7 @@ func (user *UserDataCache) getSSRRforNamespace(ctx context.Context, cache *Cache
 							// exit the resourceRulesLoop
 							if res == "*" && api == "*" {
 								user.NsResources[ns] = []Resource{{Apigroup: api, Kind: res}}
+								delete(user.NsResourceNames, ns)
 								klog.V(5).Infof("User %s with uid: %s has access to everything in the namespace %s",
 									user.userInfo.Username, user.userInfo.UID, ns)
 
@@ -352,9 +441,15 @@ func (user *UserDataCache) getSSRRforNamespace(ctx context.Context, cache *Cache
 						} else if cache.shared.isClusterScoped(res, api) {
 							klog.V(6).Info("Got clusterscoped resource ", api, "/",
 								res, " from SelfSubjectRulesReviews. Excluding it from ns scoped resoures.")
+							if len(rule.ResourceNames) > 0 && rule.ResourceNames[0] != "*" {
+								user.csNameCandidates = addResourceNames(user.csNameCandidates,
+									Resource{Apigroup: api, Kind: res}, rule.ResourceNames)
+							}
 						} else if len(rule.ResourceNames) > 0 && rule.ResourceNames[0] != "*" {
-							klog.V(5).Info("Got whitelist in resourcenames. Excluding resource", api, "/", res,
-								" from ns scoped resoures.")
+							klog.V(5).Info("Got resourcenames for resource ", api, "/", res,
+								". Restricting the ns scoped resource to the names.")
+							user.NsResourceNames[ns] = addResourceNames(user.NsResourceNames[ns],
+								Resource{Apigroup: api, Kind: res}, rule.ResourceNames)
 						}
 					}
 				}
@@ -374,6 +469,13 @@ func (user *UserDataCache) getSSRRforNamespace(ctx context.Context, cache *Cache
 			}
 		}
 	}
+	// The names aren't needed when the user is authorized to list all resources of the kind.
+	for _, res := range user.NsResources[ns] {
+		delete(user.NsResourceNames[ns], res)
+	}
+	if len(user.NsResourceNames[ns]) == 0 {
+		delete(user.NsResourceNames, ns)
+	}
 	//Sort the user's namespace resources so that it is easier to consolidate them
 	sort.Slice(user.NsResources[ns][:], func(i, j int) bool {
 		resAKind := user.NsResources[ns][i].Kind
@@ -400,6 +502,8 @@ func (user *UserDataCache) getNamespacedResources(cache *Cache, ctx context.Cont
 	// Clear cached data
 	user.nsrCache.err = nil
 	user.NsResources = make(map[string][]Resource)
+	user.NsResourceNames = make(map[string]map[Resource][]string)
+	user.csNameCandidates = nil
 	user.clustersCache.err = nil
 	user.ManagedClusters = make(map[string]struct{})
 
@@ -497,6 +601,22 @@ func (user *UserDataCache) GetNsResourcesCopy() map[string][]Resource {
 	return nsResourcesCopy
 }
 
+func (user *UserDataCache) GetCsResourceNamesCopy() map[Resource][]string {
+	user.csrCache.lock.Lock()
+	defer user.csrCache.lock.Unlock()
+	return copyResourceNames(user.CsResourceNames)
+}
+
+func (user *UserDataCache) GetNsResourceNamesCopy() map[string]map[Resource][]string {
+	user.nsrCache.lock.Lock()
+	defer user.nsrCache.lock.Unlock()
+	nsResourceNamesCopy := make(map[string]map[Resource][]string)
+	for ns, resourceNames := range user.NsResourceNames {
+		nsResourceNamesCopy[ns] = copyResourceNames(resourceNames)
+	}
+	return nsResourceNamesCopy
+}
+
 func (user *UserDataCache) GetManagedClustersCopy() map[string]struct{} {
 	user.clustersCache.lock.Lock()
 	defer user.clustersCache.lock.Unlock()
@@ -506,3 +626,40 @@ func (user *UserDataCache) GetManagedClustersCopy() map[string]struct{} {
 	}
 	return mcCopy
 }
+
+// Returns when the user data was computed. Uses the oldest of the cluster-scoped resources, namespaced
+// resources and managed clusters, which are refreshed independently.
+func (user *UserDataCache) GetUpdatedAt() time.Time {
+	updatedAt := user.csrCache.getUpdatedAt()
+	for _, t := range []time.Time{user.nsrCache.getUpdatedAt(), user.clustersCache.getUpdatedAt()} {
+		if t.Before(updatedAt) {
+			updatedAt = t
+		}
+	}
+	return updatedAt
+}
+
+// Adds the names from a resourceNames rule to the resource. The names are sorted and without duplicates.
+func addResourceNames(resourceNames map[Resource][]string, res Resource, names []string) map[Resource][]string {
+	if resourceNames == nil {
+		resourceNames = map[Resource][]string{}
+	}
+	merged := append(append([]string{}, resourceNames[res]...), names...)
+	sort.Strings(merged)
+	unique := merged[:0]
+	for i, name := range merged {
+		if i == 0 || name != merged[i-1] {
+			unique = append(unique, name)
+		}
+	}
+	resourceNames[res] = unique
+	return resourceNames
+}
+
+func copyResourceNames(resourceNames map[Resource][]string) map[Resource][]string {
+	resourceNamesCopy := make(map[Resource][]string)
+	for res, names := range resourceNames {
+		resourceNamesCopy[res] = names
+	}
+	return resourceNamesCopy
+}
@@ -8,11 +8,14 @@ import (
 	"testing"
 	"time"
 
+	"github.com/stolostron/search-v2-api/pkg/config"
 	"github.com/stretchr/testify/assert"
 	authv1 "k8s.io/api/authentication/v1"
 	authz "k8s.io/api/authorization/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	fakedynclient "k8s.io/client-go/dynamic/fake"
 	fake "k8s.io/client-go/kubernetes/fake"
 
 	"k8s.io/client-go/rest"
@@ -23,21 +26,21 @@ import (
 func mockNamespaceCache() *Cache {
 
 	return &Cache{
-		users:            map[string]*UserDataCache{},
+		users:            newUsersCache(),
 		shared:           SharedData{},
 		restConfig:       &rest.Config{},
-		tokenReviews:     map[string]*tokenReviewCache{},
+		tokenReviews:     newTokenReviewsCache(),
 		tokenReviewsLock: sync.Mutex{},
 	}
 }
 
 func setupToken(cache *Cache) *Cache {
 	if cache.tokenReviews == nil {
-		cache.tokenReviews = map[string]*tokenReviewCache{}
+		cache.tokenReviews = newTokenReviewsCache()
 	}
-	cache.tokenReviews["123456"] = &tokenReviewCache{
-		meta:       cacheMetadata{updatedAt: time.Now()},
-		authClient: fake.NewSimpleClientset().AuthenticationV1(),
+	cache.tokenReviews.add(tokenHash("123456"), &tokenReviewCache{
+		meta:          cacheMetadata{updatedAt: time.Now()},
+		authenticator: &tokenReviewAuthenticator{authClient: fake.NewSimpleClientset().AuthenticationV1()},
 		tokenReview: &authv1.TokenReview{
 			Status: authv1.TokenReviewStatus{
 				User: authv1.UserInfo{
@@ -45,12 +48,12 @@ func setupToken(cache *Cache) *Cache {
 				},
 			},
 		},
-	}
+	})
 
 	return cache
 }
 func setupUserDataCache(cache *Cache, ud *UserDataCache) {
-	cache.users["unique-user-id"] = ud
+	cache.users.add("unique-user-id", ud)
 }
 
 func addCSResources(cache *Cache, res []Resource) *Cache {
@@ -116,6 +119,56 @@ func Test_getNamespaces_emptyCache(t *testing.T) {
 
 }
 
+func Test_getNamespaces_resourceNames(t *testing.T) {
+	mock_cache := mockNamespaceCache()
+	mock_cache = setupToken(mock_cache)
+	mock_cache.shared.namespaces = []string{"some-namespace"}
+	mock_cache.shared.nsCache.updatedAt = time.Now()
+	mock_cache = addCSResources(mock_cache, []Resource{{Apigroup: "", Kind: "nodes"}})
+
+	rulesCheck := &authz.SelfSubjectRulesReview{
+		Status: authz.SubjectRulesReviewStatus{
+			ResourceRules: []authz.ResourceRule{
+				{Verbs: []string{"list"}, APIGroups: []string{""}, Resources: []string{"configmaps"}},
+				{Verbs: []string{"get", "list"}, APIGroups: []string{""}, Resources: []string{"secrets"},
+					ResourceNames: []string{"secret-b", "secret-a"}},
+				{Verbs: []string{"list"}, APIGroups: []string{""}, Resources: []string{"secrets"},
+					ResourceNames: []string{"secret-a", "secret-c"}},
+				// The names aren't needed, because the user can list all configmaps.
+				{Verbs: []string{"list"}, APIGroups: []string{""}, Resources: []string{"configmaps"},
+					ResourceNames: []string{"config"}},
+				// Cluster-scoped, the names are verified with a SelfSubjectAccessReview.
+				{Verbs: []string{"list"}, APIGroups: []string{""}, Resources: []string{"nodes"},
+					ResourceNames: []string{"node-1", "node-2"}},
+			},
+		},
+	}
+	fs := fake.Clientset{}
+	fs.AddReactor("create", "selfsubjectaccessreviews", func(action testingk8s.Action) (handled bool,
+		ret runtime.Object, err error) {
+		ssar := action.(testingk8s.CreateAction).GetObject().(*authz.SelfSubjectAccessReview)
+		// Mimic a RoleBinding granting node-2, which doesn't grant access to the cluster-scoped resource.
+		ssar.Status.Allowed = ssar.Spec.ResourceAttributes.Resource == "nodes" &&
+			ssar.Spec.ResourceAttributes.Name == "node-1"
+		return true, ssar, nil
+	})
+	fs.AddReactor("create", "selfsubjectrulesreviews", func(action testingk8s.Action) (handled bool,
+		ret runtime.Object, err error) {
+		return true, rulesCheck, nil
+	})
+	ctx := context.WithValue(context.Background(), ContextAuthTokenKey, "123456")
+	result, err := mock_cache.GetUserDataCache(ctx, fs.AuthorizationV1())
+
+	assert.Nil(t, err)
+	assert.Equal(t, []Resource{{Apigroup: "", Kind: "configmaps"}}, result.NsResources["some-namespace"])
+	assert.Equal(t, map[string]map[Resource][]string{
+		"some-namespace": {{Apigroup: "", Kind: "secrets"}: {"secret-a", "secret-b", "secret-c"}},
+	}, result.GetNsResourceNamesCopy())
+	assert.Empty(t, result.CsResources)
+	assert.Equal(t, map[Resource][]string{{Apigroup: "", Kind: "nodes"}: {"node-1"}},
+		result.GetCsResourceNamesCopy())
+}
+
 func Test_getNamespaces_usingCache(t *testing.T) {
 	var namespaces []string
 	nsresources := make(map[string][]Resource)
@@ -134,13 +187,13 @@ func Test_getNamespaces_usingCache(t *testing.T) {
 	nsresources["some-namespace"] = append(nsresources["some-namespace"],
 		Resource{Apigroup: "some-apigroup", Kind: "some-kind"})
 
-	mock_cache.users["unique-user-id"] = &UserDataCache{
+	mock_cache.users.add("unique-user-id", &UserDataCache{
 		UserData: UserData{ManagedClusters: managedclusters,
 			NsResources: nsresources},
 		csrCache:      cacheMetadata{updatedAt: time.Now()},
 		nsrCache:      cacheMetadata{updatedAt: time.Now()},
 		clustersCache: cacheMetadata{updatedAt: time.Now()},
-	}
+	})
 
 	rulesCheck := &authz.SelfSubjectRulesReview{
 		Spec: authz.SelfSubjectRulesReviewSpec{
@@ -203,10 +256,10 @@ func Test_getNamespaces_expiredCache(t *testing.T) {
 		Resource{Apigroup: "some-apigroup", Kind: "some-kind"})
 
 	last_cache_time := time.Now().Add(time.Duration(-5) * time.Minute)
-	mock_cache.users["unique-user-id"] = &UserDataCache{
+	mock_cache.users.add("unique-user-id", &UserDataCache{
 		UserData: UserData{NsResources: nsresources},
 		nsrCache: cacheMetadata{updatedAt: last_cache_time},
-	}
+	})
 	rulesCheck := &authz.SelfSubjectRulesReview{
 		Spec: authz.SelfSubjectRulesReviewSpec{
 			Namespace: "some-namespace",
@@ -251,7 +304,7 @@ func Test_getNamespaces_expiredCache(t *testing.T) {
 	}
 
 	//  Verify that cache was updated by checking the timestamp
-	if !mock_cache.users["unique-user-id"].nsrCache.updatedAt.After(last_cache_time) {
+	if !mock_cache.users.value("unique-user-id").nsrCache.updatedAt.After(last_cache_time) {
 		t.Error("Expected the cache.users.updatedAt to have a later timestamp")
 	}
 }
@@ -264,7 +317,7 @@ func Test_clusterScoped_usingCache(t *testing.T) {
 	mock_cache = addCSResources(mock_cache, res)
 
 	//mock cache for cluster-scoped resouces
-	mock_cache.users["unique-user-id"] = &UserDataCache{
+	mock_cache.users.add("unique-user-id", &UserDataCache{
 		UserData: UserData{
 			CsResources:     []Resource{{Apigroup: "storage.k8s.io", Kind: "nodes"}},
 			ManagedClusters: map[string]struct{}{"some-namespace": {}}},
@@ -272,7 +325,7 @@ func Test_clusterScoped_usingCache(t *testing.T) {
 		// Using current time , GetUserData should have the same values as cache
 		csrCache: cacheMetadata{updatedAt: time.Now()},
 		nsrCache: cacheMetadata{updatedAt: time.Now()},
-	}
+	})
 	ctx := context.WithValue(context.Background(), ContextAuthTokenKey, "123456")
 
 	result, err := mock_cache.GetUserDataCache(ctx, nil)
@@ -339,13 +392,13 @@ func Test_clusterScoped_expiredCache(t *testing.T) {
 	// Setup a allowed resource , we have have access to this resource through falseCheck Object
 	// So when the next GetUserData executes user should not have this resource in allowed list
 	last_cache_time := time.Now().Add(time.Duration(-5) * time.Minute)
-	mock_cache.users["unique-user-id"] = &UserDataCache{
+	mock_cache.users.add("unique-user-id", &UserDataCache{
 		UserData: UserData{
 			CsResources: []Resource{{Apigroup: "k8s.io", Kind: "csinodes"}},
 		},
 		csrCache:    cacheMetadata{updatedAt: last_cache_time},
 		authzClient: fs.AuthorizationV1(),
-	}
+	})
 
 	ctx := context.WithValue(context.Background(), ContextAuthTokenKey, "123456")
 	result, err := mock_cache.GetUserDataCache(ctx, fs.AuthorizationV1())
@@ -359,7 +412,7 @@ func Test_clusterScoped_expiredCache(t *testing.T) {
 	}
 
 	//  Verify that cache was updated by checking the timestamp
-	if !mock_cache.users["unique-user-id"].csrCache.updatedAt.After(last_cache_time) {
+	if !mock_cache.users.value("unique-user-id").csrCache.updatedAt.After(last_cache_time) {
 		t.Error("Expected the cache.users.updatedAt to have a later timestamp")
 	}
 
@@ -448,7 +501,7 @@ func Test_managedClusters_usingCache(t *testing.T) {
 	mock_cache = addCSResources(mock_cache, res)
 
 	//mock cache for cluster-scoped resouces
-	mock_cache.users["unique-user-id"] = &UserDataCache{
+	mock_cache.users.add("unique-user-id", &UserDataCache{
 		UserData: UserData{
 			CsResources:     []Resource{{Apigroup: "storage.k8s.io", Kind: "nodes"}},
 			ManagedClusters: map[string]struct{}{"some-managed-cluster": {}, "some-other-managed-cluster": {}},
@@ -457,7 +510,7 @@ func Test_managedClusters_usingCache(t *testing.T) {
 		// Using current time , GetUserData should have the same values as cache
 		csrCache: cacheMetadata{updatedAt: time.Now()},
 		nsrCache: cacheMetadata{updatedAt: time.Now()},
-	}
+	})
 	ctx := context.WithValue(context.Background(), ContextAuthTokenKey, "123456")
 
 	result, err := mock_cache.GetUserDataCache(ctx, nil)
@@ -544,11 +597,11 @@ func Test_managedCluster_expiredCache(t *testing.T) {
 	pastManClusters["past-managed-cluster"] = struct{}{}
 
 	last_cache_time := time.Now().Add(time.Duration(-5) * time.Minute)
-	mock_cache.users["unique-user-id"] = &UserDataCache{
+	mock_cache.users.add("unique-user-id", &UserDataCache{
 		UserData:      UserData{ManagedClusters: pastManClusters},
 		clustersCache: cacheMetadata{updatedAt: last_cache_time},
 		authzClient:   fs.AuthorizationV1(),
-	}
+	})
 
 	ctx := context.WithValue(context.Background(), ContextAuthTokenKey, "123456")
 	result, err := mock_cache.GetUserDataCache(ctx, fs.AuthorizationV1())
@@ -561,7 +614,7 @@ func Test_managedCluster_expiredCache(t *testing.T) {
 	}
 
 	//  Verify that cache was updated by checking the timestamp
-	if !mock_cache.users["unique-user-id"].clustersCache.updatedAt.After(last_cache_time) {
+	if !mock_cache.users.value("unique-user-id").clustersCache.updatedAt.After(last_cache_time) {
 		t.Error("Expected the cache.users.updatedAt to have a later timestamp")
 	}
 
@@ -579,20 +632,20 @@ func Test_managedCluster_GetUserData(t *testing.T) {
 	nsRes["ns2"] = []Resource{{Kind: "kind3", Apigroup: ""}, {Kind: "kind4", Apigroup: "v1"}}
 
 	last_cache_time := time.Now().Add(time.Duration(-5) * time.Minute)
-	mock_cache.users["unique-user-id"] = &UserDataCache{
+	mock_cache.users.add("unique-user-id", &UserDataCache{
 		UserData:      UserData{ManagedClusters: managedClusters, CsResources: csRes, NsResources: nsRes},
 		clustersCache: cacheMetadata{updatedAt: last_cache_time},
-	}
-	csResResult := mock_cache.users["unique-user-id"].GetCsResourcesCopy()
+	})
+	csResResult := mock_cache.users.value("unique-user-id").GetCsResourcesCopy()
 	if len(csResResult) != 2 {
 		t.Errorf("Expected 2 clusterScoped resources but got %d", len(csResResult))
 
 	}
-	nsResResult := mock_cache.users["unique-user-id"].GetNsResourcesCopy()
+	nsResResult := mock_cache.users.value("unique-user-id").GetNsResourcesCopy()
 	if len(nsResResult) != 2 {
 		t.Errorf("Expected 2 namespace Scoped resources but got %d", len(nsResResult))
 	}
-	mcResult := mock_cache.users["unique-user-id"].GetManagedClustersCopy()
+	mcResult := mock_cache.users.value("unique-user-id").GetManagedClustersCopy()
 	if len(mcResult) != 1 {
 		t.Errorf("Expected 1 managed cluster but got %d", len(mcResult))
 	}
@@ -617,7 +670,7 @@ func Test_getUserData(t *testing.T) {
 
 	mock_cache := mockNamespaceCache()
 	mock_cache = setupToken(mock_cache)
-	mock_cache.users["unique-user-id"] = &UserDataCache{
+	mock_cache.users.add("unique-user-id", &UserDataCache{
 		UserData: UserData{
 			CsResources:     []Resource{{Apigroup: "storage.k8s.io", Kind: "nodes"}},
 			ManagedClusters: map[string]struct{}{"some-managed-cluster": {}, "some-other-managed-cluster": {}},
@@ -627,7 +680,7 @@ func Test_getUserData(t *testing.T) {
 		clustersCache: cacheMetadata{updatedAt: time.Now()},
 		csrCache:      cacheMetadata{updatedAt: time.Now()},
 		nsrCache:      cacheMetadata{updatedAt: time.Now()},
-	}
+	})
 	ctx := context.WithValue(context.Background(), ContextAuthTokenKey, "123456")
 
 	result, err := mock_cache.GetUserData(ctx)
@@ -852,3 +905,90 @@ func Test_updateUserManagedClusterList(t *testing.T) {
 	}
 	assert.Equal(t, len(managedclusters), len(udc.ManagedClusters))
 }
+
+func Test_GetUpdatedAt(t *testing.T) {
+	oldest := time.Now().Add(-time.Minute)
+	user := &UserDataCache{
+		csrCache:      cacheMetadata{updatedAt: time.Now()},
+		nsrCache:      cacheMetadata{updatedAt: oldest},
+		clustersCache: cacheMetadata{updatedAt: time.Now()},
+	}
+
+	assert.Equal(t, oldest, user.GetUpdatedAt(), "Expected the time of the oldest cached data.")
+}
+
+// Cache with bob in a RoleBinding and the team-a group in a ClusterRoleBinding.
+func mockSharedUserDataCache(t *testing.T) *Cache {
+	config.Cfg.ShareUserDataByGroups = true
+	t.Cleanup(func() { config.Cfg.ShareUserDataByGroups = false })
+	dynamicClient := fakedynclient.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{
+			roleBindingsGvr:        "RoleBindingList",
+			clusterRoleBindingsGvr: "ClusterRoleBindingList",
+		},
+		newMockBinding("RoleBinding", "app-a", "1", "Role", "viewer",
+			map[string]interface{}{"kind": "User", "name": "bob"}),
+		newMockBinding("ClusterRoleBinding", "", "1", "ClusterRole", "viewer",
+			map[string]interface{}{"kind": "Group", "name": "team-a"}))
+	return &Cache{users: newUsersCache(), shared: SharedData{dynamicClient: dynamicClient}}
+}
+
+func Test_userDataKey_sharedByGroups(t *testing.T) {
+	mock_cache := mockSharedUserDataCache(t)
+
+	alice := mock_cache.userDataKey(context.TODO(), "uid-alice",
+		authv1.UserInfo{Username: "alice", Groups: []string{"team-a", "system:authenticated"}})
+	carol := mock_cache.userDataKey(context.TODO(), "uid-carol",
+		authv1.UserInfo{Username: "carol", Groups: []string{"system:authenticated", "team-a"}})
+	bob := mock_cache.userDataKey(context.TODO(), "uid-bob",
+		authv1.UserInfo{Username: "bob", Groups: []string{"team-a", "system:authenticated"}})
+	scoped := mock_cache.userDataKey(context.TODO(), "uid-dave", authv1.UserInfo{Username: "dave",
+		Groups: []string{"team-a", "system:authenticated"},
+		Extra:  map[string]authv1.ExtraValue{"scopes.authorization.openshift.io": {"user:info"}}})
+
+	assert.Equal(t, alice, carol, "Expected users with the same groups to share the user data.")
+	assert.Contains(t, alice, "groups:")
+	assert.Equal(t, "uid-bob", bob, "Expected users with direct bindings to use their own user data.")
+	assert.NotEqual(t, alice, scoped, "Expected users with different scopes to use different user data.")
+}
+
+func Test_userDataKey_newDirectBinding(t *testing.T) {
+	mock_cache := mockSharedUserDataCache(t)
+	userInfo := authv1.UserInfo{Username: "alice", Groups: []string{"team-a"}}
+	assert.NotEqual(t, "uid-alice", mock_cache.userDataKey(context.TODO(), "uid-alice", userInfo))
+
+	mock_cache.bindingChanged(newMockBinding("RoleBinding", "app-b", "1", "Role", "admin",
+		map[string]interface{}{"kind": "User", "name": "alice"}))
+
+	assert.Equal(t, "uid-alice", mock_cache.userDataKey(context.TODO(), "uid-alice", userInfo),
+		"Expected the user to stop sharing the user data after adding a direct binding.")
+}
+
+func Test_userDataKey_disabled(t *testing.T) {
+	mock_cache := mockSharedUserDataCache(t)
+	config.Cfg.ShareUserDataByGroups = false
+
+	key := mock_cache.userDataKey(context.TODO(), "uid-alice", authv1.UserInfo{Username: "alice"})
+
+	assert.Equal(t, "uid-alice", key)
+}
+
+func Test_GetUserDataCache_sharedByGroups(t *testing.T) {
+	mock_cache := mockSharedUserDataCache(t)
+	groups := []string{"team-a"}
+	key := mock_cache.userDataKey(context.TODO(), "uid-alice", authv1.UserInfo{Username: "alice", Groups: groups})
+	aliceData := &UserDataCache{
+		userInfo:      authv1.UserInfo{Username: "alice", Groups: groups},
+		csrCache:      cacheMetadata{updatedAt: time.Now()},
+		nsrCache:      cacheMetadata{updatedAt: time.Now()},
+		clustersCache: cacheMetadata{updatedAt: time.Now()},
+	}
+	mock_cache.users.add(key, aliceData)
+	ctx := context.WithValue(context.Background(), ContextCertUserKey, authv1.UserInfo{Username: "carol", Groups: groups})
+
+	// The cached data is used, so the test fails if the access is requested from the Kube API.
+	result, err := mock_cache.GetUserDataCache(ctx, nil)
+
+	assert.Nil(t, err)
+	assert.Same(t, aliceData, result)
+}
@@ -0,0 +1,225 @@
+// Copyright Contributors to the Open Cluster Management project
+package resolver
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/doug-martin/goqu/v9"
+	"github.com/driftprogramming/pgxpoolmock"
+	"github.com/stolostron/search-v2-api/graph/model"
+	"github.com/stolostron/search-v2-api/pkg/config"
+	db "github.com/stolostron/search-v2-api/pkg/database"
+	"github.com/stolostron/search-v2-api/pkg/metrics"
+	"github.com/stolostron/search-v2-api/pkg/rbac"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	klog "k8s.io/klog/v2"
+)
+
+type ClusterStatusResult struct {
+	pool     pgxpoolmock.PgxPool
+	clusters []string
+	userData rbac.UserData
+}
+
+// Status of the search collector on a managed cluster, from the Available condition of the search-collector
+// ManagedClusterAddOn. The add-on manager sets the condition from the lease the collector renews while it runs,
+// so the condition changes to Unknown or False when the collector stops reporting.
+type collectorStatus struct {
+	available      bool
+	lastTransition time.Time // Last change of the Available condition.
+	lastUpdated    time.Time // Time the data was last known to be current.
+}
+
+// Caches the resource count and the collector status of all the managed clusters. The data is shared across
+// users and refreshed using the shared cache TTL, so the messages query doesn't group all the resources each time.
+type clusterStatusData struct {
+	counts     map[string]int // Key: cluster
+	collectors map[string]collectorStatus
+	updatedAt  time.Time
+	lock       sync.Mutex
+}
+
+var clusterStatusCache = &clusterStatusData{}
+
+var managedClusterAddonGvr = schema.GroupVersionResource{
+	Group:    "addon.open-cluster-management.io",
+	Version:  "v1alpha1",
+	Resource: "managedclusteraddons",
+}
+
+// Tests will replace this function to avoid listing the add-ons with the kubernetes client.
+var listCollectorAddons = func(ctx context.Context) ([]unstructured.Unstructured, error) {
+	list, err := config.GetDynamicClient().Resource(managedClusterAddonGvr).
+		List(ctx, metav1.ListOptions{FieldSelector: "metadata.name=search-collector"})
+	if err != nil {
+		return nil, err
+	}
+	return list.Items, nil
+}
+
+func ClusterStatus(ctx context.Context, clusters []*string) ([]*model.ClusterStatus, error) {
+	defer metrics.SlowLog("ClusterStatusResolver", 0)()
+	userData, userDataErr := rbac.GetCache().GetUserData(ctx)
+	if userDataErr != nil {
+		return []*model.ClusterStatus{}, userDataErr
+	}
+	clusterStatus := &ClusterStatusResult{
+		pool:     db.GetConnPool(ctx),
+		clusters: PointerToStringArray(clusters),
+		userData: userData,
+	}
+	return clusterStatus.clusterStatusResults(ctx)
+}
+
+// Counts the resources of all the managed clusters. The results are filtered for each user from the cache.
+// Sample query: SELECT "cluster", COUNT(*) AS "count" FROM "search"."resources"
+// WHERE ("cluster" != 'local-cluster') GROUP BY "cluster"
+func buildClusterStatusQuery() (string, []interface{}, error) {
+	query, params, err := goqu.From(goqu.S("search").Table("resources")).
+		Select(goqu.C("cluster"), goqu.COUNT(goqu.Star()).As("count")).
+		Where(goqu.C("cluster").Neq("local-cluster")).GroupBy(goqu.C("cluster")).ToSQL()
+	if err != nil {
+		klog.Errorf("Error building clusterStatus query: %s", err.Error())
+		return "", nil, err
+	}
+	klog.V(5).Info("ClusterStatus Query: ", query)
+	return query, params, nil
+}
+
+// Returns the resource counts and the collector status of all the managed clusters. Uses the cached data
+// if it's newer than the shared cache TTL. Errors aren't cached, so the next request tries again.
+func (c *clusterStatusData) get(ctx context.Context, pool pgxpoolmock.PgxPool) (map[string]int,
+	map[string]collectorStatus, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if !c.updatedAt.IsZero() &&
+		time.Since(c.updatedAt) < time.Duration(config.Cfg.SharedCacheTTL)*time.Millisecond {
+		return c.counts, c.collectors, nil
+	}
+	counts, collectors, err := loadClusterStatus(ctx, pool)
+	if err != nil {
+		return counts, collectors, err
+	}
+	c.counts, c.collectors, c.updatedAt = counts, collectors, time.Now()
+	return counts, collectors, nil
+}
+
+func loadClusterStatus(ctx context.Context, pool pgxpoolmock.PgxPool) (map[string]int,
+	map[string]collectorStatus, error) {
+	counts := map[string]int{}
+	collectors := map[string]collectorStatus{}
+	if pool == nil {
+		return counts, collectors, errors.New("unable to get the cluster status, the database is not available")
+	}
+	query, params, err := buildClusterStatusQuery()
+	if err != nil {
+		return counts, collectors, err
+	}
+	rows, err := pool.Query(ctx, query, params...)
+	if err != nil {
+		klog.Error("Error fetching clusterStatus results from db ", err)
+		return counts, collectors, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var cluster string
+		var count int64
+		if err := rows.Scan(&cluster, &count); err != nil {
+			klog.Error("Error reading clusterStatus results. ", err)
+			continue
+		}
+		counts[cluster] = int(count)
+	}
+
+	checkedAt := time.Now()
+	addons, err := listCollectorAddons(ctx)
+	if err != nil {
+		klog.Warningf("Error listing the search-collector add-ons. The collector status isn't known. Error: %s", err)
+		return counts, collectors, nil
+	}
+	for _, addon := range addons {
+		status, ok := getCollectorStatus(addon)
+		if !ok {
+			continue
+		}
+		// The data is current while the collector is reporting. Otherwise, it's from when the collector stopped.
+		status.lastUpdated = status.lastTransition
+		if status.available {
+			status.lastUpdated = checkedAt
+		}
+		collectors[addon.GetNamespace()] = status // The add-on is in the namespace of the managed cluster.
+	}
+	return counts, collectors, nil
+}
+
+// Reads the Available condition of the add-on. Returns false when the add-on doesn't have the condition.
+func getCollectorStatus(addon unstructured.Unstructured) (collectorStatus, bool) {
+	conditions, _, _ := unstructured.NestedSlice(addon.Object, "status", "conditions")
+	for _, condition := range conditions {
+		c, ok := condition.(map[string]interface{})
+		if !ok || c["type"] != "Available" {
+			continue
+		}
+		status := collectorStatus{available: c["status"] == "True"}
+		if lastTransition, ok := c["lastTransitionTime"].(string); ok {
+			status.lastTransition, _ = time.Parse(time.RFC3339, lastTransition)
+		}
+		return status, true
+	}
+	return collectorStatus{}, false
+}
+
+func (s *ClusterStatusResult) clusterStatusResults(ctx context.Context) ([]*model.ClusterStatus, error) {
+	klog.V(2).Info("Resolving clusterStatusResults()")
+	results := []*model.ClusterStatus{}
+	if len(s.userData.ManagedClusters) == 0 {
+		klog.V(5).Info("User doesn't have access to any managed clusters.")
+		return results, nil
+	}
+	counts, collectors, err := clusterStatusCache.get(ctx, s.pool)
+	if err != nil {
+		return results, err
+	}
+
+	// Only the managed clusters the user is authorized to see.
+	_, allClusters := s.userData.ManagedClusters["*"]
+	requested := map[string]struct{}{}
+	for _, cluster := range s.clusters {
+		requested[cluster] = struct{}{}
+	}
+	clusters := map[string]struct{}{}
+	for cluster := range counts {
+		clusters[cluster] = struct{}{}
+	}
+	for cluster := range collectors {
+		clusters[cluster] = struct{}{}
+	}
+	for cluster := range clusters {
+		if _, ok := s.userData.ManagedClusters[cluster]; !ok && (!allClusters || cluster == "local-cluster") {
+			continue
+		}
+		if _, ok := requested[cluster]; len(requested) > 0 && !ok {
+			continue
+		}
+		status := &model.ClusterStatus{Cluster: cluster, ResourceCount: counts[cluster]}
+		if collector, ok := collectors[cluster]; ok && !collector.lastUpdated.IsZero() {
+			lastUpdated := collector.lastUpdated.UTC().Format(time.RFC3339)
+			status.LastUpdated = &lastUpdated
+			status.Stale = !collector.available && isStale(collector.lastUpdated)
+		}
+		results = append(results, status)
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].Cluster < results[j].Cluster })
+	return results, nil
+}
+
+// Returns true if the collector stopped reporting longer ago than the configured threshold.
+func isStale(lastUpdated time.Time) bool {
+	return time.Since(lastUpdated) > time.Duration(config.Cfg.StaleClusterThreshold)*time.Millisecond
+}
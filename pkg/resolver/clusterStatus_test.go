@@ -0,0 +1,238 @@
+// Copyright Contributors to the Open Cluster Management project
+package resolver
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/driftprogramming/pgxpoolmock"
+	"github.com/golang/mock/gomock"
+	"github.com/stolostron/search-v2-api/pkg/config"
+	"github.com/stolostron/search-v2-api/pkg/rbac"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func newMockClusterStatus(t *testing.T, managedClusters map[string]struct{}) (*ClusterStatusResult, *pgxpoolmock.MockPgxPool) {
+	ctrl := gomock.NewController(t)
+	mockPool := pgxpoolmock.NewMockPgxPool(ctrl)
+	// Each test starts with an empty cache.
+	originalCache := clusterStatusCache
+	clusterStatusCache = &clusterStatusData{}
+	t.Cleanup(func() { clusterStatusCache = originalCache })
+	return &ClusterStatusResult{
+		pool:     mockPool,
+		userData: rbac.UserData{ManagedClusters: managedClusters},
+	}, mockPool
+}
+
+// Mocks the search-collector add-ons with the status of their Available condition.
+func mockCollectorAddons(t *testing.T, addons ...unstructured.Unstructured) {
+	original := listCollectorAddons
+	listCollectorAddons = func(ctx context.Context) ([]unstructured.Unstructured, error) { return addons, nil }
+	t.Cleanup(func() { listCollectorAddons = original })
+}
+
+func newCollectorAddon(cluster, available string, lastTransition time.Time) unstructured.Unstructured {
+	return unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "addon.open-cluster-management.io/v1alpha1",
+		"kind":       "ManagedClusterAddOn",
+		"metadata":   map[string]interface{}{"name": "search-collector", "namespace": cluster},
+		"status": map[string]interface{}{
+			"conditions": []interface{}{
+				map[string]interface{}{"type": "Progressing", "status": "False",
+					"lastTransitionTime": "2024-01-01T00:00:00Z"},
+				map[string]interface{}{"type": "Available", "status": available,
+					"reason":             "ManagedClusterAddOnLeaseUpdateStopped",
+					"lastTransitionTime": lastTransition.UTC().Format(time.RFC3339)},
+			},
+		},
+	}}
+}
+
+func Test_ClusterStatus_Query(t *testing.T) {
+	query, _, err := buildClusterStatusQuery()
+
+	assert.Nil(t, err)
+	assert.Equal(t, `SELECT "cluster", COUNT(*) AS "count" FROM "search"."resources" WHERE ("cluster" != 'local-cluster') GROUP BY "cluster"`,
+		query)
+}
+
+func Test_ClusterStatus_Results(t *testing.T) {
+	resolver, mockPool := newMockClusterStatus(t, map[string]struct{}{"*": {}})
+	recent := time.Now().Add(-time.Minute)
+	old := time.Now().Add(-2 * time.Hour)
+	mockCollectorAddons(t,
+		newCollectorAddon("managed1", "True", old),
+		newCollectorAddon("managed2", "Unknown", old),
+		newCollectorAddon("managed3", "False", recent),
+		newCollectorAddon("managed5", "Unknown", old), // Never sent any resources.
+	)
+
+	mockPool.EXPECT().Query(gomock.Any(), gomock.Any()).
+		Return(pgxpoolmock.NewRows([]string{"cluster", "count"}).
+			AddRow("managed1", int64(100)).
+			AddRow("managed2", int64(20)).
+			AddRow("managed3", int64(5)).
+			AddRow("managed4", int64(1)).ToPgxRows(), nil)
+
+	result, err := resolver.clusterStatusResults(context.TODO())
+
+	assert.Nil(t, err)
+	assert.Equal(t, 5, len(result))
+	assert.Equal(t, "managed1", result[0].Cluster)
+	assert.Equal(t, 100, result[0].ResourceCount)
+	lastUpdated, err := time.Parse(time.RFC3339, *result[0].LastUpdated)
+	assert.Nil(t, err)
+	assert.WithinDuration(t, time.Now(), lastUpdated, time.Minute,
+		"Expected the data to be current while the collector is reporting.")
+	assert.False(t, result[0].Stale)
+	assert.Equal(t, old.UTC().Format(time.RFC3339), *result[1].LastUpdated)
+	assert.True(t, result[1].Stale)
+	assert.Equal(t, recent.UTC().Format(time.RFC3339), *result[2].LastUpdated)
+	assert.False(t, result[2].Stale, "Expected the cluster to not be stale before the threshold.")
+	assert.Nil(t, result[3].LastUpdated)
+	assert.False(t, result[3].Stale, "Expected clusters without the collector status to not be stale.")
+	assert.Equal(t, "managed5", result[4].Cluster)
+	assert.Equal(t, 0, result[4].ResourceCount)
+	assert.True(t, result[4].Stale)
+}
+
+// A collector that has been reporting longer than the threshold isn't stale.
+func Test_ClusterStatus_AvailableNotStale(t *testing.T) {
+	resolver, mockPool := newMockClusterStatus(t, map[string]struct{}{"*": {}})
+	mockCollectorAddons(t, newCollectorAddon("managed1", "True", time.Now().Add(-48*time.Hour)))
+	mockPool.EXPECT().Query(gomock.Any(), gomock.Any()).
+		Return(pgxpoolmock.NewRows([]string{"cluster", "count"}).AddRow("managed1", int64(100)).ToPgxRows(), nil)
+
+	result, err := resolver.clusterStatusResults(context.TODO())
+
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(result))
+	assert.NotNil(t, result[0].LastUpdated)
+	assert.NotEqual(t, time.Now().Add(-48*time.Hour).UTC().Format(time.RFC3339), *result[0].LastUpdated)
+	assert.False(t, result[0].Stale)
+}
+
+func Test_ClusterStatus_ResultsFiltered(t *testing.T) {
+	resolver, mockPool := newMockClusterStatus(t, map[string]struct{}{"managed1": {}, "managed2": {}})
+	resolver.clusters = []string{"managed2", "managed3"}
+	mockCollectorAddons(t, newCollectorAddon("managed3", "Unknown", time.Now().Add(-2*time.Hour)))
+	mockPool.EXPECT().Query(gomock.Any(), gomock.Any()).
+		Return(pgxpoolmock.NewRows([]string{"cluster", "count"}).
+			AddRow("managed1", int64(100)).
+			AddRow("managed2", int64(20)).ToPgxRows(), nil)
+
+	result, err := resolver.clusterStatusResults(context.TODO())
+
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(result), "Expected only the requested clusters the user is authorized to see.")
+	assert.Equal(t, "managed2", result[0].Cluster)
+}
+
+func Test_ClusterStatus_Cached(t *testing.T) {
+	resolver, mockPool := newMockClusterStatus(t, map[string]struct{}{"*": {}})
+	mockCollectorAddons(t)
+	// The mock pool fails the test if the query runs more than once.
+	mockPool.EXPECT().Query(gomock.Any(), gomock.Any()).
+		Return(pgxpoolmock.NewRows([]string{"cluster", "count"}).
+			AddRow("managed1", int64(100)).ToPgxRows(), nil).Times(1)
+
+	_, err := resolver.clusterStatusResults(context.TODO())
+	assert.Nil(t, err)
+	result, err := resolver.clusterStatusResults(context.TODO())
+
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(result))
+	assert.Equal(t, 100, result[0].ResourceCount)
+}
+
+func Test_ClusterStatus_ErrorNotCached(t *testing.T) {
+	resolver, mockPool := newMockClusterStatus(t, map[string]struct{}{"*": {}})
+	mockCollectorAddons(t)
+	gomock.InOrder(
+		mockPool.EXPECT().Query(gomock.Any(), gomock.Any()).Return(nil, errors.New("connection refused")),
+		mockPool.EXPECT().Query(gomock.Any(), gomock.Any()).
+			Return(pgxpoolmock.NewRows([]string{"cluster", "count"}).
+				AddRow("managed1", int64(100)).ToPgxRows(), nil),
+	)
+
+	_, err := resolver.clusterStatusResults(context.TODO())
+	assert.NotNil(t, err)
+	result, err := resolver.clusterStatusResults(context.TODO())
+
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(result))
+}
+
+func Test_ClusterStatus_AddonsError(t *testing.T) {
+	resolver, mockPool := newMockClusterStatus(t, map[string]struct{}{"*": {}})
+	original := listCollectorAddons
+	listCollectorAddons = func(ctx context.Context) ([]unstructured.Unstructured, error) {
+		return nil, errors.New("forbidden")
+	}
+	t.Cleanup(func() { listCollectorAddons = original })
+	mockPool.EXPECT().Query(gomock.Any(), gomock.Any()).
+		Return(pgxpoolmock.NewRows([]string{"cluster", "count"}).
+			AddRow("managed1", int64(100)).ToPgxRows(), nil)
+
+	result, err := resolver.clusterStatusResults(context.TODO())
+
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(result))
+	assert.False(t, result[0].Stale, "Expected clusters to not be stale when the collector status isn't known.")
+}
+
+func Test_ClusterStatus_NoManagedClusters(t *testing.T) {
+	// The mock pool fails the test if a query is executed.
+	resolver, _ := newMockClusterStatus(t, map[string]struct{}{})
+
+	result, err := resolver.clusterStatusResults(context.TODO())
+
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(result))
+}
+
+func Test_Messages_StaleClusters(t *testing.T) {
+	resolver, mockPool := newMockClusterStatus(t, map[string]struct{}{"*": {}})
+	old := time.Now().Add(-2 * time.Hour)
+	mockCollectorAddons(t, newCollectorAddon("managed1", "Unknown", old), newCollectorAddon("managed2", "False", old))
+	mockPool.EXPECT().Query(gomock.Any(), gomock.Any()).
+		Return(pgxpoolmock.NewRows([]string{"cluster", "count"}).
+			AddRow("managed1", int64(100)).
+			AddRow("managed2", int64(20)).ToPgxRows(), nil)
+	mockMessage := Message{
+		cache:    &MockCache{disabled: map[string]struct{}{}},
+		clusters: resolver,
+	}
+
+	res, err := mockMessage.messageResults(context.Background())
+
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(res))
+	assert.Equal(t, "S21", res[0].ID)
+	assert.Equal(t, "warning", *res[0].Kind)
+	assert.Equal(t, "Data for 2 clusters is older than 30m0s.", *res[0].Description)
+}
+
+func Test_Messages_StaleClustersShortThreshold(t *testing.T) {
+	original := config.Cfg.StaleClusterThreshold
+	config.Cfg.StaleClusterThreshold = 45 * 1000
+	t.Cleanup(func() { config.Cfg.StaleClusterThreshold = original })
+	resolver, mockPool := newMockClusterStatus(t, map[string]struct{}{"*": {}})
+	mockCollectorAddons(t, newCollectorAddon("managed1", "Unknown", time.Now().Add(-time.Minute)))
+	mockPool.EXPECT().Query(gomock.Any(), gomock.Any()).
+		Return(pgxpoolmock.NewRows([]string{"cluster", "count"}).AddRow("managed1", int64(100)).ToPgxRows(), nil)
+	mockMessage := Message{
+		cache:    &MockCache{disabled: map[string]struct{}{}},
+		clusters: resolver,
+	}
+
+	res, err := mockMessage.messageResults(context.Background())
+
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(res))
+	assert.Equal(t, "Data for 1 clusters is older than 45s.", *res[0].Description)
+}
@@ -0,0 +1,147 @@
+// Copyright Contributors to the Open Cluster Management project
+package resolver
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/doug-martin/goqu/v9"
+	"github.com/doug-martin/goqu/v9/exp"
+	"github.com/driftprogramming/pgxpoolmock"
+	"github.com/stolostron/search-v2-api/graph/model"
+	db "github.com/stolostron/search-v2-api/pkg/database"
+	"github.com/stolostron/search-v2-api/pkg/metrics"
+	"github.com/stolostron/search-v2-api/pkg/rbac"
+	v1 "k8s.io/api/authentication/v1"
+	klog "k8s.io/klog/v2"
+)
+
+type AccessExplanationResult struct {
+	pool     pgxpoolmock.PgxPool
+	cluster  string
+	uid      string
+	query    string
+	params   []interface{}
+	userData rbac.UserData
+	userInfo v1.UserInfo
+}
+
+func ExplainAccess(ctx context.Context, cluster string, uid string) (*model.AccessExplanation, error) {
+	defer metrics.SlowLog("ExplainAccessResolver", 0)()
+	userData, userDataErr := rbac.GetCache().GetUserData(ctx)
+	if userDataErr != nil {
+		return nil, userDataErr
+	}
+	_, userInfo := rbac.GetCache().GetUserUID(ctx)
+	explanation := &AccessExplanationResult{
+		pool:     db.GetConnPool(ctx),
+		cluster:  cluster,
+		uid:      uid,
+		userData: userData,
+		userInfo: userInfo,
+	}
+	return explanation.explainAccessResults(ctx)
+}
+
+// Evaluates the RBAC clauses used by the search query for the resource. The RBAC clause is also added to the
+// WHERE clause, so resources the user isn't authorized to see return the same result as resources that aren't
+// in the index.
+// Sample query:
+//
+//	SELECT COALESCE("data"->>'kind', '') AS "kind", COALESCE("data"->>'namespace', '') AS "namespace",
+//	("cluster" = ANY ('{"managed1"}')) AS "mc", FALSE AS "mcr",
+//	(("data"?'_hubClusterResource' AND (...)) AND NOT("data"?'namespace')) AS "cs",
+//	(("data"?'_hubClusterResource' AND (...)) AND "data"?'namespace') AS "ns"
+//	FROM "search"."resources" WHERE (("cluster" = 'managed1') AND ("uid" = 'managed1/abc') AND (...)) LIMIT 1
+func (a *AccessExplanationResult) buildExplainAccessQuery() error {
+	mc := goqu.And(matchManagedCluster(getKeys(a.userData.ManagedClusters)))
+	mcr := matchManagedClusterResources(a.userData.ManagedClusterResources, a.userInfo)
+	hub := matchHubCluster(a.userData, a.userInfo)
+	namespaced := goqu.L("???", goqu.C("data"), goqu.Literal("?"), "namespace") // "data"?'namespace'
+
+	var err error
+	a.query, a.params, err = goqu.From(goqu.S("search").Table("resources")).Select(
+		goqu.COALESCE(goqu.L(`"data"->>'kind'`), "").As("kind"),
+		goqu.COALESCE(goqu.L(`"data"->>'namespace'`), "").As("namespace"),
+		rbacColumn(mc, "mc"),
+		rbacColumn(mcr, "mcr"),
+		rbacColumn(hub, "cs", goqu.L("NOT(?)", namespaced)),
+		rbacColumn(hub, "ns", namespaced),
+	).Where(goqu.C("cluster").Eq(a.cluster), goqu.C("uid").Eq(a.uid), goqu.Or(mc, mcr, hub)).Limit(1).ToSQL()
+	if err != nil {
+		klog.Errorf("Error building explainAccess query: %s", err.Error())
+		return err
+	}
+	klog.V(5).Info("ExplainAccess Query: ", a.query)
+	return nil
+}
+
+// Selects the RBAC clause as a boolean column. Empty clauses are omitted from the RBAC clause of the search
+// query, so they don't grant access.
+func rbacColumn(clause exp.ExpressionList, alias string, conditions ...exp.Expression) exp.Expression {
+	if clause.IsEmpty() {
+		return goqu.L("FALSE").As(alias)
+	}
+	return goqu.L("?", goqu.And(append([]exp.Expression{clause}, conditions...)...)).As(alias)
+}
+
+func (a *AccessExplanationResult) explainAccessResults(ctx context.Context) (*model.AccessExplanation, error) {
+	klog.V(2).Info("Resolving explainAccessResults()")
+	if err := a.buildExplainAccessQuery(); err != nil {
+		return nil, err
+	}
+	rows, err := a.pool.Query(ctx, a.query, a.params...)
+	if err != nil {
+		klog.Error("Error fetching explainAccess results from db ", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := &model.AccessExplanation{Cluster: a.cluster, UID: a.uid, Rule: model.AccessRuleMissing}
+	if !rows.Next() {
+		// Don't disclose if a resource the user isn't authorized to see is in the index.
+		reason := "The resource isn't in the search index, or the user isn't authorized to see it."
+		result.Reason = &reason
+		return result, nil
+	}
+	var kind, namespace string
+	var managedCluster, managedClusterResource, hubClusterScoped, hubNamespaced bool
+	if err := rows.Scan(&kind, &namespace, &managedCluster, &managedClusterResource, &hubClusterScoped,
+		&hubNamespaced); err != nil {
+		klog.Error("Error reading explainAccess results. ", err)
+		return nil, err
+	}
+	switch {
+	case managedCluster:
+		result.Rule = model.AccessRuleManagedCluster
+	case managedClusterResource:
+		result.Rule = model.AccessRuleManagedClusterResource
+	case hubClusterScoped:
+		result.Rule = model.AccessRuleHubClusterScoped
+	case hubNamespaced:
+		result.Rule = model.AccessRuleHubNamespaced
+	}
+	result.Found, result.Visible = true, true
+	reason := accessReason(result.Rule, a.userData, a.cluster, kind, namespace)
+	result.Reason = &reason
+	return result, nil
+}
+
+// Describes the rule that granted access.
+func accessReason(rule model.AccessRule, userData rbac.UserData, cluster, kind, namespace string) string {
+	switch rule {
+	case model.AccessRuleManagedCluster:
+		if _, allClusters := userData.ManagedClusters["*"]; allClusters {
+			return "User has view access to all managed clusters."
+		}
+		return fmt.Sprintf("User has view access to managed cluster %s.", cluster)
+	case model.AccessRuleManagedClusterResource:
+		return fmt.Sprintf("User is authorized to list %s in namespace %s on managed cluster %s.",
+			kind, namespace, cluster)
+	case model.AccessRuleHubClusterScoped:
+		return fmt.Sprintf("User is authorized to list the cluster-scoped kind %s on the hub.", kind)
+	case model.AccessRuleHubNamespaced:
+		return fmt.Sprintf("User is authorized to list %s in namespace %s on the hub.", kind, namespace)
+	}
+	return "User is authorized to see the resource."
+}
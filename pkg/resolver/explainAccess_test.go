@@ -0,0 +1,134 @@
+// Copyright Contributors to the Open Cluster Management project
+package resolver
+
+import (
+	"context"
+	"testing"
+
+	"github.com/driftprogramming/pgxpoolmock"
+	"github.com/golang/mock/gomock"
+	"github.com/stolostron/search-v2-api/graph/model"
+	"github.com/stolostron/search-v2-api/pkg/rbac"
+	"github.com/stretchr/testify/assert"
+)
+
+func newMockExplainAccess(t *testing.T, userData rbac.UserData) (*AccessExplanationResult, *pgxpoolmock.MockPgxPool) {
+	ctrl := gomock.NewController(t)
+	mockPool := pgxpoolmock.NewMockPgxPool(ctrl)
+	return &AccessExplanationResult{
+		pool:     mockPool,
+		cluster:  "local-cluster",
+		uid:      "local-cluster/pod-uid",
+		userData: userData,
+	}, mockPool
+}
+
+// Hub user with access to nodes and to pods in namespace ns1.
+func newMockHubUserData() rbac.UserData {
+	return rbac.UserData{
+		CsResources:     []rbac.Resource{{Apigroup: "", Kind: "nodes"}},
+		NsResources:     map[string][]rbac.Resource{"ns1": {{Apigroup: "", Kind: "pods"}}},
+		ManagedClusters: map[string]struct{}{"managed1": {}},
+	}
+}
+
+func Test_ExplainAccess_Query(t *testing.T) {
+	resolver, _ := newMockExplainAccess(t, newMockHubUserData())
+
+	err := resolver.buildExplainAccessQuery()
+
+	hub := `"data"?'_hubClusterResource' AND ((NOT("data"?'namespace') AND (NOT("data"?'apigroup') AND ` +
+		`data->'kind_plural'?'nodes')) OR (data->'namespace'?|'{"ns1"}' AND (NOT("data"?'apigroup') AND ` +
+		`data->'kind_plural'?'pods')))`
+	assert.Nil(t, err)
+	assert.Equal(t, `SELECT COALESCE("data"->>'kind', '') AS "kind", COALESCE("data"->>'namespace', '') AS "namespace", `+
+		`("cluster" = ANY ('{"managed1"}')) AS "mc", FALSE AS "mcr", `+
+		`((`+hub+`) AND NOT("data"?'namespace')) AS "cs", ((`+hub+`) AND "data"?'namespace') AS "ns" `+
+		`FROM "search"."resources" WHERE (("cluster" = 'local-cluster') AND ("uid" = 'local-cluster/pod-uid') AND `+
+		`(("cluster" = ANY ('{"managed1"}')) OR (`+hub+`))) LIMIT 1`,
+		resolver.query)
+}
+
+func Test_ExplainAccess_QueryManagedClusterResources(t *testing.T) {
+	resolver, _ := newMockExplainAccess(t, rbac.UserData{
+		ManagedClusterResources: rbac.ManagedClusterResources{"managed2": {"ns1": {{Apigroup: "", Kind: "pods"}}}}})
+
+	err := resolver.buildExplainAccessQuery()
+
+	mcr := `("cluster" = 'managed2') AND (data->'namespace'?|'{"ns1"}' AND (NOT("data"?'apigroup') AND ` +
+		`data->'kind_plural'?'pods'))`
+	assert.Nil(t, err)
+	assert.Equal(t, `SELECT COALESCE("data"->>'kind', '') AS "kind", COALESCE("data"->>'namespace', '') AS "namespace", `+
+		`("cluster" = ANY ('{}')) AS "mc", (`+mcr+`) AS "mcr", FALSE AS "cs", FALSE AS "ns" `+
+		`FROM "search"."resources" WHERE (("cluster" = 'local-cluster') AND ("uid" = 'local-cluster/pod-uid') AND `+
+		`(("cluster" = ANY ('{}')) OR (`+mcr+`))) LIMIT 1`,
+		resolver.query)
+}
+
+func Test_ExplainAccess_Results(t *testing.T) {
+	resolver, mockPool := newMockExplainAccess(t, newMockHubUserData())
+	mockPool.EXPECT().Query(gomock.Any(), gomock.Any()).
+		Return(pgxpoolmock.NewRows([]string{"kind", "namespace", "mc", "mcr", "cs", "ns"}).
+			AddRow("Pod", "ns1", false, false, false, true).ToPgxRows(), nil)
+
+	result, err := resolver.explainAccessResults(context.TODO())
+
+	assert.Nil(t, err)
+	assert.True(t, result.Found)
+	assert.True(t, result.Visible)
+	assert.Equal(t, model.AccessRuleHubNamespaced, result.Rule)
+	assert.Equal(t, "User is authorized to list Pod in namespace ns1 on the hub.", *result.Reason)
+}
+
+func Test_ExplainAccess_NotFound(t *testing.T) {
+	resolver, mockPool := newMockExplainAccess(t, newMockHubUserData())
+	// The RBAC clause doesn't return the resources the user isn't authorized to see.
+	mockPool.EXPECT().Query(gomock.Any(), gomock.Any()).
+		Return(pgxpoolmock.NewRows([]string{"kind", "namespace", "mc", "mcr", "cs", "ns"}).ToPgxRows(), nil)
+
+	result, err := resolver.explainAccessResults(context.TODO())
+
+	assert.Nil(t, err)
+	assert.False(t, result.Found)
+	assert.False(t, result.Visible)
+	assert.Equal(t, model.AccessRuleMissing, result.Rule)
+	assert.Equal(t, "The resource isn't in the search index, or the user isn't authorized to see it.", *result.Reason)
+}
+
+func Test_ExplainAccess_Rules(t *testing.T) {
+	allClusters := rbac.UserData{ManagedClusters: map[string]struct{}{"*": {}}}
+	tests := []struct {
+		name     string
+		userData rbac.UserData
+		cluster  string
+		matches  []bool // mc, mcr, cs, ns
+		rule     model.AccessRule
+		reason   string
+	}{
+		{"managed cluster", newMockHubUserData(), "managed1", []bool{true, false, false, false},
+			model.AccessRuleManagedCluster, "User has view access to managed cluster managed1."},
+		{"all managed clusters", allClusters, "managed1", []bool{true, true, false, false},
+			model.AccessRuleManagedCluster, "User has view access to all managed clusters."},
+		{"managed cluster resource", rbac.UserData{}, "managed2", []bool{false, true, false, false},
+			model.AccessRuleManagedClusterResource,
+			"User is authorized to list Pod in namespace ns1 on managed cluster managed2."},
+		{"hub cluster-scoped", newMockHubUserData(), "local-cluster", []bool{false, false, true, false},
+			model.AccessRuleHubClusterScoped, "User is authorized to list the cluster-scoped kind Pod on the hub."},
+		{"hub namespaced", newMockHubUserData(), "local-cluster", []bool{false, false, false, true},
+			model.AccessRuleHubNamespaced, "User is authorized to list Pod in namespace ns1 on the hub."},
+	}
+	for _, test := range tests {
+		resolver, mockPool := newMockExplainAccess(t, test.userData)
+		resolver.cluster = test.cluster
+		mockPool.EXPECT().Query(gomock.Any(), gomock.Any()).
+			Return(pgxpoolmock.NewRows([]string{"kind", "namespace", "mc", "mcr", "cs", "ns"}).
+				AddRow("Pod", "ns1", test.matches[0], test.matches[1], test.matches[2], test.matches[3]).ToPgxRows(), nil)
+
+		result, err := resolver.explainAccessResults(context.TODO())
+
+		assert.Nil(t, err, test.name)
+		assert.True(t, result.Visible, test.name)
+		assert.Equal(t, test.rule, result.Rule, test.name)
+		assert.Equal(t, test.reason, *result.Reason, test.name)
+	}
+}
@@ -2,8 +2,14 @@ package resolver
 
 import (
 	"context"
+	"fmt"
+	"strings"
+	"time"
 
 	"github.com/stolostron/search-v2-api/graph/model"
+	"github.com/stolostron/search-v2-api/pkg/config"
+	db "github.com/stolostron/search-v2-api/pkg/database"
+	"github.com/stolostron/search-v2-api/pkg/federated/hubstatus"
 	"github.com/stolostron/search-v2-api/pkg/rbac"
 	klog "k8s.io/klog/v2"
 )
@@ -13,35 +19,179 @@ type ICache interface {
 	GetDisabledClusters(ctx context.Context) (*map[string]struct{}, error)
 }
 type Message struct {
-	cache ICache // Tests will replace this interface with a mock cache instance.
+	cache    ICache               // Tests will replace this interface with a mock cache instance.
+	searches []*SearchResult      // Used to suggest similar names for searches without results.
+	clusters *ClusterStatusResult // Used to find managed clusters with stale data.
+	userData rbac.UserData        // Used to filter the managed hubs the user is authorized to see.
 }
 
-func Messages(ctx context.Context) ([]*model.Message, error) {
+// A message producer checks for a condition and returns the messages for the user.
+// Messages are added by adding a producer to the messageProducers list.
+type messageProducer func(ctx context.Context, s *Message) ([]*model.Message, error)
+
+var messageProducers = []messageProducer{
+	disabledClustersMessages, // S20
+	staleClusterMessages,     // S21
+	suggestionMessages,       // S30
+	truncatedResultsMessages, // S31
+	databaseMessages,         // S40
+	federationMessages,       // S50
+}
+
+// Tests will replace these functions to simulate the database and federation conditions.
+var isDatabaseDegraded = db.IsPoolSaturated
+var unreachableHubs = hubstatus.Unreachable
+
+func Messages(ctx context.Context, input []*model.SearchInput) ([]*model.Message, error) {
+	userData, userDataErr := rbac.GetCache().GetUserData(ctx)
+	if userDataErr != nil {
+		return []*model.Message{}, userDataErr
+	}
 	message := &Message{
-		cache: rbac.GetCache(),
+		cache:    rbac.GetCache(),
+		clusters: &ClusterStatusResult{pool: db.GetConnPool(ctx), userData: userData},
+		userData: userData,
+	}
+	if len(input) > 0 {
+		searches, err := Search(ctx, input)
+		if err != nil {
+			return []*model.Message{}, err
+		}
+		message.searches = searches
 	}
 	return message.messageResults(ctx)
 }
 
 func (s *Message) messageResults(ctx context.Context) ([]*model.Message, error) {
 	klog.V(2).Info("Resolving Messages()")
+	messages := make([]*model.Message, 0)
+	for _, producer := range messageProducers {
+		produced, err := producer(ctx, s)
+		if err != nil {
+			return []*model.Message{}, err
+		}
+		messages = append(messages, produced...)
+	}
+	return messages, nil
+}
 
+// Builds a message. The count and affected clusters are only set when provided.
+func newMessage(id, kind, desc string, count int, affectedClusters []string) *model.Message {
+	message := &model.Message{ID: id, Kind: &kind, Description: &desc}
+	if count > 0 {
+		message.Count = &count
+	}
+	if len(affectedClusters) > 0 {
+		message.AffectedClusters = stringArrayToPointer(affectedClusters)
+	}
+	if config.Cfg.MessagesDocURL != "" {
+		docLink := fmt.Sprintf("%s#%s", config.Cfg.MessagesDocURL, strings.ToLower(id))
+		message.DocLink = &docLink
+	}
+	return message
+}
+
+// Reports the managed clusters, that the user has access to view, with the search add-on disabled.
+func disabledClustersMessages(ctx context.Context, s *Message) ([]*model.Message, error) {
 	disabledClusters, disabledClustersErr := s.cache.GetDisabledClusters(ctx)
 	//Cache is invalid
 	if disabledClustersErr != nil {
-		return []*model.Message{}, disabledClustersErr
+		return nil, disabledClustersErr
 	}
 	//Cache is valid
-	if len(*disabledClusters) <= 0 { //no clusters with addon disabled or user does not have access to view them
-		return []*model.Message{}, nil
-	} else {
-		messages := make([]*model.Message, 0)
-		kind := "information"
-		desc := "Search is disabled on some of your managed clusters."
-		message := model.Message{ID: "S20",
-			Kind:        &kind,
-			Description: &desc}
-		messages = append(messages, &message)
-		return messages, nil
+	if len(*disabledClusters) == 0 {
+		return nil, nil
+	}
+	clusters := getKeys(*disabledClusters)
+	return []*model.Message{newMessage("S20", "information",
+		"Search is disabled on some of your managed clusters.", len(clusters), clusters)}, nil
+}
+
+// Reports the managed clusters where the search collector stopped reporting longer ago than the configured threshold.
+func staleClusterMessages(ctx context.Context, s *Message) ([]*model.Message, error) {
+	if s.clusters == nil {
+		return nil, nil
+	}
+	clusterStatus, err := s.clusters.clusterStatusResults(ctx)
+	if err != nil {
+		klog.Warningf("Error finding managed clusters with stale data. Error: %s", err)
+		return nil, nil
+	}
+	staleClusters := []string{}
+	for _, status := range clusterStatus {
+		if status.Stale {
+			staleClusters = append(staleClusters, status.Cluster)
+		}
+	}
+	if len(staleClusters) == 0 {
+		return nil, nil
+	}
+	threshold := time.Duration(config.Cfg.StaleClusterThreshold) * time.Millisecond
+	desc := fmt.Sprintf("Data for %d clusters is older than %s.", len(staleClusters), threshold.Round(time.Second))
+	return []*model.Message{newMessage("S21", "warning", desc, len(staleClusters), staleClusters)}, nil
+}
+
+// Suggests similar resource names for searches without results.
+func suggestionMessages(ctx context.Context, s *Message) ([]*model.Message, error) {
+	messages := make([]*model.Message, 0)
+	for _, search := range s.searches {
+		suggestion, err := search.didYouMean()
+		if err != nil {
+			klog.Warningf("Error finding suggestions for search input %+v. Error: %s", search.input, err)
+			continue
+		}
+		if suggestion == "" {
+			continue
+		}
+		desc := fmt.Sprintf("No results found. Did you mean \"%s\"?", suggestion)
+		messages = append(messages, newMessage("S30", "information", desc, 0, nil))
+	}
+	return messages, nil
+}
+
+// Reports the searches with more results than the limit.
+func truncatedResultsMessages(ctx context.Context, s *Message) ([]*model.Message, error) {
+	messages := make([]*model.Message, 0)
+	for _, search := range s.searches {
+		limit := search.setLimit()
+		if limit == 0 {
+			continue
+		}
+		count, err := search.totalCount()
+		if err != nil {
+			klog.Warningf("Error counting results for search input %+v. Error: %s", search.input, err)
+			continue
+		}
+		if count <= int(limit) {
+			continue
+		}
+		desc := fmt.Sprintf("Search results were truncated. Showing %d of %d results.", limit, count)
+		messages = append(messages, newMessage("S31", "information", desc, count, nil))
+	}
+	return messages, nil
+}
+
+// Reports when all the database connections are in use, so queries are slower than usual.
+func databaseMessages(ctx context.Context, s *Message) ([]*model.Message, error) {
+	if !isDatabaseDegraded() {
+		return nil, nil
+	}
+	return []*model.Message{newMessage("S40", "warning",
+		"The search database is under heavy load. Results may take longer than usual.", 0, nil)}, nil
+}
+
+// Reports the managed hubs, that the user has access to view, that couldn't be reached on the last federated search.
+func federationMessages(ctx context.Context, s *Message) ([]*model.Message, error) {
+	hubs := []string{}
+	_, allClusters := s.userData.ManagedClusters["*"]
+	for _, hub := range unreachableHubs() {
+		if _, ok := s.userData.ManagedClusters[hub]; ok || allClusters {
+			hubs = append(hubs, hub)
+		}
+	}
+	if len(hubs) == 0 {
+		return nil, nil
 	}
+	desc := fmt.Sprintf("Unable to get results from %d managed hubs. Results may be incomplete.", len(hubs))
+	return []*model.Message{newMessage("S50", "warning", desc, len(hubs), hubs)}, nil
 }
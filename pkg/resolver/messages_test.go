@@ -7,7 +7,11 @@ import (
 	"reflect"
 	"testing"
 
+	"github.com/golang/mock/gomock"
 	"github.com/stolostron/search-v2-api/graph/model"
+	"github.com/stolostron/search-v2-api/pkg/config"
+	"github.com/stolostron/search-v2-api/pkg/rbac"
+	"github.com/stretchr/testify/assert"
 )
 
 func Test_Messages_DisabledCluster(t *testing.T) {
@@ -24,9 +28,13 @@ func Test_Messages_DisabledCluster(t *testing.T) {
 	messages := make([]*model.Message, 0)
 	kind := "information"
 	desc := "Search is disabled on some of your managed clusters."
+	count := 1
+	clusters := "managed1"
 	message := model.Message{ID: "S20",
-		Kind:        &kind,
-		Description: &desc}
+		Kind:             &kind,
+		Description:      &desc,
+		AffectedClusters: []*string{&clusters},
+		Count:            &count}
 	messages = append(messages, &message)
 
 	if !reflect.DeepEqual(messages, res) {
@@ -72,9 +80,13 @@ func Test_Messages_MultipleDisabledClusters(t *testing.T) {
 	messages := make([]*model.Message, 0)
 	kind := "information"
 	desc := "Search is disabled on some of your managed clusters."
+	count := 2
+	cluster1, cluster2 := "managed1", "managed2"
 	message := model.Message{ID: "S20",
-		Kind:        &kind,
-		Description: &desc}
+		Kind:             &kind,
+		Description:      &desc,
+		AffectedClusters: []*string{&cluster1, &cluster2},
+		Count:            &count}
 	messages = append(messages, &message)
 
 	if !reflect.DeepEqual(messages, res) {
@@ -104,3 +116,69 @@ func Test_Message_NoDisabledClusters(t *testing.T) {
 		t.Errorf("Incorrect results. expected error to be [%v] got [%v]", nil, err)
 	}
 }
+
+func Test_Messages_TruncatedResults(t *testing.T) {
+	mockTrigramAvailable(t, true)
+	limit := 2
+	val := "nginx"
+	searchInput := &model.SearchInput{Keywords: []*string{&val}, Limit: &limit}
+	resolver, mockPool := newMockSearchResolver(t, searchInput, nil, rbac.UserData{CsResources: []rbac.Resource{}}, nil)
+	// The count query runs only once for all messages.
+	mockPool.EXPECT().QueryRow(gomock.Any(), gomock.Any()).Return(&Row{MockValue: 5}).Times(1)
+	mockMessage := Message{
+		cache:    &MockCache{disabled: map[string]struct{}{}},
+		searches: []*SearchResult{resolver},
+	}
+
+	res, err := mockMessage.messageResults(context.Background())
+
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(res))
+	assert.Equal(t, "S31", res[0].ID)
+	assert.Equal(t, "Search results were truncated. Showing 2 of 5 results.", *res[0].Description)
+	assert.Equal(t, 5, *res[0].Count)
+}
+
+func Test_Messages_DatabaseDegraded(t *testing.T) {
+	original := isDatabaseDegraded
+	isDatabaseDegraded = func() bool { return true }
+	t.Cleanup(func() { isDatabaseDegraded = original })
+	mockMessage := Message{cache: &MockCache{disabled: map[string]struct{}{}}}
+
+	res, err := mockMessage.messageResults(context.Background())
+
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(res))
+	assert.Equal(t, "S40", res[0].ID)
+	assert.Equal(t, "warning", *res[0].Kind)
+}
+
+func Test_Messages_UnreachableHubs(t *testing.T) {
+	original := unreachableHubs
+	unreachableHubs = func() []string { return []string{"hub-a", "hub-b"} }
+	t.Cleanup(func() { unreachableHubs = original })
+	mockMessage := Message{
+		cache:    &MockCache{disabled: map[string]struct{}{}},
+		userData: rbac.UserData{ManagedClusters: map[string]struct{}{"hub-b": {}}},
+	}
+
+	res, err := mockMessage.messageResults(context.Background())
+
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(res))
+	assert.Equal(t, "S50", res[0].ID)
+	assert.Equal(t, 1, *res[0].Count)
+	assert.Equal(t, []*string{&[]string{"hub-b"}[0]}, res[0].AffectedClusters, "Only hubs the user can access.")
+}
+
+func Test_Messages_DocLink(t *testing.T) {
+	original := config.Cfg.MessagesDocURL
+	config.Cfg.MessagesDocURL = "https://docs.example.com/search-messages"
+	t.Cleanup(func() { config.Cfg.MessagesDocURL = original })
+
+	message := newMessage("S20", "information", "desc", 0, nil)
+
+	assert.Equal(t, "https://docs.example.com/search-messages#s20", *message.DocLink)
+	assert.Nil(t, message.Count)
+	assert.Nil(t, message.AffectedClusters)
+}
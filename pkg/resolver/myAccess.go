@@ -0,0 +1,123 @@
+// Copyright Contributors to the Open Cluster Management project
+package resolver
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/stolostron/search-v2-api/graph/model"
+	"github.com/stolostron/search-v2-api/pkg/metrics"
+	"github.com/stolostron/search-v2-api/pkg/rbac"
+	klog "k8s.io/klog/v2"
+)
+
+type MyAccessResult struct {
+	username   string
+	userData   rbac.UserData
+	computedAt time.Time
+}
+
+func MyAccess(ctx context.Context) (*model.UserAccess, error) {
+	defer metrics.SlowLog("MyAccessResolver", 0)()
+	userDataCache, err := rbac.GetCache().GetUserDataCache(ctx, nil)
+	if err != nil {
+		klog.Error("Error fetching UserAccessData: ", err)
+		return nil, rbac.ErrUserAccess
+	}
+	_, userInfo := rbac.GetCache().GetUserUID(ctx)
+	myAccess := &MyAccessResult{
+		username: userInfo.Username,
+		userData: rbac.UserData{
+			CsResources:             userDataCache.GetCsResourcesCopy(),
+			NsResources:             userDataCache.GetNsResourcesCopy(),
+			ManagedClusters:         userDataCache.GetManagedClustersCopy(),
+			CsResourceNames:         userDataCache.GetCsResourceNamesCopy(),
+			NsResourceNames:         userDataCache.GetNsResourceNamesCopy(),
+			ManagedClusterResources: userDataCache.GetManagedClusterResourcesCopy(),
+		},
+		computedAt: userDataCache.GetUpdatedAt(),
+	}
+	return myAccess.myAccessResults(), nil
+}
+
+// Builds the access summary from the user data. Results are sorted to keep the response stable.
+func (a *MyAccessResult) myAccessResults() *model.UserAccess {
+	klog.V(2).Info("Resolving myAccessResults()")
+	result := &model.UserAccess{
+		User:                    a.username,
+		ManagedClusters:         []*string{},
+		ClusterScopedKinds:      kindAccess(a.userData.CsResources, a.userData.CsResourceNames),
+		Namespaces:              namespaceAccess(a.userData.NsResources, a.userData.NsResourceNames),
+		ManagedClusterResources: []*model.ManagedClusterAccess{},
+	}
+	csRes := a.userData.CsResources
+	result.AllAccess = len(csRes) == 1 && csRes[0].Apigroup == "*" && csRes[0].Kind == "*"
+	_, result.AllManagedClusters = a.userData.ManagedClusters["*"]
+
+	if !result.AllManagedClusters {
+		clusters := getKeys(a.userData.ManagedClusters)
+		sort.Strings(clusters)
+		for i := range clusters {
+			result.ManagedClusters = append(result.ManagedClusters, &clusters[i])
+		}
+	}
+	clusters := getKeys(a.userData.ManagedClusterResources)
+	sort.Strings(clusters)
+	for _, cluster := range clusters {
+		result.ManagedClusterResources = append(result.ManagedClusterResources, &model.ManagedClusterAccess{
+			Cluster:    cluster,
+			Namespaces: namespaceAccess(a.userData.ManagedClusterResources[cluster], nil),
+		})
+	}
+	if !a.computedAt.IsZero() {
+		computedAt := a.computedAt.UTC().Format(time.RFC3339)
+		result.ComputedAt = &computedAt
+	}
+	return result
+}
+
+// Converts the namespaces with the kinds and the resource names the user can list, sorted by namespace.
+func namespaceAccess(nsResources map[string][]rbac.Resource,
+	nsResourceNames map[string]map[rbac.Resource][]string) []*model.NamespaceAccess {
+	namespaces := getKeys(nsResources)
+	for ns := range nsResourceNames {
+		if _, ok := nsResources[ns]; !ok {
+			namespaces = append(namespaces, ns)
+		}
+	}
+	sort.Strings(namespaces)
+	result := make([]*model.NamespaceAccess, 0, len(namespaces))
+	for _, ns := range namespaces {
+		result = append(result,
+			&model.NamespaceAccess{Namespace: ns, Kinds: kindAccess(nsResources[ns], nsResourceNames[ns])})
+	}
+	return result
+}
+
+// Converts the resources to the model, sorted by apigroup and kind. The resources the user can list
+// only by name include the names, unless the user can list all the resources of the kind.
+func kindAccess(resources []rbac.Resource, resourceNames map[rbac.Resource][]string) []*model.KindAccess {
+	kinds := make([]*model.KindAccess, 0, len(resources)+len(resourceNames))
+	allNames := map[rbac.Resource]struct{}{}
+	for _, res := range resources {
+		kinds = append(kinds, &model.KindAccess{Apigroup: res.Apigroup, Kind: res.Kind})
+		allNames[res] = struct{}{}
+	}
+	for res, names := range resourceNames {
+		if _, ok := allNames[res]; ok {
+			continue
+		}
+		sortedNames := append([]string{}, names...)
+		sort.Strings(sortedNames)
+		kinds = append(kinds, &model.KindAccess{Apigroup: res.Apigroup, Kind: res.Kind,
+			Names: stringArrayToPointer(sortedNames)})
+	}
+	sort.Slice(kinds, func(i, j int) bool {
+		if kinds[i].Apigroup != kinds[j].Apigroup {
+			return kinds[i].Apigroup < kinds[j].Apigroup
+		}
+		return kinds[i].Kind < kinds[j].Kind
+	})
+	return kinds
+}
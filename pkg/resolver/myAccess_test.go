@@ -0,0 +1,126 @@
+// Copyright Contributors to the Open Cluster Management project
+package resolver
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stolostron/search-v2-api/graph/model"
+	"github.com/stolostron/search-v2-api/pkg/rbac"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_MyAccess_Results(t *testing.T) {
+	computedAt := time.Date(2024, 5, 1, 10, 30, 0, 0, time.UTC)
+	myAccess := &MyAccessResult{
+		username: "alice",
+		userData: rbac.UserData{
+			CsResources: []rbac.Resource{{Apigroup: "storage.k8s.io", Kind: "storageclasses"}, {Kind: "nodes"}},
+			NsResources: map[string][]rbac.Resource{
+				"ns2": {{Apigroup: "apps", Kind: "deployments"}, {Kind: "pods"}},
+				"ns1": {{Kind: "configmaps"}},
+			},
+			ManagedClusters: map[string]struct{}{"managed2": {}, "managed1": {}},
+		},
+		computedAt: computedAt,
+	}
+
+	result := myAccess.myAccessResults()
+
+	assert.Equal(t, "alice", result.User)
+	assert.False(t, result.AllAccess)
+	assert.False(t, result.AllManagedClusters)
+	assert.Equal(t, []string{"managed1", "managed2"}, PointerToStringArray(result.ManagedClusters))
+	assert.Equal(t, []*model.KindAccess{{Kind: "nodes"}, {Apigroup: "storage.k8s.io", Kind: "storageclasses"}},
+		result.ClusterScopedKinds)
+	assert.Equal(t, []*model.NamespaceAccess{
+		{Namespace: "ns1", Kinds: []*model.KindAccess{{Kind: "configmaps"}}},
+		{Namespace: "ns2", Kinds: []*model.KindAccess{{Kind: "pods"}, {Apigroup: "apps", Kind: "deployments"}}},
+	}, result.Namespaces)
+	assert.Equal(t, "2024-05-01T10:30:00Z", *result.ComputedAt)
+}
+
+func Test_MyAccess_AllAccess(t *testing.T) {
+	myAccess := &MyAccessResult{
+		username: "kube:admin",
+		userData: rbac.UserData{
+			CsResources:     []rbac.Resource{{Apigroup: "*", Kind: "*"}},
+			NsResources:     map[string][]rbac.Resource{"*": {{Apigroup: "*", Kind: "*"}}},
+			ManagedClusters: map[string]struct{}{"*": {}},
+		},
+	}
+
+	result := myAccess.myAccessResults()
+
+	assert.True(t, result.AllAccess)
+	assert.True(t, result.AllManagedClusters)
+	assert.Empty(t, result.ManagedClusters)
+	assert.Equal(t, "*", result.Namespaces[0].Namespace)
+	assert.Nil(t, result.ComputedAt, "Expected no time when the access wasn't computed.")
+}
+
+func Test_MyAccess_NoAccess(t *testing.T) {
+	myAccess := &MyAccessResult{username: "developer", userData: rbac.UserData{}}
+
+	result := myAccess.myAccessResults()
+
+	assert.False(t, result.AllAccess)
+	assert.False(t, result.AllManagedClusters)
+	assert.Empty(t, result.ManagedClusters)
+	assert.Empty(t, result.ClusterScopedKinds)
+	assert.Empty(t, result.Namespaces)
+	assert.Empty(t, result.ManagedClusterResources)
+}
+
+func Test_MyAccess_ResourceNames(t *testing.T) {
+	myAccess := &MyAccessResult{
+		username: "alice",
+		userData: rbac.UserData{
+			CsResources:     []rbac.Resource{{Kind: "nodes"}},
+			NsResources:     map[string][]rbac.Resource{"ns1": {{Kind: "configmaps"}}},
+			CsResourceNames: map[rbac.Resource][]string{{Kind: "persistentvolumes"}: {"pv-2", "pv-1"}},
+			NsResourceNames: map[string]map[rbac.Resource][]string{
+				"ns1": {{Kind: "secrets"}: {"credentials"}, {Kind: "configmaps"}: {"settings"}},
+				"ns2": {{Apigroup: "apps", Kind: "deployments"}: {"web"}},
+			},
+		},
+	}
+
+	result := myAccess.myAccessResults()
+
+	assert.Equal(t, []*model.KindAccess{{Kind: "nodes"},
+		{Kind: "persistentvolumes", Names: stringArrayToPointer([]string{"pv-1", "pv-2"})}},
+		result.ClusterScopedKinds)
+	assert.Equal(t, []*model.NamespaceAccess{
+		{Namespace: "ns1", Kinds: []*model.KindAccess{{Kind: "configmaps"},
+			{Kind: "secrets", Names: stringArrayToPointer([]string{"credentials"})}}},
+		{Namespace: "ns2", Kinds: []*model.KindAccess{
+			{Apigroup: "apps", Kind: "deployments", Names: stringArrayToPointer([]string{"web"})}}},
+	}, result.Namespaces, "Expected the names only for the kinds the user can't list by kind.")
+}
+
+func Test_MyAccess_ManagedClusterResources(t *testing.T) {
+	myAccess := &MyAccessResult{
+		username: "alice",
+		userData: rbac.UserData{
+			ManagedClusters: map[string]struct{}{"managed1": {}},
+			ManagedClusterResources: rbac.ManagedClusterResources{
+				"managed3": {"*": {{Apigroup: "apps", Kind: "deployments"}}},
+				"managed2": {"ns2": {{Kind: "pods"}}, "ns1": {{Kind: "configmaps"}, {Apigroup: "apps", Kind: "*"}}},
+			},
+		},
+	}
+
+	result := myAccess.myAccessResults()
+
+	assert.Equal(t, []string{"managed1"}, PointerToStringArray(result.ManagedClusters))
+	assert.Equal(t, []*model.ManagedClusterAccess{
+		{Cluster: "managed2", Namespaces: []*model.NamespaceAccess{
+			{Namespace: "ns1", Kinds: []*model.KindAccess{{Kind: "configmaps"}, {Apigroup: "apps", Kind: "*"}}},
+			{Namespace: "ns2", Kinds: []*model.KindAccess{{Kind: "pods"}}},
+		}},
+		{Cluster: "managed3", Namespaces: []*model.NamespaceAccess{
+			{Namespace: "*", Kinds: []*model.KindAccess{{Apigroup: "apps", Kind: "deployments"}}},
+		}},
+	}, result.ManagedClusterResources)
+}
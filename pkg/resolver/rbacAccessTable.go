@@ -0,0 +1,222 @@
+// Copyright Contributors to the Open Cluster Management project
+package resolver
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/doug-martin/goqu/v9"
+	"github.com/driftprogramming/pgxpoolmock"
+	"github.com/stolostron/search-v2-api/pkg/config"
+	db "github.com/stolostron/search-v2-api/pkg/database"
+	"github.com/stolostron/search-v2-api/pkg/rbac"
+	"golang.org/x/sync/singleflight"
+	"k8s.io/klog/v2"
+)
+
+// The RBAC access table materializes the namespaced resources a user can list on the hub, so the query
+// matches a row in the table instead of building an OR clause for each namespace. The rows are keyed
+// by a fingerprint of the resources. Users with the same access share the rows, and the rows for a
+// fingerprint never change.
+// The table is part of the search schema, which is owned by the indexer. The API doesn't create it,
+// and only uses the access table when the table exists:
+//
+//	CREATE UNLOGGED TABLE IF NOT EXISTS search.rbac_access (
+//		fingerprint TEXT NOT NULL,
+//		namespace TEXT NOT NULL,
+//		apigroup TEXT NOT NULL,
+//		kind TEXT NOT NULL,
+//		updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+//		PRIMARY KEY (fingerprint, namespace, apigroup, kind))
+const accessTableExists = "SELECT to_regclass('search.rbac_access') IS NOT NULL"
+
+// Interval to delete the rows that weren't written for a day. The rows are written again after the
+// user cache TTL, so multiple instances of the API can share the table, and the rows are restored
+// if the database truncates the unlogged table after a crash.
+const accessTableCleanupInterval = time.Hour
+
+// The lock guards the fields and isn't held during the database operations. The group writes
+// each fingerprint once for concurrent requests from users with the same access.
+type rbacAccessTable struct {
+	available    bool
+	checkedAt    time.Time            // Last time the table was checked.
+	cleanedAt    time.Time            // Last time the unused rows were deleted.
+	fingerprints map[string]time.Time // Fingerprints written to the table and when they were written.
+	group        singleflight.Group
+	lock         sync.Mutex
+	pool         pgxpoolmock.PgxPool
+}
+
+var accessTableCache = &rbacAccessTable{fingerprints: map[string]time.Time{}}
+
+// Tests will replace this function to avoid writing to the database.
+var useAccessTable = materializeAccess
+
+// Writes the namespaced resources to the access table when the user has access to more namespaces
+// than the configured threshold. Returns false when the query must use the OR clauses instead.
+func materializeAccess(ctx context.Context, nsResources map[string][]rbac.Resource) (string, bool) {
+	threshold := config.Cfg.RbacAccessTableThreshold
+	if threshold <= 0 || len(nsResources) <= threshold {
+		return "", false
+	}
+	if _, allNamespaces := nsResources["*"]; allNamespaces {
+		return "", false
+	}
+	return accessTableCache.materialize(ctx, nsResources)
+}
+
+// Returns the fingerprint of the namespaced resources after writing them to the table.
+func (a *rbacAccessTable) materialize(ctx context.Context, nsResources map[string][]rbac.Resource) (string, bool) {
+	fingerprint, err := accessFingerprint(nsResources)
+	if err != nil {
+		klog.Warning("Error building the fingerprint of the user access. ", err)
+		return "", false
+	}
+	if a.isWritten(fingerprint) {
+		return fingerprint, true
+	}
+	_, err, _ = a.group.Do(fingerprint, func() (interface{}, error) {
+		if a.isWritten(fingerprint) { // Written by a request that just finished.
+			return nil, nil
+		}
+		return nil, a.write(ctx, fingerprint, nsResources)
+	})
+	if err != nil {
+		return "", false
+	}
+	return fingerprint, true
+}
+
+// Returns true if the fingerprint was written to the table within the user cache TTL.
+func (a *rbacAccessTable) isWritten(fingerprint string) bool {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	writtenAt, ok := a.fingerprints[fingerprint]
+	return ok && time.Since(writtenAt) < time.Duration(config.Cfg.UserCacheTTL)*time.Millisecond
+}
+
+func (a *rbacAccessTable) write(ctx context.Context, fingerprint string,
+	nsResources map[string][]rbac.Resource) error {
+	pool := a.getPool(ctx)
+	if pool == nil {
+		return errors.New("database connection is not available")
+	}
+	if !a.tableExists(ctx, pool) {
+		return errors.New("the RBAC access table doesn't exist")
+	}
+	query, params, err := buildAccessTableInsert(fingerprint, nsResources)
+	if err != nil {
+		klog.Warning("Error building the query to write the user access. ", err)
+		return err
+	}
+	if _, err := pool.Exec(ctx, query, params...); err != nil {
+		klog.Warningf("Error writing the user access to the RBAC access table. Error: %s", err)
+		return err
+	}
+	klog.V(4).Infof("Wrote the access to %d namespaces to the RBAC access table with fingerprint %s.",
+		len(nsResources), fingerprint)
+
+	a.lock.Lock()
+	refresh := time.Duration(config.Cfg.UserCacheTTL) * time.Millisecond
+	for key, writtenAt := range a.fingerprints {
+		if time.Since(writtenAt) > refresh {
+			delete(a.fingerprints, key)
+		}
+	}
+	a.fingerprints[fingerprint] = time.Now()
+	a.lock.Unlock()
+
+	a.deleteUnusedRows(ctx, pool)
+	return nil
+}
+
+func (a *rbacAccessTable) getPool(ctx context.Context) pgxpoolmock.PgxPool {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	if a.pool == nil {
+		a.pool = db.GetConnPool(ctx)
+	}
+	return a.pool
+}
+
+// Checks if the indexer created the table. Checks again after the shared cache TTL when it doesn't exist.
+func (a *rbacAccessTable) tableExists(ctx context.Context, pool pgxpoolmock.PgxPool) bool {
+	a.lock.Lock()
+	if a.available || (!a.checkedAt.IsZero() &&
+		time.Since(a.checkedAt) < time.Duration(config.Cfg.SharedCacheTTL)*time.Millisecond) {
+		a.lock.Unlock()
+		return a.available
+	}
+	a.checkedAt = time.Now()
+	a.lock.Unlock()
+
+	var exists bool
+	if err := pool.QueryRow(ctx, accessTableExists).Scan(&exists); err != nil {
+		klog.Warningf("Error checking the RBAC access table. Using the RBAC clause in the query. Error: %s", err)
+		return false
+	}
+	if !exists {
+		klog.Warning("The RBAC access table search.rbac_access doesn't exist. Using the RBAC clause in the query.")
+		return false
+	}
+	a.lock.Lock()
+	a.available = true
+	a.lock.Unlock()
+	return true
+}
+
+// Deletes the rows that weren't written for a day, at most once per cleanup interval.
+func (a *rbacAccessTable) deleteUnusedRows(ctx context.Context, pool pgxpoolmock.PgxPool) {
+	a.lock.Lock()
+	if time.Since(a.cleanedAt) < accessTableCleanupInterval {
+		a.lock.Unlock()
+		return
+	}
+	a.cleanedAt = time.Now()
+	a.lock.Unlock()
+	if _, err := pool.Exec(ctx,
+		"DELETE FROM search.rbac_access WHERE updated_at < now() - interval '1 day'"); err != nil {
+		klog.Warningf("Error deleting unused rows from the RBAC access table. Error: %s", err)
+	}
+}
+
+// The map keys are sorted by json.Marshal, so the same access produces the same fingerprint.
+func accessFingerprint(nsResources map[string][]rbac.Resource) (string, error) {
+	data, err := json.Marshal(nsResources)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:16]), nil
+}
+
+// Sample query: INSERT INTO "search"."rbac_access" ("apigroup", "fingerprint", "kind", "namespace")
+// VALUES (”, 'abc', 'pods', 'ns1') ON CONFLICT (fingerprint, namespace, apigroup, kind)
+// DO UPDATE SET "updated_at"=now()
+func buildAccessTableInsert(fingerprint string, nsResources map[string][]rbac.Resource) (string, []interface{},
+	error) {
+	rows := []interface{}{}
+	namespaces := getKeys(nsResources)
+	sort.Strings(namespaces)
+	for _, namespace := range namespaces {
+		// Postgres can't update the same row twice in one statement, so duplicates are skipped.
+		written := map[rbac.Resource]struct{}{}
+		for _, res := range nsResources[namespace] {
+			if _, ok := written[res]; ok {
+				continue
+			}
+			written[res] = struct{}{}
+			rows = append(rows, goqu.Record{"fingerprint": fingerprint, "namespace": namespace,
+				"apigroup": res.Apigroup, "kind": res.Kind})
+		}
+	}
+	return goqu.Insert(goqu.S("search").Table("rbac_access")).Rows(rows...).
+		OnConflict(goqu.DoUpdate("fingerprint, namespace, apigroup, kind",
+			goqu.Record{"updated_at": goqu.L("now()")})).ToSQL()
+}
@@ -0,0 +1,279 @@
+// Copyright Contributors to the Open Cluster Management project
+package resolver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/doug-martin/goqu/v9"
+	"github.com/driftprogramming/pgxpoolmock"
+	"github.com/golang/mock/gomock"
+	"github.com/jackc/pgconn"
+	"github.com/stolostron/search-v2-api/pkg/config"
+	db "github.com/stolostron/search-v2-api/pkg/database"
+	"github.com/stolostron/search-v2-api/pkg/rbac"
+	"github.com/stretchr/testify/assert"
+)
+
+func mockAccessTable(t *testing.T, fingerprint string) {
+	original := useAccessTable
+	useAccessTable = func(ctx context.Context, nsResources map[string][]rbac.Resource) (string, bool) {
+		return fingerprint, fingerprint != ""
+	}
+	t.Cleanup(func() { useAccessTable = original })
+}
+
+// Mock of the row with the result of the access table check.
+type boolRow struct {
+	value bool
+}
+
+func (r *boolRow) Scan(dest ...interface{}) error {
+	*dest[0].(*bool) = r.value
+	return nil
+}
+
+func newMockAccessTable(t *testing.T) (*rbacAccessTable, *pgxpoolmock.MockPgxPool) {
+	ctrl := gomock.NewController(t)
+	mockPool := pgxpoolmock.NewMockPgxPool(ctrl)
+	return &rbacAccessTable{fingerprints: map[string]time.Time{}, pool: mockPool}, mockPool
+}
+
+// User with access to the given number of namespaces. The kinds are different in each namespace,
+// so the namespaces can't be consolidated.
+func newUserDataWithNamespaces(count int) rbac.UserData {
+	nsResources := map[string][]rbac.Resource{}
+	for i := 0; i < count; i++ {
+		nsResources[fmt.Sprintf("namespace-%d", i)] = []rbac.Resource{
+			{Apigroup: "", Kind: "pods"}, {Apigroup: "apps", Kind: "deployments"},
+			{Apigroup: "example.com", Kind: fmt.Sprintf("kind-%d", i)},
+		}
+	}
+	return rbac.UserData{
+		CsResources:     []rbac.Resource{{Apigroup: "", Kind: "nodes"}},
+		NsResources:     nsResources,
+		ManagedClusters: map[string]struct{}{"managed1": {}},
+	}
+}
+
+func Test_buildRbacWhereClause_accessTable(t *testing.T) {
+	mockAccessTable(t, "abc")
+	csres, nsScopeAccess, _ := newUserData()
+	ud := rbac.UserData{CsResources: csres, NsResources: nsScopeAccess}
+
+	rbacCombined := buildRbacWhereClause(context.TODO(), ud, getUserInfo())
+
+	expectedSql := `SELECT * WHERE (("cluster" = ANY ('{}')) OR ("data"?'_hubClusterResource' AND ((NOT("data"?'namespace') AND ((NOT("data"?'apigroup') AND data->'kind_plural'?'nodes') OR (data->'apigroup'?'storage.k8s.io' AND data->'kind_plural'?'csinodes'))) OR EXISTS (SELECT 1 FROM "search"."rbac_access" AS "a" WHERE (("a"."fingerprint" = 'abc') AND ("a"."namespace" = "data"->>'namespace') AND (("a"."apigroup" = '*') OR ("a"."apigroup" = COALESCE("data"->>'apigroup', ''))) AND (("a"."kind" = '*') OR ("a"."kind" = "data"->>'kind_plural')))))))`
+	gotSql, _, _ := goqu.Select().Where(rbacCombined).ToSQL()
+	assert.Equal(t, expectedSql, gotSql)
+}
+
+func Test_buildRbacWhereClause_accessTableSize(t *testing.T) {
+	mockAccessTable(t, "abc")
+	small, _, _ := goqu.Select().Where(buildRbacWhereClause(context.TODO(), newUserDataWithNamespaces(10),
+		getUserInfo())).ToSQL()
+	large, _, _ := goqu.Select().Where(buildRbacWhereClause(context.TODO(), newUserDataWithNamespaces(1000),
+		getUserInfo())).ToSQL()
+
+	assert.Equal(t, len(small), len(large), "Expected the query size to be independent of the namespaces.")
+}
+
+func Test_materializeAccess_belowThreshold(t *testing.T) {
+	original := config.Cfg.RbacAccessTableThreshold
+	config.Cfg.RbacAccessTableThreshold = 50
+	t.Cleanup(func() { config.Cfg.RbacAccessTableThreshold = original })
+
+	// The access table isn't used, so the database isn't needed.
+	_, ok := materializeAccess(context.TODO(), newUserDataWithNamespaces(50).NsResources)
+
+	assert.False(t, ok)
+}
+
+func Test_materializeAccess_disabledByDefault(t *testing.T) {
+	assert.Equal(t, 0, config.Cfg.RbacAccessTableThreshold)
+
+	_, ok := materializeAccess(context.TODO(), newUserDataWithNamespaces(1000).NsResources)
+
+	assert.False(t, ok)
+}
+
+func Test_rbacAccessTable_materialize(t *testing.T) {
+	accessTable, mockPool := newMockAccessTable(t)
+	nsResources := map[string][]rbac.Resource{
+		"ns2": {{Apigroup: "apps", Kind: "deployments"}, {Apigroup: "apps", Kind: "deployments"}},
+		"ns1": {{Apigroup: "", Kind: "pods"}},
+	}
+	fingerprint, _ := accessFingerprint(nsResources)
+	gomock.InOrder(
+		mockPool.EXPECT().QueryRow(gomock.Any(), gomock.Eq(accessTableExists)).
+			Return(&boolRow{value: true}),
+		mockPool.EXPECT().Exec(gomock.Any(),
+			gomock.Eq(`INSERT INTO "search"."rbac_access" ("apigroup", "fingerprint", "kind", "namespace") VALUES ('', '`+
+				fingerprint+`', 'pods', 'ns1'), ('apps', '`+fingerprint+`', 'deployments', 'ns2') ON CONFLICT (fingerprint, namespace, apigroup, kind) DO UPDATE SET "updated_at"=now()`)).
+			Return(pgconn.CommandTag{}, nil),
+		mockPool.EXPECT().Exec(gomock.Any(), gomock.Any()).Return(pgconn.CommandTag{}, nil), // Delete unused rows.
+	)
+
+	result, ok := accessTable.materialize(context.TODO(), nsResources)
+	// The mock pool fails the test if the rows are written again.
+	cached, cachedOk := accessTable.materialize(context.TODO(), nsResources)
+
+	assert.True(t, ok)
+	assert.Equal(t, fingerprint, result)
+	assert.True(t, cachedOk)
+	assert.Equal(t, fingerprint, cached)
+}
+
+func Test_rbacAccessTable_tableMissing(t *testing.T) {
+	accessTable, mockPool := newMockAccessTable(t)
+	// The table isn't checked again until the shared cache TTL expires.
+	mockPool.EXPECT().QueryRow(gomock.Any(), gomock.Eq(accessTableExists)).
+		Return(&boolRow{value: false}).Times(1)
+
+	_, ok := accessTable.materialize(context.TODO(), newUserDataWithNamespaces(2).NsResources)
+	_, retryOk := accessTable.materialize(context.TODO(), newUserDataWithNamespaces(2).NsResources)
+
+	assert.False(t, ok, "Expected the RBAC clause to be used when the indexer didn't create the table.")
+	assert.False(t, retryOk)
+}
+
+func Test_rbacAccessTable_writeError(t *testing.T) {
+	accessTable, mockPool := newMockAccessTable(t)
+	accessTable.available = true
+	gomock.InOrder(
+		mockPool.EXPECT().Exec(gomock.Any(), gomock.Any()).
+			Return(pgconn.CommandTag{}, errors.New("connection reset")),
+		mockPool.EXPECT().Exec(gomock.Any(), gomock.Any()).Return(pgconn.CommandTag{}, nil), // Insert.
+		mockPool.EXPECT().Exec(gomock.Any(), gomock.Any()).Return(pgconn.CommandTag{}, nil), // Delete unused rows.
+	)
+
+	_, ok := accessTable.materialize(context.TODO(), newUserDataWithNamespaces(2).NsResources)
+	_, retryOk := accessTable.materialize(context.TODO(), newUserDataWithNamespaces(2).NsResources)
+
+	assert.False(t, ok)
+	assert.True(t, retryOk, "Expected the rows to be written again after an error.")
+}
+
+// Concurrent requests with the same access write the rows once, without holding the lock during the write.
+func Test_rbacAccessTable_concurrent(t *testing.T) {
+	accessTable, mockPool := newMockAccessTable(t)
+	accessTable.available = true
+	accessTable.cleanedAt = time.Now()
+	writing := make(chan struct{})
+	release := make(chan struct{})
+	mockPool.EXPECT().Exec(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error) {
+			close(writing)
+			<-release
+			return pgconn.CommandTag{}, nil
+		}).Times(1)
+
+	results := make(chan bool, 3)
+	for i := 0; i < 3; i++ {
+		go func() {
+			_, ok := accessTable.materialize(context.TODO(), newUserDataWithNamespaces(2).NsResources)
+			results <- ok
+		}()
+	}
+	<-writing
+	assert.False(t, accessTable.isWritten("other"), "Expected the lock to be available during the write.")
+	close(release)
+	for i := 0; i < 3; i++ {
+		assert.True(t, <-results)
+	}
+}
+
+func Test_accessFingerprint(t *testing.T) {
+	first, _ := accessFingerprint(newUserDataWithNamespaces(3).NsResources)
+	same, _ := accessFingerprint(newUserDataWithNamespaces(3).NsResources)
+	other, _ := accessFingerprint(newUserDataWithNamespaces(4).NsResources)
+
+	assert.Equal(t, first, same)
+	assert.NotEqual(t, first, other)
+}
+
+// Compares the RBAC clause with OR conditions for each namespace and the clause using the access table.
+// Reports the size of the generated SQL, which drives the planning time in the database.
+// Run with: go test ./pkg/resolver -run none -bench RbacWhereClause
+func BenchmarkRbacWhereClause(b *testing.B) {
+	for _, namespaces := range []int{10, 100, 1000} {
+		userData := newUserDataWithNamespaces(namespaces)
+		for _, mode := range []string{"inline", "accessTable"} {
+			b.Run(fmt.Sprintf("namespaces=%d/%s", namespaces, mode), func(b *testing.B) {
+				original := useAccessTable
+				defer func() { useAccessTable = original }()
+				useAccessTable = func(ctx context.Context, nsResources map[string][]rbac.Resource) (string, bool) {
+					fingerprint, err := accessFingerprint(nsResources)
+					return fingerprint, mode == "accessTable" && err == nil
+				}
+
+				var sql string
+				for i := 0; i < b.N; i++ {
+					sql, _, _ = goqu.Select().Where(
+						buildRbacWhereClause(context.TODO(), userData, getUserInfo())).ToSQL()
+				}
+				b.ReportMetric(float64(len(sql)), "sql-bytes")
+			})
+		}
+	}
+}
+
+// Compares the planning and execution time of the search query with the RBAC clause with OR conditions for
+// each namespace and with the access table. Requires the search database with the rbac_access table, it's
+// skipped when the database isn't available.
+// Run with: DB_USER=<user> DB_PASS=<password> DB_NAME=search go test ./pkg/resolver -run none -bench RbacQueryPlan
+func BenchmarkRbacQueryPlan(b *testing.B) {
+	ctx := context.Background()
+	if config.Cfg.DBUser == "" {
+		b.Skip("Requires the search database. Set DB_HOST, DB_PORT, DB_USER, DB_PASS and DB_NAME.")
+	}
+	pool := db.GetConnPool(ctx)
+	if pool == nil {
+		b.Skip("The search database isn't available.")
+	}
+	for _, namespaces := range []int{10, 100, 1000} {
+		userData := newUserDataWithNamespaces(namespaces)
+		for _, mode := range []string{"inline", "accessTable"} {
+			b.Run(fmt.Sprintf("namespaces=%d/%s", namespaces, mode), func(b *testing.B) {
+				original := useAccessTable
+				defer func() { useAccessTable = original }()
+				accessTable := &rbacAccessTable{fingerprints: map[string]time.Time{}, pool: pool}
+				useAccessTable = func(ctx context.Context, nsResources map[string][]rbac.Resource) (string, bool) {
+					if mode != "accessTable" {
+						return "", false
+					}
+					return accessTable.materialize(ctx, nsResources)
+				}
+				if _, ok := useAccessTable(ctx, userData.NsResources); mode == "accessTable" && !ok {
+					b.Skip("The search.rbac_access table doesn't exist.")
+				}
+
+				sql, _, _ := goqu.From(goqu.S("search").Table("resources")).Select(goqu.C("uid")).
+					Where(buildRbacWhereClause(ctx, userData, getUserInfo())).Limit(1000).ToSQL()
+				var planning, execution float64
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					var plan []byte
+					if err := pool.QueryRow(ctx, "EXPLAIN (ANALYZE, FORMAT JSON) "+sql).Scan(&plan); err != nil {
+						b.Fatal(err)
+					}
+					result := []struct {
+						Planning  float64 `json:"Planning Time"`
+						Execution float64 `json:"Execution Time"`
+					}{}
+					if err := json.Unmarshal(plan, &result); err != nil || len(result) == 0 {
+						b.Fatalf("Error reading the query plan: %v", err)
+					}
+					planning += result[0].Planning
+					execution += result[0].Execution
+				}
+				b.ReportMetric(planning/float64(b.N), "planning-ms/op")
+				b.ReportMetric(execution/float64(b.N), "execution-ms/op")
+			})
+		}
+	}
+}
@@ -3,6 +3,7 @@ package resolver
 
 import (
 	"encoding/json"
+	"sort"
 
 	"github.com/doug-martin/goqu/v9"
 	"github.com/doug-martin/goqu/v9/exp"
@@ -156,29 +157,116 @@ func consolidateNsResources(nsResources map[string][]rbac.Resource) (map[string]
 	return m, getKeys(m), nil
 }
 
+// Match the resources the user can list only by name, from rules with resourceNames.
+// Resolves to:
+//	(namespace = 'a' AND apigroup AND kind AND data->>'name' IN ('x', 'y')) OR
+//	(namespace=null AND apigroup AND kind AND data->>'name' IN ('z')) OR ...
+
+func matchResourceNames(csResourceNames map[rbac.Resource][]string,
+	nsResourceNames map[string]map[rbac.Resource][]string) exp.ExpressionList {
+	whereNamesDs := []exp.Expression{}
+	for _, res := range sortedResources(csResourceNames) {
+		whereNamesDs = append(whereNamesDs, goqu.And(
+			goqu.L("NOT(???)", goqu.C("data"), goqu.Literal("?"), "namespace"), // NOT("data"?'namespace')
+			matchApigroupKind([]rbac.Resource{res}),
+			goqu.L(`"data"->>'name'`).In(csResourceNames[res])))
+	}
+	namespaces := getKeys(nsResourceNames)
+	sort.Strings(namespaces)
+	for _, namespace := range namespaces {
+		for _, res := range sortedResources(nsResourceNames[namespace]) {
+			whereNamesDs = append(whereNamesDs, goqu.And(
+				goqu.L("???", goqu.L(`data->?`, "namespace"), goqu.Literal("?"), namespace),
+				matchApigroupKind([]rbac.Resource{res}),
+				goqu.L(`"data"->>'name'`).In(nsResourceNames[namespace][res])))
+		}
+	}
+	return goqu.Or(whereNamesDs...)
+}
+
+// Returns the resources sorted by apigroup and kind, so the clause doesn't change between queries.
+func sortedResources(resourceNames map[rbac.Resource][]string) []rbac.Resource {
+	resources := make([]rbac.Resource, 0, len(resourceNames))
+	for res := range resourceNames {
+		resources = append(resources, res)
+	}
+	sort.Slice(resources, func(i, j int) bool {
+		if resources[i].Apigroup != resources[j].Apigroup {
+			return resources[i].Apigroup < resources[j].Apigroup
+		}
+		return resources[i].Kind < resources[j].Kind
+	})
+	return resources
+}
+
 // Match cluster scoped and namespace scoped resources from the hub.
 // These are identified by containing the property _hubClusterResource=true
 // Resolves to:
 // (data->>'_hubClusterResource' = true)
 // AND ((namespace=null AND apigroup AND kind) OR
-//	(namespace AND apigroup AND kind))
+//	(namespace AND apigroup AND kind) OR
+//	(namespace AND apigroup AND kind AND name IN (...)))
 
 func matchHubCluster(userrbac rbac.UserData, userInfo v1.UserInfo) exp.ExpressionList {
-	if len(userrbac.CsResources) == 0 && len(userrbac.NsResources) == 0 {
+	if len(userrbac.CsResources) == 0 && len(userrbac.NsResources) == 0 &&
+		len(userrbac.CsResourceNames) == 0 && len(userrbac.NsResourceNames) == 0 {
 		// Do not match hub cluster if user doesn't have access to cluster scoped or namespace scoped resources on hub
 		return goqu.And()
 	} else {
 		// hub cluster rbac clause
 		return goqu.And(
 			goqu.L("???", goqu.C("data"), goqu.Literal("?"), "_hubClusterResource"), // "data"?'_hubClusterResource'
-			goqu.Or(
+			withResourceNames(goqu.Or(
 				matchClusterScopedResources(userrbac.CsResources, userInfo), // (namespace=null AND apigroup AND kind)
 				matchNamespacedResources(userrbac.NsResources, userInfo),    // (namespace AND apiproup AND kind)
-			),
+			), userrbac),
 		)
 	}
 }
 
+// Adds the resources the user can list only by name to the hub cluster clause. An empty clause
+// matches all resources on the hub, so the names aren't needed.
+func withResourceNames(hubRbac exp.ExpressionList, userrbac rbac.UserData) exp.ExpressionList {
+	if hubRbac.IsEmpty() && (len(userrbac.CsResources) > 0 || len(userrbac.NsResources) > 0) {
+		return hubRbac
+	}
+	return hubRbac.Append(matchResourceNames(userrbac.CsResourceNames, userrbac.NsResourceNames))
+}
+
+// Same as matchHubCluster, but matches the namespaced resources with the RBAC access table.
+// The size of the clause doesn't depend on the number of namespaces.
+// Resolves to:
+// (data->>'_hubClusterResource' = true)
+// AND ((namespace=null AND apigroup AND kind) OR
+//	EXISTS (SELECT 1 FROM search.rbac_access WHERE fingerprint AND namespace AND apigroup AND kind))
+
+func matchHubClusterAccessTable(userrbac rbac.UserData, userInfo v1.UserInfo, fingerprint string) exp.ExpressionList {
+	return goqu.And(
+		goqu.L("???", goqu.C("data"), goqu.Literal("?"), "_hubClusterResource"), // "data"?'_hubClusterResource'
+		withResourceNames(goqu.Or(
+			matchClusterScopedResources(userrbac.CsResources, userInfo), // (namespace=null AND apigroup AND kind)
+			matchAccessTable(fingerprint),                               // EXISTS (SELECT 1 FROM search.rbac_access ...)
+		), userrbac),
+	)
+}
+
+// Match the namespaced resources written to the RBAC access table with the fingerprint.
+// Resolves to:
+//	EXISTS (SELECT 1 FROM search.rbac_access AS a WHERE a.fingerprint = 'abc'
+//	AND a.namespace = data->>'namespace' AND (a.apigroup = '*' OR a.apigroup = COALESCE(data->>'apigroup', ''))
+//	AND (a.kind = '*' OR a.kind = data->>'kind_plural'))
+
+func matchAccessTable(fingerprint string) exp.Expression {
+	access := goqu.From(goqu.S("search").Table("rbac_access").As("a")).Select(goqu.L("1")).Where(
+		goqu.I("a.fingerprint").Eq(fingerprint),
+		goqu.I("a.namespace").Eq(goqu.L(`"data"->>'namespace'`)),
+		goqu.Or(goqu.I("a.apigroup").Eq("*"),
+			goqu.I("a.apigroup").Eq(goqu.COALESCE(goqu.L(`"data"->>'apigroup'`), ""))),
+		goqu.Or(goqu.I("a.kind").Eq("*"), goqu.I("a.kind").Eq(goqu.L(`"data"->>'kind_plural'`))),
+	)
+	return goqu.L("EXISTS ?", access)
+}
+
 // Match resources from the managed clusters.
 // Resolves to:
 //	( cluster IN ['a', 'b', ...] )
@@ -191,3 +279,25 @@ func matchManagedCluster(managedClusters []string) exp.BooleanExpression {
 	//managed clusters
 	return goqu.C("cluster").Eq(goqu.Any(pq.Array(managedClusters)))
 }
+
+// Match the namespaced resources from the managed clusters where the user has fine-grained permissions.
+// Resolves to:
+//	(cluster = 'a' AND ((namespace = 'x' AND apigroup AND kind) OR ... )) OR
+//	(cluster = 'b' AND (apigroup AND kind)) OR ...
+
+func matchManagedClusterResources(mcResources rbac.ManagedClusterResources, userInfo v1.UserInfo) exp.ExpressionList {
+	whereMcDs := []exp.Expression{}
+	for _, cluster := range getKeys(mcResources) {
+		nsResources := mcResources[cluster]
+		if allNamespaces, ok := nsResources["*"]; ok {
+			// The resources are allowed in all namespaces, so the namespace filter isn't needed.
+			whereMcDs = append(whereMcDs, goqu.And(goqu.C("cluster").Eq(cluster),
+				goqu.L("???", goqu.C("data"), goqu.Literal("?"), "namespace"), // "data"?'namespace'
+				matchApigroupKind(allNamespaces)))
+			continue
+		}
+		whereMcDs = append(whereMcDs, goqu.And(goqu.C("cluster").Eq(cluster),
+			matchNamespacedResources(nsResources, userInfo)))
+	}
+	return goqu.Or(whereMcDs...)
+}
@@ -0,0 +1,337 @@
+// Copyright Contributors to the Open Cluster Management project
+package resolver
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/doug-martin/goqu/v9"
+	"github.com/doug-martin/goqu/v9/exp"
+	"github.com/stolostron/search-v2-api/graph/model"
+	"github.com/stolostron/search-v2-api/pkg/config"
+	"github.com/stolostron/search-v2-api/pkg/rbac"
+	klog "k8s.io/klog/v2"
+)
+
+// Value of the masked properties.
+const redactedValue = "********"
+
+// Policy to redact sensitive properties from the results, loaded from the file in REDACTION_POLICY_CONFIG.
+// Sample:
+//
+//	{"exemptGroups": ["system:cluster-admins"],
+//	 "rules": [{"kinds": ["ConfigMap"], "properties": ["annotation", "label.secret-*"]},
+//	           {"properties": ["*password*"], "mask": true}]}
+type redactionPolicy struct {
+	ExemptGroups []string        `json:"exemptGroups"` // Users in these groups see all the properties.
+	Rules        []redactionRule `json:"rules"`
+}
+
+type redactionRule struct {
+	Kinds []string `json:"kinds"` // Kinds where the properties are redacted, case insensitive. All kinds if empty.
+	// Names or patterns with * of the properties, case insensitive. Use <property>.<key> for the keys of an object,
+	// like label.
+	Properties []string `json:"properties"`
+	Mask       bool     `json:"mask"` // Replace the values instead of removing the properties.
+
+	patterns []redactionPattern
+}
+
+type redactionPattern struct {
+	property  string         // Property pattern, used to build the LIKE clause.
+	matchProp *regexp.Regexp // Matches the property names.
+	matchKey  *regexp.Regexp // Matches the keys of an object property. Nil when the whole property is redacted.
+}
+
+var redactionPolicyOnce sync.Once
+var redactionPolicyLoaded *redactionPolicy
+
+// Tests will replace this function to use a policy without a file.
+var getRedactionPolicy = func() *redactionPolicy {
+	redactionPolicyOnce.Do(func() {
+		if config.Cfg.RedactionPolicyConfig == "" {
+			return
+		}
+		policy, err := loadRedactionPolicy(config.Cfg.RedactionPolicyConfig)
+		if err != nil {
+			klog.Errorf("Error loading the redaction policy. Properties aren't redacted. Error: %s", err)
+			return
+		}
+		klog.Infof("Redacting properties with %d rules.", len(policy.Rules))
+		redactionPolicyLoaded = policy
+	})
+	return redactionPolicyLoaded
+}
+
+func loadRedactionPolicy(path string) (*redactionPolicy, error) {
+	data, err := os.ReadFile(path) // #nosec G304 - The path is set by the administrator.
+	if err != nil {
+		return nil, err
+	}
+	policy := &redactionPolicy{}
+	if err := json.Unmarshal(data, policy); err != nil {
+		return nil, fmt.Errorf("error parsing %s: %w", path, err)
+	}
+	for i := range policy.Rules {
+		if len(policy.Rules[i].Properties) == 0 {
+			return nil, fmt.Errorf("the redaction rule %d is missing the properties", i)
+		}
+		policy.Rules[i].compile()
+	}
+	return policy, nil
+}
+
+func (r *redactionRule) compile() {
+	r.patterns = make([]redactionPattern, 0, len(r.Properties))
+	for _, property := range r.Properties {
+		pattern := redactionPattern{property: property}
+		if prop, key, found := strings.Cut(property, "."); found && key != "" {
+			pattern.property = prop
+			pattern.matchKey = globRegexp(key)
+		}
+		pattern.matchProp = globRegexp(pattern.property)
+		r.patterns = append(r.patterns, pattern)
+	}
+}
+
+// Converts a pattern with * into a case-insensitive regular expression. Other characters are matched literally.
+func globRegexp(pattern string) *regexp.Regexp {
+	return regexp.MustCompile("(?i)^" + strings.ReplaceAll(regexp.QuoteMeta(pattern), `\*`, ".*") + "$")
+}
+
+// Converts a pattern with * into a LIKE pattern.
+func globLike(pattern string) string {
+	return strings.ReplaceAll(escapeLikePattern(pattern), "*", "%")
+}
+
+// Returns the policy for the user in the context, or nil when the user is exempt or there isn't a policy.
+// The methods of a nil policy don't redact anything.
+func redactionFor(ctx context.Context) *redactionPolicy {
+	policy := getRedactionPolicy()
+	if policy == nil {
+		return nil
+	}
+	_, userInfo := rbac.GetCache().GetUserUID(ctx)
+	if policy.exempts(userInfo.Groups) {
+		klog.V(5).Infof("User %s is exempt from the redaction policy.", userInfo.Username)
+		return nil
+	}
+	return policy
+}
+
+func (p *redactionPolicy) exempts(groups []string) bool {
+	for _, group := range groups {
+		for _, exempt := range p.ExemptGroups {
+			if group == exempt {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Returns the rules for the kinds. When kinds is empty, the results can include any kind, so all rules apply.
+func (p *redactionPolicy) rulesFor(kinds []string) []redactionRule {
+	if p == nil {
+		return nil
+	}
+	if len(kinds) == 0 {
+		return p.Rules
+	}
+	rules := []redactionRule{}
+	for _, rule := range p.Rules {
+		if len(rule.Kinds) == 0 || containsFold(rule.Kinds, kinds) {
+			rules = append(rules, rule)
+		}
+	}
+	return rules
+}
+
+func containsFold(values []string, lookup []string) bool {
+	for _, value := range values {
+		for _, l := range lookup {
+			if strings.EqualFold(value, l) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Removes or masks the redacted properties of a resource.
+func (p *redactionPolicy) redact(data map[string]interface{}) {
+	kind, _ := data["kind"].(string)
+	for _, rule := range p.rulesFor([]string{kind}) {
+		for _, pattern := range rule.patterns {
+			for property, value := range data {
+				if !pattern.matchProp.MatchString(property) {
+					continue
+				}
+				if pattern.matchKey == nil {
+					if rule.Mask {
+						data[property] = redactedValue
+					} else {
+						delete(data, property)
+					}
+					continue
+				}
+				object, ok := value.(map[string]interface{})
+				if !ok {
+					continue
+				}
+				for key := range object {
+					if !pattern.matchKey.MatchString(key) {
+						continue
+					}
+					if rule.Mask {
+						object[key] = redactedValue
+					} else {
+						delete(object, key)
+					}
+				}
+			}
+		}
+	}
+}
+
+// Checks if the property is redacted for any of the kinds. When key isn't empty, checks the key of
+// an object property, like label.
+func (p *redactionPolicy) isRedacted(kinds []string, property, key string) bool {
+	for _, rule := range p.rulesFor(kinds) {
+		for _, pattern := range rule.patterns {
+			if !pattern.matchProp.MatchString(property) {
+				continue
+			}
+			if pattern.matchKey == nil || (key != "" && pattern.matchKey.MatchString(key)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Checks that the search doesn't use redacted properties, so the values can't be probed with filters.
+func (p *redactionPolicy) validateInput(input *model.SearchInput, propTypes map[string]string) error {
+	if p == nil || input == nil {
+		return nil
+	}
+	kinds := filterKinds(input)
+	for _, filter := range input.Filters {
+		if p.isRedacted(kinds, filter.Property, "") {
+			return fmt.Errorf("property [%s] is redacted and can't be used in the search", filter.Property)
+		}
+		if propTypes[filter.Property] != "object" {
+			continue
+		}
+		redactsKeys := p.redactsKeys(kinds, filter.Property)
+		for _, value := range PointerToStringArray(filter.Values) {
+			key, _, hasValue := strings.Cut(strings.TrimLeft(value, "!="), "=")
+			// Wildcards and values without a key can match any key, including the redacted keys.
+			if redactsKeys && (!hasValue || strings.ContainsAny(key, "*%")) {
+				return fmt.Errorf("property [%s] has redacted keys, filters must use key=value without wildcards in the key",
+					filter.Property)
+			}
+			if p.isRedacted(kinds, filter.Property, key) {
+				return fmt.Errorf("property [%s.%s] is redacted and can't be used in the search", filter.Property, key)
+			}
+		}
+	}
+	// Keywords are matched with the text of the whole property, so object properties with redacted keys
+	// can't be used either.
+	for _, field := range PointerToStringArray(input.KeywordFields) {
+		if p.redactsProperty(kinds, field) {
+			return fmt.Errorf("property [%s] is redacted and can't be used in the search", field)
+		}
+	}
+	if len(input.KeywordFields) == 0 && len(input.Keywords) > 0 && getKeywordMode(input) != model.KeywordModeSubstring {
+		// Full-text and fuzzy search use the default properties, so the redacted properties are removed.
+		fields := []string{}
+		for _, field := range fullTextProperties {
+			if !p.redactsProperty(kinds, field) {
+				fields = append(fields, field)
+			}
+		}
+		if len(fields) == 0 {
+			return fmt.Errorf("the keyword properties are redacted and can't be used in the search")
+		} else if len(fields) < len(fullTextProperties) {
+			input.KeywordFields = stringArrayToPointer(fields)
+		}
+	}
+	return nil
+}
+
+// Checks if any key of the object property is redacted for any of the kinds.
+func (p *redactionPolicy) redactsKeys(kinds []string, property string) bool {
+	for _, rule := range p.rulesFor(kinds) {
+		for _, pattern := range rule.patterns {
+			if pattern.matchKey != nil && pattern.matchProp.MatchString(property) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Checks if the property, or any key of the property, is redacted for any of the kinds.
+func (p *redactionPolicy) redactsProperty(kinds []string, property string) bool {
+	for _, rule := range p.rulesFor(kinds) {
+		for _, pattern := range rule.patterns {
+			if pattern.matchProp.MatchString(property) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Excludes the redacted properties from the keywords matched with all the properties.
+// Object properties with redacted keys are excluded entirely.
+// Sample: NOT (((lower("data"->>'kind') IN ('secret')) AND ("key" ILIKE 'annotation')) OR ("key" ILIKE '%password%'))
+func (p *redactionPolicy) redactedKeysClause(input *model.SearchInput) exp.Expression {
+	whereDs := []exp.Expression{}
+	for _, rule := range p.rulesFor(filterKinds(input)) {
+		keys := []exp.Expression{}
+		for _, pattern := range rule.patterns {
+			keys = append(keys, goqu.L(`"key"`).ILike(globLike(pattern.property)))
+		}
+		if len(rule.Kinds) == 0 {
+			whereDs = append(whereDs, goqu.Or(keys...))
+			continue
+		}
+		kinds := make([]string, len(rule.Kinds))
+		for i, kind := range rule.Kinds {
+			kinds[i] = strings.ToLower(kind)
+		}
+		whereDs = append(whereDs, goqu.And(goqu.L(`lower("data"->>'kind')`).In(kinds), goqu.Or(keys...)))
+	}
+	if len(whereDs) == 0 {
+		return nil
+	}
+	return goqu.L("NOT ?", goqu.Or(whereDs...))
+}
+
+// Returns the kinds from the kind filter. Returns nil when the filter has operators or wildcards,
+// because the results can include other kinds.
+func filterKinds(input *model.SearchInput) []string {
+	if input == nil {
+		return nil
+	}
+	for _, filter := range input.Filters {
+		if filter.Property != "kind" {
+			continue
+		}
+		kinds := PointerToStringArray(filter.Values)
+		for _, kind := range kinds {
+			if strings.ContainsAny(kind, "!=<>*") {
+				return nil
+			}
+		}
+		return kinds
+	}
+	return nil
+}
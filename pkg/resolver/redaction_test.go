@@ -0,0 +1,196 @@
+// Copyright Contributors to the Open Cluster Management project
+package resolver
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/doug-martin/goqu/v9"
+	"github.com/driftprogramming/pgxpoolmock"
+	"github.com/golang/mock/gomock"
+	"github.com/stolostron/search-v2-api/graph/model"
+	"github.com/stretchr/testify/assert"
+)
+
+// Redacts the annotations of ConfigMaps, the secret-* labels, and masks the properties with password.
+func newMockRedactionPolicy() *redactionPolicy {
+	policy := &redactionPolicy{
+		ExemptGroups: []string{"system:cluster-admins"},
+		Rules: []redactionRule{
+			{Kinds: []string{"ConfigMap"}, Properties: []string{"annotation", "label.secret-*"}},
+			{Properties: []string{"*password*"}, Mask: true},
+		},
+	}
+	for i := range policy.Rules {
+		policy.Rules[i].compile()
+	}
+	return policy
+}
+
+func mockRedactionPolicy(t *testing.T, policy *redactionPolicy) {
+	original := getRedactionPolicy
+	getRedactionPolicy = func() *redactionPolicy { return policy }
+	t.Cleanup(func() { getRedactionPolicy = original })
+}
+
+func Test_loadRedactionPolicy(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "redaction.json")
+	err := os.WriteFile(path, []byte(`{"exemptGroups": ["admins"],
+		"rules": [{"kinds": ["Secret"], "properties": ["label.app.kubernetes.io/*"], "mask": true}]}`), 0600)
+	assert.Nil(t, err)
+
+	policy, err := loadRedactionPolicy(path)
+
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"admins"}, policy.ExemptGroups)
+	assert.True(t, policy.isRedacted([]string{"secret"}, "label", "app.kubernetes.io/name"))
+	assert.False(t, policy.isRedacted([]string{"Secret"}, "label", "app"))
+	assert.False(t, policy.isRedacted([]string{"Pod"}, "label", "app.kubernetes.io/name"))
+}
+
+func Test_loadRedactionPolicy_missingProperties(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "redaction.json")
+	err := os.WriteFile(path, []byte(`{"rules": [{"kinds": ["Secret"]}]}`), 0600)
+	assert.Nil(t, err)
+
+	_, err = loadRedactionPolicy(path)
+
+	assert.NotNil(t, err)
+}
+
+func Test_redactionPolicy_redact(t *testing.T) {
+	policy := newMockRedactionPolicy()
+	configMap := map[string]interface{}{
+		"kind": "ConfigMap", "name": "app-config", "annotation": map[string]interface{}{"owner": "team-a"},
+		"label": map[string]interface{}{"app": "web", "secret-key": "abc"}, "dbPassword": "hunter2",
+	}
+	pod := map[string]interface{}{
+		"kind": "Pod", "name": "web", "annotation": map[string]interface{}{"owner": "team-a"},
+		"label": map[string]interface{}{"secret-key": "abc"},
+	}
+
+	policy.redact(configMap)
+	policy.redact(pod)
+
+	assert.Equal(t, map[string]interface{}{"kind": "ConfigMap", "name": "app-config",
+		"label": map[string]interface{}{"app": "web"}, "dbPassword": redactedValue}, configMap)
+	assert.Equal(t, map[string]interface{}{"kind": "Pod", "name": "web",
+		"annotation": map[string]interface{}{"owner": "team-a"},
+		"label":      map[string]interface{}{"secret-key": "abc"}}, pod)
+}
+
+func Test_redactionPolicy_nil(t *testing.T) {
+	var policy *redactionPolicy
+	data := map[string]interface{}{"kind": "ConfigMap", "annotation": map[string]interface{}{"owner": "team-a"}}
+
+	policy.redact(data)
+
+	assert.Contains(t, data, "annotation")
+	assert.False(t, policy.isRedacted(nil, "annotation", ""))
+	assert.Nil(t, policy.validateInput(&model.SearchInput{}, nil))
+	assert.Nil(t, policy.redactedKeysClause(&model.SearchInput{}))
+}
+
+func Test_redactionPolicy_exempts(t *testing.T) {
+	policy := newMockRedactionPolicy()
+
+	assert.True(t, policy.exempts([]string{"system:authenticated", "system:cluster-admins"}))
+	assert.False(t, policy.exempts([]string{"system:authenticated"}))
+}
+
+func Test_redactionPolicy_validateInput(t *testing.T) {
+	policy := newMockRedactionPolicy()
+	propTypes := map[string]string{"label": "object", "annotation": "object", "kind": "string"}
+	newInput := func(filters ...*model.SearchFilter) *model.SearchInput {
+		return &model.SearchInput{Filters: filters}
+	}
+	filter := func(property string, values ...string) *model.SearchFilter {
+		return &model.SearchFilter{Property: property, Values: stringArrayToPointer(values)}
+	}
+
+	tests := []struct {
+		name    string
+		input   *model.SearchInput
+		allowed bool
+	}{
+		{"redacted for all kinds", newInput(filter("dbPassword", "hunter2")), false},
+		{"redacted for the kind", newInput(filter("kind", "ConfigMap"), filter("annotation", "owner=team-a")), false},
+		{"redacted for any kind", newInput(filter("annotation", "owner=team-a")), false},
+		{"not redacted for the kind", newInput(filter("kind", "Pod"), filter("annotation", "owner=team-a")), true},
+		{"kind with operator", newInput(filter("kind", "!Pod"), filter("annotation", "owner=team-a")), false},
+		{"redacted label key", newInput(filter("label", "secret-key=abc")), false},
+		{"label key", newInput(filter("label", "app=web")), true},
+		{"wildcard label key", newInput(filter("label", "*=topsecret*")), false},
+		{"label key with LIKE wildcard", newInput(filter("label", "secret%=abc")), false},
+		{"label value without key", newInput(filter("label", "*secret*")), false},
+		{"wildcard annotation key for other kinds", newInput(filter("kind", "Pod"), filter("annotation", "*=abc")), true},
+		{"redacted keyword field", &model.SearchInput{Keywords: stringArrayToPointer([]string{"abc"}),
+			KeywordFields: stringArrayToPointer([]string{"label"})}, false},
+	}
+	for _, test := range tests {
+		err := policy.validateInput(test.input, propTypes)
+
+		assert.Equal(t, test.allowed, err == nil, test.name)
+	}
+}
+
+func Test_redactionPolicy_validateInput_fullTextFields(t *testing.T) {
+	policy := newMockRedactionPolicy()
+	mode := model.KeywordModeFulltext
+	input := &model.SearchInput{Keywords: stringArrayToPointer([]string{"web"}), KeywordMode: &mode}
+
+	err := policy.validateInput(input, nil)
+
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"name", "namespace", "kind", "image"}, PointerToStringArray(input.KeywordFields),
+		"Expected the redacted label property to be removed from the keyword fields.")
+}
+
+func Test_redactionPolicy_redactedKeysClause(t *testing.T) {
+	policy := newMockRedactionPolicy()
+
+	sql, _, _ := goqu.Select().Where(policy.redactedKeysClause(&model.SearchInput{})).ToSQL()
+
+	assert.Equal(t, `SELECT * WHERE NOT (((lower("data"->>'kind') IN ('configmap')) AND (("key" ILIKE 'annotation') OR ("key" ILIKE 'label'))) OR ("key" ILIKE '%password%'))`, sql)
+}
+
+func Test_SearchResolver_Items_Redacted(t *testing.T) {
+	mockRedactionPolicy(t, newMockRedactionPolicy())
+	ctrl := gomock.NewController(t)
+	mockPool := pgxpoolmock.NewMockPgxPool(ctrl)
+	mockPool.EXPECT().Query(gomock.Any(), gomock.Any()).Return(
+		pgxpoolmock.NewRows([]string{"uid", "cluster", "data"}).AddRow("local-cluster/abc", "local-cluster",
+			map[string]interface{}{"kind": "ConfigMap", "name": "app-config", "dbPassword": "hunter2",
+				"annotation": map[string]interface{}{"owner": "team-a"}}).ToPgxRows(), nil)
+	resolver := &SearchResult{context: context.TODO(), pool: mockPool, redaction: redactionFor(context.TODO())}
+
+	items, err := resolver.resolveItems(false)
+
+	assert.Nil(t, err)
+	assert.Equal(t, []map[string]interface{}{{"_uid": "local-cluster/abc", "cluster": "local-cluster",
+		"kind": "ConfigMap", "name": "app-config", "dbPassword": redactedValue}}, items)
+}
+
+func Test_SearchSchema_Redacted(t *testing.T) {
+	resolver, mockPool := newMockSearchSchema(t)
+	resolver.redaction = newMockRedactionPolicy()
+	mockPool.EXPECT().Query(gomock.Any(), gomock.Any()).Return(
+		pgxpoolmock.NewRows([]string{"prop"}).AddRow("annotation").AddRow("dbPassword").AddRow("image").
+			ToPgxRows(), nil)
+
+	res, err := resolver.searchSchemaResults(context.TODO())
+
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"cluster", "kind", "label", "name", "namespace", "status", "image"}, res["allProperties"])
+}
+
+func Test_SearchComplete_Redacted(t *testing.T) {
+	resolver := &SearchCompleteResult{property: "dbPassword", redaction: newMockRedactionPolicy()}
+
+	result, err := resolver.autoComplete(context.TODO())
+
+	assert.NotNil(t, err)
+	assert.Empty(t, result)
+}
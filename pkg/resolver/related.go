@@ -285,7 +285,7 @@ func (s *SearchResult) getRelationResolvers(ctx context.Context) []SearchRelated
 	if len(s.uids) > 0 {
 		// Build query to get full item data from s.uids
 		s.buildQueryToGetItemsFromUIDs()
-		items, err := s.resolveItems() // Fetch the related items
+		items, err := s.resolveItems(false) // Fetch the related items
 		if err != nil {
 			klog.Warning("Error resolving related items.", err)
 			return []SearchRelatedResult{}
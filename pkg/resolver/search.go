@@ -28,9 +28,13 @@ type SearchResult struct {
 	pool      pgxpoolmock.PgxPool // Used to mock database pool in tests
 	propTypes map[string]string
 	query     string
-	uids      []*string // List of uids from search result to be used to get relatioinships.
+	redaction *redactionPolicy // Properties redacted from the items. Nil if nothing is redacted.
+	uids      []*string        // List of uids from search result to be used to get relatioinships.
 	userData  rbac.UserData
 	wg        sync.WaitGroup // Used to serialize search query and relatioinships query.
+	countOnce sync.Once      // Used to run the count query only once when finding messages.
+	count     int
+	countErr  error
 }
 
 const ErrorMsg string = "Error building Search query:"
@@ -59,6 +63,7 @@ func Search(ctx context.Context, input []*model.SearchInput) ([]*SearchResult, e
 				userData:  userData,
 				context:   ctx,
 				propTypes: propTypes,
+				redaction: redactionFor(ctx),
 			}
 		}
 	}
@@ -104,6 +109,14 @@ func (s *SearchResult) Count() (int, error) {
 	return s.resolveCount()
 }
 
+// Returns the count of results. The count query runs only once, even when needed for multiple messages.
+func (s *SearchResult) totalCount() (int, error) {
+	s.countOnce.Do(func() {
+		s.count, s.countErr = s.Count()
+	})
+	return s.count, s.countErr
+}
+
 func (s *SearchResult) Items() ([]map[string]interface{}, error) {
 	s.wg.Add(1)
 	defer s.wg.Done()
@@ -115,7 +128,7 @@ func (s *SearchResult) Items() ([]map[string]interface{}, error) {
 	if err != nil {
 		return nil, err
 	}
-	r, e := s.resolveItems()
+	r, e := s.resolveItems(hasRelevanceScore(s.input))
 	if e != nil {
 		s.checkErrorBuildingQuery(e, "Error resolving items.")
 	}
@@ -162,9 +175,17 @@ func (s *SearchResult) Uids() error {
 
 // Build where clause with rbac by combining clusterscoped, namespace scoped and managed cluster access
 func buildRbacWhereClause(ctx context.Context, userrbac rbac.UserData, userInfo v1.UserInfo) exp.ExpressionList {
+	var hubCluster exp.ExpressionList
+	// Users with access to many namespaces use the access table to keep the query small.
+	if fingerprint, ok := useAccessTable(ctx, userrbac.NsResources); ok {
+		hubCluster = matchHubClusterAccessTable(userrbac, userInfo, fingerprint)
+	} else {
+		hubCluster = matchHubCluster(userrbac, userInfo)
+	}
 	return goqu.Or(
 		matchManagedCluster(getKeys(userrbac.ManagedClusters)), // goqu.I("cluster").In([]string{"clusterNames", ....})
-		matchHubCluster(userrbac, userInfo),
+		matchManagedClusterResources(userrbac.ManagedClusterResources, userInfo),
+		hubCluster,
 	)
 }
 
@@ -182,12 +203,24 @@ func (s *SearchResult) buildSearchQuery(ctx context.Context, count bool, uid boo
 	schemaTable := goqu.S("search").Table("resources")
 	ds := goqu.From(schemaTable)
 
-	if len(s.input.Keywords) > 0 {
+	// Use the SUBSTRING mode if fuzzy search isn't available.
+	s.input = fuzzyFallback(ctx, s.pool, s.input)
+
+	// Full-text and fuzzy search don't need to expand the data into key/value rows.
+	// Keywords limited to some fields don't need it either.
+	if s.input != nil && len(s.input.Keywords) > 0 && len(s.input.KeywordFields) == 0 &&
+		getKeywordMode(s.input) == model.KeywordModeSubstring {
 		jsb := goqu.L("jsonb_each_text(?)", goqu.C("data"))
 		ds = goqu.From(schemaTable, jsb)
 	}
 
-	if s.input != nil && (len(s.input.Filters) > 0 || len(s.input.Keywords) > 0) {
+	sortByRelevance, err := orderByRelevanceEnabled(s.input)
+	if err != nil {
+		s.checkErrorBuildingQuery(err, ErrorMsg)
+		return err
+	}
+
+	if s.input != nil && (len(s.input.Filters) > 0 || len(s.input.Keywords) > 0 || len(s.input.ExcludeKeywords) > 0) {
 		// WHERE CLAUSE
 		whereDs, s.propTypes, err = WhereClauseFilter(s.context, s.input, s.propTypes)
 		if err != nil {
@@ -200,6 +233,15 @@ func (s *SearchResult) buildSearchQuery(ctx context.Context, count bool, uid boo
 			selectDs = ds.Select(goqu.COUNT("uid"))
 		} else if uid {
 			selectDs = ds.Select("uid")
+			if sortByRelevance {
+				// Keep the same order as the items, so relationships are resolved for the same results.
+				selectDs = selectDs.Order(goqu.L("?", relevanceScore(s.input)).Desc())
+			}
+		} else if hasRelevanceScore(s.input) {
+			selectDs = ds.SelectDistinct("uid", "cluster", "data", goqu.L("?", relevanceScore(s.input)).As("_score"))
+			if sortByRelevance {
+				selectDs = selectDs.Order(goqu.C("_score").Desc())
+			}
 		} else {
 			selectDs = ds.SelectDistinct("uid", "cluster", "data")
 		}
@@ -287,7 +329,10 @@ func (s *SearchResult) resolveUids() error {
 	}
 	return nil
 }
-func (s *SearchResult) resolveItems() ([]map[string]interface{}, error) {
+
+// Resolves the items from the query results. When withScore is true, the query must select
+// the relevance score after the data column and it's added to each item as _score.
+func (s *SearchResult) resolveItems(withScore bool) ([]map[string]interface{}, error) {
 	items := []map[string]interface{}{}
 	timer := prometheus.NewTimer(metrics.DBQueryDuration.WithLabelValues("resolveItemsFunc"))
 	klog.V(5).Infof("Query issued by resolver [%s] ", s.query)
@@ -306,13 +351,22 @@ func (s *SearchResult) resolveItems() ([]map[string]interface{}, error) {
 		var uid string
 		var cluster string
 		var data map[string]interface{}
-		err = rows.Scan(&uid, &cluster, &data)
+		var score float32
+		if withScore {
+			err = rows.Scan(&uid, &cluster, &data, &score)
+		} else {
+			err = rows.Scan(&uid, &cluster, &data)
+		}
 		if err != nil {
 			klog.Errorf("Error %s retrieving rows for query:%s", err.Error(), s.query)
 		}
+		s.redaction.redact(data)
 		currItem := formatDataMap(data)
 		currItem["_uid"] = uid
 		currItem["cluster"] = cluster
+		if withScore {
+			currItem["_score"] = score
+		}
 
 		items = append(items, currItem)
 		s.uids = append(s.uids, &uid)
@@ -328,7 +382,34 @@ func WhereClauseFilter(ctx context.Context, input *model.SearchInput,
 	var whereDs []exp.Expression
 	var err error
 
-	if len(input.Keywords) > 0 {
+	redaction := redactionFor(ctx)
+	if err = redaction.validateInput(input, propTypeMap); err != nil {
+		return whereDs, propTypeMap, err
+	}
+	redactedKeys := redaction.redactedKeysClause(input)
+
+	if isFullTextSearch(input) {
+		// Sample query: SELECT COUNT("uid") FROM "search"."resources" WHERE
+		// (to_tsvector('simple', COALESCE("data"->>'name', '') || ...) @@ (plainto_tsquery('simple', 'dns')))
+		whereDs = append(whereDs, fullTextWhereClause(PointerToStringArray(input.Keywords),
+			PointerToStringArray(input.KeywordFields)))
+	} else if getKeywordMode(input) == model.KeywordModeFuzzy && len(input.Keywords) > 0 {
+		// Sample query: SELECT COUNT("uid") FROM "search"."resources" WHERE
+		// ((word_similarity('ngnix', COALESCE("data"->>'name', '') || ...) >= 0.3))
+		threshold, err := fuzzyThreshold(input)
+		if err != nil {
+			return whereDs, propTypeMap, err
+		}
+		for _, key := range PointerToStringArray(input.Keywords) {
+			whereDs = append(whereDs, fuzzyKeywordWhereClause(key, PointerToStringArray(input.KeywordFields), threshold))
+		}
+	} else if len(input.Keywords) > 0 && len(input.KeywordFields) > 0 {
+		// Sample query: SELECT COUNT("uid") FROM "search"."resources"
+		// WHERE (("data"->>'name' ILIKE '%redis%') OR ("data"->>'image' ILIKE '%redis%'))
+		for _, key := range PointerToStringArray(input.Keywords) {
+			whereDs = append(whereDs, fieldsSubstringMatch(key, PointerToStringArray(input.KeywordFields)))
+		}
+	} else if len(input.Keywords) > 0 {
 		// Sample query: SELECT COUNT("uid") FROM "search"."resources", jsonb_each_text("data")
 		// WHERE (("value" LIKE '%dns%') AND ("data"->>'kind' ILIKE ANY ('{"pod","deployment"}')))
 		keywords := PointerToStringArray(input.Keywords)
@@ -336,6 +417,15 @@ func WhereClauseFilter(ctx context.Context, input *model.SearchInput,
 			key = "%" + key + "%"
 			whereDs = append(whereDs, goqu.L(`"value"`).ILike(key).Expression())
 		}
+		if redactedKeys != nil {
+			whereDs = append(whereDs, redactedKeys)
+		}
+	}
+
+	// Exclude keywords use a substring comparison for all keyword modes.
+	for _, key := range PointerToStringArray(input.ExcludeKeywords) {
+		whereDs = append(whereDs, excludeKeywordWhereClause(key, PointerToStringArray(input.KeywordFields),
+			redactedKeys))
 	}
 
 	if input.Filters != nil {
@@ -347,6 +437,23 @@ func WhereClauseFilter(ctx context.Context, input *model.SearchInput,
 			}
 			values := PointerToStringArray(filter.Values)
 
+			var operatorWhereDs []exp.Expression //store all the clauses for this filter together
+			if filter.Property == "name" && getKeywordMode(input) == model.KeywordModeFuzzy {
+				threshold, err := fuzzyThreshold(input)
+				if err != nil {
+					return whereDs, propTypeMap, err
+				}
+				fuzzyValues, otherValues := splitFuzzyNameValues(values)
+				if len(fuzzyValues) > 0 {
+					operatorWhereDs = append(operatorWhereDs, fuzzyNameWhereClause(fuzzyValues, threshold))
+				}
+				if len(otherValues) == 0 {
+					whereDs = append(whereDs, goqu.Or(operatorWhereDs...))
+					continue
+				}
+				values = otherValues
+			}
+
 			dataType, dataTypeInMap := propTypeMap[filter.Property]
 			if len(propTypeMap) == 0 || !dataTypeInMap {
 				klog.V(3).Infof("Property type for [%s] doesn't exist in cache. Refreshing property type cache",
@@ -375,7 +482,6 @@ func WhereClauseFilter(ctx context.Context, input *model.SearchInput,
 
 			//Sort map according to keys - This is for the ease/stability of tests when there are multiple operators
 			keys := getKeys(opValueMap)
-			var operatorWhereDs []exp.Expression //store all the clauses for this filter together
 			for _, operator := range keys {
 				operatorWhereDs = append(operatorWhereDs,
 					getWhereClauseExpression(filter.Property, operator, opValueMap[operator], propTypeMap[filter.Property])...)
@@ -6,6 +6,7 @@ import (
 	"reflect"
 	"sort"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/doug-martin/goqu/v9"
@@ -24,20 +25,35 @@ type SearchCompleteResult struct {
 	pool      pgxpoolmock.PgxPool
 	property  string
 	limit     *int
+	prefix    string // Only values starting with this text (case insensitive).
+	contains  string // Only values containing this text (case insensitive).
+	offset    uint   // Number of values to skip, used for paging.
+	keysOnly  bool   // Return the keys of an object property, like label.
+	objectKey string // Return the values for this key of an object property. Set from properties like label.app
 	query     string
 	params    []interface{}
 	propTypes map[string]string
+	redaction *redactionPolicy // Redacted properties can't be completed. Nil if nothing is redacted.
 	userData  rbac.UserData
 }
 
-var arrayProperties = make(map[string]struct{})
 var hubName = config.Cfg.HubName
 
 func (s *SearchCompleteResult) autoComplete(ctx context.Context) ([]*string, error) {
 	if s.property == "managedHub" { // return hubName for managedHub property
 		return []*string{&hubName}, nil
 	}
-	s.searchCompleteQuery(ctx)
+	s.parseObjectKey()
+	if err := s.checkRedacted(); err != nil {
+		return []*string{}, err
+	}
+	if s.keysOnly && (s.objectKey != "" || s.propTypes[s.property] != "object") {
+		return []*string{}, fmt.Errorf("keysOnly is only supported for object properties like label. Property: %s",
+			s.property)
+	}
+	if err := s.searchCompleteQuery(ctx); err != nil {
+		return []*string{}, err
+	}
 	res, autoCompleteErr := s.searchCompleteResults(ctx)
 	if autoCompleteErr != nil {
 		klog.Error("Error resolving properties in autoComplete. ", autoCompleteErr)
@@ -45,7 +61,8 @@ func (s *SearchCompleteResult) autoComplete(ctx context.Context) ([]*string, err
 	return res, autoCompleteErr
 }
 
-func SearchComplete(ctx context.Context, property string, srchInput *model.SearchInput, limit *int) ([]*string, error) {
+func SearchComplete(ctx context.Context, property string, srchInput *model.SearchInput, limit *int,
+	prefix *string, contains *string, offset *int, keysOnly *bool) ([]*string, error) {
 	defer metrics.SlowLog("SearchCompleteResolver", 0)()
 	userData, userDataErr := rbac.GetCache().GetUserData(ctx)
 	if userDataErr != nil {
@@ -66,6 +83,19 @@ func SearchComplete(ctx context.Context, property string, srchInput *model.Searc
 		limit:     limit,
 		userData:  userData,
 		propTypes: propTypes,
+		redaction: redactionFor(ctx),
+	}
+	if prefix != nil {
+		searchCompleteResult.prefix = *prefix
+	}
+	if contains != nil {
+		searchCompleteResult.contains = *contains
+	}
+	if offset != nil && *offset > 0 {
+		searchCompleteResult.offset = uint(*offset)
+	}
+	if keysOnly != nil {
+		searchCompleteResult.keysOnly = *keysOnly
 	}
 	return searchCompleteResult.autoComplete(ctx)
 
@@ -76,7 +106,7 @@ func SearchComplete(ctx context.Context, property string, srchInput *model.Searc
 // LIMIT 100000) as searchComplete
 // ORDER BY name ASC
 // LIMIT 1000
-func (s *SearchCompleteResult) searchCompleteQuery(ctx context.Context) {
+func (s *SearchCompleteResult) searchCompleteQuery(ctx context.Context) error {
 	var limit uint
 	var whereDs []exp.Expression
 	var selectDs *goqu.SelectDataset
@@ -87,11 +117,27 @@ func (s *SearchCompleteResult) searchCompleteQuery(ctx context.Context) {
 
 		// WHERE CLAUSE
 		if s.input != nil && len(s.input.Filters) > 0 {
-			whereDs, s.propTypes, _ = WhereClauseFilter(ctx, s.input, s.propTypes)
+			s.input = fuzzyFallback(ctx, s.pool, s.input)
+			var err error
+			whereDs, s.propTypes, err = WhereClauseFilter(ctx, s.input, s.propTypes)
+			if err != nil {
+				return err
+			}
 		}
 
 		// SELECT CLAUSE
-		if s.property == "cluster" {
+		if s.keysOnly {
+			// Sample: SELECT DISTINCT "key" FROM "search"."resources", jsonb_object_keys("data"->'label') AS "key"
+			// WHERE (jsonb_typeof("data"->'label') = 'object') ORDER BY "key" ASC
+			ds = goqu.From(schemaTable, goqu.L(`jsonb_object_keys("data"->?)`, s.property).As("key"))
+			selectDs = ds.SelectDistinct(goqu.C("key")).Order(goqu.C("key").Asc())
+			whereDs = append(whereDs, goqu.L(`jsonb_typeof("data"->?)`, s.property).Eq("object"))
+		} else if s.objectKey != "" {
+			// Sample: SELECT DISTINCT "data"->'label'->>'app' FROM "search"."resources"
+			// WHERE ("data"->'label'->>'app' IS NOT NULL) ORDER BY "data"->'label'->>'app' ASC
+			selectDs = ds.SelectDistinct(s.valueExpression()).Order(s.valueExpression().Asc())
+			whereDs = append(whereDs, s.valueExpression().IsNotNull())
+		} else if s.property == "cluster" {
 			selectDs = ds.SelectDistinct(goqu.C(s.property)).Order(goqu.C(s.property).Asc())
 			//Adding notNull clause to filter out NULL values and ORDER by sort results
 			whereDs = append(whereDs, goqu.C(s.property).IsNotNull(),
@@ -103,6 +149,7 @@ func (s *SearchCompleteResult) searchCompleteQuery(ctx context.Context) {
 			//Adding notNull clause to filter out NULL values and ORDER by sort results
 			whereDs = append(whereDs, goqu.L(`"data"->?`, s.property).IsNotNull())
 		}
+		whereDs = append(whereDs, s.matchValueClause()...)
 
 		// get user info for logging
 		_, userInfo := rbac.GetCache().GetUserUID(ctx)
@@ -119,22 +166,21 @@ func (s *SearchCompleteResult) searchCompleteQuery(ctx context.Context) {
 
 			s.query = ""
 			s.params = nil
-			return
+			return nil
 		}
 
 		// LIMIT CLAUSE
-		if s.limit != nil && *s.limit > 0 {
-			limit = uint(*s.limit)
-		} else if s.limit != nil && *s.limit == -1 {
-			klog.Warning("Limit set to -1. Fetching all results. This may affect performance.")
-		} else {
-			limit = config.Cfg.QueryLimit
-		}
+		limit = s.getLimit()
 
 		var params []interface{}
 		var sql string
 		var err error
 
+		// OFFSET CLAUSE
+		if s.offset > 0 {
+			selectDs = selectDs.Offset(s.offset)
+		}
+
 		// Get the query
 		if limit > 0 {
 			sql, params, err = selectDs.Where(whereDs...).Limit(limit).ToSQL()
@@ -144,6 +190,7 @@ func (s *SearchCompleteResult) searchCompleteQuery(ctx context.Context) {
 
 		if err != nil {
 			klog.Errorf("Error building SearchComplete query: %s", err.Error())
+			return err
 		}
 		s.query = sql
 		s.params = params
@@ -155,7 +202,7 @@ func (s *SearchCompleteResult) searchCompleteQuery(ctx context.Context) {
 	// SELECT DISTINCT "prop" FROM (SELECT "data"->'?'
 	// AS "prop" FROM "search"."resources" WHERE ("data"->'?' IS NOT NULL) LIMIT 100000)
 	// AS "searchComplete" ORDER BY prop ASC LIMIT 1000
-
+	return nil
 }
 
 func (s *SearchCompleteResult) searchCompleteResults(ctx context.Context) ([]*string, error) {
@@ -181,6 +228,9 @@ func (s *SearchCompleteResult) searchCompleteResults(ctx context.Context) ([]*st
 
 			switch v := input.(type) {
 			case string:
+				if s.keysOnly && s.isRedactedKey(v) {
+					continue
+				}
 				prop = v
 				props[v] = struct{}{}
 			case bool:
@@ -190,15 +240,17 @@ func (s *SearchCompleteResult) searchCompleteResults(ctx context.Context) ([]*st
 				prop = strconv.FormatInt(int64(v), 10)
 				props[prop] = struct{}{}
 			case map[string]interface{}:
-				arrayProperties[s.property] = struct{}{}
 				for key, value := range v {
 					labelString := fmt.Sprintf("%s=%s", key, value.(string))
-					props[labelString] = struct{}{}
+					if s.matchesValue(labelString) && !s.isRedactedKey(key) {
+						props[labelString] = struct{}{}
+					}
 				}
 			case []interface{}:
-				arrayProperties[s.property] = struct{}{}
 				for _, value := range v {
-					props[value.(string)] = struct{}{}
+					if s.matchesValue(value.(string)) {
+						props[value.(string)] = struct{}{}
+					}
 				}
 			default:
 				prop = v.(string)
@@ -212,7 +264,7 @@ func (s *SearchCompleteResult) searchCompleteResults(ctx context.Context) ([]*st
 	} else {
 		klog.Error("searchCompleteResults rows is nil", srchCompleteOut)
 	}
-	if len(srchCompleteOut) > 0 {
+	if len(srchCompleteOut) > 0 && !s.keysOnly {
 		//Check if results are date or number
 		isNumber := isNumber(srchCompleteOut)
 		if isNumber { //check if valid number
@@ -245,6 +297,94 @@ func (s *SearchCompleteResult) searchCompleteResults(ctx context.Context) ([]*st
 	return srchCompleteOut, nil
 }
 
+// Returns the limit from the query or the default QueryLimit. Returns 0 (no limit) when the limit is -1.
+func (s *SearchCompleteResult) getLimit() uint {
+	if s.limit != nil && *s.limit > 0 {
+		return uint(*s.limit)
+	} else if s.limit != nil && *s.limit == -1 {
+		klog.Warning("Limit set to -1. Fetching all results. This may affect performance.")
+		return 0
+	}
+	return config.Cfg.QueryLimit
+}
+
+// Escapes the LIKE wildcards, so the text is matched literally.
+func escapeLikePattern(text string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(text)
+}
+
+// Builds the clauses to match the prefix and contains arguments.
+// Sample: ("data"->>'name' ILIKE 'prod-%') AND ("data"->>'name' ILIKE '%db%')
+// Object and array properties are matched as text, the values are filtered again after they are split.
+func (s *SearchCompleteResult) matchValueClause() []exp.Expression {
+	var whereDs []exp.Expression
+	value := s.valueExpression()
+	propType := s.propTypes[s.property]
+	if s.keysOnly || s.objectKey != "" {
+		propType = "string"
+	}
+	if s.prefix != "" {
+		if propType == "object" || propType == "array" {
+			whereDs = append(whereDs, goqu.L("?", value).ILike("%"+escapeLikePattern(s.prefix)+"%"))
+		} else {
+			whereDs = append(whereDs, goqu.L("?", value).ILike(escapeLikePattern(s.prefix)+"%"))
+		}
+	}
+	if s.contains != "" {
+		whereDs = append(whereDs, goqu.L("?", value).ILike("%"+escapeLikePattern(s.contains)+"%"))
+	}
+	return whereDs
+}
+
+// Returns the text expression for the completed values.
+func (s *SearchCompleteResult) valueExpression() exp.LiteralExpression {
+	switch {
+	case s.keysOnly:
+		return goqu.L(`"key"`)
+	case s.objectKey != "":
+		return goqu.L(`"data"->?->>?`, s.property, s.objectKey)
+	case s.property == "cluster":
+		return goqu.L(`"cluster"`)
+	default:
+		return goqu.L(`"data"->>?`, s.property)
+	}
+}
+
+// Splits properties like label.app into the object property (label) and the key (app).
+// Keys can contain dots, for example label.app.kubernetes.io/name
+func (s *SearchCompleteResult) parseObjectKey() {
+	if _, exists := s.propTypes[s.property]; exists {
+		return
+	}
+	if property, key, found := strings.Cut(s.property, "."); found && key != "" && s.propTypes[property] == "object" {
+		s.property = property
+		s.objectKey = key
+	}
+}
+
+// Returns an error when the property is redacted, so the values can't be listed.
+func (s *SearchCompleteResult) checkRedacted() error {
+	if s.redaction.isRedacted(filterKinds(s.input), s.property, s.objectKey) {
+		if s.objectKey != "" {
+			return fmt.Errorf("property [%s.%s] is redacted", s.property, s.objectKey)
+		}
+		return fmt.Errorf("property [%s] is redacted", s.property)
+	}
+	return nil
+}
+
+// Checks if the key of an object property is redacted.
+func (s *SearchCompleteResult) isRedactedKey(key string) bool {
+	return s.redaction.isRedacted(filterKinds(s.input), s.property, key)
+}
+
+// Checks if the value matches the prefix and contains arguments. Matches are case insensitive.
+func (s *SearchCompleteResult) matchesValue(value string) bool {
+	lowerValue := strings.ToLower(value)
+	return strings.HasPrefix(lowerValue, strings.ToLower(s.prefix)) &&
+		strings.Contains(lowerValue, strings.ToLower(s.contains))
+}
+
 // check if a given string is of type date
 func isDate(vals []*string) bool {
 	for _, val := range vals {
@@ -0,0 +1,231 @@
+// Copyright Contributors to the Open Cluster Management project
+package resolver
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/doug-martin/goqu/v9"
+	"github.com/doug-martin/goqu/v9/exp"
+	"github.com/stolostron/search-v2-api/graph/model"
+	db "github.com/stolostron/search-v2-api/pkg/database"
+	"github.com/stolostron/search-v2-api/pkg/metrics"
+	"github.com/stolostron/search-v2-api/pkg/rbac"
+	klog "k8s.io/klog/v2"
+)
+
+func SearchCompleteValues(ctx context.Context, property string, srchInput *model.SearchInput,
+	limit *int) ([]*model.CompletionValue, error) {
+	defer metrics.SlowLog("SearchCompleteValuesResolver", 0)()
+	userData, userDataErr := rbac.GetCache().GetUserData(ctx)
+	if userDataErr != nil {
+		return []*model.CompletionValue{}, userDataErr
+	}
+
+	// Check that shared cache has property types:
+	propTypes, err := rbac.GetCache().GetPropertyTypes(ctx, false)
+	if err != nil {
+		klog.Warningf("Error creating datatype map with err: [%s] ", err)
+	}
+
+	searchCompleteResult := &SearchCompleteResult{
+		input:     srchInput,
+		pool:      db.GetConnPool(ctx),
+		property:  property,
+		limit:     limit,
+		userData:  userData,
+		propTypes: propTypes,
+		redaction: redactionFor(ctx),
+	}
+	return searchCompleteResult.completeValues(ctx)
+}
+
+// Returns the values with the number of resources for each value. For number and date properties,
+// returns the range of values instead.
+func (s *SearchCompleteResult) completeValues(ctx context.Context) ([]*model.CompletionValue, error) {
+	if s.property == "" {
+		return []*model.CompletionValue{}, fmt.Errorf("property is required")
+	}
+	if err := s.checkRedacted(); err != nil {
+		return []*model.CompletionValue{}, err
+	}
+	propType := s.propTypes[s.property]
+	if s.property == "cluster" || s.property == "managedHub" || propType == "" {
+		propType = "string"
+	}
+	if s.property == "managedHub" { // return hubName for managedHub property
+		return []*model.CompletionValue{{Value: &hubName, Type: &propType}}, nil
+	}
+	if propType == "number" {
+		return s.completeRange(ctx, propType)
+	}
+
+	values, err := s.completeValueCounts(ctx, propType)
+	if err != nil || propType != "string" || len(values) == 0 {
+		return values, err
+	}
+	// Dates are stored as strings, check the values to find if this is a date property.
+	strValues := make([]*string, len(values))
+	for i, value := range values {
+		strValues[i] = value.Value
+	}
+	if isDate(strValues) {
+		return s.completeRange(ctx, "date")
+	}
+	return values, nil
+}
+
+// Builds the WHERE clause with the filters from the query, the RBAC clause, and the condition
+// to include only resources with the property.
+func (s *SearchCompleteResult) completeValuesWhereClause(ctx context.Context,
+	propType string) ([]exp.Expression, error) {
+	var whereDs []exp.Expression
+	var err error
+	if s.input != nil && len(s.input.Filters) > 0 {
+		s.input = fuzzyFallback(ctx, s.pool, s.input)
+		whereDs, s.propTypes, err = WhereClauseFilter(ctx, s.input, s.propTypes)
+		if err != nil {
+			return whereDs, err
+		}
+	}
+
+	switch {
+	case s.property == "cluster":
+		whereDs = append(whereDs, goqu.C(s.property).IsNotNull(), goqu.C(s.property).Neq(""))
+	case propType == "string":
+		whereDs = append(whereDs, goqu.L(`"data"->?`, s.property).IsNotNull())
+	default:
+		// Check the type to avoid errors from resources with a different type for the same property.
+		whereDs = append(whereDs, goqu.L(`jsonb_typeof("data"->?)`, s.property).Eq(propType))
+	}
+
+	// RBAC CLAUSE
+	_, userInfo := rbac.GetCache().GetUserUID(ctx)
+	if s.userData.CsResources == nil && s.userData.NsResources == nil && s.userData.ManagedClusters == nil {
+		return whereDs, fmt.Errorf("RBAC clause is required! None found for searchCompleteValues query %+v "+
+			"for user %s with uid %s ", s.input, userInfo.Username, userInfo.UID)
+	}
+	return append(whereDs, buildRbacWhereClause(ctx, s.userData, userInfo)), nil
+}
+
+// Sample query: SELECT "data"->>'status' AS "value", COUNT(*) AS "count" FROM "search"."resources"
+// WHERE (("data"->'status' IS NOT NULL) AND rbac) GROUP BY 1 ORDER BY "count" DESC, 1 ASC LIMIT 1000
+// Object and array properties are expanded with jsonb_each_text and jsonb_array_elements_text.
+func (s *SearchCompleteResult) completeValueCounts(ctx context.Context,
+	propType string) ([]*model.CompletionValue, error) {
+	values := []*model.CompletionValue{}
+	whereDs, err := s.completeValuesWhereClause(ctx, propType)
+	if err != nil {
+		klog.Error("Error building searchCompleteValues query. ", err)
+		return values, err
+	}
+
+	schemaTable := goqu.S("search").Table("resources")
+	var ds *goqu.SelectDataset
+	var valueDs interface{}
+	switch {
+	case s.property == "cluster":
+		ds = goqu.From(schemaTable)
+		valueDs = goqu.C(s.property)
+	case propType == "object":
+		ds = goqu.From(schemaTable, goqu.L(`jsonb_each_text("data"->?)`, s.property))
+		valueDs = goqu.L(`concat("key", '=', "value")`)
+	case propType == "array":
+		ds = goqu.From(schemaTable, goqu.L(`jsonb_array_elements_text("data"->?)`, s.property))
+		valueDs = goqu.L(`"value"`)
+	default:
+		ds = goqu.From(schemaTable)
+		valueDs = goqu.L(`"data"->>?`, s.property)
+	}
+	// GROUP BY and ORDER BY use the position because the alias "value" is also a column of the expanded rows.
+	selectDs := ds.Select(goqu.L("?", valueDs).As("value"), goqu.COUNT(goqu.Star()).As("count")).
+		Where(whereDs...).GroupBy(goqu.L("1")).Order(goqu.C("count").Desc(), goqu.L("1").Asc())
+	if limit := s.getLimit(); limit > 0 {
+		selectDs = selectDs.Limit(limit)
+	}
+	s.query, s.params, err = selectDs.ToSQL()
+	if err != nil {
+		klog.Errorf("Error building searchCompleteValues query: %s", err.Error())
+		return values, err
+	}
+	klog.V(5).Info("SearchCompleteValues Query: ", s.query)
+
+	rows, err := s.pool.Query(ctx, s.query, s.params...)
+	if err != nil {
+		klog.Error("Error fetching searchCompleteValues results from db ", err)
+		return values, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var value string
+		var count int64
+		if err := rows.Scan(&value, &count); err != nil {
+			klog.Error("Error reading searchCompleteValues results. ", err)
+			continue
+		}
+		if key, _, _ := strings.Cut(value, "="); propType == "object" && s.isRedactedKey(key) {
+			continue
+		}
+		valueCount := int(count)
+		values = append(values, &model.CompletionValue{Value: &value, Count: &valueCount, Type: &propType})
+	}
+	return values, nil
+}
+
+// Sample query: SELECT MIN(("data"->>'cpu')::float8), MAX(("data"->>'cpu')::float8), COUNT(*)
+// FROM "search"."resources" WHERE ((jsonb_typeof("data"->'cpu') = 'number') AND rbac) HAVING (COUNT(*) > 0)
+func (s *SearchCompleteResult) completeRange(ctx context.Context, propType string) ([]*model.CompletionValue, error) {
+	values := []*model.CompletionValue{}
+	whereType := propType
+	if propType == "date" {
+		whereType = "string" // Dates are stored as strings.
+	}
+	whereDs, err := s.completeValuesWhereClause(ctx, whereType)
+	if err != nil {
+		klog.Error("Error building searchCompleteValues query. ", err)
+		return values, err
+	}
+
+	var valueDs exp.Expression
+	if propType == "number" {
+		valueDs = goqu.L(`("data"->>?)::float8`, s.property)
+	} else {
+		// Dates use the RFC3339 format, so the text order is the same as the date order.
+		valueDs = goqu.L(`"data"->>?`, s.property)
+	}
+	s.query, s.params, err = goqu.From(goqu.S("search").Table("resources")).
+		Select(goqu.MIN(valueDs), goqu.MAX(valueDs), goqu.COUNT(goqu.Star())).
+		Where(whereDs...).Having(goqu.COUNT(goqu.Star()).Gt(0)).ToSQL() // No rows if there aren't values.
+	if err != nil {
+		klog.Errorf("Error building searchCompleteValues query: %s", err.Error())
+		return values, err
+	}
+	klog.V(5).Info("SearchCompleteValues Query: ", s.query)
+
+	rows, err := s.pool.Query(ctx, s.query, s.params...)
+	if err != nil {
+		klog.Error("Error fetching searchCompleteValues results from db ", err)
+		return values, err
+	}
+	defer rows.Close()
+	if rows.Next() {
+		var min, max string
+		var count int64
+		if propType == "number" {
+			var minNum, maxNum float64
+			err = rows.Scan(&minNum, &maxNum, &count)
+			min, max = strconv.FormatFloat(minNum, 'f', -1, 64), strconv.FormatFloat(maxNum, 'f', -1, 64)
+		} else {
+			err = rows.Scan(&min, &max, &count)
+		}
+		if err != nil {
+			klog.Error("Error reading searchCompleteValues results. ", err)
+			return values, err
+		}
+		valueCount := int(count)
+		values = append(values, &model.CompletionValue{Type: &propType, Count: &valueCount, Min: &min, Max: &max})
+	}
+	return values, nil
+}
@@ -0,0 +1,127 @@
+// Copyright Contributors to the Open Cluster Management project
+package resolver
+
+import (
+	"context"
+	"testing"
+
+	"github.com/driftprogramming/pgxpoolmock"
+	"github.com/golang/mock/gomock"
+	"github.com/stolostron/search-v2-api/graph/model"
+	"github.com/stolostron/search-v2-api/pkg/rbac"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_SearchCompleteValues_String(t *testing.T) {
+	// Create a SearchCompleteResolver instance with a mock connection pool.
+	resolver, mockPool := newMockSearchComplete(t, &model.SearchInput{}, "status",
+		rbac.UserData{CsResources: []rbac.Resource{}}, map[string]string{"status": "string"})
+
+	// Mock the database query
+	mockPool.EXPECT().Query(gomock.Any(),
+		gomock.Eq(`SELECT "data"->>'status' AS "value", COUNT(*) AS "count" FROM "search"."resources" WHERE (("data"->'status' IS NOT NULL) AND ("cluster" = ANY ('{}'))) GROUP BY 1 ORDER BY "count" DESC, 1 ASC LIMIT 1000`),
+		gomock.Eq([]interface{}{})).
+		Return(pgxpoolmock.NewRows([]string{"value", "count"}).
+			AddRow("Running", int64(12034)).AddRow("Pending", int64(37)).ToPgxRows(), nil)
+
+	// Execute function
+	result, err := resolver.completeValues(context.TODO())
+
+	// Verify response
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(result))
+	assert.Equal(t, "Running", *result[0].Value)
+	assert.Equal(t, 12034, *result[0].Count)
+	assert.Equal(t, "string", *result[0].Type)
+	assert.Equal(t, "Pending", *result[1].Value)
+	assert.Equal(t, 37, *result[1].Count)
+	assert.Nil(t, result[0].Min)
+}
+
+func Test_SearchCompleteValues_Object(t *testing.T) {
+	// Create a SearchCompleteResolver instance with a mock connection pool.
+	limit := 5
+	resolver, mockPool := newMockSearchComplete(t, &model.SearchInput{}, "label",
+		rbac.UserData{CsResources: []rbac.Resource{}}, map[string]string{"label": "object"})
+	resolver.limit = &limit
+
+	// Mock the database query
+	mockPool.EXPECT().Query(gomock.Any(),
+		gomock.Eq(`SELECT concat("key", '=', "value") AS "value", COUNT(*) AS "count" FROM "search"."resources", jsonb_each_text("data"->'label') WHERE ((jsonb_typeof("data"->'label') = 'object') AND ("cluster" = ANY ('{}'))) GROUP BY 1 ORDER BY "count" DESC, 1 ASC LIMIT 5`),
+		gomock.Eq([]interface{}{})).
+		Return(pgxpoolmock.NewRows([]string{"value", "count"}).AddRow("app=search", int64(4)).ToPgxRows(), nil)
+
+	// Execute function
+	result, err := resolver.completeValues(context.TODO())
+
+	// Verify response
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(result))
+	assert.Equal(t, "app=search", *result[0].Value)
+	assert.Equal(t, "object", *result[0].Type)
+}
+
+func Test_SearchCompleteValues_Number(t *testing.T) {
+	// Create a SearchCompleteResolver instance with a mock connection pool.
+	resolver, mockPool := newMockSearchComplete(t, &model.SearchInput{}, "cpu",
+		rbac.UserData{CsResources: []rbac.Resource{}}, map[string]string{"cpu": "number"})
+
+	// Mock the database query
+	mockPool.EXPECT().Query(gomock.Any(),
+		gomock.Eq(`SELECT MIN(("data"->>'cpu')::float8), MAX(("data"->>'cpu')::float8), COUNT(*) FROM "search"."resources" WHERE ((jsonb_typeof("data"->'cpu') = 'number') AND ("cluster" = ANY ('{}'))) HAVING (COUNT(*) > 0)`),
+		gomock.Eq([]interface{}{})).
+		Return(pgxpoolmock.NewRows([]string{"min", "max", "count"}).
+			AddRow(float64(2), float64(24.5), int64(10)).ToPgxRows(), nil)
+
+	// Execute function
+	result, err := resolver.completeValues(context.TODO())
+
+	// Verify response
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(result))
+	assert.Equal(t, "number", *result[0].Type)
+	assert.Equal(t, "2", *result[0].Min)
+	assert.Equal(t, "24.5", *result[0].Max)
+	assert.Equal(t, 10, *result[0].Count)
+	assert.Nil(t, result[0].Value)
+}
+
+func Test_SearchCompleteValues_Date(t *testing.T) {
+	// Create a SearchCompleteResolver instance with a mock connection pool.
+	resolver, mockPool := newMockSearchComplete(t, &model.SearchInput{}, "created",
+		rbac.UserData{CsResources: []rbac.Resource{}}, map[string]string{"created": "string"})
+
+	// Mock the database queries.
+	mockPool.EXPECT().Query(gomock.Any(),
+		gomock.Eq(`SELECT "data"->>'created' AS "value", COUNT(*) AS "count" FROM "search"."resources" WHERE (("data"->'created' IS NOT NULL) AND ("cluster" = ANY ('{}'))) GROUP BY 1 ORDER BY "count" DESC, 1 ASC LIMIT 1000`),
+		gomock.Eq([]interface{}{})).
+		Return(pgxpoolmock.NewRows([]string{"value", "count"}).
+			AddRow("2022-01-01T17:17:09Z", int64(1)).AddRow("2021-01-01T17:17:09Z", int64(1)).ToPgxRows(), nil)
+	mockPool.EXPECT().Query(gomock.Any(),
+		gomock.Eq(`SELECT MIN("data"->>'created'), MAX("data"->>'created'), COUNT(*) FROM "search"."resources" WHERE (("data"->'created' IS NOT NULL) AND ("cluster" = ANY ('{}'))) HAVING (COUNT(*) > 0)`),
+		gomock.Eq([]interface{}{})).
+		Return(pgxpoolmock.NewRows([]string{"min", "max", "count"}).
+			AddRow("2021-01-01T17:17:09Z", "2022-01-01T17:17:09Z", int64(2)).ToPgxRows(), nil)
+
+	// Execute function
+	result, err := resolver.completeValues(context.TODO())
+
+	// Verify response
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(result))
+	assert.Equal(t, "date", *result[0].Type)
+	assert.Equal(t, "2021-01-01T17:17:09Z", *result[0].Min)
+	assert.Equal(t, "2022-01-01T17:17:09Z", *result[0].Max)
+}
+
+func Test_SearchCompleteValues_NoRbac(t *testing.T) {
+	// Create a SearchCompleteResolver instance with a mock connection pool.
+	resolver, _ := newMockSearchComplete(t, &model.SearchInput{}, "status", rbac.UserData{}, nil)
+
+	// Execute function
+	result, err := resolver.completeValues(context.TODO())
+
+	// Verify response
+	assert.NotNil(t, err)
+	assert.Equal(t, 0, len(result))
+}
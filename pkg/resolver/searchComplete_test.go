@@ -349,3 +349,121 @@ func Test_SearchComplete_EmptyQueryWithoutRbac(t *testing.T) {
 	}
 	assert.Equal(t, resolver.query, "", "query should be empty as there is no rbac clause")
 }
+
+func Test_SearchComplete_RedactedFilter(t *testing.T) {
+	mockRedactionPolicy(t, newMockRedactionPolicy())
+	password := "hunter2"
+	searchInput := &model.SearchInput{Filters: []*model.SearchFilter{{Property: "dbPassword", Values: []*string{&password}}}}
+	// The mock pool fails the test if the query runs without the filter.
+	resolver, _ := newMockSearchComplete(t, searchInput, "name", rbac.UserData{CsResources: []rbac.Resource{}},
+		map[string]string{"name": "string", "dbPassword": "string"})
+
+	result, err := resolver.autoComplete(context.TODO())
+
+	assert.NotNil(t, err, "Expected the completion with a redacted filter to be rejected.")
+	assert.Equal(t, 0, len(result))
+}
+
+func Test_SearchComplete_Query_WithPrefixAndOffset(t *testing.T) {
+	// Create a SearchCompleteResolver instance with a mock connection pool.
+	prop1 := "name"
+	resolver, _ := newMockSearchComplete(t, &model.SearchInput{}, prop1, rbac.UserData{CsResources: []rbac.Resource{}}, nil)
+	resolver.prefix = "Prod_"
+	resolver.contains = "50%"
+	resolver.offset = 100
+
+	// Execute function
+	resolver.searchCompleteQuery(context.TODO())
+
+	// Verify response
+	expectedQuery := `SELECT DISTINCT "data"->'name' FROM "search"."resources" WHERE (("data"->'name' IS NOT NULL) AND ("data"->>'name' ILIKE 'Prod\_%') AND ("data"->>'name' ILIKE '%50\%%') AND ("cluster" = ANY ('{}'))) ORDER BY "data"->'name' ASC LIMIT 1000 OFFSET 100`
+	assert.Equal(t, expectedQuery, resolver.query)
+}
+
+func Test_SearchCompleteWithObject_Prefix(t *testing.T) {
+	// Create a SearchCompleteResolver instance with a mock connection pool.
+	prop1 := "label"
+	limit := 10
+	searchInput := &model.SearchInput{Limit: &limit}
+	mockRows := newMockRowsWithoutRBAC("../resolver/mocks/mock.json", searchInput, prop1, limit)
+	propTypesMock := map[string]string{"label": "object"}
+	resolver, mockPool := newMockSearchComplete(t, searchInput, prop1, rbac.UserData{CsResources: []rbac.Resource{}}, propTypesMock)
+	resolver.prefix = "APP."
+
+	val1 := "app.kubernetes.io/name=prometheus-operator"
+	expectedProps := []*string{&val1}
+
+	// Mock the database query
+	mockPool.EXPECT().Query(gomock.Any(),
+		gomock.Eq(`SELECT DISTINCT "data"->'label' FROM "search"."resources" WHERE (("data"->'label' IS NOT NULL) AND ("data"->>'label' ILIKE '%APP.%') AND ("cluster" = ANY ('{}'))) ORDER BY "data"->'label' ASC LIMIT 1000`),
+		gomock.Eq([]interface{}{})).Return(mockRows, nil)
+	// Execute function
+	result, err := resolver.autoComplete(context.TODO())
+	if err != nil {
+		t.Errorf("Incorrect results. expected error to be [%v] got [%v]", nil, err)
+	}
+	// Verify response
+	AssertStringArrayEqual(t, result, expectedProps, "Error in Test_SearchCompleteWithObject_Prefix")
+}
+
+func Test_SearchComplete_Query_KeysOnly(t *testing.T) {
+	// Create a SearchCompleteResolver instance with a mock connection pool.
+	resolver, _ := newMockSearchComplete(t, &model.SearchInput{}, "label", rbac.UserData{CsResources: []rbac.Resource{}},
+		map[string]string{"label": "object"})
+	resolver.keysOnly = true
+	resolver.prefix = "app"
+
+	// Execute function
+	resolver.searchCompleteQuery(context.TODO())
+
+	// Verify response
+	expectedQuery := `SELECT DISTINCT "key" FROM "search"."resources", jsonb_object_keys("data"->'label') AS "key" WHERE ((jsonb_typeof("data"->'label') = 'object') AND ("key" ILIKE 'app%') AND ("cluster" = ANY ('{}'))) ORDER BY "key" ASC LIMIT 1000`
+	assert.Equal(t, expectedQuery, resolver.query)
+}
+
+func Test_SearchComplete_KeysOnlyNotObject(t *testing.T) {
+	// Create a SearchCompleteResolver instance with a mock connection pool.
+	resolver, _ := newMockSearchComplete(t, &model.SearchInput{}, "kind", rbac.UserData{CsResources: []rbac.Resource{}},
+		map[string]string{"kind": "string"})
+	resolver.keysOnly = true
+
+	// Execute function
+	result, err := resolver.autoComplete(context.TODO())
+
+	// Verify response
+	assert.NotNil(t, err)
+	assert.Equal(t, 0, len(result))
+}
+
+func Test_SearchComplete_Query_ObjectKeyValues(t *testing.T) {
+	// Create a SearchCompleteResolver instance with a mock connection pool.
+	resolver, _ := newMockSearchComplete(t, &model.SearchInput{}, "label.app.kubernetes.io/name",
+		rbac.UserData{CsResources: []rbac.Resource{}}, map[string]string{"label": "object"})
+	resolver.contains = "prom"
+
+	// Execute function
+	resolver.parseObjectKey()
+	resolver.searchCompleteQuery(context.TODO())
+
+	// Verify response
+	assert.Equal(t, "label", resolver.property)
+	assert.Equal(t, "app.kubernetes.io/name", resolver.objectKey)
+	expectedQuery := `SELECT DISTINCT "data"->'label'->>'app.kubernetes.io/name' FROM "search"."resources" WHERE (("data"->'label'->>'app.kubernetes.io/name' IS NOT NULL) AND ("data"->'label'->>'app.kubernetes.io/name' ILIKE '%prom%') AND ("cluster" = ANY ('{}'))) ORDER BY "data"->'label'->>'app.kubernetes.io/name' ASC LIMIT 1000`
+	assert.Equal(t, expectedQuery, resolver.query)
+}
+
+func Test_SearchComplete_parseObjectKey(t *testing.T) {
+	// A property that exists with a dot in the name is not split.
+	resolver, _ := newMockSearchComplete(t, &model.SearchInput{}, "status.phase", rbac.UserData{},
+		map[string]string{"status.phase": "string", "status": "object"})
+	resolver.parseObjectKey()
+	assert.Equal(t, "status.phase", resolver.property)
+	assert.Equal(t, "", resolver.objectKey)
+
+	// Only object properties are split.
+	resolver, _ = newMockSearchComplete(t, &model.SearchInput{}, "name.foo", rbac.UserData{},
+		map[string]string{"name": "string"})
+	resolver.parseObjectKey()
+	assert.Equal(t, "name.foo", resolver.property)
+	assert.Equal(t, "", resolver.objectKey)
+}
@@ -0,0 +1,248 @@
+// Copyright Contributors to the Open Cluster Management project
+package resolver
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/doug-martin/goqu/v9"
+	"github.com/doug-martin/goqu/v9/exp"
+	"github.com/driftprogramming/pgxpoolmock"
+	"github.com/stolostron/search-v2-api/graph/model"
+	"github.com/stolostron/search-v2-api/pkg/config"
+	"github.com/stolostron/search-v2-api/pkg/rbac"
+	"k8s.io/klog/v2"
+)
+
+// Caches the result of checking if the pg_trgm extension is installed in the database.
+type trigramExtension struct {
+	available bool
+	checkedAt time.Time
+	lock      sync.Mutex
+}
+
+var trigramCache = &trigramExtension{}
+
+// Tests will replace this function to avoid querying the database.
+var isTrigramAvailable = checkTrigramExtension
+
+// Checks if the pg_trgm extension is installed. The result is cached using the shared cache TTL.
+func checkTrigramExtension(ctx context.Context, pool pgxpoolmock.PgxPool) bool {
+	trigramCache.lock.Lock()
+	defer trigramCache.lock.Unlock()
+	if !trigramCache.checkedAt.IsZero() &&
+		time.Since(trigramCache.checkedAt) < time.Duration(config.Cfg.SharedCacheTTL)*time.Millisecond {
+		return trigramCache.available
+	}
+	if pool == nil {
+		return false
+	}
+
+	var available bool
+	err := pool.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM pg_extension WHERE extname = 'pg_trgm')").Scan(&available)
+	if err != nil {
+		klog.Warningf("Error checking if the pg_trgm extension is installed. Error: %s", err)
+		return false
+	}
+	if !available {
+		klog.Warning("The pg_trgm extension is not installed in the database. Fuzzy search is not available.")
+	}
+	trigramCache.available = available
+	trigramCache.checkedAt = time.Now()
+	return available
+}
+
+// Returns the input to use for the query. When the mode is FUZZY and the pg_trgm extension isn't installed,
+// returns a copy of the input using the SUBSTRING mode and without sorting by relevance.
+func fuzzyFallback(ctx context.Context, pool pgxpoolmock.PgxPool, input *model.SearchInput) *model.SearchInput {
+	if input == nil || getKeywordMode(input) != model.KeywordModeFuzzy || isTrigramAvailable(ctx, pool) {
+		return input
+	}
+	klog.V(3).Info("Fuzzy search is not available. Using keywordMode SUBSTRING.")
+	substring := model.KeywordModeSubstring
+	fallback := *input
+	fallback.KeywordMode = &substring
+	fallback.OrderBy = nil
+	return &fallback
+}
+
+// Fuzzy search is used when the mode is FUZZY and the input has keywords or a name filter.
+func isFuzzySearch(input *model.SearchInput) bool {
+	return input != nil && getKeywordMode(input) == model.KeywordModeFuzzy &&
+		(len(input.Keywords) > 0 || len(fuzzyNameValues(input)) > 0)
+}
+
+// Returns the similarity threshold from the search input or the configured default.
+func fuzzyThreshold(input *model.SearchInput) (float64, error) {
+	threshold := config.Cfg.FuzzySearchThreshold
+	if input != nil && input.FuzzyThreshold != nil {
+		threshold = *input.FuzzyThreshold
+	}
+	if threshold < 0 || threshold > 1 {
+		return threshold, fmt.Errorf("fuzzyThreshold must be between 0 and 1. Received: %v", threshold)
+	}
+	return threshold, nil
+}
+
+// Returns the values of the name filter that use fuzzy matching.
+func fuzzyNameValues(input *model.SearchInput) []string {
+	values := []string{}
+	for _, filter := range input.Filters {
+		if filter.Property == "name" {
+			fuzzyValues, _ := splitFuzzyNameValues(PointerToStringArray(filter.Values))
+			values = append(values, fuzzyValues...)
+		}
+	}
+	return values
+}
+
+// Splits the name values into the operands for fuzzy matching and the values that use the same comparison
+// as the other keyword modes. Negated values, other operators and values with wildcards aren't fuzzy matched.
+func splitFuzzyNameValues(values []string) ([]string, []string) {
+	fuzzyValues, otherValues := []string{}, []string{}
+	for _, value := range values {
+		operator, operand := getOperatorFromString(value)
+		if operator == "=" && !strings.Contains(operand, "*") {
+			fuzzyValues = append(fuzzyValues, operand)
+		} else {
+			otherValues = append(otherValues, value)
+		}
+	}
+	return fuzzyValues, otherValues
+}
+
+// Sample: word_similarity('ngnix', COALESCE("data"->>'name', ...) || ...)
+func fuzzyKeywordScore(keyword string, fields []string) exp.LiteralExpression {
+	return goqu.L("word_similarity(?, ?)", keyword, keywordDocumentText(fields))
+}
+
+// Sample: similarity("data"->>'name', 'ngnix')
+func fuzzyNameScore(value string) exp.LiteralExpression {
+	return goqu.L(`similarity("data"->>'name', ?)`, value)
+}
+
+// Sample: (word_similarity('ngnix', COALESCE("data"->>'name', ...) || ...) >= 0.3)
+func fuzzyKeywordWhereClause(keyword string, fields []string, threshold float64) exp.Expression {
+	return fuzzyKeywordScore(keyword, fields).Gte(threshold)
+}
+
+// Matches any of the values. Sample: ((similarity("data"->>'name', 'ngnix') >= 0.3) OR ...)
+func fuzzyNameWhereClause(values []string, threshold float64) exp.Expression {
+	whereDs := make([]exp.Expression, len(values))
+	for i, value := range values {
+		whereDs[i] = fuzzyNameScore(value).Gte(threshold)
+	}
+	return goqu.Or(whereDs...)
+}
+
+// Builds the _score for fuzzy search. Each keyword must match, so the score is the lowest keyword similarity.
+// The name filter matches any of the values, so its score is the highest similarity of the values.
+// Sample: LEAST(word_similarity('ngnix', COALESCE(...) || ...), GREATEST(similarity("data"->>'name', 'ngnix')))
+func fuzzyScore(input *model.SearchInput) exp.Expression {
+	scores := []interface{}{}
+	for _, keyword := range PointerToStringArray(input.Keywords) {
+		scores = append(scores, fuzzyKeywordScore(keyword, PointerToStringArray(input.KeywordFields)))
+	}
+	if names := fuzzyNameValues(input); len(names) > 0 {
+		nameScores := make([]interface{}, len(names))
+		for i, name := range names {
+			nameScores[i] = fuzzyNameScore(name)
+		}
+		scores = append(scores, goqu.Func("GREATEST", nameScores...))
+	}
+	if len(scores) == 1 {
+		return scores[0].(exp.Expression)
+	}
+	return goqu.Func("LEAST", scores...)
+}
+
+// Returns the keywords and name filter values used to find suggestions.
+func suggestionTerms(input *model.SearchInput) []string {
+	terms := []string{}
+	for _, keyword := range PointerToStringArray(input.Keywords) {
+		if term := strings.Trim(keyword, `"* `); term != "" {
+			terms = append(terms, term)
+		}
+	}
+	for _, value := range fuzzyNameValues(input) {
+		_, operand := getOperatorFromString(value)
+		if term := strings.Trim(operand, `"* `); term != "" {
+			terms = append(terms, term)
+		}
+	}
+	return terms
+}
+
+// Suggests resource names similar to the keywords and name filter values when the search doesn't
+// return any results. Returns an empty string if there aren't suggestions.
+func (s *SearchResult) didYouMean() (string, error) {
+	if s.input == nil || getKeywordMode(s.input) == model.KeywordModeFuzzy {
+		return "", nil
+	}
+	terms := suggestionTerms(s.input)
+	if len(terms) == 0 || !isTrigramAvailable(s.context, s.pool) {
+		return "", nil
+	}
+	count, err := s.totalCount()
+	if err != nil || count > 0 {
+		return "", err
+	}
+	threshold, err := fuzzyThreshold(s.input)
+	if err != nil {
+		return "", err
+	}
+
+	found := false
+	suggestions := make([]string, len(terms))
+	for i, term := range terms {
+		name, err := s.closestName(term, threshold)
+		if err != nil {
+			return "", err
+		}
+		suggestions[i] = term
+		if name != "" && !strings.EqualFold(name, term) {
+			suggestions[i] = name
+			found = true
+		}
+	}
+	if !found {
+		return "", nil
+	}
+	return strings.Join(suggestions, " "), nil
+}
+
+// Finds the resource name most similar to the term, from the resources the user is authorized to see.
+// Sample query: SELECT "data"->>'name' FROM "search"."resources" WHERE ((similarity("data"->>'name', 'ngnix') >= 0.3)
+// AND rbac) ORDER BY similarity("data"->>'name', 'ngnix') DESC LIMIT 1
+func (s *SearchResult) closestName(term string, threshold float64) (string, error) {
+	if s.userData.CsResources == nil && s.userData.NsResources == nil && s.userData.ManagedClusters == nil {
+		return "", nil
+	}
+	_, userInfo := rbac.GetCache().GetUserUID(s.context)
+	sql, params, err := goqu.From(goqu.S("search").Table("resources")).
+		Select(goqu.L(`"data"->>'name'`)).
+		Where(fuzzyNameScore(term).Gte(threshold), buildRbacWhereClause(s.context, s.userData, userInfo)).
+		Order(fuzzyNameScore(term).Desc()).
+		Limit(1).ToSQL()
+	if err != nil {
+		klog.Errorf("Error building query to find names similar to [%s]. Error: %s", term, err)
+		return "", err
+	}
+
+	rows, err := s.pool.Query(s.context, sql, params...)
+	if err != nil {
+		klog.Errorf("Error resolving query [%s]. Error: [%+v]", sql, err)
+		return "", err
+	}
+	defer rows.Close()
+	name := ""
+	if rows.Next() {
+		if err = rows.Scan(&name); err != nil {
+			klog.Errorf("Error %s retrieving rows for query:%s", err.Error(), sql)
+		}
+	}
+	return name, nil
+}
@@ -0,0 +1,201 @@
+// Copyright Contributors to the Open Cluster Management project
+package resolver
+
+import (
+	"context"
+	"testing"
+
+	"github.com/doug-martin/goqu/v9"
+	"github.com/driftprogramming/pgxpoolmock"
+	"github.com/golang/mock/gomock"
+	"github.com/stolostron/search-v2-api/graph/model"
+	"github.com/stolostron/search-v2-api/pkg/rbac"
+	"github.com/stretchr/testify/assert"
+)
+
+const keywordDocumentSQL = `COALESCE("data"->>'name', '') || ' ' || COALESCE("data"->>'namespace', '') || ' ' || ` +
+	`COALESCE("data"->>'kind', '') || ' ' || COALESCE("data"->>'label', '') || ' ' || COALESCE("data"->>'image', '')`
+
+func mockTrigramAvailable(t *testing.T, available bool) {
+	original := isTrigramAvailable
+	isTrigramAvailable = func(ctx context.Context, pool pgxpoolmock.PgxPool) bool { return available }
+	t.Cleanup(func() { isTrigramAvailable = original })
+}
+
+func newFuzzySearchInput(orderBy string, keywords ...string) *model.SearchInput {
+	limit := 10
+	mode := model.KeywordModeFuzzy
+	input := &model.SearchInput{Keywords: stringArrayToPointer(keywords), KeywordMode: &mode, Limit: &limit}
+	if orderBy != "" {
+		input.OrderBy = &orderBy
+	}
+	return input
+}
+
+func Test_buildSearchQuery_FuzzyItems(t *testing.T) {
+	mockTrigramAvailable(t, true)
+	searchInput := newFuzzySearchInput("relevance", "ngnix")
+	resolver, _ := newMockSearchResolver(t, searchInput, nil, rbac.UserData{CsResources: []rbac.Resource{}}, nil)
+
+	err := resolver.buildSearchQuery(context.TODO(), false, false)
+
+	assert.Nil(t, err)
+	assert.Equal(t, `SELECT DISTINCT "uid", "cluster", "data", word_similarity('ngnix', `+keywordDocumentSQL+
+		`) AS "_score" FROM "search"."resources" WHERE ((word_similarity('ngnix', `+keywordDocumentSQL+
+		`) >= 0.3) AND ("cluster" = ANY ('{}'))) ORDER BY "_score" DESC LIMIT 10`, resolver.query)
+}
+
+func Test_buildSearchQuery_FuzzyNameFilter(t *testing.T) {
+	mockTrigramAvailable(t, true)
+	name1, name2 := "ngnix", "promethues"
+	threshold := 0.5
+	searchInput := newFuzzySearchInput("relevance")
+	searchInput.FuzzyThreshold = &threshold
+	searchInput.Filters = []*model.SearchFilter{{Property: "name", Values: []*string{&name1, &name2}}}
+	resolver, _ := newMockSearchResolver(t, searchInput, nil, rbac.UserData{CsResources: []rbac.Resource{}}, nil)
+
+	err := resolver.buildSearchQuery(context.TODO(), false, false)
+
+	assert.Nil(t, err)
+	assert.Equal(t, `SELECT DISTINCT "uid", "cluster", "data", GREATEST(similarity("data"->>'name', 'ngnix'), `+
+		`similarity("data"->>'name', 'promethues')) AS "_score" FROM "search"."resources" WHERE `+
+		`(((similarity("data"->>'name', 'ngnix') >= 0.5) OR (similarity("data"->>'name', 'promethues') >= 0.5)) `+
+		`AND ("cluster" = ANY ('{}'))) ORDER BY "_score" DESC LIMIT 10`, resolver.query)
+}
+
+func Test_buildSearchQuery_FuzzyNameNegatedAndWildcard(t *testing.T) {
+	mockTrigramAvailable(t, true)
+	name1, name2, name3 := "ngnix", "!test", "web*"
+	searchInput := newFuzzySearchInput("relevance")
+	searchInput.Filters = []*model.SearchFilter{{Property: "name", Values: []*string{&name1, &name2, &name3}}}
+	resolver, _ := newMockSearchResolver(t, searchInput, nil, rbac.UserData{CsResources: []rbac.Resource{}},
+		map[string]string{"name": "string"})
+
+	err := resolver.buildSearchQuery(context.TODO(), false, false)
+
+	assert.Nil(t, err)
+	assert.Equal(t, `SELECT DISTINCT "uid", "cluster", "data", GREATEST(similarity("data"->>'name', 'ngnix')) AS "_score" `+
+		`FROM "search"."resources" WHERE (((similarity("data"->>'name', 'ngnix') >= 0.3) OR `+
+		`NOT(("data"->>'name' LIKE 'test')) OR ("data"->>'name' LIKE 'web%')) AND ("cluster" = ANY ('{}'))) `+
+		`ORDER BY "_score" DESC LIMIT 10`, resolver.query)
+}
+
+func Test_buildSearchQuery_FuzzyNameOnlyNegated(t *testing.T) {
+	mockTrigramAvailable(t, true)
+	name := "!nginx"
+	searchInput := newFuzzySearchInput("")
+	searchInput.Filters = []*model.SearchFilter{{Property: "name", Values: []*string{&name}}}
+	resolver, _ := newMockSearchResolver(t, searchInput, nil, rbac.UserData{CsResources: []rbac.Resource{}},
+		map[string]string{"name": "string"})
+
+	err := resolver.buildSearchQuery(context.TODO(), false, false)
+
+	assert.Nil(t, err)
+	assert.False(t, isFuzzySearch(searchInput), "Expected negated names to not use fuzzy matching.")
+	assert.Equal(t, `SELECT DISTINCT "uid", "cluster", "data" FROM "search"."resources" WHERE `+
+		`(("data"->>'name' NOT IN ('nginx')) AND ("cluster" = ANY ('{}'))) LIMIT 10`, resolver.query)
+}
+
+func Test_buildSearchQuery_FuzzyKeywordsAndName(t *testing.T) {
+	mockTrigramAvailable(t, true)
+	name := "ngnix"
+	searchInput := newFuzzySearchInput("", "dflt")
+	searchInput.Filters = []*model.SearchFilter{{Property: "name", Values: []*string{&name}}}
+	resolver, _ := newMockSearchResolver(t, searchInput, nil, rbac.UserData{CsResources: []rbac.Resource{}}, nil)
+
+	err := resolver.buildSearchQuery(context.TODO(), true, false)
+
+	assert.Nil(t, err)
+	assert.Equal(t, `SELECT COUNT("uid") FROM "search"."resources" WHERE ((word_similarity('dflt', `+
+		keywordDocumentSQL+`) >= 0.3) AND (similarity("data"->>'name', 'ngnix') >= 0.3) AND ("cluster" = ANY ('{}')))`,
+		resolver.query)
+	assert.Equal(t, `SELECT LEAST(word_similarity('dflt', `+keywordDocumentSQL+
+		`), GREATEST(similarity("data"->>'name', 'ngnix')))`, selectSQL(t, fuzzyScore(searchInput)))
+}
+
+func Test_buildSearchQuery_FuzzyFallback(t *testing.T) {
+	mockTrigramAvailable(t, false)
+	searchInput := newFuzzySearchInput("relevance", "ngnix")
+	resolver, _ := newMockSearchResolver(t, searchInput, nil, rbac.UserData{CsResources: []rbac.Resource{}}, nil)
+
+	err := resolver.buildSearchQuery(context.TODO(), false, false)
+
+	assert.Nil(t, err)
+	assert.Equal(t, `SELECT DISTINCT "uid", "cluster", "data" FROM "search"."resources", jsonb_each_text("data") `+
+		`WHERE (("value" ILIKE '%ngnix%') AND ("cluster" = ANY ('{}'))) LIMIT 10`, resolver.query)
+	assert.False(t, hasRelevanceScore(resolver.input))
+	assert.Equal(t, model.KeywordModeFuzzy, *searchInput.KeywordMode, "Original input must not be modified.")
+}
+
+func Test_buildSearchQuery_FuzzyInvalidThreshold(t *testing.T) {
+	mockTrigramAvailable(t, true)
+	threshold := 1.5
+	searchInput := newFuzzySearchInput("", "ngnix")
+	searchInput.FuzzyThreshold = &threshold
+	resolver, _ := newMockSearchResolver(t, searchInput, nil, rbac.UserData{CsResources: []rbac.Resource{}}, nil)
+
+	err := resolver.buildSearchQuery(context.TODO(), false, false)
+
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "fuzzyThreshold must be between 0 and 1")
+}
+
+func Test_didYouMean(t *testing.T) {
+	mockTrigramAvailable(t, true)
+	val := "ngnix"
+	searchInput := &model.SearchInput{Keywords: []*string{&val}}
+	resolver, mockPool := newMockSearchResolver(t, searchInput, nil, rbac.UserData{CsResources: []rbac.Resource{}}, nil)
+
+	mockPool.EXPECT().QueryRow(gomock.Any(),
+		gomock.Eq(`SELECT COUNT("uid") FROM "search"."resources", jsonb_each_text("data") WHERE (("value" ILIKE '%ngnix%') AND ("cluster" = ANY ('{}')))`),
+	).Return(&Row{MockValue: 0})
+	mockPool.EXPECT().Query(gomock.Any(),
+		gomock.Eq(`SELECT "data"->>'name' FROM "search"."resources" WHERE ((similarity("data"->>'name', 'ngnix') >= 0.3) AND ("cluster" = ANY ('{}'))) ORDER BY similarity("data"->>'name', 'ngnix') DESC LIMIT 1`),
+	).Return(pgxpoolmock.NewRows([]string{"name"}).AddRow("nginx").ToPgxRows(), nil)
+
+	suggestion, err := resolver.didYouMean()
+
+	assert.Nil(t, err)
+	assert.Equal(t, "nginx", suggestion)
+}
+
+func Test_didYouMean_WithResults(t *testing.T) {
+	mockTrigramAvailable(t, true)
+	val := "nginx"
+	searchInput := &model.SearchInput{Keywords: []*string{&val}}
+	resolver, mockPool := newMockSearchResolver(t, searchInput, nil, rbac.UserData{CsResources: []rbac.Resource{}}, nil)
+
+	mockPool.EXPECT().QueryRow(gomock.Any(), gomock.Any()).Return(&Row{MockValue: 3})
+
+	suggestion, err := resolver.didYouMean()
+
+	assert.Nil(t, err)
+	assert.Equal(t, "", suggestion)
+}
+
+func Test_Messages_DidYouMean(t *testing.T) {
+	mockTrigramAvailable(t, true)
+	val := "ngnix"
+	searchInput := &model.SearchInput{Keywords: []*string{&val}}
+	resolver, mockPool := newMockSearchResolver(t, searchInput, nil, rbac.UserData{CsResources: []rbac.Resource{}}, nil)
+	mockPool.EXPECT().QueryRow(gomock.Any(), gomock.Any()).Return(&Row{MockValue: 0})
+	mockPool.EXPECT().Query(gomock.Any(), gomock.Any()).
+		Return(pgxpoolmock.NewRows([]string{"name"}).AddRow("nginx").ToPgxRows(), nil)
+	mockMessage := Message{
+		cache:    &MockCache{disabled: map[string]struct{}{}},
+		searches: []*SearchResult{resolver},
+	}
+
+	res, err := mockMessage.messageResults(context.Background())
+
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(res))
+	assert.Equal(t, "S30", res[0].ID)
+	assert.Equal(t, `No results found. Did you mean "nginx"?`, *res[0].Description)
+}
+
+func selectSQL(t *testing.T, expression interface{}) string {
+	sql, _, err := goqu.Select(expression).ToSQL()
+	assert.Nil(t, err)
+	return sql
+}
@@ -0,0 +1,173 @@
+// Copyright Contributors to the Open Cluster Management project
+package resolver
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/doug-martin/goqu/v9"
+	"github.com/doug-martin/goqu/v9/exp"
+	"github.com/stolostron/search-v2-api/graph/model"
+)
+
+// Properties included in the document used for full-text and fuzzy keyword search. Changing the properties
+// or their order requires the same change in the full-text index created by the indexer.
+var fullTextProperties = []string{"name", "namespace", "kind", "label", "image"}
+
+// Matches the words that can be used to build a prefix tsquery. Any other character is dropped
+// to avoid syntax errors from the tsquery operators (& | ! : * ( ) ').
+var tsqueryWordRegex = regexp.MustCompile(`[\p{L}\p{N}_]+`)
+
+const orderByRelevance = "relevance"
+
+// Returns the keyword mode from the search input. Defaults to SUBSTRING.
+func getKeywordMode(input *model.SearchInput) model.KeywordMode {
+	if input == nil || input.KeywordMode == nil {
+		return model.KeywordModeSubstring
+	}
+	return *input.KeywordMode
+}
+
+// Full-text search is used only when the input has keywords and the mode is FULLTEXT.
+func isFullTextSearch(input *model.SearchInput) bool {
+	return input != nil && len(input.Keywords) > 0 && getKeywordMode(input) == model.KeywordModeFulltext
+}
+
+// Validates the orderBy value from the search input.
+// Returns true if the results must be sorted by relevance.
+func orderByRelevanceEnabled(input *model.SearchInput) (bool, error) {
+	if input == nil || input.OrderBy == nil || *input.OrderBy == "" {
+		return false, nil
+	}
+	if !strings.EqualFold(*input.OrderBy, orderByRelevance) {
+		return false, fmt.Errorf("orderBy value [%s] is not supported. Supported values: [%s]",
+			*input.OrderBy, orderByRelevance)
+	}
+	if !hasRelevanceScore(input) {
+		return false, fmt.Errorf("orderBy [%s] requires keywords and keywordMode: %s or %s",
+			orderByRelevance, model.KeywordModeFulltext, model.KeywordModeFuzzy)
+	}
+	return true, nil
+}
+
+// Returns true if the query selects the _score of each item.
+func hasRelevanceScore(input *model.SearchInput) bool {
+	return isFullTextSearch(input) || isFuzzySearch(input)
+}
+
+// Returns the expression used to compute the _score of each item.
+func relevanceScore(input *model.SearchInput) exp.Expression {
+	if isFullTextSearch(input) {
+		return fullTextScore(PointerToStringArray(input.Keywords), PointerToStringArray(input.KeywordFields))
+	}
+	return fuzzyScore(input)
+}
+
+// Returns the text value of a property. The cluster is a column, other properties are in the data column.
+func keywordField(field string) exp.Expression {
+	if field == "cluster" {
+		return goqu.C("cluster")
+	}
+	return goqu.L(`"data"->>?`, field)
+}
+
+// Concatenates the properties into a single text value. Uses the full-text properties if fields is empty.
+// Uses || instead of concat_ws() because concat_ws() isn't IMMUTABLE, so it can't be used in an index expression.
+// Sample:
+//
+//	COALESCE("data"->>'name', '') || ' ' || COALESCE("data"->>'namespace', '') || ...
+func keywordDocumentText(fields []string) exp.LiteralExpression {
+	if len(fields) == 0 {
+		fields = fullTextProperties
+	}
+	placeholders := make([]string, len(fields))
+	args := make([]interface{}, len(fields))
+	for i, field := range fields {
+		placeholders[i] = "COALESCE(?, '')"
+		args[i] = keywordField(field)
+	}
+	return goqu.L(strings.Join(placeholders, " || ' ' || "), args...)
+}
+
+// Builds the text search document from the properties.
+// The search schema is owned by the indexer, so the API doesn't create the index for the document. Postgres only
+// uses the index when the query has the same expression, so the indexer must create it for the full-text
+// properties in the same order. Searches with custom keywordFields build a different document and don't use it.
+// Without the index, to_tsvector() is computed for each row with a sequential scan of the table.
+//
+//	CREATE INDEX IF NOT EXISTS data_fulltext_idx ON search.resources USING GIN (to_tsvector('simple',
+//		COALESCE(data->>'name', '') || ' ' || COALESCE(data->>'namespace', '') || ' ' ||
+//		COALESCE(data->>'kind', '') || ' ' || COALESCE(data->>'label', '') || ' ' || COALESCE(data->>'image', '')))
+func fullTextDocument(fields []string) exp.LiteralExpression {
+	return goqu.L("to_tsvector('simple', ?)", keywordDocumentText(fields))
+}
+
+// Matches the keyword in any of the properties using a case-insensitive substring comparison.
+// Sample: (("data"->>'name' ILIKE '%redis%') OR ("data"->>'image' ILIKE '%redis%'))
+func fieldsSubstringMatch(keyword string, fields []string) exp.Expression {
+	whereDs := make([]exp.Expression, len(fields))
+	for i, field := range fields {
+		whereDs[i] = goqu.L("?", keywordField(field)).ILike("%" + keyword + "%")
+	}
+	return goqu.Or(whereDs...)
+}
+
+// Excludes resources containing the keyword. When fields is empty, checks every text field without
+// joining the data into key/value rows.
+// Sample: NOT EXISTS (SELECT 1 FROM jsonb_each_text("data") WHERE "value" ILIKE '%test%')
+// Sample with fields: NOT COALESCE((("data"->>'name' ILIKE '%test%') OR ...), FALSE)
+func excludeKeywordWhereClause(keyword string, fields []string, redactedKeys exp.Expression) exp.Expression {
+	if len(fields) == 0 && redactedKeys != nil {
+		return goqu.L(`NOT EXISTS (SELECT 1 FROM jsonb_each_text("data") WHERE "value" ILIKE ? AND ?)`,
+			"%"+keyword+"%", redactedKeys)
+	} else if len(fields) == 0 {
+		return goqu.L(`NOT EXISTS (SELECT 1 FROM jsonb_each_text("data") WHERE "value" ILIKE ?)`, "%"+keyword+"%")
+	}
+	// COALESCE is needed because the comparison is NULL when the resource doesn't have the property.
+	return goqu.L("NOT COALESCE(?, FALSE)", fieldsSubstringMatch(keyword, fields))
+}
+
+// Builds the tsquery for a single keyword.
+//   - "my app" (wrapped in double quotes) matches the phrase: phraseto_tsquery('simple', 'my app')
+//   - ngin* (ends with *) matches the prefix: to_tsquery('simple', 'ngin:*')
+//   - Otherwise matches all the words: plainto_tsquery('simple', 'nginx')
+func keywordToTsquery(keyword string) exp.LiteralExpression {
+	keyword = strings.TrimSpace(keyword)
+	if len(keyword) > 2 && strings.HasPrefix(keyword, `"`) && strings.HasSuffix(keyword, `"`) {
+		return goqu.L("phraseto_tsquery('simple', ?)", strings.Trim(keyword, `"`))
+	}
+	if strings.HasSuffix(keyword, "*") {
+		words := tsqueryWordRegex.FindAllString(keyword, -1)
+		if len(words) > 0 {
+			words[len(words)-1] = words[len(words)-1] + ":*"
+			return goqu.L("to_tsquery('simple', ?)", strings.Join(words, " & "))
+		}
+	}
+	return goqu.L("plainto_tsquery('simple', ?)", keyword)
+}
+
+// Combines the tsquery of all keywords with AND (&&).
+func fullTextQuery(keywords []string) exp.LiteralExpression {
+	placeholders := make([]string, len(keywords))
+	args := make([]interface{}, len(keywords))
+	for i, keyword := range keywords {
+		placeholders[i] = "?"
+		args[i] = keywordToTsquery(keyword)
+	}
+	return goqu.L("("+strings.Join(placeholders, " && ")+")", args...)
+}
+
+// Sample:
+//
+//	to_tsvector('simple', COALESCE("data"->>'name', '') || ...) @@ (plainto_tsquery('simple', 'nginx'))
+func fullTextWhereClause(keywords []string, fields []string) exp.Expression {
+	return goqu.L("? @@ ?", fullTextDocument(fields), fullTextQuery(keywords))
+}
+
+// Sample:
+//
+//	ts_rank(to_tsvector('simple', COALESCE("data"->>'name', '') || ...), (plainto_tsquery('simple', 'nginx')))
+func fullTextScore(keywords []string, fields []string) exp.LiteralExpression {
+	return goqu.L("ts_rank(?, ?)", fullTextDocument(fields), fullTextQuery(keywords))
+}
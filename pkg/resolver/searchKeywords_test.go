@@ -0,0 +1,170 @@
+// Copyright Contributors to the Open Cluster Management project
+package resolver
+
+import (
+	"context"
+	"testing"
+
+	"github.com/doug-martin/goqu/v9"
+	"github.com/stolostron/search-v2-api/graph/model"
+	"github.com/stolostron/search-v2-api/pkg/rbac"
+	"github.com/stretchr/testify/assert"
+)
+
+const fullTextDocumentSQL = `to_tsvector('simple', COALESCE("data"->>'name', '') || ' ' || COALESCE("data"->>'namespace', '') || ' ' || ` +
+	`COALESCE("data"->>'kind', '') || ' ' || COALESCE("data"->>'label', '') || ' ' || COALESCE("data"->>'image', ''))`
+
+func newFullTextSearchInput(orderBy string, keywords ...string) *model.SearchInput {
+	limit := 10
+	mode := model.KeywordModeFulltext
+	input := &model.SearchInput{Keywords: stringArrayToPointer(keywords), KeywordMode: &mode, Limit: &limit}
+	if orderBy != "" {
+		input.OrderBy = &orderBy
+	}
+	return input
+}
+
+func Test_buildSearchQuery_FullTextItems(t *testing.T) {
+	searchInput := newFullTextSearchInput("relevance", "nginx")
+	resolver, _ := newMockSearchResolver(t, searchInput, nil, rbac.UserData{CsResources: []rbac.Resource{}}, nil)
+
+	err := resolver.buildSearchQuery(context.TODO(), false, false)
+
+	assert.Nil(t, err)
+	assert.Equal(t, `SELECT DISTINCT "uid", "cluster", "data", ts_rank(`+fullTextDocumentSQL+
+		`, (plainto_tsquery('simple', 'nginx'))) AS "_score" FROM "search"."resources" WHERE (`+
+		fullTextDocumentSQL+` @@ (plainto_tsquery('simple', 'nginx')) AND ("cluster" = ANY ('{}'))) `+
+		`ORDER BY "_score" DESC LIMIT 10`, resolver.query)
+}
+
+func Test_buildSearchQuery_FullTextCount(t *testing.T) {
+	searchInput := newFullTextSearchInput("", `"my app"`, "ngin*")
+	resolver, _ := newMockSearchResolver(t, searchInput, nil, rbac.UserData{CsResources: []rbac.Resource{}}, nil)
+
+	err := resolver.buildSearchQuery(context.TODO(), true, false)
+
+	assert.Nil(t, err)
+	assert.Equal(t, `SELECT COUNT("uid") FROM "search"."resources" WHERE (`+fullTextDocumentSQL+
+		` @@ (phraseto_tsquery('simple', 'my app') && to_tsquery('simple', 'ngin:*')) AND ("cluster" = ANY ('{}')))`,
+		resolver.query)
+}
+
+func Test_buildSearchQuery_FullTextUids(t *testing.T) {
+	searchInput := newFullTextSearchInput("relevance", "nginx")
+	resolver, _ := newMockSearchResolver(t, searchInput, nil, rbac.UserData{CsResources: []rbac.Resource{}}, nil)
+
+	err := resolver.buildSearchQuery(context.TODO(), false, true)
+
+	assert.Nil(t, err)
+	assert.Equal(t, `SELECT "uid" FROM "search"."resources" WHERE (`+fullTextDocumentSQL+
+		` @@ (plainto_tsquery('simple', 'nginx')) AND ("cluster" = ANY ('{}'))) ORDER BY ts_rank(`+
+		fullTextDocumentSQL+`, (plainto_tsquery('simple', 'nginx'))) DESC LIMIT 10`, resolver.query)
+}
+
+func Test_buildSearchQuery_OrderByRelevanceRequiresFullText(t *testing.T) {
+	val := "nginx"
+	orderBy := "relevance"
+	searchInput := &model.SearchInput{Keywords: []*string{&val}, OrderBy: &orderBy}
+	resolver, _ := newMockSearchResolver(t, searchInput, nil, rbac.UserData{CsResources: []rbac.Resource{}}, nil)
+
+	err := resolver.buildSearchQuery(context.TODO(), false, false)
+
+	assert.NotNil(t, err)
+	assert.Equal(t, "", resolver.query)
+}
+
+func Test_buildSearchQuery_OrderByNotSupported(t *testing.T) {
+	searchInput := newFullTextSearchInput("name", "nginx")
+	resolver, _ := newMockSearchResolver(t, searchInput, nil, rbac.UserData{CsResources: []rbac.Resource{}}, nil)
+
+	err := resolver.buildSearchQuery(context.TODO(), false, false)
+
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "orderBy value [name] is not supported")
+}
+
+func Test_keywordToTsquery(t *testing.T) {
+	tests := map[string]string{
+		"nginx":        `plainto_tsquery('simple', 'nginx')`,
+		`"my app"`:     `phraseto_tsquery('simple', 'my app')`,
+		"ngin*":        `to_tsquery('simple', 'ngin:*')`,
+		"my-app*":      `to_tsquery('simple', 'my & app:*')`,
+		"o'brien":      `plainto_tsquery('simple', 'o''brien')`,
+		"*":            `plainto_tsquery('simple', '*')`,
+		` "spaced" `:   `phraseto_tsquery('simple', 'spaced')`,
+		"a & b | !c:*": `to_tsquery('simple', 'a & b & c:*')`,
+	}
+	for keyword, expected := range tests {
+		sql, _, err := goqu.Select(keywordToTsquery(keyword)).ToSQL()
+		assert.Nil(t, err)
+		assert.Equal(t, "SELECT "+expected, sql, "keyword: %s", keyword)
+	}
+}
+
+func Test_buildSearchQuery_KeywordFields(t *testing.T) {
+	limit := 10
+	searchInput := &model.SearchInput{Keywords: stringArrayToPointer([]string{"redis"}),
+		KeywordFields: stringArrayToPointer([]string{"name", "image"}), Limit: &limit}
+	resolver, _ := newMockSearchResolver(t, searchInput, nil, rbac.UserData{CsResources: []rbac.Resource{}}, nil)
+
+	err := resolver.buildSearchQuery(context.TODO(), false, false)
+
+	assert.Nil(t, err)
+	assert.Equal(t, `SELECT DISTINCT "uid", "cluster", "data" FROM "search"."resources" WHERE `+
+		`((("data"->>'name' ILIKE '%redis%') OR ("data"->>'image' ILIKE '%redis%')) AND ("cluster" = ANY ('{}'))) LIMIT 10`,
+		resolver.query)
+}
+
+func Test_buildSearchQuery_ExcludeKeywords(t *testing.T) {
+	searchInput := &model.SearchInput{Keywords: stringArrayToPointer([]string{"redis"}),
+		ExcludeKeywords: stringArrayToPointer([]string{"test"})}
+	resolver, _ := newMockSearchResolver(t, searchInput, nil, rbac.UserData{CsResources: []rbac.Resource{}}, nil)
+
+	err := resolver.buildSearchQuery(context.TODO(), true, false)
+
+	assert.Nil(t, err)
+	assert.Equal(t, `SELECT COUNT("uid") FROM "search"."resources", jsonb_each_text("data") WHERE (("value" ILIKE '%redis%') `+
+		`AND NOT EXISTS (SELECT 1 FROM jsonb_each_text("data") WHERE "value" ILIKE '%test%') AND ("cluster" = ANY ('{}')))`,
+		resolver.query)
+}
+
+func Test_buildSearchQuery_OnlyExcludeKeywords(t *testing.T) {
+	searchInput := &model.SearchInput{ExcludeKeywords: stringArrayToPointer([]string{"test"})}
+	resolver, _ := newMockSearchResolver(t, searchInput, nil, rbac.UserData{CsResources: []rbac.Resource{}}, nil)
+
+	err := resolver.buildSearchQuery(context.TODO(), true, false)
+
+	assert.Nil(t, err, "Expected exclude keywords to be a valid search input.")
+	assert.Equal(t, `SELECT COUNT("uid") FROM "search"."resources" WHERE (NOT EXISTS (SELECT 1 FROM jsonb_each_text("data") `+
+		`WHERE "value" ILIKE '%test%') AND ("cluster" = ANY ('{}')))`,
+		resolver.query)
+}
+
+func Test_buildSearchQuery_ExcludeKeywordsWithFields(t *testing.T) {
+	kind := "Pod"
+	searchInput := &model.SearchInput{ExcludeKeywords: stringArrayToPointer([]string{"test"}),
+		KeywordFields: stringArrayToPointer([]string{"name", "cluster"}),
+		Filters:       []*model.SearchFilter{{Property: "kind", Values: []*string{&kind}}}}
+	resolver, _ := newMockSearchResolver(t, searchInput, nil, rbac.UserData{CsResources: []rbac.Resource{}},
+		map[string]string{"kind": "string"})
+
+	err := resolver.buildSearchQuery(context.TODO(), true, false)
+
+	assert.Nil(t, err)
+	assert.Equal(t, `SELECT COUNT("uid") FROM "search"."resources" WHERE (NOT COALESCE((("data"->>'name' ILIKE '%test%') `+
+		`OR ("cluster" ILIKE '%test%')), FALSE) AND "data"->'kind'?('Pod') AND ("cluster" = ANY ('{}')))`,
+		resolver.query)
+}
+
+func Test_buildSearchQuery_FullTextKeywordFields(t *testing.T) {
+	searchInput := newFullTextSearchInput("", "redis")
+	searchInput.KeywordFields = stringArrayToPointer([]string{"name", "image"})
+	resolver, _ := newMockSearchResolver(t, searchInput, nil, rbac.UserData{CsResources: []rbac.Resource{}}, nil)
+
+	err := resolver.buildSearchQuery(context.TODO(), true, false)
+
+	assert.Nil(t, err)
+	assert.Equal(t, `SELECT COUNT("uid") FROM "search"."resources" WHERE (to_tsvector('simple', `+
+		`COALESCE("data"->>'name', '') || ' ' || COALESCE("data"->>'image', '')) @@ (plainto_tsquery('simple', 'redis')) AND ("cluster" = ANY ('{}')))`,
+		resolver.query)
+}
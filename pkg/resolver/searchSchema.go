@@ -13,10 +13,11 @@ import (
 )
 
 type SearchSchema struct {
-	pool     pgxpoolmock.PgxPool
-	query    string
-	params   []interface{}
-	userData rbac.UserData
+	pool      pgxpoolmock.PgxPool
+	query     string
+	params    []interface{}
+	redaction *redactionPolicy // Redacted properties are removed from the schema. Nil if nothing is redacted.
+	userData  rbac.UserData
 }
 
 func SearchSchemaResolver(ctx context.Context) (map[string]interface{}, error) {
@@ -26,8 +27,9 @@ func SearchSchemaResolver(ctx context.Context) (map[string]interface{}, error) {
 	}
 	// Proceed if user's rbac data exists
 	searchSchemaResult := &SearchSchema{
-		pool:     db.GetConnPool(ctx),
-		userData: userData,
+		pool:      db.GetConnPool(ctx),
+		redaction: redactionFor(ctx),
+		userData:  userData,
 	}
 	searchSchemaResult.buildSearchSchemaQuery(ctx)
 	return searchSchemaResult.searchSchemaResults(ctx)
@@ -97,11 +99,15 @@ func (s *SearchSchema) searchSchemaResults(ctx context.Context) (map[string]inte
 	klog.V(2).Info("Resolving searchSchemaResults()")
 	srchSchema := map[string]interface{}{}
 	// These default properties are always present and we want them at the top.
-	schema := []string{"cluster", "kind", "label", "name", "namespace", "status"}
+	defaults := []string{"cluster", "kind", "label", "name", "namespace", "status"}
+	schema := []string{}
 	// Use a map to remove duplicates efficiently.
 	schemaMap := map[string]struct{}{}
-	for _, key := range schema {
+	for _, key := range defaults {
 		schemaMap[key] = struct{}{}
+		if !s.redaction.isRedacted(nil, key, "") {
+			schema = append(schema, key)
+		}
 	}
 
 	rows, err := s.pool.Query(ctx, s.query)
@@ -114,7 +120,7 @@ func (s *SearchSchema) searchSchemaResults(ctx context.Context) (map[string]inte
 		prop := ""
 		_ = rows.Scan(&prop)
 		// Skip properties that start with _ because those are used internally and aren't intended to be exposed.
-		if prop[0:1] == "_" {
+		if prop[0:1] == "_" || s.redaction.isRedacted(nil, prop, "") {
 			continue
 		}
 		if _, present := schemaMap[prop]; !present {
@@ -0,0 +1,289 @@
+// Copyright Contributors to the Open Cluster Management project
+package resolver
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/doug-martin/goqu/v9"
+	"github.com/doug-martin/goqu/v9/exp"
+	"github.com/driftprogramming/pgxpoolmock"
+	"github.com/stolostron/search-v2-api/graph/model"
+	"github.com/stolostron/search-v2-api/pkg/config"
+	db "github.com/stolostron/search-v2-api/pkg/database"
+	"github.com/stolostron/search-v2-api/pkg/metrics"
+	"github.com/stolostron/search-v2-api/pkg/rbac"
+	"golang.org/x/sync/singleflight"
+	klog "k8s.io/klog/v2"
+)
+
+// Number of resources of each kind used to estimate the frequency of the properties. Listing the keys of every
+// resource is too slow on large clusters.
+const schemaByKindSampleSize = 1000
+
+type SchemaByKind struct {
+	pool       pgxpoolmock.PgxPool
+	kinds      []string // Lowercase, the kind filter is case-insensitive.
+	cluster    string
+	perCluster bool // Returns the schema of each kind on each cluster.
+	propTypes  map[string]string
+	query      string           // Query to get the properties of each kind.
+	countQuery string           // Query to get the number of resources of each kind.
+	redaction  *redactionPolicy // Redacted properties are removed from the schema. Nil if nothing is redacted.
+	userData   rbac.UserData
+}
+
+// Cached schema for a user. The schema is computed with RBAC, so it can't be shared across users.
+type schemaByKindCacheEntry struct {
+	schema    []*model.KindSchema
+	updatedAt time.Time
+}
+
+// The lock only guards the entries. The queries run outside the lock, and the group runs them once for
+// concurrent requests with the same key. The number of entries is limited to UserCacheMaxSize.
+var schemaByKindCache = struct {
+	entries map[string]*schemaByKindCacheEntry
+	group   singleflight.Group
+	lock    sync.Mutex
+}{entries: map[string]*schemaByKindCacheEntry{}}
+
+func SearchSchemaByKind(ctx context.Context, kinds []*string, cluster *string,
+	perCluster *bool) ([]*model.KindSchema, error) {
+	defer metrics.SlowLog("SearchSchemaByKindResolver", 0)()
+	userData, userDataErr := rbac.GetCache().GetUserData(ctx)
+	if userDataErr != nil {
+		return nil, userDataErr
+	}
+	propTypes, err := rbac.GetCache().GetPropertyTypes(ctx, false)
+	if err != nil {
+		klog.Warningf("Error creating datatype map with err: [%s] ", err)
+	}
+
+	schemaByKind := &SchemaByKind{
+		pool:      db.GetConnPool(ctx),
+		kinds:     PointerToStringArray(kinds),
+		userData:  userData,
+		propTypes: propTypes,
+		redaction: redactionFor(ctx),
+	}
+	if cluster != nil {
+		schemaByKind.cluster = *cluster
+	}
+	if perCluster != nil {
+		schemaByKind.perCluster = *perCluster
+	}
+	uid, _ := rbac.GetCache().GetUserUID(ctx)
+	return schemaByKind.resolve(ctx, uid)
+}
+
+// Returns the schema from the cache or runs the queries to get it.
+func (s *SchemaByKind) resolve(ctx context.Context, userUID string) ([]*model.KindSchema, error) {
+	for i, kind := range s.kinds {
+		s.kinds[i] = strings.ToLower(kind)
+	}
+	sort.Strings(s.kinds)
+	cacheKey := fmt.Sprintf("%s/%s/%t/%s", userUID, s.cluster, s.perCluster, strings.Join(s.kinds, ","))
+
+	if schema, ok := getCachedSchemaByKind(cacheKey); ok {
+		klog.V(5).Info("Using schema by kind from cache.")
+		return schema, nil
+	}
+	schema, err, _ := schemaByKindCache.group.Do(cacheKey, func() (interface{}, error) {
+		if schema, ok := getCachedSchemaByKind(cacheKey); ok { // Added by a request that just finished.
+			return schema, nil
+		}
+		if err := s.buildSchemaByKindQuery(ctx); err != nil {
+			return nil, err
+		}
+		schema, err := s.schemaByKindResults(ctx)
+		if err != nil {
+			return nil, err
+		}
+		addCachedSchemaByKind(cacheKey, schema)
+		return schema, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return schema.([]*model.KindSchema), nil
+}
+
+func getCachedSchemaByKind(key string) ([]*model.KindSchema, bool) {
+	schemaByKindCache.lock.Lock()
+	defer schemaByKindCache.lock.Unlock()
+	entry, ok := schemaByKindCache.entries[key]
+	if !ok || time.Since(entry.updatedAt) >= time.Duration(config.Cfg.SchemaCacheTTL)*time.Millisecond {
+		return nil, false
+	}
+	return entry.schema, true
+}
+
+// Adds the schema to the cache. Removes the expired entries, and the oldest entry when the cache is full.
+func addCachedSchemaByKind(key string, schema []*model.KindSchema) {
+	schemaByKindCache.lock.Lock()
+	defer schemaByKindCache.lock.Unlock()
+	oldestKey, oldest := "", time.Time{}
+	for k, entry := range schemaByKindCache.entries {
+		if time.Since(entry.updatedAt) >= time.Duration(config.Cfg.SchemaCacheTTL)*time.Millisecond {
+			delete(schemaByKindCache.entries, k)
+		} else if oldestKey == "" || entry.updatedAt.Before(oldest) {
+			oldestKey, oldest = k, entry.updatedAt
+		}
+	}
+	if _, exists := schemaByKindCache.entries[key]; !exists && oldestKey != "" &&
+		len(schemaByKindCache.entries) >= config.Cfg.UserCacheMaxSize {
+		delete(schemaByKindCache.entries, oldestKey)
+	}
+	schemaByKindCache.entries[key] = &schemaByKindCacheEntry{schema: schema, updatedAt: time.Now()}
+}
+
+// Sample queries:
+//
+//	SELECT "kind", "cluster", "prop", COUNT(*) AS "count" FROM (SELECT "data"->>'kind' AS "kind", '' AS "cluster",
+//		"data", row_number() OVER (PARTITION BY "data"->>'kind') AS "row" FROM "search"."resources"
+//		WHERE (rbac)) AS "sample", jsonb_object_keys(jsonb_strip_nulls("data")) AS "prop"
+//		WHERE ("row" <= 1000) GROUP BY 1, 2, 3
+//	SELECT "data"->>'kind' AS "kind", '' AS "cluster", COUNT(*) AS "count" FROM "search"."resources"
+//		WHERE (rbac) GROUP BY 1
+//
+// Per cluster, the queries also select, partition and group by the cluster.
+func (s *SchemaByKind) buildSchemaByKindQuery(ctx context.Context) error {
+	var whereDs []exp.Expression
+	if len(s.kinds) > 0 {
+		whereDs = append(whereDs, goqu.L(`lower("data"->>'kind')`).In(s.kinds))
+	}
+	if s.cluster != "" {
+		whereDs = append(whereDs, goqu.C("cluster").Eq(s.cluster))
+	}
+
+	// RBAC CLAUSE
+	_, userInfo := rbac.GetCache().GetUserUID(ctx)
+	if s.userData.CsResources == nil && s.userData.NsResources == nil && s.userData.ManagedClusters == nil {
+		s.query, s.countQuery = "", ""
+		return fmt.Errorf("RBAC clause is required! None found for schema by kind query for user %s with uid %s ",
+			userInfo.Username, userInfo.UID)
+	}
+	whereDs = append(whereDs, buildRbacWhereClause(ctx, s.userData, userInfo))
+
+	schemaTable := goqu.S("search").Table("resources")
+	// The cluster is empty when the schema isn't per cluster, so the results are scanned the same way.
+	groups := []interface{}{goqu.L(`"data"->>'kind'`).As("kind"), goqu.L("''").As("cluster")}
+	groupBy := []interface{}{goqu.L("1")}
+	partition := goqu.L(`row_number() OVER (PARTITION BY "data"->>'kind')`)
+	if s.perCluster {
+		groups[1] = goqu.C("cluster")
+		groupBy = append(groupBy, goqu.L("2"))
+		partition = goqu.L(`row_number() OVER (PARTITION BY "data"->>'kind', "cluster")`)
+	}
+	// The keys are only listed for a sample of the resources of each kind.
+	sample := goqu.From(schemaTable).Select(append(groups, goqu.C("data"), partition.As("row"))...).Where(whereDs...)
+	var err error
+	s.query, _, err = goqu.From(sample.As("sample"), goqu.L(`jsonb_object_keys(jsonb_strip_nulls("data"))`).As("prop")).
+		Select(goqu.C("kind"), goqu.C("cluster"), goqu.C("prop"), goqu.COUNT(goqu.Star()).As("count")).
+		Where(goqu.C("row").Lte(schemaByKindSampleSize)).GroupBy(goqu.L("1"), goqu.L("2"), goqu.L("3")).ToSQL()
+	if err != nil {
+		klog.Errorf("Error building schema by kind query: %s", err.Error())
+		return err
+	}
+	s.countQuery, _, err = goqu.From(schemaTable).
+		Select(append(groups, goqu.COUNT(goqu.Star()).As("count"))...).
+		Where(whereDs...).GroupBy(groupBy...).ToSQL()
+	if err != nil {
+		klog.Errorf("Error building schema by kind query: %s", err.Error())
+		return err
+	}
+	klog.V(3).Infof("SchemaByKind queries: %s\n%s", s.query, s.countQuery)
+	return nil
+}
+
+func (s *SchemaByKind) schemaByKindResults(ctx context.Context) ([]*model.KindSchema, error) {
+	klog.V(2).Info("Resolving schemaByKindResults()")
+	kindSchemas := map[string]*model.KindSchema{}
+
+	countRows, err := s.pool.Query(ctx, s.countQuery)
+	if err != nil {
+		klog.Error("Error fetching schema by kind results from db ", err)
+		return nil, err
+	}
+	defer countRows.Close()
+	for countRows.Next() {
+		var kind, cluster string
+		var count int64
+		if err := countRows.Scan(&kind, &cluster, &count); err != nil {
+			klog.Error("Error reading schema by kind results. ", err)
+			continue
+		}
+		kindSchema := &model.KindSchema{Kind: kind, Count: int(count), Properties: []*model.PropertySchema{}}
+		// The cluster is a column, so it isn't found in the data. All resources have it.
+		if !s.redaction.isRedacted([]string{kind}, "cluster", "") {
+			kindSchema.Properties = append(kindSchema.Properties,
+				&model.PropertySchema{Name: "cluster", Type: s.propertyType("cluster"), Frequency: 1})
+		}
+		if s.perCluster {
+			kindSchema.Cluster = &cluster
+		}
+		kindSchemas[kind+"/"+cluster] = kindSchema
+	}
+
+	rows, err := s.pool.Query(ctx, s.query)
+	if err != nil {
+		klog.Error("Error fetching schema by kind results from db ", err)
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var kind, cluster, prop string
+		var count int64
+		if err := rows.Scan(&kind, &cluster, &prop, &count); err != nil {
+			klog.Error("Error reading schema by kind results. ", err)
+			continue
+		}
+		// Skip properties that start with _ because those are used internally and aren't intended to be exposed.
+		// Kinds without a count were created after the count query, those are skipped too, like the redacted properties.
+		kindSchema, ok := kindSchemas[kind+"/"+cluster]
+		if !ok || kindSchema.Count == 0 || strings.HasPrefix(prop, "_") ||
+			s.redaction.isRedacted([]string{kind}, prop, "") {
+			continue
+		}
+		sampled := kindSchema.Count
+		if sampled > schemaByKindSampleSize {
+			sampled = schemaByKindSampleSize
+		}
+		kindSchema.Properties = append(kindSchema.Properties, &model.PropertySchema{
+			Name:      prop,
+			Type:      s.propertyType(prop),
+			Frequency: float64(count) / float64(sampled),
+		})
+	}
+
+	schema := make([]*model.KindSchema, 0, len(kindSchemas))
+	for _, kindSchema := range kindSchemas {
+		sort.SliceStable(kindSchema.Properties, func(i, j int) bool {
+			a, b := kindSchema.Properties[i], kindSchema.Properties[j]
+			if a.Frequency != b.Frequency {
+				return a.Frequency > b.Frequency
+			}
+			return a.Name < b.Name
+		})
+		schema = append(schema, kindSchema)
+	}
+	sort.Slice(schema, func(i, j int) bool {
+		if schema[i].Kind != schema[j].Kind {
+			return schema[i].Kind < schema[j].Kind
+		}
+		return s.perCluster && *schema[i].Cluster < *schema[j].Cluster
+	})
+	return schema, nil
+}
+
+// Returns the type from the property types cache, or nil if the type isn't known.
+func (s *SchemaByKind) propertyType(prop string) *string {
+	if propType, ok := s.propTypes[prop]; ok {
+		return &propType
+	}
+	return nil
+}
@@ -0,0 +1,224 @@
+// Copyright Contributors to the Open Cluster Management project
+package resolver
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/driftprogramming/pgxpoolmock"
+	"github.com/golang/mock/gomock"
+	"github.com/jackc/pgx/v4"
+	"github.com/stolostron/search-v2-api/graph/model"
+	"github.com/stolostron/search-v2-api/pkg/config"
+	"github.com/stolostron/search-v2-api/pkg/rbac"
+	"github.com/stretchr/testify/assert"
+)
+
+func newMockSchemaByKind(t *testing.T, ud rbac.UserData) (*SchemaByKind, *pgxpoolmock.MockPgxPool) {
+	ctrl := gomock.NewController(t)
+	mockPool := pgxpoolmock.NewMockPgxPool(ctrl)
+	return &SchemaByKind{
+		pool:      mockPool,
+		userData:  ud,
+		propTypes: map[string]string{"cluster": "string", "name": "string", "replicas": "number", "label": "object"},
+	}, mockPool
+}
+
+func Test_SchemaByKind_Query(t *testing.T) {
+	resolver, _ := newMockSchemaByKind(t, rbac.UserData{CsResources: []rbac.Resource{}})
+	resolver.kinds = []string{"deployment", "pod"}
+	resolver.cluster = "local-cluster"
+
+	err := resolver.buildSchemaByKindQuery(context.TODO())
+
+	assert.Nil(t, err)
+	assert.Equal(t, `SELECT "kind", "cluster", "prop", COUNT(*) AS "count" FROM (SELECT "data"->>'kind' AS "kind", '' AS "cluster", "data", row_number() OVER (PARTITION BY "data"->>'kind') AS "row" FROM "search"."resources" WHERE ((lower("data"->>'kind') IN ('deployment', 'pod')) AND ("cluster" = 'local-cluster') AND ("cluster" = ANY ('{}')))) AS "sample", jsonb_object_keys(jsonb_strip_nulls("data")) AS "prop" WHERE ("row" <= 1000) GROUP BY 1, 2, 3`,
+		resolver.query)
+	assert.Equal(t, `SELECT "data"->>'kind' AS "kind", '' AS "cluster", COUNT(*) AS "count" FROM "search"."resources" WHERE ((lower("data"->>'kind') IN ('deployment', 'pod')) AND ("cluster" = 'local-cluster') AND ("cluster" = ANY ('{}'))) GROUP BY 1`,
+		resolver.countQuery)
+}
+
+func Test_SchemaByKind_QueryPerCluster(t *testing.T) {
+	resolver, _ := newMockSchemaByKind(t, rbac.UserData{CsResources: []rbac.Resource{}})
+	resolver.perCluster = true
+
+	err := resolver.buildSchemaByKindQuery(context.TODO())
+
+	assert.Nil(t, err)
+	assert.Equal(t, `SELECT "kind", "cluster", "prop", COUNT(*) AS "count" FROM (SELECT "data"->>'kind' AS "kind", "cluster", "data", row_number() OVER (PARTITION BY "data"->>'kind', "cluster") AS "row" FROM "search"."resources" WHERE ("cluster" = ANY ('{}'))) AS "sample", jsonb_object_keys(jsonb_strip_nulls("data")) AS "prop" WHERE ("row" <= 1000) GROUP BY 1, 2, 3`,
+		resolver.query)
+	assert.Equal(t, `SELECT "data"->>'kind' AS "kind", "cluster", COUNT(*) AS "count" FROM "search"."resources" WHERE ("cluster" = ANY ('{}')) GROUP BY 1, 2`,
+		resolver.countQuery)
+}
+
+func Test_SchemaByKind_QueryNoRbac(t *testing.T) {
+	resolver, _ := newMockSchemaByKind(t, rbac.UserData{})
+
+	err := resolver.buildSchemaByKindQuery(context.TODO())
+
+	assert.NotNil(t, err)
+	assert.Equal(t, "", resolver.query)
+}
+
+func Test_SchemaByKind_ResultsAndCache(t *testing.T) {
+	resolver, mockPool := newMockSchemaByKind(t, rbac.UserData{CsResources: []rbac.Resource{}})
+
+	// Mock the database queries. Only called once, the second call uses the cache.
+	mockPool.EXPECT().Query(gomock.Any(), gomock.Eq(`SELECT "data"->>'kind' AS "kind", '' AS "cluster", COUNT(*) AS "count" FROM "search"."resources" WHERE ("cluster" = ANY ('{}')) GROUP BY 1`)).
+		Return(pgxpoolmock.NewRows([]string{"kind", "cluster", "count"}).
+			AddRow("Pod", "", int64(4)).AddRow("Deployment", "", int64(2)).ToPgxRows(), nil).Times(1)
+	mockPool.EXPECT().Query(gomock.Any(), gomock.Eq(`SELECT "kind", "cluster", "prop", COUNT(*) AS "count" FROM (SELECT "data"->>'kind' AS "kind", '' AS "cluster", "data", row_number() OVER (PARTITION BY "data"->>'kind') AS "row" FROM "search"."resources" WHERE ("cluster" = ANY ('{}'))) AS "sample", jsonb_object_keys(jsonb_strip_nulls("data")) AS "prop" WHERE ("row" <= 1000) GROUP BY 1, 2, 3`)).
+		Return(pgxpoolmock.NewRows([]string{"kind", "cluster", "prop", "count"}).
+			AddRow("Pod", "", "name", int64(4)).
+			AddRow("Pod", "", "label", int64(1)).
+			AddRow("Pod", "", "_uid", int64(4)).
+			AddRow("Deployment", "", "replicas", int64(2)).
+			AddRow("Deployment", "", "unknownType", int64(1)).ToPgxRows(), nil).Times(1)
+
+	result, err := resolver.resolve(context.TODO(), "test-schema-user")
+	cached, cachedErr := resolver.resolve(context.TODO(), "test-schema-user")
+
+	assert.Nil(t, err)
+	assert.Nil(t, cachedErr)
+	assert.Equal(t, result, cached)
+	assert.Equal(t, 2, len(result))
+
+	assert.Equal(t, "Deployment", result[0].Kind)
+	assert.Equal(t, 2, result[0].Count)
+	assert.Equal(t, 3, len(result[0].Properties))
+	assert.Equal(t, "cluster", result[0].Properties[0].Name)
+	assert.Equal(t, "replicas", result[0].Properties[1].Name)
+	assert.Equal(t, "number", *result[0].Properties[1].Type)
+	assert.Equal(t, 0.5, result[0].Properties[2].Frequency)
+	assert.Nil(t, result[0].Properties[2].Type)
+
+	assert.Equal(t, "Pod", result[1].Kind)
+	assert.Equal(t, 3, len(result[1].Properties), "Internal properties starting with _ are excluded.")
+	assert.Equal(t, "name", result[1].Properties[1].Name)
+	assert.Equal(t, "label", result[1].Properties[2].Name)
+	assert.Equal(t, 0.25, result[1].Properties[2].Frequency)
+}
+
+func Test_SchemaByKind_ResultsPerCluster(t *testing.T) {
+	resolver, mockPool := newMockSchemaByKind(t, rbac.UserData{CsResources: []rbac.Resource{}})
+	resolver.perCluster = true
+	resolver.kinds = []string{"Pod"}
+	mockPool.EXPECT().Query(gomock.Any(), gomock.Any()).
+		Return(pgxpoolmock.NewRows([]string{"kind", "cluster", "count"}).
+			AddRow("Pod", "managed2", int64(1)).AddRow("Pod", "managed1", int64(4)).ToPgxRows(), nil)
+	mockPool.EXPECT().Query(gomock.Any(), gomock.Any()).
+		Return(pgxpoolmock.NewRows([]string{"kind", "cluster", "prop", "count"}).
+			AddRow("Pod", "managed1", "name", int64(4)).
+			AddRow("Pod", "managed1", "label", int64(2)).
+			AddRow("Pod", "managed2", "name", int64(1)).ToPgxRows(), nil)
+
+	result, err := resolver.resolve(context.TODO(), "test-schema-per-cluster-user")
+
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"pod"}, resolver.kinds, "Expected the kind filter to be lowercase.")
+	assert.Equal(t, 2, len(result))
+	assert.Equal(t, "managed1", *result[0].Cluster)
+	assert.Equal(t, 4, result[0].Count)
+	assert.Equal(t, 3, len(result[0].Properties))
+	assert.Equal(t, 0.5, result[0].Properties[2].Frequency)
+	assert.Equal(t, "managed2", *result[1].Cluster)
+	assert.Equal(t, 2, len(result[1].Properties))
+}
+
+// The frequency of the properties is estimated from a sample of the resources of large kinds.
+func Test_SchemaByKind_ResultsSampled(t *testing.T) {
+	resolver, mockPool := newMockSchemaByKind(t, rbac.UserData{CsResources: []rbac.Resource{}})
+	mockPool.EXPECT().Query(gomock.Any(), gomock.Any()).
+		Return(pgxpoolmock.NewRows([]string{"kind", "cluster", "count"}).
+			AddRow("Pod", "", int64(5000)).ToPgxRows(), nil)
+	mockPool.EXPECT().Query(gomock.Any(), gomock.Any()).
+		Return(pgxpoolmock.NewRows([]string{"kind", "cluster", "prop", "count"}).
+			AddRow("Pod", "", "name", int64(1000)).
+			AddRow("Pod", "", "label", int64(250)).ToPgxRows(), nil)
+
+	result, err := resolver.resolve(context.TODO(), "test-schema-sampled-user")
+
+	assert.Nil(t, err)
+	assert.Equal(t, 5000, result[0].Count)
+	assert.Equal(t, "name", result[0].Properties[1].Name)
+	assert.Equal(t, 1.0, result[0].Properties[1].Frequency)
+	assert.Equal(t, "label", result[0].Properties[2].Name)
+	assert.Equal(t, 0.25, result[0].Properties[2].Frequency)
+}
+
+func Test_SchemaByKind_RedactedCluster(t *testing.T) {
+	resolver, mockPool := newMockSchemaByKind(t, rbac.UserData{CsResources: []rbac.Resource{}})
+	resolver.redaction = &redactionPolicy{Rules: []redactionRule{{Kinds: []string{"Secret"}, Properties: []string{"cluster"}}}}
+	resolver.redaction.Rules[0].compile()
+	mockPool.EXPECT().Query(gomock.Any(), gomock.Any()).
+		Return(pgxpoolmock.NewRows([]string{"kind", "cluster", "count"}).
+			AddRow("Pod", "", int64(2)).AddRow("Secret", "", int64(2)).ToPgxRows(), nil)
+	mockPool.EXPECT().Query(gomock.Any(), gomock.Any()).
+		Return(pgxpoolmock.NewRows([]string{"kind", "cluster", "prop", "count"}).
+			AddRow("Pod", "", "name", int64(2)).
+			AddRow("Secret", "", "name", int64(2)).ToPgxRows(), nil)
+
+	result, err := resolver.resolve(context.TODO(), "test-schema-redacted-cluster-user")
+
+	assert.Nil(t, err)
+	assert.Equal(t, "Pod", result[0].Kind)
+	assert.Equal(t, "cluster", result[0].Properties[0].Name)
+	assert.Equal(t, "Secret", result[1].Kind)
+	assert.Equal(t, 1, len(result[1].Properties), "Expected the redacted cluster property to be removed.")
+	assert.Equal(t, "name", result[1].Properties[0].Name)
+}
+
+// Concurrent requests with the same key run the queries once, and don't block requests with other keys.
+func Test_SchemaByKind_ConcurrentRequests(t *testing.T) {
+	resolver, mockPool := newMockSchemaByKind(t, rbac.UserData{CsResources: []rbac.Resource{}})
+	var queries int32
+	release := make(chan struct{})
+	mockPool.EXPECT().Query(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error) {
+			if atomic.AddInt32(&queries, 1) == 1 {
+				<-release // Hold the first query until the other user is resolved.
+			}
+			return pgxpoolmock.NewRows([]string{"kind", "cluster", "count"}).ToPgxRows(), nil
+		}).Times(4) // The count and the properties queries for each user.
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			copy := *resolver
+			_, err := copy.resolve(context.TODO(), "test-schema-concurrent-user")
+			assert.Nil(t, err)
+		}()
+	}
+	time.Sleep(10 * time.Millisecond)
+	other := *resolver
+	_, err := other.resolve(context.TODO(), "test-schema-other-user")
+	assert.Nil(t, err, "Expected the other user to not wait for the first user.")
+	close(release)
+	wg.Wait()
+}
+
+func Test_addCachedSchemaByKind_bounded(t *testing.T) {
+	original := config.Cfg.UserCacheMaxSize
+	config.Cfg.UserCacheMaxSize = 2
+	t.Cleanup(func() { config.Cfg.UserCacheMaxSize = original })
+	schemaByKindCache.lock.Lock()
+	originalEntries := schemaByKindCache.entries
+	schemaByKindCache.entries = map[string]*schemaByKindCacheEntry{}
+	schemaByKindCache.lock.Unlock()
+	t.Cleanup(func() { schemaByKindCache.entries = originalEntries })
+
+	addCachedSchemaByKind("a", []*model.KindSchema{})
+	addCachedSchemaByKind("b", []*model.KindSchema{})
+	addCachedSchemaByKind("c", []*model.KindSchema{})
+
+	assert.Equal(t, 2, len(schemaByKindCache.entries))
+	_, ok := getCachedSchemaByKind("a")
+	assert.False(t, ok, "Expected the oldest entry to be removed.")
+	_, ok = getCachedSchemaByKind("c")
+	assert.True(t, ok)
+}
@@ -4,14 +4,41 @@ package resolver
 import (
 	"context"
 	"errors"
+	"fmt"
 	"time"
 
+	"github.com/99designs/gqlgen/graphql/handler/transport"
+	"github.com/vektah/gqlparser/v2/gqlerror"
 	klog "k8s.io/klog/v2"
 
 	"github.com/stolostron/search-v2-api/graph/model"
 	"github.com/stolostron/search-v2-api/pkg/config"
+	"github.com/stolostron/search-v2-api/pkg/rbac"
 )
 
+// Error sent to the client when the subscription is closed because the token is no longer valid.
+var ErrSubscriptionUnauthenticated = errors.New("subscription closed because the authentication token is no longer valid")
+
+// Allows tests to replace the token validation with a mock.
+var validateToken = func(ctx context.Context, token string) (bool, error) {
+	return rbac.GetCache().IsValidToken(ctx, token)
+}
+
+// Allows tests to replace the rate limit with a mock.
+var checkRateLimit = rbac.CheckRateLimit
+
+// Allows tests to replace the search with a mock.
+var searchForSubscription = Search
+
+// Send an error to the websocket client before the subscription channel is closed.
+// Allows tests to replace this function, the context of the tests isn't created by the websocket transport.
+var addSubscriptionError = func(ctx context.Context, err error, code string) {
+	transport.AddSubscriptionError(ctx, &gqlerror.Error{
+		Message:    err.Error(),
+		Extensions: map[string]interface{}{"code": code},
+	})
+}
+
 func SearchSubscription(ctx context.Context, input []*model.SearchInput) (<-chan []*SearchResult, error) {
 	ch := make(chan []*SearchResult)
 
@@ -32,10 +59,42 @@ func SearchSubscription(ctx context.Context, input []*model.SearchInput) (<-chan
 
 		for {
 			klog.V(3).Info("Search subscription new poll interval")
-			searchResult, err := Search(ctx, input)
 
-			if err != nil {
-				klog.Errorf("Error occurred during the search subscription request: %s", err)
+			// The subscription could stay open for a long time, so we validate the token on every poll.
+			// This is cheap because the TokenReview is cached.
+			if authErr := authenticateSubscription(ctx); errors.Is(authErr, ErrSubscriptionUnauthenticated) {
+				klog.V(3).Infof("Closing search subscription. %s", authErr)
+				addSubscriptionError(ctx, authErr, "UNAUTHENTICATED")
+				return
+			} else if authErr != nil {
+				klog.Warningf("Skipping search subscription poll. %s", authErr)
+				if !waitForNextPoll(ctx, timeout) {
+					return
+				}
+				continue
+			}
+
+			// Each poll counts against the rate limit of the user, like the requests to /graphql.
+			if _, allowed := checkRateLimit(ctx, "subscription"); !allowed {
+				klog.V(3).Info("Skipping search subscription poll. Rate limit exceeded.")
+				if !waitForNextPoll(ctx, timeout) {
+					return
+				}
+				continue
+			}
+
+			// Search() refreshes the user's RBAC data if the cached data has expired.
+			searchResult, err := searchForSubscription(ctx, input)
+			if errors.Is(err, rbac.ErrUserAccess) {
+				klog.V(3).Infof("Closing search subscription. %s", err)
+				addSubscriptionError(ctx, err, "UNAUTHORIZED")
+				return
+			} else if err != nil {
+				klog.Errorf("Error occurred during the search subscription request. Retrying on the next poll. %s", err)
+				if !waitForNextPoll(ctx, timeout) {
+					return
+				}
+				continue
 			}
 
 			// The subscription may have been closed due to the client disconnecting.
@@ -49,16 +108,53 @@ func SearchSubscription(ctx context.Context, input []*model.SearchInput) (<-chan
 			case <-timeout: // This runs when timeoout is hit. Subscription closes.
 				klog.V(3).Info("Subscription timeout reached. Closing connection.")
 				return // Remember to return to end the routine.
-			
+
 			case ch <- searchResult: // This is the actual send.
-				// Our message went through, do nothing 
+				// Our message went through, do nothing
 			}
 
 			// Wait SubscriptionRefreshInterval seconds for next search reuslt send.
-			time.Sleep(time.Duration(config.Cfg.SubscriptionRefreshInterval) * time.Millisecond)
+			if !waitForNextPoll(ctx, timeout) {
+				return
+			}
 		}
 	}()
 
 	// We return the channel and no error.
 	return ch, nil
-}
\ No newline at end of file
+}
+
+// Waits SubscriptionRefreshInterval for the next poll. Returns false when the subscription is closed
+// or the timeout is reached.
+func waitForNextPoll(ctx context.Context, timeout <-chan time.Time) bool {
+	select {
+	case <-ctx.Done():
+		klog.V(3).Info("Search subscription Closed")
+		return false
+	case <-timeout:
+		klog.V(3).Info("Subscription timeout reached. Closing connection.")
+		return false
+	case <-time.After(time.Duration(config.Cfg.SubscriptionRefreshInterval) * time.Millisecond):
+		return true
+	}
+}
+
+// Validate the token used to open the subscription. Returns ErrSubscriptionUnauthenticated when the token isn't
+// valid, or another error when the token couldn't be validated. The token is set in the context by the authentication middleware or by the websocket connection_init.
+func authenticateSubscription(ctx context.Context) error {
+	if _, isCertUser := rbac.GetCertUser(ctx); isCertUser {
+		return nil // Authenticated with a client certificate.
+	}
+	token, ok := ctx.Value(rbac.ContextAuthTokenKey).(string)
+	if !ok || token == "" {
+		return ErrSubscriptionUnauthenticated
+	}
+	authenticated, err := validateToken(ctx, token)
+	if err != nil {
+		return fmt.Errorf("unexpected error while validating the subscription token: %w", err)
+	}
+	if !authenticated {
+		return ErrSubscriptionUnauthenticated
+	}
+	return nil
+}
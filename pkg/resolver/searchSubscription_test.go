@@ -0,0 +1,199 @@
+// Copyright Contributors to the Open Cluster Management project
+package resolver
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stolostron/search-v2-api/graph/model"
+	"github.com/stolostron/search-v2-api/pkg/config"
+	"github.com/stolostron/search-v2-api/pkg/rbac"
+	"github.com/stretchr/testify/assert"
+	authv1 "k8s.io/api/authentication/v1"
+)
+
+func Test_SearchSubscription_Disabled(t *testing.T) {
+	config.Cfg.Features.SubscriptionEnabled = false
+
+	ch, err := SearchSubscription(context.Background(), nil)
+
+	assert.NotNil(t, err)
+	_, open := <-ch
+	assert.False(t, open, "Expected subscription channel to be closed.")
+}
+
+func Test_SearchSubscription_InvalidToken(t *testing.T) {
+	config.Cfg.Features.SubscriptionEnabled = true
+	defer func() { config.Cfg.Features.SubscriptionEnabled = false }()
+
+	// Mock the token validation to simulate a revoked token.
+	originalValidateToken := validateToken
+	validateToken = func(ctx context.Context, token string) (bool, error) { return false, nil }
+	defer func() { validateToken = originalValidateToken }()
+
+	codes := mockSubscriptionErrors(t)
+
+	ctx := context.WithValue(context.Background(), rbac.ContextAuthTokenKey, "revoked-token")
+	ch, err := SearchSubscription(ctx, nil)
+	assert.Nil(t, err)
+
+	select {
+	case _, open := <-ch:
+		assert.False(t, open, "Expected subscription channel to be closed without sending results.")
+		assert.Equal(t, "UNAUTHENTICATED", <-codes)
+	case <-time.After(time.Second):
+		t.Error("Expected subscription to close when the token is invalid.")
+	}
+}
+
+// Mocks the errors sent to the websocket client. Returns the codes of the errors.
+func mockSubscriptionErrors(t *testing.T) chan string {
+	codes := make(chan string, 10)
+	original := addSubscriptionError
+	addSubscriptionError = func(ctx context.Context, err error, code string) { codes <- code }
+	t.Cleanup(func() { addSubscriptionError = original })
+	return codes
+}
+
+func Test_SearchSubscription_TokenValidationError(t *testing.T) {
+	config.Cfg.Features.SubscriptionEnabled = true
+	originalInterval := config.Cfg.SubscriptionRefreshInterval
+	config.Cfg.SubscriptionRefreshInterval = 10
+	originalValidateToken := validateToken
+	defer func() {
+		config.Cfg.Features.SubscriptionEnabled = false
+		config.Cfg.SubscriptionRefreshInterval = originalInterval
+		validateToken = originalValidateToken
+	}()
+	validations := make(chan struct{}, 10)
+	validateToken = func(ctx context.Context, token string) (bool, error) {
+		validations <- struct{}{}
+		return false, errors.New("connection refused")
+	}
+	codes := mockSubscriptionErrors(t)
+
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), rbac.ContextAuthTokenKey, "token"))
+	ch, err := SearchSubscription(ctx, nil)
+	assert.Nil(t, err)
+
+	<-validations
+	<-validations // The subscription keeps polling when the token can't be validated.
+	cancel()
+	_, open := <-ch
+	assert.False(t, open)
+	assert.Equal(t, 0, len(codes), "Expected no errors sent to the client.")
+}
+
+func Test_SearchSubscription_SearchError(t *testing.T) {
+	config.Cfg.Features.SubscriptionEnabled = true
+	originalInterval := config.Cfg.SubscriptionRefreshInterval
+	config.Cfg.SubscriptionRefreshInterval = 10
+	originalValidateToken, originalSearch := validateToken, searchForSubscription
+	defer func() {
+		config.Cfg.Features.SubscriptionEnabled = false
+		config.Cfg.SubscriptionRefreshInterval = originalInterval
+		validateToken, searchForSubscription = originalValidateToken, originalSearch
+	}()
+	validateToken = func(ctx context.Context, token string) (bool, error) { return true, nil }
+	searches := make(chan struct{}, 10)
+	searchForSubscription = func(ctx context.Context, input []*model.SearchInput) ([]*SearchResult, error) {
+		searches <- struct{}{}
+		return nil, errors.New("unexpected error")
+	}
+	codes := mockSubscriptionErrors(t)
+
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), rbac.ContextAuthTokenKey, "token"))
+	ch, err := SearchSubscription(ctx, nil)
+	assert.Nil(t, err)
+
+	<-searches
+	<-searches // The subscription keeps polling after the error.
+	cancel()
+	_, open := <-ch
+	assert.False(t, open)
+	assert.Equal(t, 0, len(codes), "Expected no errors sent to the client.")
+}
+
+func Test_SearchSubscription_UserAccessError(t *testing.T) {
+	config.Cfg.Features.SubscriptionEnabled = true
+	originalValidateToken, originalSearch := validateToken, searchForSubscription
+	defer func() {
+		config.Cfg.Features.SubscriptionEnabled = false
+		validateToken, searchForSubscription = originalValidateToken, originalSearch
+	}()
+	validateToken = func(ctx context.Context, token string) (bool, error) { return true, nil }
+	searchForSubscription = func(ctx context.Context, input []*model.SearchInput) ([]*SearchResult, error) {
+		return nil, rbac.ErrUserAccess
+	}
+	codes := mockSubscriptionErrors(t)
+
+	ctx := context.WithValue(context.Background(), rbac.ContextAuthTokenKey, "token")
+	ch, err := SearchSubscription(ctx, nil)
+	assert.Nil(t, err)
+
+	select {
+	case _, open := <-ch:
+		assert.False(t, open, "Expected subscription channel to be closed without sending results.")
+		assert.Equal(t, "UNAUTHORIZED", <-codes)
+	case <-time.After(time.Second):
+		t.Error("Expected subscription to close when the user's access can't be resolved.")
+	}
+}
+
+func Test_SearchSubscription_RateLimited(t *testing.T) {
+	config.Cfg.Features.SubscriptionEnabled = true
+	originalInterval := config.Cfg.SubscriptionRefreshInterval
+	config.Cfg.SubscriptionRefreshInterval = 10
+	originalValidateToken, originalCheckRateLimit := validateToken, checkRateLimit
+	defer func() {
+		config.Cfg.Features.SubscriptionEnabled = false
+		config.Cfg.SubscriptionRefreshInterval = originalInterval
+		validateToken, checkRateLimit = originalValidateToken, originalCheckRateLimit
+	}()
+	validateToken = func(ctx context.Context, token string) (bool, error) { return true, nil }
+	polls := make(chan string, 10)
+	checkRateLimit = func(ctx context.Context, source string) (time.Duration, bool) {
+		polls <- source
+		return time.Second, false // Throttled, so the search doesn't run.
+	}
+
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), rbac.ContextAuthTokenKey, "token"))
+	ch, err := SearchSubscription(ctx, nil)
+	assert.Nil(t, err)
+
+	assert.Equal(t, "subscription", <-polls)
+	assert.Equal(t, "subscription", <-polls, "Expected the subscription to keep polling after it's throttled.")
+	cancel()
+	_, open := <-ch
+	assert.False(t, open, "Expected subscription channel to be closed without sending results.")
+}
+
+func Test_authenticateSubscription(t *testing.T) {
+	originalValidateToken := validateToken
+	defer func() { validateToken = originalValidateToken }()
+	validateToken = func(ctx context.Context, token string) (bool, error) { return token == "valid-token", nil }
+
+	// Missing token.
+	assert.Equal(t, ErrSubscriptionUnauthenticated, authenticateSubscription(context.Background()))
+
+	// Invalid token.
+	ctx := context.WithValue(context.Background(), rbac.ContextAuthTokenKey, "invalid-token")
+	assert.Equal(t, ErrSubscriptionUnauthenticated, authenticateSubscription(ctx))
+
+	// Error validating the token.
+	validateToken = func(ctx context.Context, token string) (bool, error) { return false, errors.New("timeout") }
+	err := authenticateSubscription(ctx)
+	assert.NotNil(t, err)
+	assert.NotEqual(t, ErrSubscriptionUnauthenticated, err)
+	validateToken = func(ctx context.Context, token string) (bool, error) { return token == "valid-token", nil }
+
+	// Valid token.
+	ctx = context.WithValue(context.Background(), rbac.ContextAuthTokenKey, "valid-token")
+	assert.Nil(t, authenticateSubscription(ctx))
+
+	// Client certificate.
+	ctx = context.WithValue(context.Background(), rbac.ContextCertUserKey, authv1.UserInfo{Username: "automation"})
+	assert.Nil(t, authenticateSubscription(ctx))
+}
@@ -619,6 +619,46 @@ func Test_buildRbacWhereClauseCsNsAndMc(t *testing.T) {
 	assert.Equal(t, expectedSql, gotSql)
 }
 
+func Test_buildRbacWhereClauseMcResources(t *testing.T) {
+	ud := rbac.UserData{
+		ManagedClusters: map[string]struct{}{"managed1": {}},
+		ManagedClusterResources: rbac.ManagedClusterResources{
+			"managed2": {"app-a": {{Apigroup: "apps", Kind: "deployments"}}},
+			"managed3": {"*": {{Apigroup: "", Kind: "pods"}}},
+		}}
+	rbacCombined := buildRbacWhereClause(context.WithValue(context.Background(), rbac.ContextAuthTokenKey, "123456"),
+		ud, getUserInfo())
+	expectedSql := `SELECT * WHERE (("cluster" = ANY ('{"managed1"}')) OR ((("cluster" = 'managed2') AND (data->'namespace'?|'{"app-a"}' AND (data->'apigroup'?'apps' AND data->'kind_plural'?'deployments'))) OR (("cluster" = 'managed3') AND "data"?'namespace' AND (NOT("data"?'apigroup') AND data->'kind_plural'?'pods'))))`
+	gotSql, _, _ := goqu.Select().Where(rbacCombined).ToSQL()
+	assert.Equal(t, expectedSql, gotSql)
+}
+
+func Test_buildRbacWhereClauseResourceNames(t *testing.T) {
+	_, nsScopeAccess, _ := newUserData()
+	ud := rbac.UserData{
+		NsResources:     nsScopeAccess,
+		CsResourceNames: map[rbac.Resource][]string{{Apigroup: "", Kind: "nodes"}: {"node-1"}},
+		NsResourceNames: map[string]map[rbac.Resource][]string{
+			"default": {{Apigroup: "", Kind: "secrets"}: {"secret-a", "secret-b"}},
+		}}
+	rbacCombined := buildRbacWhereClause(context.WithValue(context.Background(), rbac.ContextAuthTokenKey, "123456"),
+		ud, getUserInfo())
+	expectedSql := `SELECT * WHERE (("cluster" = ANY ('{}')) OR ("data"?'_hubClusterResource' AND (((data->'namespace'?|'{"default"}' AND ((NOT("data"?'apigroup') AND data->'kind_plural'?'configmaps') OR (data->'apigroup'?'v4' AND data->'kind_plural'?'services'))) OR (data->'namespace'?|'{"ocm"}' AND ((data->'apigroup'?'v1' AND data->'kind_plural'?'pods') OR (data->'apigroup'?'v2' AND data->'kind_plural'?'deployments')))) OR ((NOT("data"?'namespace') AND (NOT("data"?'apigroup') AND data->'kind_plural'?'nodes') AND ("data"->>'name' IN ('node-1'))) OR (data->'namespace'?'default' AND (NOT("data"?'apigroup') AND data->'kind_plural'?'secrets') AND ("data"->>'name' IN ('secret-a', 'secret-b')))))))`
+	gotSql, _, _ := goqu.Select().Where(rbacCombined).ToSQL()
+	assert.Equal(t, expectedSql, gotSql)
+}
+
+func Test_buildRbacWhereClauseOnlyResourceNames(t *testing.T) {
+	ud := rbac.UserData{NsResourceNames: map[string]map[rbac.Resource][]string{
+		"default": {{Apigroup: "", Kind: "secrets"}: {"secret-a"}},
+	}}
+	rbacCombined := buildRbacWhereClause(context.WithValue(context.Background(), rbac.ContextAuthTokenKey, "123456"),
+		ud, getUserInfo())
+	expectedSql := `SELECT * WHERE (("cluster" = ANY ('{}')) OR ("data"?'_hubClusterResource' AND (data->'namespace'?'default' AND (NOT("data"?'apigroup') AND data->'kind_plural'?'secrets') AND ("data"->>'name' IN ('secret-a')))))`
+	gotSql, _, _ := goqu.Select().Where(rbacCombined).ToSQL()
+	assert.Equal(t, expectedSql, gotSql)
+}
+
 func Test_SearchResolver_Items_Labels(t *testing.T) {
 	// Create a SearchResolver instance with a mock connection pool.
 	cluster := "local-cluster"
@@ -9,12 +9,15 @@ import (
 	klog "k8s.io/klog/v2"
 
 	"github.com/99designs/gqlgen/graphql/handler"
+	"github.com/99designs/gqlgen/graphql/handler/extension"
+	"github.com/99designs/gqlgen/graphql/handler/lru"
 	"github.com/99designs/gqlgen/graphql/handler/transport"
 	"github.com/99designs/gqlgen/graphql/playground"
 	"github.com/gorilla/mux"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/stolostron/search-v2-api/graph"
 	"github.com/stolostron/search-v2-api/graph/generated"
+	"github.com/stolostron/search-v2-api/pkg/audit"
 	"github.com/stolostron/search-v2-api/pkg/config"
 	"github.com/stolostron/search-v2-api/pkg/federated"
 	"github.com/stolostron/search-v2-api/pkg/metrics"
@@ -33,6 +36,12 @@ func StartAndListen() {
 			tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
 		},
 	}
+	if err := rbac.ConfigureClientCertAuth(cfg); err != nil {
+		klog.Fatal("Error configuring client certificate authentication. ", err)
+	}
+
+	// Audit the requests rejected by the authentication, impersonation and rate limit checks.
+	rbac.OnRejectedRequest(audit.LogRejectedRequest)
 
 	// Initiate router
 	router := mux.NewRouter()
@@ -50,6 +59,7 @@ func StartAndListen() {
 		klog.Infof("Federated search is enabled.")
 		fedSubrouter := router.PathPrefix("/federated").Subrouter()
 		fedSubrouter.Use(rbac.AuthenticateUser)
+		fedSubrouter.Use(audit.FederatedMiddleware)
 		// fedSubrouter.Use(metrics.PrometheusMiddleware)  // FUTURE: Add prometheus metric for federated requests.
 		// fedSubrouter.Use(federated.GetConfig)           // TODO: Add a health check for federated services.
 		fedSubrouter.HandleFunc("", federated.HandleFederatedRequest).Methods("POST")
@@ -63,11 +73,27 @@ func StartAndListen() {
 	apiSubrouter.Use(metrics.PrometheusMiddleware)
 	apiSubrouter.Use(rbac.CheckDBAvailability)
 	apiSubrouter.Use(rbac.AuthenticateUser)
+	apiSubrouter.Use(rbac.RateLimitUser)
 	apiSubrouter.Use(rbac.AuthorizeUser)
 
-	defaultSrv := handler.NewDefaultServer(generated.NewExecutableSchema(
+	// Same configuration as handler.NewDefaultServer(), but the websocket transport must be added first
+	// to use our InitFunc. Browsers can't set headers on websocket requests, so the token can be sent
+	// in the connection_init payload.
+	defaultSrv := handler.New(generated.NewExecutableSchema(
 		generated.Config{Resolvers: &graph.Resolver{}}))
-	defaultSrv.AddTransport(&transport.Websocket{})
+	defaultSrv.AddTransport(transport.Websocket{
+		KeepAlivePingInterval: 10 * time.Second,
+		InitFunc:              rbac.AuthenticateWebsocketInit,
+	})
+	defaultSrv.AddTransport(transport.Options{})
+	defaultSrv.AddTransport(transport.GET{})
+	defaultSrv.AddTransport(transport.POST{})
+	defaultSrv.AddTransport(transport.MultipartForm{})
+	defaultSrv.SetQueryCache(lru.New(1000))
+	defaultSrv.Use(extension.Introspection{})
+	defaultSrv.Use(extension.AutomaticPersistedQuery{Cache: lru.New(100)})
+	defaultSrv.Use(rbac.WebsocketRateLimit{})
+	defaultSrv.Use(audit.Extension{})
 	apiSubrouter.Handle("/graphql", defaultSrv)
 
 	srv := &http.Server{